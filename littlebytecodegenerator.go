@@ -2,18 +2,21 @@ package main
 
 import (
 	"encoding/binary"
-	"strconv"
+	"strings"
 )
 
-var (
+const (
 	OP_HALT  byte = 0x01
 	OP_ECALL byte = 0x02
+	OP_BREAK byte = 0x03
 
-	OP_CALL   byte = 0x04
-	OP_RETURN byte = 0x05
+	OP_CALL          byte = 0x04
+	OP_RETURN        byte = 0x05
+	OP_CALL_INDIRECT byte = 0x06
 
-	OP_JUMP   byte = 0x08
-	OP_BRANCH byte = 0x09
+	OP_JUMP       byte = 0x08
+	OP_BRANCH     byte = 0x09
+	OP_JUMP_TABLE byte = 0x0a
 
 	OP_PUSH   byte = 0x0c
 	OP_POP    byte = 0x0d
@@ -50,228 +53,63 @@ var (
 
 var bytecode []byte
 
-type IntInfo struct {
-	IsSigned   bool
-	BytesCount int
-}
-
-type IntStorageInfo struct {
-	Ident      string
-	IsSigned   bool
-	BlockLevel int
-	BytesCount int
-}
+var funcAddrList map[string]int
 
-type IntAddressInfo struct {
-	RealSize   int
-	IsSigned   bool
-	BytesCount int
+type BlankFuncCall struct {
+	Ident string
+	Addr  int
 }
 
-type PreviousFrameAddressInfo struct {
-	BytesCount int
-}
+var blankFuncCallList []BlankFuncCall
+var blankFuncAddrList []BlankFuncCall
 
-type ReturnAddressInfo struct {
-	BytesCount int
+type BlankBlockJump struct {
+	Block      int
+	Addr       int
+	EntryIndex int
 }
 
-type VoidInfo struct {
-	BytesCount int
-}
+var blockAddrList []int
+var blankBlockJumpList []BlankBlockJump
+var blankJumpTableEntryList []BlankBlockJump
 
-func getIntInfoFromTypeString(s string) (IntInfo, bool) {
-	if ii, ok := map[string]IntInfo{
-		"i8":  {IsSigned: true, BytesCount: 1},
-		"i16": {IsSigned: true, BytesCount: 2},
-		"i32": {IsSigned: true, BytesCount: 4},
-		"i64": {IsSigned: true, BytesCount: 8},
-
-		"u8":  {IsSigned: false, BytesCount: 1},
-		"u16": {IsSigned: false, BytesCount: 2},
-		"u32": {IsSigned: false, BytesCount: 4},
-		"u64": {IsSigned: false, BytesCount: 8},
-	}[s]; ok {
-		return ii, true
-	} else {
-		return IntInfo{}, false
-	}
-}
-
-var ADDR_BYTES_COUNT int = 8
-
-var blockLevel int
-var returnValueInfo interface{}
 var framePointer int
+var localAddrList []uint64
+var scratchAddr uint64
+var isLocalReferencedList []bool
+var isLoopBlockList []bool
 
-var whileBlockLevel int
+var debugFuncList []DebugFunc
 
-var callStackInfo []interface{}
+func encodeIntInfo(ii IntInfo) byte {
+	var b byte = byte(ii.BytesCount)
 
-var STARTING_BLOCK_LEVEL int = 1
+	if ii.IsSigned {
+		return b | 0b10000
+	}
 
-func callStackInfoReset() {
-	blockLevel = STARTING_BLOCK_LEVEL
-	returnValueInfo = VoidInfo{BytesCount: 0}
-	framePointer = 0
-	whileBlockLevel = STARTING_BLOCK_LEVEL
-	callStackInfo = make([]interface{}, 0)
+	return b
 }
 
-func callStackInfoGetBytesCount(i interface{}) int {
+func encodeTypeInfo(i interface{}, isAddress bool) byte {
+	var b byte
+
 	switch v := i.(type) {
 	case IntInfo:
-		return v.BytesCount
-	case IntStorageInfo:
-		return v.BytesCount
-	case IntAddressInfo:
-		return v.BytesCount
-	case PreviousFrameAddressInfo:
-		return v.BytesCount
-	case ReturnAddressInfo:
-		return v.BytesCount
-	case VoidInfo:
-		return v.BytesCount
+		b = encodeIntInfo(v)
+	case FuncInfo:
+		b = encodeIntInfo(IntInfo{IsSigned: false, BytesCount: ADDR_BYTES_COUNT})
 	default:
 		PrintErrorAndExit(0)
-		return 0
 	}
-}
 
-func callStackInfoGetTotalBytesCount() int {
-	var totalBytesCount int
-	for _, i := range callStackInfo {
-		totalBytesCount += callStackInfoGetBytesCount(i)
-	}
-
-	return totalBytesCount
-}
-
-func callStackInfoInitFrame() {
-	callStackInfo = append(callStackInfo, PreviousFrameAddressInfo{BytesCount: ADDR_BYTES_COUNT})
-	callStackInfo = append(callStackInfo, ReturnAddressInfo{BytesCount: ADDR_BYTES_COUNT})
-	framePointer = callStackInfoGetTotalBytesCount()
-}
-
-func callStackInfoFindIntStorageInfo(intStorageInfoIdent string) (IntStorageInfo, bool) {
-	for i := len(callStackInfo) - 1; i >= 0; i-- {
-		if isi, ok := callStackInfo[i].(IntStorageInfo); ok && (isi.Ident == intStorageInfoIdent) {
-			return isi, true
-		}
-	}
-
-	return IntStorageInfo{}, false
-}
-
-func callStackInfoGetIntAddress(intStorageInfoIdent string) (uint64, bool) {
-	var hasFound bool = false
-
-	var totalBytesCount int
-
-	for i := len(callStackInfo) - 1; i >= 0; i-- {
-		if hasFound {
-			totalBytesCount += callStackInfoGetBytesCount(callStackInfo[i])
-		} else if isi, ok := callStackInfo[i].(IntStorageInfo); ok &&
-			(isi.Ident == intStorageInfoIdent) {
-			hasFound = true
-		}
-	}
-
-	if hasFound {
-		return (uint64(totalBytesCount) - uint64(framePointer)), true
-	} else {
-		return 0, false
-	}
-}
-
-type FuncSigInfo struct {
-	ParamListInt    []IntInfo
-	ReturnValueInfo interface{}
-}
-
-var funcListInfo map[string]FuncSigInfo
-
-func funcListInfoInit(tn TreeNode) {
-	funcListInfo = make(map[string]FuncSigInfo)
-
-	for _, funcTreeNode := range tn.Children {
-
-		funcSigTreeNode := funcTreeNode.Children[1]
-		var newFuncSigInfo FuncSigInfo
-
-		for _, c := range funcSigTreeNode.Children {
-
-			if c.Kype == TNT_FUNC_PARAM_LIST {
-
-				funcParamListTreeNode := c
-
-				for _, funcParmTreeNode := range funcParamListTreeNode.Children {
-
-					funcParamTypeTreeNode := funcParmTreeNode.Children[1]
-
-					ii, ok := getIntInfoFromTypeString(string(funcParamTypeTreeNode.Tok.Buf))
-					if !ok {
-						PrintErrorAndExit(funcParamTypeTreeNode.Tok.LineNumber)
-					}
-
-					newFuncSigInfo.ParamListInt = append(newFuncSigInfo.ParamListInt, ii)
-
-				}
-
-			} else if c.Kype == TNT_FUNC_RETURN_TYPE {
-
-				funcReturnTypeTreeNode := c
-				ii, ok := getIntInfoFromTypeString(string(funcReturnTypeTreeNode.Tok.Buf))
-				if !ok {
-					PrintErrorAndExit(tn.Tok.LineNumber)
-				}
-				newFuncSigInfo.ReturnValueInfo = ii
-
-			}
-
-		}
-
-		funcIdentTreeNode := funcTreeNode.Children[0]
-		funcIdent := string(funcIdentTreeNode.Tok.Buf)
-
-		if _, doesAlreadyExists := funcListInfo[funcIdent]; doesAlreadyExists {
-			PrintErrorAndExit(funcIdentTreeNode.Tok.LineNumber)
-		}
-
-		if _, ok := newFuncSigInfo.ReturnValueInfo.(IntInfo); !ok {
-			newFuncSigInfo.ReturnValueInfo = VoidInfo{BytesCount: 0}
-		}
-
-		funcListInfo[funcIdent] = newFuncSigInfo
-	}
-}
-
-var funcAddrList map[string]int
-
-type BlankFuncCall struct {
-	Ident string
-	Addr  int
-}
-
-var blankFuncCallList []BlankFuncCall
-
-var blankContinueStmtAddrList [][]int
-var blankBreakStmtAddrList [][]int
-
-func encodeIntInfo(ii IntInfo) byte {
-	var b byte = byte(ii.BytesCount)
-
-	if ii.IsSigned {
-		return b | 0b10000
+	if isAddress {
+		return b | 0b100000
 	}
 
 	return b
 }
 
-func encodeIntAddressInfo(iai IntAddressInfo) byte {
-	return (encodeIntInfo(IntInfo{IsSigned: iai.IsSigned, BytesCount: iai.RealSize}) | 0b100000)
-}
-
 func emitBlankPushOp() int {
 	addr := len(bytecode)
 	emitPushOp(IntInfo{IsSigned: false, BytesCount: ADDR_BYTES_COUNT}, 0)
@@ -301,916 +139,542 @@ func emitPopOp(ii IntInfo) {
 	bytecode = append(bytecode, encodeIntInfo(ii))
 }
 
-func emitReturnOp(i interface{}) bool {
-	switch v := i.(type) {
-	case IntInfo:
-		bytecode = append(bytecode, OP_RETURN)
-		bytecode = append(bytecode, encodeIntInfo(v))
-
-		return true
-	case IntAddressInfo:
-		bytecode = append(bytecode, OP_RETURN)
-		bytecode = append(bytecode, encodeIntAddressInfo(v))
-
-		return true
-	case VoidInfo:
-		bytecode = append(bytecode, OP_RETURN)
-		bytecode = append(bytecode, encodeIntInfo(IntInfo{IsSigned: false, BytesCount: 0}))
-
-		return true
-	default:
-		return false
-	}
+func emitBlockJumpOp(op byte, b int) {
+	blankBlockJumpList = append(blankBlockJumpList, BlankBlockJump{Block: b, Addr: emitBlankPushOp()})
+	emitOp(op)
 }
 
-func emitBinaryOp(op byte, v1 interface{}, v2 interface{}) (bool, IntInfo) {
-	var vb1 byte = 0
-	var vb2 byte = 0
-
-	var ii IntInfo
-
-	switch v := v1.(type) {
-	case IntInfo:
-		vb1 = encodeIntInfo(v)
-		ii = IntInfo{IsSigned: v.IsSigned, BytesCount: v.BytesCount}
-	case IntAddressInfo:
-		vb1 = encodeIntAddressInfo(v)
-		ii = IntInfo{IsSigned: v.IsSigned, BytesCount: v.RealSize}
-	default:
-		return false, IntInfo{}
-	}
-
-	switch v := v2.(type) {
-	case IntInfo:
-		vb2 = encodeIntInfo(v)
-	case IntAddressInfo:
-		vb2 = encodeIntAddressInfo(v)
-	default:
-		return false, IntInfo{}
-	}
-
-	if _, ok := map[byte]bool{
-		OP_EQL: true, OP_NEQ: true,
-		OP_LSS: true, OP_GTR: true,
-		OP_LEQ: true, OP_GEQ: true}[op]; ok {
-
-		ii = IntInfo{IsSigned: false, BytesCount: 1}
-	}
+func emitJumpTableOp(ii IntInfo, entriesCount int) int {
+	addr := len(bytecode)
 
-	if ((vb1 & 0b11111) == (vb2 & 0b11111)) || (op == OP_SHL) || (op == OP_SHR) {
-		bytecode = append(bytecode, op)
-		bytecode = append(bytecode, vb1)
-		bytecode = append(bytecode, vb2)
+	bytecode = append(bytecode, OP_JUMP_TABLE)
+	bytecode = append(bytecode, encodeIntInfo(ii))
+	bytecode = binary.LittleEndian.AppendUint64(bytecode, uint64(entriesCount))
 
-		return true, ii
+	for j := 0; j < entriesCount; j++ {
+		bytecode = binary.LittleEndian.AppendUint64(bytecode, 0)
 	}
 
-	return false, IntInfo{}
+	return addr
 }
 
-func emitAssignOp(v1 interface{}, v2 interface{}) bool {
-	var vb1 byte = 0
-	var vb2 byte = 0
+func backpatchJumpTableOp(addr int, entryIndex int, targetAddr int) {
+	entryAddr := addr + 10 + (entryIndex * 8)
 
-	switch v := v1.(type) {
-	case IntAddressInfo:
-		vb1 = encodeIntAddressInfo(v)
-	default:
-		return false
-	}
-
-	switch v := v2.(type) {
-	case IntInfo:
-		vb2 = encodeIntInfo(v)
-	case IntAddressInfo:
-		vb2 = encodeIntAddressInfo(v)
-	default:
-		return false
-	}
+	for i, b := range binary.LittleEndian.AppendUint64(make([]byte, 0),
+		uint64(targetAddr)-uint64(addr)) {
 
-	if (vb1 & 0b11111) == (vb2 & 0b11111) {
-		bytecode = append(bytecode, OP_ASSIGN)
-		bytecode = append(bytecode, vb1)
-		bytecode = append(bytecode, vb2)
-
-		return true
+		bytecode[entryAddr+i] = b
 	}
-
-	return false
 }
 
-func emitBranchOp(i interface{}) bool {
-	switch v := i.(type) {
-	case IntInfo:
-		bytecode = append(bytecode, OP_BRANCH)
-		bytecode = append(bytecode, encodeIntInfo(v))
-
-		return true
-	case IntAddressInfo:
-		bytecode = append(bytecode, OP_BRANCH)
-		bytecode = append(bytecode, encodeIntAddressInfo(v))
+var SWITCH_JUMP_TABLE_MIN_CASES_COUNT uint64 = 4
+var SWITCH_JUMP_TABLE_MAX_ENTRIES_PER_CASE uint64 = 3
 
-		return true
-	default:
-		return false
-	}
-}
-
-func emitStoreStringOp(a interface{}, b []byte) bool {
-	switch v := a.(type) {
-	case IntAddressInfo:
-		if (v.RealSize != 8) || (v.IsSigned) {
-			return false
+func getSwitchJumpTableInfo(ii IntInfo, caseValueList []uint64) (uint64, uint64, bool) {
+	getOrderingKey := func(v uint64) uint64 {
+		k := v << ((8 - ii.BytesCount) * 8)
+		if ii.IsSigned {
+			k = k ^ (uint64(1) << 63)
 		}
-	default:
-		return false
+		return k
 	}
 
-	bytecode = append(bytecode, OP_STORE_STRING)
-	bytecode = append(bytecode, b...)
-	bytecode = append(bytecode, 0)
-
-	return true
-}
-
-func emitConvertOp(a interface{}, b IntInfo) bool {
-	var vb byte
+	minValue := caseValueList[0]
+	maxValue := caseValueList[0]
 
-	switch v := a.(type) {
-	case IntInfo:
-		vb = encodeIntInfo(v)
-	case IntAddressInfo:
-		vb = encodeIntAddressInfo(v)
-	default:
-		return false
+	for _, v := range caseValueList {
+		if getOrderingKey(v) < getOrderingKey(minValue) {
+			minValue = v
+		}
+		if getOrderingKey(v) > getOrderingKey(maxValue) {
+			maxValue = v
+		}
 	}
 
-	bytecode = append(bytecode, OP_CONVERT)
-	bytecode = append(bytecode, vb)
-	bytecode = append(bytecode, encodeIntInfo(b))
-
-	return true
-}
-
-func compileFuncList(tn TreeNode) {
-	compileTreeNodeChildren(tn.Children)
-}
-
-func compileFunc(tn TreeNode) {
-	callStackInfoReset()
-	compileTreeNodeChildren(tn.Children)
-}
-
-func compileFuncIdent(tn TreeNode) {
-	funcAddrList[string(tn.Tok.Buf)] = len(bytecode)
-}
+	casesCount := uint64(len(caseValueList))
+	entriesCount := ((getOrderingKey(maxValue) - getOrderingKey(minValue)) >>
+		((8 - ii.BytesCount) * 8)) + 1
 
-func compileFuncSig(tn TreeNode) {
-	compileTreeNodeChildren(tn.Children)
-	callStackInfoInitFrame()
+	return minValue, entriesCount, (casesCount >= SWITCH_JUMP_TABLE_MIN_CASES_COUNT) &&
+		(entriesCount >= casesCount) &&
+		(entriesCount <= casesCount*SWITCH_JUMP_TABLE_MAX_ENTRIES_PER_CASE)
 }
 
-func compileFuncParamList(tn TreeNode) {
-	compileTreeNodeChildren(tn.Children)
-}
+func lowerIRSwitch(f IRFunc, blockIndex int, instr IRInstr, defInstr IRInstr, isFolded bool) {
+	ii := f.ValueTypeList[instr.ArgList[0]].(IntInfo)
+	vb := encodeTypeInfo(ii, isFolded)
 
-func compileFuncParam(tn TreeNode) {
-	var isi IntStorageInfo
+	if minValue, entriesCount, ok := getSwitchJumpTableInfo(ii, instr.CaseValueList); ok {
+		uii := IntInfo{IsSigned: false, BytesCount: ii.BytesCount}
 
-	funcParamIdentTreeNode := tn.Children[0]
-	funcParamTypeTreeNode := tn.Children[1]
+		bytecode = append(bytecode, OP_CONVERT, vb, encodeIntInfo(uii))
 
-	isi.Ident = string(funcParamIdentTreeNode.Tok.Buf)
+		emitPushOp(uii, minValue)
 
-	if ii, ok := getIntInfoFromTypeString(string(funcParamTypeTreeNode.Tok.Buf)); ok {
-		isi.IsSigned = ii.IsSigned
-		isi.BytesCount = ii.BytesCount
-	} else {
-		PrintErrorAndExit(funcParamTypeTreeNode.Tok.LineNumber)
-	}
+		bytecode = append(bytecode, OP_SUB, encodeIntInfo(uii), encodeIntInfo(uii))
 
-	isi.BlockLevel = blockLevel
+		jumpTableOpAddr := emitJumpTableOp(uii, int(entriesCount))
 
-	callStackInfo = append(callStackInfo, isi)
-}
+		for i := 0; i < int(entriesCount); i++ {
+			blankJumpTableEntryList = append(blankJumpTableEntryList,
+				BlankBlockJump{Block: instr.TargetList[0], Addr: jumpTableOpAddr, EntryIndex: i})
+		}
 
-func compileFuncReturnType(tn TreeNode) {
-	if ii, ok := getIntInfoFromTypeString(string(tn.Tok.Buf)); ok {
-		returnValueInfo = ii
+		for i, v := range instr.CaseValueList {
+			blankJumpTableEntryList = append(blankJumpTableEntryList,
+				BlankBlockJump{Block: instr.TargetList[i+1], Addr: jumpTableOpAddr,
+					EntryIndex: int((v - minValue) & getIntInfoMask(ii))})
+		}
 	} else {
-		PrintErrorAndExit(tn.Tok.LineNumber)
-	}
-}
-
-func compileStmtList(tn TreeNode) {
-	blockLevel++
-
-	compileTreeNodeChildren(tn.Children)
-
-	blockLevel--
+		addr := scratchAddr
 
-	for i := len(callStackInfo) - 1; i >= 0; i-- {
-		if isi, ok := callStackInfo[i].(IntStorageInfo); ok && (isi.BlockLevel > blockLevel) {
-			emitPopOp(IntInfo{IsSigned: isi.IsSigned, BytesCount: isi.BytesCount})
-			callStackInfo = callStackInfo[:len(callStackInfo)-1]
+		if isFolded {
+			addr = localAddrList[defInstr.Local]
 		} else {
-			break
+			bytecode = append(bytecode, OP_ASSIGN, encodeTypeInfo(ii, true), vb)
 		}
-	}
-}
-
-func compileStmtDecl(tn TreeNode) {
-	stmtDeclIdentTreeNode := tn.Children[0]
-	stmtDeclTypeTreeNode := tn.Children[1]
-
-	if isi, ok := callStackInfoFindIntStorageInfo(string(stmtDeclIdentTreeNode.Tok.Buf)); ok {
-		if (isi.BlockLevel == blockLevel) ||
-			((isi.BlockLevel == STARTING_BLOCK_LEVEL) && (blockLevel == STARTING_BLOCK_LEVEL+1)) {
-			PrintErrorAndExit(stmtDeclIdentTreeNode.Tok.LineNumber)
-		}
-	}
 
-	var isi IntStorageInfo
-
-	isi.Ident = string(stmtDeclIdentTreeNode.Tok.Buf)
-
-	if ii, ok := getIntInfoFromTypeString(string(stmtDeclTypeTreeNode.Tok.Buf)); ok {
-		isi.IsSigned = ii.IsSigned
-		isi.BytesCount = ii.BytesCount
-
-		emitPushOp(ii, 0)
-	} else {
-		PrintErrorAndExit(stmtDeclTypeTreeNode.Tok.LineNumber)
-	}
-
-	isi.BlockLevel = blockLevel
+		for i, v := range instr.CaseValueList {
+			if i != 0 || !isFolded {
+				emitPushOp(IntInfo{IsSigned: false, BytesCount: ADDR_BYTES_COUNT}, addr)
+			}
 
-	callStackInfo = append(callStackInfo, isi)
-}
+			emitPushOp(ii, v)
 
-func compileStmtExpr(tn TreeNode) {
-	compileTreeNodeChildren(tn.Children)
+			bytecode = append(bytecode, OP_NEQ, encodeTypeInfo(ii, true), encodeIntInfo(ii))
 
-	switch v := callStackInfo[len(callStackInfo)-1].(type) {
-	case IntInfo:
-		emitPopOp(v)
-	case IntAddressInfo:
-		emitPopOp(IntInfo{IsSigned: false, BytesCount: ADDR_BYTES_COUNT})
+			emitBlockJumpOp(OP_BRANCH, instr.TargetList[i+1])
+			emitOp(encodeIntInfo(IntInfo{IsSigned: false, BytesCount: 1}))
+		}
 	}
 
-	callStackInfo = callStackInfo[:len(callStackInfo)-1]
-}
-
-func compileStmtAssign(tn TreeNode) {
-	compileTreeNodeChildren(tn.Children)
-
-	if ok := emitAssignOp(
-		callStackInfo[len(callStackInfo)-2], callStackInfo[len(callStackInfo)-1]); ok {
-
-		callStackInfo = callStackInfo[:len(callStackInfo)-2]
-	} else {
-		PrintErrorAndExit(tn.Tok.LineNumber)
+	if instr.TargetList[0] != blockIndex+1 {
+		emitBlockJumpOp(OP_JUMP, instr.TargetList[0])
 	}
 }
 
-func unescapeStmtString(b []byte) (bool, []byte) {
-	var nb []byte
+func lowerIRBlock(f IRFunc, blockIndex int) {
+	instrList := f.BlockList[blockIndex].InstrList
 
-	if (len(b) < 3) || (b[0] != 0x22) || (b[len(b)-1] != 0x22) {
-		return false, nb
-	}
+	addrII := IntInfo{IsSigned: false, BytesCount: ADDR_BYTES_COUNT}
 
-	b = b[1 : len(b)-1]
+	defIndexList := make(map[int]int)
+	useIndexList := make(map[int]int)
+	startIndexList := make(map[int]int)
 
-	for len(b) != 0 {
-		if b[0] == 0x5c {
-			b = b[1:]
+	for i, instr := range instrList {
+		for _, arg := range instr.ArgList {
+			useIndexList[arg] = i
+		}
 
-			if len(b) == 0 {
-				return false, nb
-			}
+		if instr.Dest != -1 {
+			defIndexList[instr.Dest] = i
+			startIndexList[instr.Dest] = i
 
-			if (b[0] == 0x22) || (b[0] == 0x5c) {
-				nb = append(nb, b[0])
-				b = b[1:]
-			} else {
-				return false, nb
+			if len(instr.ArgList) != 0 {
+				startIndexList[instr.Dest] = startIndexList[instr.ArgList[0]]
 			}
-		} else {
-			nb = append(nb, b[0])
-			b = b[1:]
 		}
 	}
 
-	return true, nb
-}
-
-func compileStmtStoreString(tn TreeNode) {
-	exprTreeNode := tn.Children[0]
-	stmtStringTreeNode := tn.Children[1]
-
-	compileTreeNode(exprTreeNode)
+	// A variable read right before its use is pushed as a frame address
+	// and read by the consuming op, like a direct variable reference
+	isFolded := make(map[int]bool)
 
-	if ok, b := unescapeStmtString(stmtStringTreeNode.Tok.Buf); ok {
-		if ok := emitStoreStringOp(callStackInfo[len(callStackInfo)-1], b); ok {
-			callStackInfo = callStackInfo[:len(callStackInfo)-1]
-		} else {
-			PrintErrorAndExit(tn.Tok.LineNumber)
+	for i, instr := range instrList {
+		if instr.Op != IR_LOAD_LOCAL {
+			continue
 		}
-	} else {
-		PrintErrorAndExit(stmtStringTreeNode.Tok.LineNumber)
-	}
-}
-
-func compileStmtWhile(tn TreeNode) {
-	stmtWhileStartingAddr := len(bytecode)
-
-	exprTreeNode := tn.Children[0]
-	stmtListTreeNode := tn.Children[1]
-
-	compileTreeNode(exprTreeNode)
-
-	stmtWhileBlankPushOpAddr := emitBlankPushOp()
-
-	if ok := emitBranchOp(callStackInfo[len(callStackInfo)-1]); !ok {
-		PrintErrorAndExit(tn.Tok.LineNumber)
-	}
-
-	callStackInfo = callStackInfo[:len(callStackInfo)-1]
-
-	blankBreakStmtAddrList = append(blankBreakStmtAddrList, make([]int, 0))
-	blankContinueStmtAddrList = append(blankContinueStmtAddrList, make([]int, 0))
-
-	whileBlockLevel = blockLevel
 
-	compileTreeNode(stmtListTreeNode)
+		j := useIndexList[instr.Dest]
+		user := instrList[j]
 
-	emitPushOp(IntInfo{IsSigned: false, BytesCount: ADDR_BYTES_COUNT},
-		uint64(stmtWhileStartingAddr)-(uint64(len(bytecode))+10))
-
-	emitOp(OP_JUMP)
-
-	backpatchBlankPushOp(stmtWhileBlankPushOpAddr,
-		uint64(len(bytecode))-(uint64(stmtWhileBlankPushOpAddr)+10))
-
-	for _, blankBreakStmtAddr := range blankBreakStmtAddrList[len(blankBreakStmtAddrList)-1] {
-		backpatchBlankPushOp(blankBreakStmtAddr,
-			uint64(len(bytecode))-(uint64(blankBreakStmtAddr)+10))
-	}
-
-	blankBreakStmtAddrList = blankBreakStmtAddrList[:len(blankBreakStmtAddrList)-1]
-
-	for _, blankContinueStmtAddr := range blankContinueStmtAddrList[len(
-		blankContinueStmtAddrList)-1] {
-
-		backpatchBlankPushOp(blankContinueStmtAddr,
-			uint64(stmtWhileStartingAddr)-(uint64(blankContinueStmtAddr)+10))
-	}
-
-	blankContinueStmtAddrList = blankContinueStmtAddrList[:len(blankContinueStmtAddrList)-1]
-}
-
-func compileStmtIf(tn TreeNode) {
-	exprTreeNode := tn.Children[0]
-	stmtListTreeNode := tn.Children[1]
-
-	compileTreeNode(exprTreeNode)
+		if user.Op == IR_CALL ||
+			(user.Op == IR_CALL_INDIRECT && user.ArgList[len(user.ArgList)-1] != instr.Dest) {
+			continue
+		}
 
-	stmtIfBlankPushOpAddr := emitBlankPushOp()
+		isFolded[instr.Dest] = true
 
-	if ok := emitBranchOp(callStackInfo[len(callStackInfo)-1]); !ok {
-		PrintErrorAndExit(tn.Tok.LineNumber)
+		for k := i + 1; k < j; k++ {
+			if instrList[k].Op == IR_STORE_LOCAL && instrList[k].Local == instr.Local {
+				isFolded[instr.Dest] = false
+			}
+		}
 	}
 
-	callStackInfo = callStackInfo[:len(callStackInfo)-1]
-
-	compileTreeNode(stmtListTreeNode)
-
-	if len(tn.Children) == 3 {
-		stmtIfStmtListEndBlankPushOpAddr := emitBlankPushOp()
-
-		emitOp(OP_JUMP)
-
-		backpatchBlankPushOp(stmtIfBlankPushOpAddr,
-			uint64(len(bytecode))-(uint64(stmtIfBlankPushOpAddr)+10))
+	prePushAddrList := make(map[int][]uint64)
+	isSkipped := make(map[int]bool)
 
-		stmtElseTreeNode := tn.Children[2]
-		compileTreeNode(stmtElseTreeNode)
-
-		backpatchBlankPushOp(stmtIfStmtListEndBlankPushOpAddr,
-			uint64(len(bytecode))-(uint64(stmtIfStmtListEndBlankPushOpAddr)+10))
-	} else {
-		backpatchBlankPushOp(stmtIfBlankPushOpAddr,
-			uint64(len(bytecode))-(uint64(stmtIfBlankPushOpAddr)+10))
-	}
-}
-
-func compileStmtElse(tn TreeNode) {
-	compileTreeNodeChildren(tn.Children)
-}
+	for i, instr := range instrList {
+		switch instr.Op {
+		case IR_STORE_LOCAL:
+			arg := instr.ArgList[0]
+			argInstr := instrList[defIndexList[arg]]
 
-func compileStmtReturn(tn TreeNode) {
-	if len(tn.Children) == 0 {
-		switch v := returnValueInfo.(type) {
-		case IntInfo:
-			emitPushOp(v, 0)
-			emitPushOp(IntInfo{IsSigned: false, BytesCount: ADDR_BYTES_COUNT},
-				uint64(-framePointer))
-			if ok := emitReturnOp(v); !ok {
-				PrintErrorAndExit(0)
-			}
-		case VoidInfo:
-			emitPushOp(IntInfo{IsSigned: false, BytesCount: ADDR_BYTES_COUNT},
-				uint64(-framePointer))
-			if ok := emitReturnOp(v); !ok {
-				PrintErrorAndExit(0)
+			// Locals start out as zero, so the first store outside of a loop does not have to clear them
+			if !isLoopBlockList[blockIndex] && !f.LocalList[instr.Local].IsParam &&
+				!isLocalReferencedList[instr.Local] &&
+				argInstr.Op == IR_CONST && argInstr.Value == 0 && defIndexList[arg] == i-1 {
+				isSkipped[i-1] = true
+				isSkipped[i] = true
+			} else {
+				prePushAddrList[startIndexList[arg]] = append(prePushAddrList[startIndexList[arg]],
+					localAddrList[instr.Local])
 			}
-		default:
-			PrintErrorAndExit(0)
-		}
-	} else {
-		compileTreeNodeChildren(tn.Children)
-
-		switch returnII := returnValueInfo.(type) {
-		case IntInfo:
-			switch v := callStackInfo[len(callStackInfo)-1].(type) {
-			case IntInfo:
-				if (v.BytesCount != returnII.BytesCount) || (v.IsSigned != returnII.IsSigned) {
-					PrintErrorAndExit(tn.Tok.LineNumber)
-				}
-			case IntAddressInfo:
-				if (v.RealSize != returnII.BytesCount) || (v.IsSigned != returnII.IsSigned) {
-					PrintErrorAndExit(tn.Tok.LineNumber)
-				}
-			default:
-				PrintErrorAndExit(tn.Tok.LineNumber)
+		case IR_STORE_STRING:
+			if arg := instr.ArgList[0]; !isFolded[arg] {
+				prePushAddrList[startIndexList[arg]] = append(prePushAddrList[startIndexList[arg]],
+					scratchAddr)
 			}
-
-			emitPushOp(IntInfo{IsSigned: false, BytesCount: ADDR_BYTES_COUNT},
-				uint64(-framePointer))
-
-			if ok := emitReturnOp(returnII); !ok {
-				PrintErrorAndExit(0)
+		case IR_SWITCH:
+			arg := instr.ArgList[0]
+			_, _, isJumpTable := getSwitchJumpTableInfo(f.ValueTypeList[arg].(IntInfo),
+				instr.CaseValueList)
+
+			if !isFolded[arg] && !isJumpTable {
+				prePushAddrList[startIndexList[arg]] = append(prePushAddrList[startIndexList[arg]],
+					scratchAddr)
 			}
-		case VoidInfo:
-			PrintErrorAndExit(tn.Tok.LineNumber)
-		default:
-			PrintErrorAndExit(0)
 		}
-	}
-}
 
-func compileStmtBreak(tn TreeNode) {
-	for i := len(callStackInfo) - 1; i >= 0; i-- {
-		if isi, ok := callStackInfo[i].(IntStorageInfo); ok && (isi.BlockLevel > whileBlockLevel) {
-			emitPopOp(IntInfo{IsSigned: isi.IsSigned, BytesCount: isi.BytesCount})
-		} else {
-			break
+		if instr.Op == IR_LOAD_LOCAL || instr.Op == IR_STORE_LOCAL {
+			isLocalReferencedList[instr.Local] = true
 		}
 	}
 
-	if len(blankBreakStmtAddrList) != 0 {
-		blankBreakStmtAddrList[len(blankBreakStmtAddrList)-1] = append(
-			blankBreakStmtAddrList[len(blankBreakStmtAddrList)-1], emitBlankPushOp())
-
-		emitOp(OP_JUMP)
-	} else {
-		PrintErrorAndExit(tn.Tok.LineNumber)
-	}
-}
+	for i, instr := range instrList {
+		recordDebugLine(instr.SourceFilePath, instr.Line)
 
-func compileStmtContinue(tn TreeNode) {
-	for i := len(callStackInfo) - 1; i >= 0; i-- {
-		if isi, ok := callStackInfo[i].(IntStorageInfo); ok && (isi.BlockLevel > whileBlockLevel) {
-			emitPopOp(IntInfo{IsSigned: isi.IsSigned, BytesCount: isi.BytesCount})
-		} else {
-			break
+		for _, addr := range prePushAddrList[i] {
+			emitPushOp(addrII, addr)
 		}
-	}
-
-	if len(blankContinueStmtAddrList) != 0 {
-		blankContinueStmtAddrList[len(blankContinueStmtAddrList)-1] = append(
-			blankContinueStmtAddrList[len(blankContinueStmtAddrList)-1], emitBlankPushOp())
 
-		emitOp(OP_JUMP)
-	} else {
-		PrintErrorAndExit(tn.Tok.LineNumber)
-	}
-}
-func compileExpr(tn TreeNode) {
-	compileTreeNodeChildren(tn.Children)
-}
-
-func compileExprInt(tn TreeNode) {
-	if isi, ok := callStackInfoFindIntStorageInfo(string(tn.Tok.Buf)); ok {
-		var iai IntAddressInfo
-		iai.RealSize = isi.BytesCount
-		iai.IsSigned = isi.IsSigned
-		iai.BytesCount = ADDR_BYTES_COUNT
-
-		if a, ok := callStackInfoGetIntAddress(string(tn.Tok.Buf)); ok {
-			emitPushOp(IntInfo{IsSigned: false, BytesCount: ADDR_BYTES_COUNT}, a)
-			callStackInfo = append(callStackInfo, iai)
-		} else {
-			PrintErrorAndExit(0)
-		}
-	} else {
-		PrintErrorAndExit(tn.Tok.LineNumber)
-	}
-}
-
-func unescapeExprChar(b []byte) (byte, bool) {
-	if (len(b) < 3) || (b[0] != 0x27) || (b[len(b)-1] != 0x27) {
-		return 0, false
-	}
-
-	if b[1] == 0x5c {
-		if (len(b) == 4) && (b[2] == 0x5c || b[2] == 0x27) {
-			return b[2], true
-		} else {
-			return 0, false
+		if isSkipped[i] {
+			continue
 		}
-	} else if len(b) == 3 {
-		return b[1], true
-	} else {
-		return 0, false
-	}
-}
 
-func compileExprFunc(tn TreeNode) {
-	if ii, ok := getIntInfoFromTypeString(string(tn.Tok.Buf)); ok {
-		exprFuncParmListTreeNode := tn.Children[0]
-
-		if len(exprFuncParmListTreeNode.Children) != 1 {
-			PrintErrorAndExit(tn.Tok.LineNumber)
+		argByte := func(k int) byte {
+			return encodeTypeInfo(f.ValueTypeList[instr.ArgList[k]], isFolded[instr.ArgList[k]])
 		}
 
-		exprFuncParmTreeNode := exprFuncParmListTreeNode.Children[0]
-
-		switch exprFuncParmTreeNode.Children[0].Kype {
-		case TNT_EXPR_CHAR:
-			exprCharTreeNode := exprFuncParmTreeNode.Children[0]
-			if b, ok := unescapeExprChar(exprCharTreeNode.Tok.Buf); ok {
-				if ii.BytesCount == 1 && (!ii.IsSigned) {
-					emitPushOp(ii, uint64(b))
-					callStackInfo = append(callStackInfo, ii)
-				} else {
-					PrintErrorAndExit(exprCharTreeNode.Tok.LineNumber)
-				}
+		switch instr.Op {
+		case IR_CONST:
+			if ii, ok := instr.Type.(IntInfo); ok {
+				emitPushOp(ii, instr.Value)
 			} else {
-				PrintErrorAndExit(exprCharTreeNode.Tok.LineNumber)
+				emitPushOp(addrII, instr.Value)
 			}
-
-		case TNT_EXPR_INT_LIT:
-			exprIntLitTreeNode := exprFuncParmTreeNode.Children[0]
-
-			if v, err :=
-				strconv.ParseUint(string(exprIntLitTreeNode.Tok.Buf), 0, 64); err == nil {
-
-				if v > ((^uint64(0)) >> ((8 - ii.BytesCount) * 8)) {
-					PrintErrorAndExit(exprIntLitTreeNode.Tok.LineNumber)
-				}
-				emitPushOp(ii, v)
-				callStackInfo = append(callStackInfo, ii)
-			} else {
-				PrintErrorAndExit(exprIntLitTreeNode.Tok.LineNumber)
+		case IR_FUNC_ADDR:
+			blankFuncAddrList = append(blankFuncAddrList,
+				BlankFuncCall{Ident: instr.Ident, Addr: emitBlankPushOp()})
+		case IR_LOAD_LOCAL:
+			emitPushOp(addrII, localAddrList[instr.Local])
+
+			if !isFolded[instr.Dest] {
+				bytecode = append(bytecode, OP_CONVERT,
+					encodeTypeInfo(instr.Type, true), encodeTypeInfo(instr.Type, false))
+			}
+		case IR_STORE_LOCAL:
+			bytecode = append(bytecode, OP_ASSIGN,
+				encodeTypeInfo(f.LocalList[instr.Local].Type, true), argByte(0))
+		case IR_BINARY:
+			op, ok := map[TokenType]byte{
+				TT_ADD: OP_ADD,
+				TT_SUB: OP_SUB,
+
+				TT_AND: OP_AND,
+				TT_OR:  OP_OR,
+				TT_XOR: OP_XOR,
+
+				TT_SHL: OP_SHL,
+				TT_SHR: OP_SHR,
+
+				TT_MUL: OP_MUL,
+				TT_QUO: OP_QUO,
+				TT_REM: OP_REM,
+
+				TT_EQL: OP_EQL,
+				TT_NEQ: OP_NEQ,
+				TT_LSS: OP_LSS,
+				TT_GTR: OP_GTR,
+				TT_LEQ: OP_LEQ,
+				TT_GEQ: OP_GEQ,
+			}[instr.BinaryOp]
+
+			if !ok {
+				PrintErrorAndExit(0)
 			}
 
-		case TNT_EXPR_NEG_INT_LIT:
-			exprNegIntLitTreeNode := exprFuncParmTreeNode.Children[0]
-
-			if v, err :=
-				strconv.ParseUint(string(exprNegIntLitTreeNode.Tok.Buf), 0, 64); err == nil {
+			bytecode = append(bytecode, op, argByte(0), argByte(1))
+		case IR_CONVERT:
+			bytecode = append(bytecode, OP_CONVERT, argByte(0), encodeTypeInfo(instr.Type, false))
+		case IR_CALL:
+			blankFuncCallList = append(blankFuncCallList,
+				BlankFuncCall{Ident: instr.Ident, Addr: emitBlankPushOp()})
 
-				if v > (uint64(1) << ((ii.BytesCount * 8) - 1)) {
-					PrintErrorAndExit(exprNegIntLitTreeNode.Tok.LineNumber)
-				}
-				v = (^v) + 1
-				emitPushOp(ii, v)
-				callStackInfo = append(callStackInfo, ii)
-			} else {
-				PrintErrorAndExit(exprNegIntLitTreeNode.Tok.LineNumber)
+			emitOp(OP_CALL)
+		case IR_CALL_INDIRECT:
+			bytecode = append(bytecode, OP_CALL_INDIRECT, argByte(len(instr.ArgList)-1))
+		case IR_LOAD:
+			bytecode = append(bytecode, OP_LOAD, argByte(0), encodeTypeInfo(instr.Type, false))
+		case IR_STORE:
+			bytecode = append(bytecode, OP_STORE, argByte(0), argByte(1))
+		case IR_STORE_STRING:
+			if !isFolded[instr.ArgList[0]] {
+				bytecode = append(bytecode, OP_ASSIGN, encodeIntInfo(addrII)|0b100000, argByte(0))
+				emitPushOp(addrII, scratchAddr)
 			}
-		case TNT_EXPR:
-			compileTreeNode(exprFuncParmTreeNode.Children[0])
 
-			if ok := emitConvertOp(callStackInfo[len(callStackInfo)-1], ii); ok {
-				callStackInfo = callStackInfo[:len(callStackInfo)-1]
-				callStackInfo = append(callStackInfo, ii)
+			bytecode = append(bytecode, OP_STORE_STRING)
+			bytecode = append(bytecode, instr.Buf...)
+			bytecode = append(bytecode, 0)
+		case IR_DISCARD:
+			if isFolded[instr.ArgList[0]] {
+				emitPopOp(addrII)
 			} else {
-				PrintErrorAndExit(tn.Tok.LineNumber)
+				bytecode = append(bytecode, OP_POP, argByte(0))
 			}
-		default:
-			PrintErrorAndExit(0)
-		}
-	} else {
-		callStackInfoLenBefore := len(callStackInfo)
-
-		compileTreeNodeChildren(tn.Children)
-
-		if fsi, ok := funcListInfo[string(tn.Tok.Buf)]; ok {
-			if (len(callStackInfo) - callStackInfoLenBefore) != len(fsi.ParamListInt) {
-				PrintErrorAndExit(tn.Tok.LineNumber)
+		case IR_JUMP:
+			if instr.TargetList[0] != blockIndex+1 {
+				emitBlockJumpOp(OP_JUMP, instr.TargetList[0])
 			}
+		case IR_BRANCH:
+			emitBlockJumpOp(OP_BRANCH, instr.TargetList[1])
+			emitOp(argByte(0))
 
-			for i, sigParam := range fsi.ParamListInt {
-				if stackParam, ok :=
-					callStackInfo[len(callStackInfo)-len(fsi.ParamListInt)+i].(IntInfo); ok {
-
-					if (stackParam.BytesCount != sigParam.BytesCount) ||
-						(stackParam.IsSigned != sigParam.IsSigned) {
-						PrintErrorAndExit(tn.Tok.LineNumber)
-					}
-
-				} else {
-					PrintErrorAndExit(tn.Tok.LineNumber)
-				}
+			if instr.TargetList[0] != blockIndex+1 {
+				emitBlockJumpOp(OP_JUMP, instr.TargetList[0])
 			}
-
-			blankFuncCallList = append(blankFuncCallList,
-				BlankFuncCall{Ident: string(tn.Tok.Buf), Addr: emitBlankPushOp()})
-
-			emitOp(OP_CALL)
-
-			callStackInfo = callStackInfo[:len(callStackInfo)-len(fsi.ParamListInt)]
-
-			switch v := fsi.ReturnValueInfo.(type) {
-			case IntInfo:
-				callStackInfo = append(callStackInfo, v)
-			case VoidInfo:
-				callStackInfo = append(callStackInfo, v)
-			default:
-				PrintErrorAndExit(0)
+		case IR_SWITCH:
+			lowerIRSwitch(f, blockIndex, instr, instrList[defIndexList[instr.ArgList[0]]],
+				isFolded[instr.ArgList[0]])
+		case IR_RETURN:
+			emitPushOp(addrII, uint64(-framePointer))
+
+			if len(instr.ArgList) != 0 {
+				bytecode = append(bytecode, OP_RETURN, argByte(0))
+			} else {
+				bytecode = append(bytecode, OP_RETURN, encodeIntInfo(IntInfo{IsSigned: false, BytesCount: 0}))
 			}
-		} else {
-			PrintErrorAndExit(tn.Tok.LineNumber)
+		default:
+			PrintErrorAndExit(0)
 		}
 	}
 }
 
-func compileExprFuncParmList(tn TreeNode) {
-	compileTreeNodeChildren(tn.Children)
-}
+func lowerIRFunc(f IRFunc) {
+	funcAddrList[f.Ident] = len(bytecode)
 
-func compileExprFuncParm(tn TreeNode) {
-	compileTreeNodeChildren(tn.Children)
+	paramsBytesCount := 0
+	for _, local := range f.LocalList {
+		if local.IsParam {
+			paramsBytesCount += getTypeInfoBytesCount(local.Type)
+		}
+	}
 
-	if iai, ok := callStackInfo[len(callStackInfo)-1].(IntAddressInfo); ok {
-		ii := IntInfo{IsSigned: iai.IsSigned, BytesCount: iai.RealSize}
+	framePointer = paramsBytesCount + (2 * ADDR_BYTES_COUNT)
 
-		emitPushOp(ii, 0)
-		callStackInfo = append(callStackInfo, ii)
+	localAddrList = make([]uint64, len(f.LocalList))
 
-		if ok, ii := emitBinaryOp(OP_ADD,
-			callStackInfo[len(callStackInfo)-2], callStackInfo[len(callStackInfo)-1]); ok {
+	paramsBytesCount = 0
+	localsBytesCount := 0
 
-			callStackInfo = callStackInfo[:len(callStackInfo)-2]
-			callStackInfo = append(callStackInfo, ii)
+	for i, local := range f.LocalList {
+		if local.IsParam {
+			localAddrList[i] = uint64(paramsBytesCount) - uint64(framePointer)
+			paramsBytesCount += getTypeInfoBytesCount(local.Type)
 		} else {
-			PrintErrorAndExit(0)
+			localAddrList[i] = uint64(localsBytesCount)
+			localsBytesCount += getTypeInfoBytesCount(local.Type)
 		}
 	}
-}
-
-func compileExprBinaryLAND(tn TreeNode) {
-	leftTreeNode := tn.Children[0]
-	rightTreeNode := tn.Children[1]
 
-	compileTreeNode(leftTreeNode)
+	scratchAddr = uint64(localsBytesCount)
 
-	blankPushOpAAddr := emitBlankPushOp()
+	debugFunc := DebugFunc{Ident: f.Ident, SourceFilePath: f.SourceFilePath,
+		ReturnType: f.Sig.ReturnValueInfo, Addr: funcAddrList[f.Ident]}
 
-	if ok := emitBranchOp(callStackInfo[len(callStackInfo)-1]); !ok {
-		PrintErrorAndExit(tn.Tok.LineNumber)
+	for i, local := range f.LocalList {
+		// Locals made up by the compiler cannot be named in the source
+		if !strings.Contains(local.Ident, ".") {
+			debugFunc.LocalList = append(debugFunc.LocalList, DebugLocal{Ident: local.Ident,
+				Type: local.Type, IsParam: local.IsParam, Line: local.Line, Addr: localAddrList[i]})
+		}
 	}
 
-	callStackInfo = callStackInfo[:len(callStackInfo)-1]
+	debugFuncList = append(debugFuncList, debugFunc)
 
-	compileTreeNode(rightTreeNode)
-
-	blankPushOpBAddr := emitBlankPushOp()
-
-	if ok := emitBranchOp(callStackInfo[len(callStackInfo)-1]); !ok {
-		PrintErrorAndExit(tn.Tok.LineNumber)
+	for _, b := range f.BlockList {
+		for _, instr := range b.InstrList {
+			if instr.Op == IR_STORE_STRING || instr.Op == IR_SWITCH {
+				localsBytesCount = int(scratchAddr) + ADDR_BYTES_COUNT
+			}
+		}
 	}
 
-	callStackInfo = callStackInfo[:len(callStackInfo)-1]
-
-	ii := IntInfo{IsSigned: false, BytesCount: 1}
-
-	emitPushOp(ii, 1)
-
-	blankPushOpCAddr := emitBlankPushOp()
+	for n := localsBytesCount; n != 0; {
+		for _, bytesCount := range []int{8, 4, 2, 1} {
+			if n >= bytesCount {
+				emitPushOp(IntInfo{IsSigned: false, BytesCount: bytesCount}, 0)
+				n = n - bytesCount
+				break
+			}
+		}
+	}
 
-	emitOp(OP_JUMP)
+	isLocalReferencedList = make([]bool, len(f.LocalList))
+	isLoopBlockList = getLoopBlockList(f)
 
-	backpatchBlankPushOp(blankPushOpAAddr, uint64(len(bytecode))-(uint64(blankPushOpAAddr)+10))
-	backpatchBlankPushOp(blankPushOpBAddr, uint64(len(bytecode))-(uint64(blankPushOpBAddr)+10))
+	blockAddrList = make([]int, len(f.BlockList))
+	blankBlockJumpList = make([]BlankBlockJump, 0)
+	blankJumpTableEntryList = make([]BlankBlockJump, 0)
 
-	emitPushOp(ii, 0)
+	for i := range f.BlockList {
+		blockAddrList[i] = len(bytecode)
+		lowerIRBlock(f, i)
+	}
 
-	backpatchBlankPushOp(blankPushOpCAddr, uint64(len(bytecode))-(uint64(blankPushOpCAddr)+10))
+	for _, bbj := range blankBlockJumpList {
+		backpatchBlankPushOp(bbj.Addr, uint64(blockAddrList[bbj.Block])-(uint64(bbj.Addr)+10))
+	}
 
-	callStackInfo = append(callStackInfo, ii)
+	for _, bbj := range blankJumpTableEntryList {
+		backpatchJumpTableOp(bbj.Addr, bbj.EntryIndex, blockAddrList[bbj.Block])
+	}
 }
 
-func compileExprBinaryLOR(tn TreeNode) {
-	leftTreeNode := tn.Children[0]
-	rightTreeNode := tn.Children[1]
-
-	compileTreeNode(leftTreeNode)
-
-	blankPushOpAAddr := emitBlankPushOp()
+// A block is part of a loop when a block at or after it jumps back to it or
+// to an earlier block
+func getLoopBlockList(f IRFunc) []bool {
+	list := make([]bool, len(f.BlockList))
 
-	if ok := emitBranchOp(callStackInfo[len(callStackInfo)-1]); !ok {
-		PrintErrorAndExit(tn.Tok.LineNumber)
+	for j, b := range f.BlockList {
+		for _, t := range b.InstrList[len(b.InstrList)-1].TargetList {
+			for k := t; k <= j; k++ {
+				list[k] = true
+			}
+		}
 	}
 
-	callStackInfo = callStackInfo[:len(callStackInfo)-1]
-
-	ii := IntInfo{IsSigned: false, BytesCount: 1}
-
-	onePushOpStartingAddr := len(bytecode)
-
-	emitPushOp(ii, 1)
-
-	blankPushOpBAddr := emitBlankPushOp()
+	return list
+}
 
-	emitOp(OP_JUMP)
+func emitBytecodePrologue(entryFuncIdent string) {
+	blankFuncCallList = append(blankFuncCallList,
+		BlankFuncCall{Ident: entryFuncIdent, Addr: emitBlankPushOp()})
 
-	backpatchBlankPushOp(blankPushOpAAddr, uint64(len(bytecode))-(uint64(blankPushOpAAddr)+10))
+	emitOp(OP_CALL)
+	emitOp(OP_HALT)
 
-	compileTreeNode(rightTreeNode)
+	funcAddrList["ecall"] = len(bytecode)
 
-	blankPushOpCAddr := emitBlankPushOp()
+	bytecode = append(bytecode,
+		0x02, 0x0c, 0x08, 0xf0, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x05, 0x00)
+}
 
-	if ok := emitBranchOp(callStackInfo[len(callStackInfo)-1]); !ok {
-		PrintErrorAndExit(tn.Tok.LineNumber)
+func backpatchBlankFuncList() (string, bool) {
+	for _, bfc := range blankFuncCallList {
+		if funcAddr, ok := funcAddrList[bfc.Ident]; ok {
+			backpatchBlankPushOp(bfc.Addr, uint64(funcAddr)-(uint64(bfc.Addr)+10))
+		} else {
+			return bfc.Ident, false
+		}
 	}
 
-	callStackInfo = callStackInfo[:len(callStackInfo)-1]
-
-	emitPushOp(IntInfo{IsSigned: false, BytesCount: ADDR_BYTES_COUNT},
-		uint64(onePushOpStartingAddr)-(uint64(len(bytecode))+10))
-
-	emitOp(OP_JUMP)
-
-	backpatchBlankPushOp(blankPushOpCAddr, uint64(len(bytecode))-(uint64(blankPushOpCAddr)+10))
-
-	emitPushOp(ii, 0)
-
-	backpatchBlankPushOp(blankPushOpBAddr, uint64(len(bytecode))-(uint64(blankPushOpBAddr)+10))
+	for _, bfa := range blankFuncAddrList {
+		if funcAddr, ok := funcAddrList[bfa.Ident]; ok {
+			backpatchBlankPushOp(bfa.Addr, uint64(funcAddr))
+		} else {
+			return bfa.Ident, false
+		}
+	}
 
-	callStackInfo = append(callStackInfo, ii)
+	return "", true
 }
 
-func compileExprBinary(tn TreeNode) {
-	if tn.Tok.Kype == TT_LAND {
+func bytecodeGeneratorInit() {
+	bytecode = make([]byte, 0)
 
-		compileExprBinaryLAND(tn)
-
-	} else if tn.Tok.Kype == TT_LOR {
-
-		compileExprBinaryLOR(tn)
-
-	} else {
-
-		compileTreeNodeChildren(tn.Children)
-
-		op, ok := map[TokenType]byte{
-			TT_ADD: OP_ADD,
-			TT_SUB: OP_SUB,
-
-			TT_AND: OP_AND,
-			TT_OR:  OP_OR,
-			TT_XOR: OP_XOR,
-
-			TT_SHL: OP_SHL,
-			TT_SHR: OP_SHR,
-
-			TT_MUL: OP_MUL,
-			TT_QUO: OP_QUO,
-			TT_REM: OP_REM,
+	blankFuncCallList = make([]BlankFuncCall, 0)
+	blankFuncAddrList = make([]BlankFuncCall, 0)
 
-			TT_EQL: OP_EQL,
-			TT_NEQ: OP_NEQ,
-			TT_LSS: OP_LSS,
-			TT_GTR: OP_GTR,
-			TT_LEQ: OP_LEQ,
-			TT_GEQ: OP_GEQ,
-		}[tn.Tok.Kype]
+	funcAddrList = make(map[string]int)
 
-		if !ok {
-			PrintErrorAndExit(0)
-		}
+	debugFuncList = make([]DebugFunc, 0)
+}
 
-		if ok, ii := emitBinaryOp(op,
-			callStackInfo[len(callStackInfo)-2], callStackInfo[len(callStackInfo)-1]); ok {
+func BytecodeGenerator(ir IRProgram) []byte {
+	bytecodeGeneratorInit()
 
-			callStackInfo = callStackInfo[:len(callStackInfo)-2]
-			callStackInfo = append(callStackInfo, ii)
-		} else {
-			PrintErrorAndExit(tn.Tok.LineNumber)
-		}
+	sigInfo, ok := ir.FuncSigList["main"]
 
+	if (!ok) || (len(sigInfo.ParamList) != 0) {
+		PrintErrorAndExit(0)
 	}
-}
 
-func compileTreeNode(tn TreeNode) {
-	map[TreeNodeType]func(TreeNode){
-		// TNT_ROOT
-
-		TNT_FUNC_LIST: compileFuncList,
-		TNT_FUNC:      compileFunc,
-
-		TNT_FUNC_IDENT:      compileFuncIdent,
-		TNT_FUNC_SIG:        compileFuncSig,
-		TNT_FUNC_PARAM_LIST: compileFuncParamList,
-		TNT_FUNC_PARAM:      compileFuncParam,
-		// TNT_FUNC_PARAM_IDENT
-		// TNT_FUNC_PARAM_TYPE
-		TNT_FUNC_RETURN_TYPE: compileFuncReturnType,
-
-		TNT_STMT_LIST: compileStmtList,
-
-		TNT_STMT_DECL: compileStmtDecl,
-		// TNT_STMT_DECL_IDENT
-		// TNT_STMT_DECL_TYPE
-
-		TNT_STMT_EXPR:         compileStmtExpr,
-		TNT_STMT_ASSIGN:       compileStmtAssign,
-		TNT_STMT_STORE_STRING: compileStmtStoreString,
-		// TNT_STMT_STRING
-
-		TNT_STMT_WHILE: compileStmtWhile,
-		TNT_STMT_IF:    compileStmtIf,
-		TNT_STMT_ELSE:  compileStmtElse,
-
-		TNT_STMT_RETURN:   compileStmtReturn,
-		TNT_STMT_BREAK:    compileStmtBreak,
-		TNT_STMT_CONTINUE: compileStmtContinue,
-
-		TNT_EXPR:                compileExpr,
-		TNT_EXPR_INT:            compileExprInt,
-		TNT_EXPR_FUNC:           compileExprFunc,
-		TNT_EXPR_FUNC_PARM_LIST: compileExprFuncParmList,
-		TNT_EXPR_FUNC_PARM:      compileExprFuncParm,
-		// TNT_EXPR_INT_LIT
-		// TNT_EXPR_NEG_INT_LIT
-		// TNT_EXPR_CHAR
-		TNT_EXPR_BINARY: compileExprBinary,
-	}[tn.Kype](tn)
-}
-
-func compileTreeNodeChildren(treeNodeChildren []TreeNode) {
-	for _, tn := range treeNodeChildren {
-		compileTreeNode(tn)
+	if _, ok := sigInfo.ReturnValueInfo.(VoidInfo); !ok {
+		PrintErrorAndExit(0)
 	}
-}
-
-func BytecodeGenerator(tn TreeNode) []byte {
-	funcListTreeNode := tn.Children[0]
 
-	funcListInfoInit(funcListTreeNode)
+	emitBytecodePrologue("main")
 
-	sigInfo, ok := funcListInfo["main"]
+	for _, f := range ir.FuncList {
+		lowerIRFunc(f)
+	}
 
-	if (!ok) || (len(sigInfo.ParamListInt) != 0) {
-		PrintErrorAndExit(0)
+	if isPeepholeOptimizerEnabled {
+		PeepholeOptimizer()
 	}
 
-	if _, ok := sigInfo.ReturnValueInfo.(VoidInfo); !ok {
+	if _, ok := backpatchBlankFuncList(); !ok {
 		PrintErrorAndExit(0)
 	}
 
-	blankFuncCallList = make([]BlankFuncCall, 0)
-
-	blankFuncCallList = append(blankFuncCallList,
-		BlankFuncCall{Ident: "main", Addr: emitBlankPushOp()})
+	for i := range debugFuncList {
+		debugFuncList[i].EndAddr = len(bytecode)
+		if i+1 < len(debugFuncList) {
+			debugFuncList[i].EndAddr = debugFuncList[i+1].Addr
+		}
+	}
 
-	emitOp(OP_CALL)
-	emitOp(OP_HALT)
+	return bytecode
+}
 
-	funcAddrList = make(map[string]int)
+func ObjectGenerator(ir IRProgram) ObjectFile {
+	bytecodeGeneratorInit()
 
-	funcAddrList["ecall"] = len(bytecode)
+	for _, f := range ir.FuncList {
+		lowerIRFunc(f)
+	}
 
-	bytecode = append(bytecode,
-		0x02, 0x0c, 0x08, 0xf0, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x05, 0x00)
+	if isPeepholeOptimizerEnabled {
+		PeepholeOptimizer()
+	}
 
-	funcListInfo["ecall"] = FuncSigInfo{
-		ParamListInt:    make([]IntInfo, 0),
-		ReturnValueInfo: VoidInfo{BytesCount: 0}}
+	var of ObjectFile
 
-	compileTreeNodeChildren(tn.Children)
+	for _, f := range ir.FuncList {
+		of.SymbolList = append(of.SymbolList,
+			ObjectSymbol{Ident: f.Ident, Addr: funcAddrList[f.Ident]})
+	}
 
 	for _, bfc := range blankFuncCallList {
 		if funcAddr, ok := funcAddrList[bfc.Ident]; ok {
 			backpatchBlankPushOp(bfc.Addr, uint64(funcAddr)-(uint64(bfc.Addr)+10))
 		} else {
-			PrintErrorAndExit(0)
+			of.RelocationList = append(of.RelocationList,
+				ObjectRelocation{Kype: RELOC_FUNC_CALL, Ident: bfc.Ident, Addr: bfc.Addr})
 		}
 	}
 
-	return bytecode
+	for _, bfa := range blankFuncAddrList {
+		of.RelocationList = append(of.RelocationList,
+			ObjectRelocation{Kype: RELOC_FUNC_ADDR, Ident: bfa.Ident, Addr: bfa.Addr})
+	}
+
+	of.Code = bytecode
+
+	return of
 }
@@ -0,0 +1,432 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+var C_RUNTIME_HEAD string = `#include <stdint.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+
+#ifndef LC_MEMORY_SIZE
+#define LC_MEMORY_SIZE ` + "0x" + strconv.FormatUint(MEMORY_SIZE, 16) + `
+#endif
+
+#ifndef LC_ECALL_BUFFER_ADDR
+#define LC_ECALL_BUFFER_ADDR 0x300000
+#endif
+
+static uint8_t lc_memory[LC_MEMORY_SIZE];
+
+static void lc_panic(void)
+{
+    fputs("PANIC\n", stderr);
+    exit(1);
+}
+
+static uint8_t *lc_addr(uint64_t addr, uint64_t n)
+{
+    if (addr > LC_MEMORY_SIZE || n > LC_MEMORY_SIZE - addr)
+        lc_panic();
+    return &lc_memory[addr];
+}
+
+static uint64_t lc_load(uint64_t addr, int n)
+{
+    uint8_t *p = lc_addr(addr, n);
+    uint64_t v = 0;
+    int i;
+    for (i = n - 1; i >= 0; i--)
+        v = (v << 8) | p[i];
+    return v;
+}
+
+static inline void lc_store(uint64_t addr, uint64_t v, int n)
+{
+    uint8_t *p = lc_addr(addr, n);
+    int i;
+    for (i = 0; i < n; i++) {
+        p[i] = (uint8_t)v;
+        v = v >> 8;
+    }
+}
+
+static inline void lc_store_string(uint64_t addr, const char *s, uint64_t n)
+{
+    memcpy(lc_addr(addr, n), s, n);
+}
+
+static void lc_ecall(void)
+{
+    uint64_t addr;
+    for (addr = LC_ECALL_BUFFER_ADDR; lc_load(addr, 1) != 0; addr++)
+        putchar(lc_memory[addr]);
+    putchar('\n');
+}
+
+typedef void (*lc_func)(void);
+`
+
+var cIntInfoList []IntInfo = []IntInfo{
+	{IsSigned: false, BytesCount: 1},
+	{IsSigned: false, BytesCount: 2},
+	{IsSigned: false, BytesCount: 4},
+	{IsSigned: false, BytesCount: 8},
+	{IsSigned: true, BytesCount: 1},
+	{IsSigned: true, BytesCount: 2},
+	{IsSigned: true, BytesCount: 4},
+	{IsSigned: true, BytesCount: 8},
+}
+
+var cFuncIndexList map[string]int
+
+func getCTypeString(i interface{}) string {
+	if _, ok := i.(VoidInfo); ok {
+		return "void"
+	}
+
+	ii := getIRIntInfo(i)
+
+	s := "int" + strconv.Itoa(ii.BytesCount*8) + "_t"
+	if !ii.IsSigned {
+		s = "u" + s
+	}
+
+	return s
+}
+
+func getCHexString(v uint64) string {
+	return "UINT64_C(0x" + strconv.FormatUint(v, 16) + ")"
+}
+
+// Integer constant expression for a case label
+func getCCaseValueString(ii IntInfo, v uint64) string {
+	if !ii.IsSigned {
+		return getCHexString(v & getIntInfoMask(ii))
+	}
+
+	sv := int64(getSignExtendedValue(ii, v))
+
+	if sv == -(1 << 63) {
+		return "(-INT64_C(9223372036854775807) - 1)"
+	}
+
+	return "INT64_C(" + strconv.FormatInt(sv, 10) + ")"
+}
+
+func getCStringLiteral(buf []byte) string {
+	s := "\""
+
+	for _, c := range buf {
+		if c >= 0x20 && c < 0x7f && c != '"' && c != '\\' && c != '?' {
+			s = s + string(rune(c))
+		} else {
+			o := strconv.FormatUint(uint64(c), 8)
+			s = s + "\\" + strings.Repeat("0", 3-len(o)) + o
+		}
+	}
+
+	return s + "\""
+}
+
+func getCFuncName(ident string) string {
+	if ident == "ecall" {
+		return "lc_ecall"
+	}
+
+	return "lc_f" + strconv.Itoa(cFuncIndexList[ident]) + "_" + strings.ReplaceAll(ident, ".", "_")
+}
+
+func getCFuncSigString(name string, sig FuncSigInfo, paramNameList []string) string {
+	var paramStringList []string
+
+	for i, p := range sig.ParamList {
+		if paramNameList != nil {
+			paramStringList = append(paramStringList, getCTypeString(p)+" "+paramNameList[i])
+		} else {
+			paramStringList = append(paramStringList, getCTypeString(p))
+		}
+	}
+
+	if len(paramStringList) == 0 {
+		paramStringList = append(paramStringList, "void")
+	}
+
+	return getCTypeString(sig.ReturnValueInfo) + " " + name + "(" +
+		strings.Join(paramStringList, ", ") + ")"
+}
+
+func writeCRuntimeIntHelpers(sb *strings.Builder) {
+	for _, ii := range cIntInfoList {
+		t := getCTypeString(ii)
+		n := getTypeStringFromIntInfo(ii)
+		bits := strconv.Itoa(ii.BytesCount * 8)
+		mask := getCHexString(getIntInfoMask(ii))
+
+		sb.WriteString("\nstatic inline " + t + " lc_" + n + "(uint64_t v)\n{\n")
+		if ii.IsSigned {
+			sb.WriteString("    v = v & " + mask + ";\n")
+			sb.WriteString("    if (v <= " + getCHexString(getIntInfoMask(ii)>>1) + ")\n")
+			sb.WriteString("        return (" + t + ")v;\n")
+			sb.WriteString("    return (" + t + ")(-(int64_t)(" + mask + " - v) - 1);\n}\n")
+		} else {
+			sb.WriteString("    return (" + t + ")v;\n}\n")
+		}
+
+		for _, op := range []string{"quo", "rem"} {
+			sb.WriteString("\nstatic inline " + t + " lc_" + op + "_" + n + "(" + t + " a, " + t + " b)\n{\n")
+			if ii.IsSigned {
+				sb.WriteString("    if (b == 0 || (a == INT" + bits + "_MIN && b == -1))\n")
+			} else {
+				sb.WriteString("    if (b == 0)\n")
+			}
+			sb.WriteString("        lc_panic();\n")
+			sb.WriteString("    return lc_" + n + "((uint64_t)(a " +
+				map[string]string{"quo": "/", "rem": "%"}[op] + " b));\n}\n")
+		}
+
+		sb.WriteString("\nstatic inline " + t + " lc_shl_" + n + "(" + t + " a, uint64_t n)\n{\n")
+		sb.WriteString("    if (n >= " + bits + ")\n        return 0;\n")
+		sb.WriteString("    return lc_" + n + "((uint64_t)a << n);\n}\n")
+
+		sb.WriteString("\nstatic inline " + t + " lc_shr_" + n + "(" + t + " a, uint64_t n)\n{\n")
+		if ii.IsSigned {
+			sb.WriteString("    if (n >= " + bits + ")\n        n = " + bits + " - 1;\n")
+			sb.WriteString("    if (a < 0)\n        return (" + t + ")~(~a >> n);\n")
+			sb.WriteString("    return (" + t + ")(a >> n);\n}\n")
+
+			sb.WriteString("\nstatic inline uint64_t lc_shift_" + n + "(" + t + " n)\n{\n")
+			sb.WriteString("    if (n < 0)\n        lc_panic();\n")
+			sb.WriteString("    return (uint64_t)n;\n}\n")
+		} else {
+			sb.WriteString("    if (n >= " + bits + ")\n        return 0;\n")
+			sb.WriteString("    return (" + t + ")(a >> n);\n}\n")
+		}
+	}
+}
+
+func writeCInstr(sb *strings.Builder, f IRFunc, blockIndex int, instr IRInstr) {
+	v := func(k int) string {
+		return "v" + strconv.Itoa(instr.ArgList[k])
+	}
+
+	argII := func(k int) IntInfo {
+		return getIRIntInfo(f.ValueTypeList[instr.ArgList[k]])
+	}
+
+	s := ""
+
+	if instr.Dest != -1 {
+		s = "v" + strconv.Itoa(instr.Dest) + " = "
+	}
+
+	var argStringList []string
+	for k := range instr.ArgList {
+		argStringList = append(argStringList, v(k))
+	}
+
+	switch instr.Op {
+	case IR_CONST:
+		s = s + "lc_" + getTypeStringFromIntInfo(getIRIntInfo(instr.Type)) + "(" +
+			getCHexString(instr.Value) + ")"
+	case IR_FUNC_ADDR:
+		s = s + getCHexString(uint64(cFuncIndexList[instr.Ident]))
+	case IR_LOAD_LOCAL:
+		s = s + "l" + strconv.Itoa(instr.Local)
+	case IR_STORE_LOCAL:
+		s = "l" + strconv.Itoa(instr.Local) + " = " + v(0)
+	case IR_BINARY:
+		ii := argII(0)
+		n := getTypeStringFromIntInfo(ii)
+
+		switch instr.BinaryOp {
+		case TT_ADD, TT_SUB, TT_MUL, TT_AND, TT_OR, TT_XOR:
+			s = s + "lc_" + n + "((uint64_t)" + v(0) + " " + map[TokenType]string{
+				TT_ADD: "+", TT_SUB: "-", TT_MUL: "*",
+				TT_AND: "&", TT_OR: "|", TT_XOR: "^"}[instr.BinaryOp] + " (uint64_t)" + v(1) + ")"
+		case TT_QUO, TT_REM:
+			s = s + "lc_" + IRBinaryOpNames[instr.BinaryOp] + "_" + n + "(" + v(0) + ", " + v(1) + ")"
+		case TT_SHL, TT_SHR:
+			amount := "(uint64_t)" + v(1)
+			if ii2 := argII(1); ii2.IsSigned {
+				amount = "lc_shift_" + getTypeStringFromIntInfo(ii2) + "(" + v(1) + ")"
+			}
+			s = s + "lc_" + IRBinaryOpNames[instr.BinaryOp] + "_" + n + "(" + v(0) + ", " + amount + ")"
+		case TT_EQL, TT_NEQ, TT_LSS, TT_GTR, TT_LEQ, TT_GEQ:
+			s = s + "(uint8_t)(" + v(0) + " " + map[TokenType]string{
+				TT_EQL: "==", TT_NEQ: "!=", TT_LSS: "<",
+				TT_GTR: ">", TT_LEQ: "<=", TT_GEQ: ">="}[instr.BinaryOp] + " " + v(1) + ")"
+		default:
+			PrintErrorAndExit(0)
+		}
+	case IR_CONVERT:
+		s = s + "lc_" + getTypeStringFromIntInfo(getIRIntInfo(instr.Type)) + "((uint64_t)" + v(0) + ")"
+	case IR_CALL:
+		s = s + getCFuncName(instr.Ident) + "(" + strings.Join(argStringList, ", ") + ")"
+	case IR_CALL_INDIRECT:
+		var paramTypeList []interface{}
+		for k := 0; k < len(instr.ArgList)-1; k++ {
+			paramTypeList = append(paramTypeList, f.ValueTypeList[instr.ArgList[k]])
+		}
+
+		sig := FuncSigInfo{ParamList: paramTypeList, ReturnValueInfo: instr.Type}
+
+		s = s + "((" + getCFuncSigString("(*)", sig, nil) + ")lc_get_func(" +
+			v(len(instr.ArgList)-1) + "))(" + strings.Join(argStringList[:len(argStringList)-1], ", ") + ")"
+	case IR_LOAD:
+		ii := getIRIntInfo(instr.Type)
+		s = s + "lc_" + getTypeStringFromIntInfo(ii) + "(lc_load(" + v(0) + ", " +
+			strconv.Itoa(ii.BytesCount) + "))"
+	case IR_STORE:
+		s = "lc_store(" + v(0) + ", (uint64_t)" + v(1) + ", " + strconv.Itoa(argII(1).BytesCount) + ")"
+	case IR_STORE_STRING:
+		s = "lc_store_string(" + v(0) + ", " + getCStringLiteral(instr.Buf) + ", " +
+			strconv.Itoa(len(instr.Buf)+1) + ")"
+	case IR_DISCARD:
+		s = "(void)" + v(0)
+	case IR_JUMP:
+		if instr.TargetList[0] == blockIndex+1 {
+			return
+		}
+		s = "goto b" + strconv.Itoa(instr.TargetList[0])
+	case IR_BRANCH:
+		sb.WriteString("    if (" + v(0) + " == 0)\n        goto b" + strconv.Itoa(instr.TargetList[1]) + ";\n")
+		if instr.TargetList[0] == blockIndex+1 {
+			return
+		}
+		s = "goto b" + strconv.Itoa(instr.TargetList[0])
+	case IR_SWITCH:
+		ii := argII(0)
+
+		sb.WriteString("    switch (" + v(0) + ") {\n")
+		for k, cv := range instr.CaseValueList {
+			sb.WriteString("    case " + getCCaseValueString(ii, cv) + ":\n        goto b" +
+				strconv.Itoa(instr.TargetList[k+1]) + ";\n")
+		}
+		sb.WriteString("    default:\n        goto b" + strconv.Itoa(instr.TargetList[0]) + ";\n    }\n")
+		return
+	case IR_RETURN:
+		s = "return"
+		if len(instr.ArgList) != 0 {
+			s = s + " " + v(0)
+		}
+	default:
+		PrintErrorAndExit(0)
+	}
+
+	sb.WriteString("    " + s + ";\n")
+}
+
+func writeCFunc(sb *strings.Builder, f IRFunc) {
+	var paramNameList []string
+	for i, local := range f.LocalList {
+		if local.IsParam {
+			paramNameList = append(paramNameList, "l"+strconv.Itoa(i))
+		}
+	}
+
+	sb.WriteString("\nstatic " + getCFuncSigString(getCFuncName(f.Ident), f.Sig, paramNameList) + "\n{\n")
+
+	// Locals that are never loaded and values that no instruction defines
+	// are not declared, so that the C compiler does not warn about them
+	isLoadedList := make([]bool, len(f.LocalList))
+	isDefinedList := make([]bool, len(f.ValueTypeList))
+	isTargetList := make([]bool, len(f.BlockList))
+
+	for i, b := range f.BlockList {
+		for _, instr := range b.InstrList {
+			if instr.Op == IR_LOAD_LOCAL {
+				isLoadedList[instr.Local] = true
+			}
+
+			if instr.Dest != -1 {
+				isDefinedList[instr.Dest] = true
+			}
+
+			for j, t := range instr.TargetList {
+				if (instr.Op == IR_JUMP || (instr.Op == IR_BRANCH && j == 0)) && t == i+1 {
+					continue
+				}
+				isTargetList[t] = true
+			}
+		}
+	}
+
+	for i, local := range f.LocalList {
+		if !local.IsParam && isLoadedList[i] {
+			sb.WriteString("    " + getCTypeString(local.Type) + " l" + strconv.Itoa(i) + " = 0;\n")
+		}
+	}
+
+	for i, t := range f.ValueTypeList {
+		if isDefinedList[i] {
+			sb.WriteString("    " + getCTypeString(t) + " v" + strconv.Itoa(i) + ";\n")
+		}
+	}
+
+	for i, b := range f.BlockList {
+		if isTargetList[i] {
+			sb.WriteString("b" + strconv.Itoa(i) + ":\n")
+		}
+
+		for _, instr := range b.InstrList {
+			if instr.Op == IR_STORE_LOCAL && !f.LocalList[instr.Local].IsParam && !isLoadedList[instr.Local] {
+				instr = IRInstr{Op: IR_DISCARD, Dest: -1, ArgList: instr.ArgList}
+			}
+			writeCInstr(sb, f, i, instr)
+		}
+	}
+
+	sb.WriteString("}\n")
+}
+
+func CGenerator(ir IRProgram) []byte {
+	sigInfo, ok := ir.FuncSigList["main"]
+
+	if (!ok) || (len(sigInfo.ParamList) != 0) {
+		PrintErrorAndExit(0)
+	}
+
+	if _, ok := sigInfo.ReturnValueInfo.(VoidInfo); !ok {
+		PrintErrorAndExit(0)
+	}
+
+	cFuncIndexList = make(map[string]int)
+	cFuncIndexList["ecall"] = 1
+
+	for i, f := range ir.FuncList {
+		cFuncIndexList[f.Ident] = i + 2
+	}
+
+	var sb strings.Builder
+
+	sb.WriteString(C_RUNTIME_HEAD)
+
+	writeCRuntimeIntHelpers(&sb)
+
+	sb.WriteString("\n")
+	for _, f := range ir.FuncList {
+		sb.WriteString("static " + getCFuncSigString(getCFuncName(f.Ident), f.Sig, nil) + ";\n")
+	}
+
+	sb.WriteString("\nstatic const lc_func lc_func_table[] = {\n    0,\n    (lc_func)lc_ecall,\n")
+	for _, f := range ir.FuncList {
+		sb.WriteString("    (lc_func)" + getCFuncName(f.Ident) + ",\n")
+	}
+	sb.WriteString("};\n")
+
+	sb.WriteString("\nstatic inline lc_func lc_get_func(uint64_t i)\n{\n")
+	sb.WriteString("    if (i == 0 || i >= sizeof(lc_func_table) / sizeof(lc_func_table[0]))\n")
+	sb.WriteString("        lc_panic();\n")
+	sb.WriteString("    return lc_func_table[i];\n}\n")
+
+	for _, f := range ir.FuncList {
+		writeCFunc(&sb, f)
+	}
+
+	sb.WriteString("\nint main(void)\n{\n    " + getCFuncName("main") + "();\n    return 0;\n}\n")
+
+	return []byte(sb.String())
+}
@@ -1,40 +1,724 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"io"
 	"os"
+	"path/filepath"
+	"runtime"
 	"strconv"
+	"strings"
+	"time"
 )
 
+var curSourceFilePath string
+
+var LITTLECOMPILER_VERSION = "0.1.0"
+
+const (
+	EXIT_COMPILE_ERROR = 1
+	EXIT_USAGE_ERROR   = 2
+	EXIT_IO_ERROR      = 3
+)
+
+// Servers compile in their own process, so errors are raised as a panic with
+// a CompileError instead of ending the process
+var isCompileErrorRecoverable = false
+
+type CompileError struct {
+	SourceFilePath string
+	Line           int
+	Msg            string
+}
+
+func raiseCompileError(sourceFilePath string, l int, msg string) {
+	if isCompileErrorRecoverable {
+		panic(CompileError{SourceFilePath: sourceFilePath, Line: l, Msg: msg})
+	}
+	fmt.Println(msg)
+	os.Exit(EXIT_COMPILE_ERROR)
+}
+
 func PrintErrorAndExit(l int) {
 	s := "Compilation error"
 	if l != 0 {
-		s = s + " " + "(" + "line" + " " + strconv.FormatInt(int64(l), 10) + ")"
+		if curSourceFilePath != "" {
+			s = s + " " + "(" + curSourceFilePath + " " + "line" + " " + strconv.FormatInt(int64(l), 10) + ")"
+		} else {
+			s = s + " " + "(" + "line" + " " + strconv.FormatInt(int64(l), 10) + ")"
+		}
 	}
-	fmt.Println(s)
-	os.Exit(1)
+	raiseCompileError(curSourceFilePath, l, s)
 }
 
-func main() {
-	sourceCodeFilePath := os.Args[1]
-	bytecodeFilePath := os.Args[2]
+var isWarningErrorEnabled = false
+
+// Warnings of a recoverable compilation are kept instead of printed, so that
+// servers do not write them into their protocol stream
+var warningList []CompileError
+
+func PrintWarning(l int, msg string) {
+	s := "Warning"
+	if l != 0 {
+		if curSourceFilePath != "" {
+			s = s + " " + "(" + curSourceFilePath + " " + "line" + " " + strconv.FormatInt(int64(l), 10) + ")"
+		} else {
+			s = s + " " + "(" + "line" + " " + strconv.FormatInt(int64(l), 10) + ")"
+		}
+	}
+	s = s + ":" + " " + msg
 
-	data, err := os.ReadFile(sourceCodeFilePath)
+	if isWarningErrorEnabled {
+		raiseCompileError(curSourceFilePath, l, s)
+	}
+
+	if isCompileErrorRecoverable {
+		warningList = append(warningList, CompileError{SourceFilePath: curSourceFilePath, Line: l, Msg: msg})
+		return
+	}
+
+	fmt.Fprintln(os.Stderr, s)
+}
+
+func PrintIOErrorAndExit(err error) {
+	fmt.Fprintln(os.Stderr, "I/O error"+" "+"("+err.Error()+")")
+	os.Exit(EXIT_IO_ERROR)
+}
+
+var stdinData []byte
+var isStdinRead bool
+
+// Sources that only exist in memory, like the programs of the REPL
+var memorySourceFileList = make(map[string][]byte)
+
+// A path of - reads standard input, which is read only once
+func readSourceFile(sourceFilePath string) ([]byte, error) {
+	if data, ok := memorySourceFileList[sourceFilePath]; ok {
+		return data, nil
+	}
+
+	if sourceFilePath != "-" {
+		return os.ReadFile(sourceFilePath)
+	}
+
+	if !isStdinRead {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, err
+		}
+		stdinData = data
+		isStdinRead = true
+	}
+
+	return stdinData, nil
+}
+
+// A path of - writes to standard output
+func writeOutputFile(outputFilePath string, data []byte, perm os.FileMode) {
+	var err error
+
+	if outputFilePath == "-" {
+		_, err = os.Stdout.Write(data)
+	} else {
+		err = os.WriteFile(outputFilePath, data, perm)
+	}
 
 	if err != nil {
-		log.Fatal(err)
+		PrintIOErrorAndExit(err)
 	}
+}
+
+func linkObjectFiles(bytecodeFilePath string, objectFilePathList []string) {
+	var ofs []ObjectFile
+
+	for _, objectFilePath := range objectFilePathList {
+		data, err := readSourceFile(objectFilePath)
 
-	toks := LexicalAnalyzer(append(data, 0x0a))
+		if err != nil {
+			PrintIOErrorAndExit(err)
+		}
 
-	tn := SyntaxAnalyzer(toks)
+		of, ok := DecodeObjectFile(data)
+		if !ok {
+			PrintLinkErrorAndExit("invalid object file " + objectFilePath)
+		}
+
+		ofs = append(ofs, of)
+	}
+
+	writeOutputFile(bytecodeFilePath, Linker(ofs), 0666)
+}
+
+func compileObjectFile(sourceCodeFilePath string, objectFilePath string) {
+	moduleName, tn, externFuncListTreeNode := ObjectModuleLoader(sourceCodeFilePath)
+
+	var exportedFuncIdentList []string
+	for _, funcTreeNode := range tn.Children[0].Children {
+		exportedFuncIdentList = append(exportedFuncIdentList, string(funcTreeNode.Children[0].Tok.Buf))
+	}
 
-	// PrintTreeNode(tn, 4)
+	of := ObjectGenerator(compileTree(tn, externFuncListTreeNode, exportedFuncIdentList))
+	of.ModuleName = moduleName
 
-	bytecode := BytecodeGenerator(tn)
+	writeOutputFile(objectFilePath, EncodeObjectFile(of), 0666)
+}
+
+// Runs the passes that report errors and warnings, without generating any
+// code past what the warnings need. check and the language server stop
+// here.
+func checkTree(tn TreeNode, externFuncListTreeNode TreeNode, exportedFuncIdentList []string) TreeNode {
+	tn = ConstantFolder(tn)
+
+	tn = SemanticAnalyzer(tn, externFuncListTreeNode)
+
+	// Warnings are given for code the dead code eliminator removes too
+	WarningAnalyzer(IRGenerator(tn), getReachableFuncIdentList(tn.Children[0], exportedFuncIdentList))
+
+	FlowAnalyzer(tn)
+
+	return tn
+}
+
+func checkSourceFile(sourceCodeFilePath string) TreeNode {
+	return checkTree(ModuleLoader(sourceCodeFilePath), TreeNode{Kype: TNT_FUNC_LIST}, []string{"main"})
+}
+
+func compileTree(tn TreeNode, externFuncListTreeNode TreeNode, exportedFuncIdentList []string) IRProgram {
+	tn = checkTree(tn, externFuncListTreeNode, exportedFuncIdentList)
+
+	tn = DeadCodeEliminator(tn, exportedFuncIdentList)
+
+	ir := IRGenerator(tn)
+
+	if isTailCallEliminatorEnabled {
+		ir = TailCallEliminator(ir, exportedFuncIdentList)
+	}
+
+	if isInlinerEnabled {
+		ir = InlineExpander(ir, exportedFuncIdentList)
+	}
+
+	IRVerifier(ir)
+
+	return ir
+}
+
+func compileSourceFile(sourceCodeFilePath string) IRProgram {
+	return compileTree(ModuleLoader(sourceCodeFilePath), TreeNode{Kype: TNT_FUNC_LIST}, []string{"main"})
+}
+
+// Runs f and returns the first compilation error it raises instead of
+// exiting
+func catchCompileError(f func()) (ce CompileError, ok bool) {
+	isCompileErrorRecoverable = true
+	warningList = nil
+
+	defer func() {
+		isCompileErrorRecoverable = false
+
+		if r := recover(); r != nil {
+			var isCompileError bool
+			if ce, isCompileError = r.(CompileError); !isCompileError {
+				panic(r)
+			}
+			ok = false
+		}
+	}()
+
+	f()
+
+	return CompileError{}, true
+}
+
+func compileSourceFileOrError(sourceCodeFilePath string) (ir IRProgram, ce CompileError, ok bool) {
+	ce, ok = catchCompileError(func() {
+		ir = compileSourceFile(sourceCodeFilePath)
+	})
+	return ir, ce, ok
+}
+
+func runProgram(ir IRProgram, target string) {
+	w := bufio.NewWriter(os.Stdout)
+
+	var msg string
+
+	if target == "regvm" {
+		msg, _ = RunRegisterBytecode(RegisterGenerator(ir), w)
+	} else {
+		msg, _ = RunBytecode(BytecodeGenerator(ir), w)
+	}
+
+	w.Flush()
+
+	if msg != "" {
+		fmt.Fprintln(os.Stderr, msg)
+		os.Exit(1)
+	}
+}
+
+var BENCH_MIN_RUNS_COUNT = 5
+var BENCH_MIN_DURATION = 500 * time.Millisecond
+
+func benchmarkProgram(ir IRProgram) {
+	type BenchResult struct {
+		Name       string
+		Code       []byte
+		Output     []byte
+		Msg        string
+		InstrCount uint64
+		Duration   time.Duration
+	}
+
+	resultList := []BenchResult{
+		{Name: "stack bytecode", Code: BytecodeGenerator(ir)},
+		{Name: "register bytecode", Code: RegisterGenerator(ir)},
+	}
+
+	// Every program is run until it has taken long enough in total, and the
+	// fastest run counts
+	for i := range resultList {
+		var totalDuration time.Duration
+
+		for j := 0; j < BENCH_MIN_RUNS_COUNT || totalDuration < BENCH_MIN_DURATION; j++ {
+			var output bytes.Buffer
+			var msg string
+			var instrCount uint64
+
+			runtime.GC()
+
+			start := time.Now()
+
+			if i == 0 {
+				msg, instrCount = RunBytecode(resultList[i].Code, &output)
+			} else {
+				msg, instrCount = RunRegisterBytecode(resultList[i].Code, &output)
+			}
+
+			d := time.Since(start)
+			totalDuration = totalDuration + d
+
+			if j == 0 || d < resultList[i].Duration {
+				resultList[i].Duration = d
+			}
+
+			resultList[i].Output = output.Bytes()
+			resultList[i].Msg = msg
+			resultList[i].InstrCount = instrCount
+		}
+	}
+
+	if !bytes.Equal(resultList[0].Output, resultList[1].Output) || resultList[0].Msg != resultList[1].Msg {
+		fmt.Println("Benchmark error (the VMs produced different results)")
+		os.Exit(1)
+	}
+
+	for _, r := range resultList {
+		fmt.Printf("%-18s %8d bytes %12d instructions %10.3f ms\n", r.Name, len(r.Code),
+			r.InstrCount, float64(r.Duration.Microseconds())/1000)
+	}
+
+	fmt.Printf("speedup %.2fx\n", float64(resultList[0].Duration)/float64(resultList[1].Duration))
+}
+
+var USAGE_TEXT = `usage: littlecompiler COMMAND [FLAGS] [ARGS]
+
+commands:
+  build FILE        compile a source file into bytecode or another target
+  run FILE          compile a source file and run it on the built-in VM
+  check FILE...     report compilation errors without writing any output
+  disasm FILE       print the stack bytecode of a source file
+  fmt FILE...       format source files in place
+  link OBJECT...    link object files into a bytecode file
+  bench FILE        time a source file on the stack and register VMs
+  debug FILE        debug a source file on the stack VM
+  dump FILE         print the tokens or the syntax tree of a source file
+  dap               serve the Debug Adapter Protocol on standard input and output
+  lsp               serve the Language Server Protocol on standard input and output
+  repl              run statements and function definitions as they are entered
+  version           print the version
+  help [COMMAND]    print this help or the flags of a command
+
+A FILE of - is read from standard input.`
+
+type CLICommand struct {
+	ArgsUsage string
+	Summary   string
+	Run       func(fs *flag.FlagSet, args []string) bool
+}
+
+var cliCommandList = map[string]CLICommand{
+	"build":  {"FILE", "Compiles a source file into bytecode or another target.", runBuildCommand},
+	"run":    {"FILE", "Compiles a source file and runs it on the built-in VM.", runRunCommand},
+	"check":  {"FILE...", "Compiles source files and reports the first compilation error.", runCheckCommand},
+	"disasm": {"FILE", "Compiles a source file and prints its stack bytecode.", runDisasmCommand},
+	"fmt":    {"FILE...", "Formats source files in place.", runFmtCommand},
+	"link":   {"OBJECT...", "Links object files into a bytecode file. The first one must provide main.", runLinkCommand},
+	"bench":  {"FILE", "Times a source file on the stack and register VMs.", runBenchCommand},
+	"debug":  {"FILE", "Debugs a source file on the stack VM with commands read from standard input.", runDebugCommand},
+	"dump":   {"FILE", "Prints the tokens or the syntax tree of a source file.", runDumpCommand},
+	"dap":    {"", "Serves the Debug Adapter Protocol on standard input and output.", runDAPCommand},
+	"lsp":    {"", "Serves the Language Server Protocol on standard input and output.", runLSPCommand},
+	"repl":   {"", "Reads statements and function definitions from standard input and runs them.", runREPLCommand},
+}
+
+var BUILD_TARGET_EXTENSIONS = map[string]string{
+	"bytecode": ".bc",
+	"regvm":    ".rbc",
+	"x86-64":   ".out",
+	"c":        ".c",
+	"wasm":     ".wasm",
+}
+
+// The output is written to the current directory and named after the input,
+// or a when the input is standard input
+func getDefaultOutputFilePath(inputFilePath string, ext string) string {
+	if inputFilePath == "-" {
+		return "a" + ext
+	}
+
+	base := filepath.Base(inputFilePath)
+	return strings.TrimSuffix(base, filepath.Ext(base)) + ext
+}
+
+func getNegatedBoolFlagFunc(p *bool) func(string) error {
+	return func(s string) error {
+		v, err := strconv.ParseBool(s)
+		*p = !v
+		return err
+	}
+}
+
+func addCompileFlags(fs *flag.FlagSet) {
+	addDebugCompileFlags(fs)
+	fs.BoolFunc("no-inline", "disable function inlining", getNegatedBoolFlagFunc(&isInlinerEnabled))
+	fs.BoolFunc("no-tail-calls", "disable tail call elimination", getNegatedBoolFlagFunc(&isTailCallEliminatorEnabled))
+}
+
+// The debugger keeps every call, so it has no flags for the inliner and the
+// tail call eliminator
+func addDebugCompileFlags(fs *flag.FlagSet) {
+	fs.BoolFunc("no-peephole", "disable the peephole optimizer", getNegatedBoolFlagFunc(&isPeepholeOptimizerEnabled))
+	fs.BoolFunc("Wno-unreachable-code", "do not warn about statements after a return, break or continue", getNegatedBoolFlagFunc(&isUnreachableCodeWarningEnabled))
+	fs.BoolFunc("Wno-unused-variable", "do not warn about unused variables", getNegatedBoolFlagFunc(&isUnusedVariableWarningEnabled))
+	fs.BoolFunc("Wno-unused-parameter", "do not warn about unused parameters", getNegatedBoolFlagFunc(&isUnusedParameterWarningEnabled))
+	fs.BoolFunc("Wno-unused-function", "do not warn about unused functions", getNegatedBoolFlagFunc(&isUnusedFunctionWarningEnabled))
+	fs.BoolFunc("Wno-dead-store", "do not warn about assigned values that are never read", getNegatedBoolFlagFunc(&isDeadStoreWarningEnabled))
+	fs.BoolVar(&isWarningErrorEnabled, "Werror", false, "treat warnings as errors")
+}
+
+// Flags may come before or after the other arguments, unless they follow --
+func parseCLIFlags(fs *flag.FlagSet, args []string) []string {
+	var argList []string
+
+	for {
+		if err := fs.Parse(args); err != nil {
+			if err == flag.ErrHelp {
+				os.Exit(0)
+			}
+			os.Exit(EXIT_USAGE_ERROR)
+		}
+
+		restArgs := fs.Args()
+		if len(restArgs) == 0 {
+			return argList
+		}
+
+		if i := len(args) - len(restArgs) - 1; i >= 0 && args[i] == "--" {
+			return append(argList, restArgs...)
+		}
+
+		argList = append(argList, restArgs[0])
+		args = restArgs[1:]
+	}
+}
+
+// Unknown targets are rejected while the flags are parsed
+func addTargetFlag(fs *flag.FlagSet, usage string, targetList ...string) *string {
+	target := targetList[0]
+
+	fs.Func("target", usage+" (default "+target+")", func(s string) error {
+		for _, t := range targetList {
+			if s == t {
+				target = s
+				return nil
+			}
+		}
+		return errors.New("unknown target")
+	})
+
+	return &target
+}
+
+func runBuildCommand(fs *flag.FlagSet, args []string) bool {
+	addCompileFlags(fs)
+	outputFilePath := fs.String("o", "", "write the output to `PATH`, - for standard output (default: the name of FILE with the extension of the output format)")
+	target := addTargetFlag(fs, "output `FORMAT`: bytecode, regvm, x86-64, c or wasm",
+		"bytecode", "regvm", "x86-64", "c", "wasm")
+	isEmitIR := fs.Bool("emit-ir", false, "write the intermediate representation instead of bytecode")
+	isCompileOnly := fs.Bool("c", false, "compile into a relocatable object file")
+
+	args = parseCLIFlags(fs, args)
+
+	ext, ok := BUILD_TARGET_EXTENSIONS[*target]
+	if len(args) != 1 || !ok || ((*isEmitIR || *isCompileOnly) && *target != "bytecode") ||
+		(*isEmitIR && *isCompileOnly) {
+		return false
+	}
+
+	if *isEmitIR {
+		ext = ".ir"
+	} else if *isCompileOnly {
+		ext = ".o"
+	}
+
+	if *outputFilePath == "" {
+		*outputFilePath = getDefaultOutputFilePath(args[0], ext)
+	}
+
+	if *isCompileOnly {
+		compileObjectFile(args[0], *outputFilePath)
+		return true
+	}
+
+	ir := compileSourceFile(args[0])
+
+	if *isEmitIR {
+		writeOutputFile(*outputFilePath, []byte(FormatIR(ir)), 0666)
+		return true
+	}
+
+	switch *target {
+	case "regvm":
+		writeOutputFile(*outputFilePath, RegisterGenerator(ir), 0666)
+	case "x86-64":
+		writeOutputFile(*outputFilePath, ElfGenerator(ir), 0777)
+	case "c":
+		writeOutputFile(*outputFilePath, CGenerator(ir), 0666)
+	case "wasm":
+		module := WasmGenerator(ir)
+
+		WasmValidator(module)
+
+		writeOutputFile(*outputFilePath, module, 0666)
+	default:
+		writeOutputFile(*outputFilePath, BytecodeGenerator(ir), 0666)
+	}
+
+	return true
+}
+
+func runRunCommand(fs *flag.FlagSet, args []string) bool {
+	addCompileFlags(fs)
+	target := addTargetFlag(fs, "`VM` to run on: bytecode or regvm", "bytecode", "regvm")
+
+	args = parseCLIFlags(fs, args)
+
+	if len(args) != 1 {
+		return false
+	}
+
+	runProgram(compileSourceFile(args[0]), *target)
+	return true
+}
+
+func runCheckCommand(fs *flag.FlagSet, args []string) bool {
+	addCompileFlags(fs)
+
+	args = parseCLIFlags(fs, args)
+
+	if len(args) == 0 {
+		return false
+	}
+
+	for _, sourceCodeFilePath := range args {
+		checkSourceFile(sourceCodeFilePath)
+	}
+	return true
+}
+
+func runDisasmCommand(fs *flag.FlagSet, args []string) bool {
+	addCompileFlags(fs)
+	outputFilePath := fs.String("o", "-", "write the listing to `PATH`")
+
+	args = parseCLIFlags(fs, args)
+
+	if len(args) != 1 {
+		return false
+	}
+
+	writeOutputFile(*outputFilePath, []byte(Disassembler(compileSourceFile(args[0]))), 0666)
+	return true
+}
+
+func runFmtCommand(fs *flag.FlagSet, args []string) bool {
+	isCheck := fs.Bool("check", false, "list the files that are not formatted and fail if there are any")
+
+	args = parseCLIFlags(fs, args)
+
+	if len(args) == 0 {
+		return false
+	}
+
+	formatSourceFiles(args, *isCheck)
+	return true
+}
+
+func runLinkCommand(fs *flag.FlagSet, args []string) bool {
+	outputFilePath := fs.String("o", "", "write the bytecode to `PATH`, - for standard output (default: the name of the first object file with .bc)")
+
+	args = parseCLIFlags(fs, args)
+
+	if len(args) == 0 {
+		return false
+	}
+
+	if *outputFilePath == "" {
+		*outputFilePath = getDefaultOutputFilePath(args[0], ".bc")
+	}
+
+	linkObjectFiles(*outputFilePath, args)
+	return true
+}
+
+func runBenchCommand(fs *flag.FlagSet, args []string) bool {
+	addCompileFlags(fs)
+
+	args = parseCLIFlags(fs, args)
+
+	if len(args) != 1 {
+		return false
+	}
+
+	benchmarkProgram(compileSourceFile(args[0]))
+	return true
+}
+
+func runDebugCommand(fs *flag.FlagSet, args []string) bool {
+	addDebugCompileFlags(fs)
+
+	args = parseCLIFlags(fs, args)
+
+	// Debugger commands are read from standard input
+	if len(args) != 1 || args[0] == "-" {
+		return false
+	}
+
+	// Every call keeps its frame, so that the stack matches the source
+	isInlinerEnabled = false
+	isTailCallEliminatorEnabled = false
+
+	Debugger(compileSourceFile(args[0]), os.Stdin, os.Stdout)
+	return true
+}
+
+func runDumpCommand(fs *flag.FlagSet, args []string) bool {
+	format := fs.String("format", "ast", "what to print: tokens, ast or ast-json")
+
+	args = parseCLIFlags(fs, args)
+
+	if len(args) != 1 || (*format != "tokens" && *format != "ast" && *format != "ast-json") {
+		return false
+	}
+
+	dumpSourceFile(args[0], *format, os.Stdout)
+	return true
+}
+
+func runDAPCommand(fs *flag.FlagSet, args []string) bool {
+	if len(parseCLIFlags(fs, args)) != 0 {
+		return false
+	}
+
+	DAPServer(os.Stdin, os.Stdout)
+	return true
+}
+
+func runLSPCommand(fs *flag.FlagSet, args []string) bool {
+	if len(parseCLIFlags(fs, args)) != 0 {
+		return false
+	}
+
+	LSPServer(os.Stdin, os.Stdout)
+	return true
+}
+
+func runREPLCommand(fs *flag.FlagSet, args []string) bool {
+	if len(parseCLIFlags(fs, args)) != 0 {
+		return false
+	}
+
+	REPL(os.Stdin, os.Stdout)
+	return true
+}
+
+func printCLICommandUsage(name string, fs *flag.FlagSet) {
+	cmd := cliCommandList[name]
+	w := fs.Output()
+
+	fmt.Fprintln(w, strings.TrimRight("usage: littlecompiler "+name+" [FLAGS] "+cmd.ArgsUsage, " "))
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, cmd.Summary)
+
+	hasFlags := false
+	fs.VisitAll(func(*flag.Flag) { hasFlags = true })
+
+	if hasFlags {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "flags:")
+		fs.PrintDefaults()
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, USAGE_TEXT)
+		os.Exit(EXIT_USAGE_ERROR)
+	}
+
+	name, args := os.Args[1], os.Args[2:]
+	isHelp := false
+
+	switch name {
+	case "help", "-h", "-help", "--help":
+		if len(args) == 0 {
+			fmt.Println(USAGE_TEXT)
+			return
+		}
+		if len(args) != 1 {
+			fmt.Fprintln(os.Stderr, USAGE_TEXT)
+			os.Exit(EXIT_USAGE_ERROR)
+		}
+		name, args = args[0], []string{"-h"}
+		isHelp = true
+	case "version", "-version", "--version":
+		if len(args) != 0 {
+			fmt.Fprintln(os.Stderr, USAGE_TEXT)
+			os.Exit(EXIT_USAGE_ERROR)
+		}
+		fmt.Println("littlecompiler" + " " + LITTLECOMPILER_VERSION)
+		return
+	}
+
+	cmd, ok := cliCommandList[name]
+	if !ok {
+		fmt.Fprintln(os.Stderr, "unknown command"+" "+name)
+		fmt.Fprintln(os.Stderr, USAGE_TEXT)
+		os.Exit(EXIT_USAGE_ERROR)
+	}
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() { printCLICommandUsage(name, fs) }
+
+	if isHelp {
+		fs.SetOutput(os.Stdout)
+	}
 
-	if err := os.WriteFile(bytecodeFilePath, bytecode, 0666); err != nil {
-		log.Fatal(err)
+	if !cmd.Run(fs, args) {
+		fs.Usage()
+		os.Exit(EXIT_USAGE_ERROR)
 	}
 }
@@ -0,0 +1,231 @@
+package main
+
+import "strconv"
+
+func getConstTreeNodeValue(tn TreeNode) (IntInfo, uint64, bool) {
+	var wrapperTreeNode TreeNode
+	wrapperTreeNode.Kype = TNT_EXPR
+	wrapperTreeNode.Children = append(wrapperTreeNode.Children, tn)
+
+	return getConstExprValue(wrapperTreeNode)
+}
+
+func newConstTreeNode(ii IntInfo, v uint64, tok TokenData) TreeNode {
+	v = getSignExtendedValue(ii, v)
+
+	var litTreeNode TreeNode
+	litTreeNode.Tok = tok
+	litTreeNode.Tok.Kype = TT_INT
+
+	if ii.IsSigned && int64(v) < 0 {
+		litTreeNode.Kype = TNT_EXPR_NEG_INT_LIT
+		litTreeNode.Tok.Buf = []byte(strconv.FormatUint((^v)+1, 10))
+	} else {
+		litTreeNode.Kype = TNT_EXPR_INT_LIT
+		litTreeNode.Tok.Buf = []byte(strconv.FormatUint(v, 10))
+	}
+
+	var exprFuncParmTreeNode TreeNode
+	exprFuncParmTreeNode.Kype = TNT_EXPR_FUNC_PARM
+	exprFuncParmTreeNode.Children = append(exprFuncParmTreeNode.Children, litTreeNode)
+
+	var exprFuncParmListTreeNode TreeNode
+	exprFuncParmListTreeNode.Kype = TNT_EXPR_FUNC_PARM_LIST
+	exprFuncParmListTreeNode.Children = append(exprFuncParmListTreeNode.Children,
+		exprFuncParmTreeNode)
+
+	var tn TreeNode
+	tn.Kype = TNT_EXPR_FUNC
+	tn.Tok = tok
+	tn.Tok.Kype = TT_IDENT
+	tn.Tok.Buf = []byte(getTypeStringFromIntInfo(ii))
+	tn.Children = append(tn.Children, exprFuncParmListTreeNode)
+
+	return tn
+}
+
+func printConstantFolderErrorAndExit(tok TokenData) {
+	curSourceFilePath = tok.SourceFilePath
+	PrintErrorAndExit(tok.LineNumber)
+}
+
+func foldShift(tok TokenData, ii IntInfo, v uint64, amountII IntInfo, amount uint64) uint64 {
+	amount = getSignExtendedValue(amountII, amount)
+
+	if amountII.IsSigned && int64(amount) < 0 {
+		printConstantFolderErrorAndExit(tok)
+	}
+
+	v = getSignExtendedValue(ii, v)
+
+	if amount >= uint64(ii.BytesCount*8) {
+		if tok.Kype == TT_SHR && ii.IsSigned && int64(v) < 0 {
+			return ^uint64(0)
+		}
+		return 0
+	}
+
+	if tok.Kype == TT_SHL {
+		return v << amount
+	} else if ii.IsSigned {
+		return uint64(int64(v) >> amount)
+	} else {
+		return v >> amount
+	}
+}
+
+func foldDivision(tok TokenData, ii IntInfo, a uint64, b uint64) uint64 {
+	a = getSignExtendedValue(ii, a)
+	b = getSignExtendedValue(ii, b)
+
+	if b == 0 {
+		printConstantFolderErrorAndExit(tok)
+	}
+
+	if ii.IsSigned {
+		minValue := getSignExtendedValue(ii, uint64(1)<<((ii.BytesCount*8)-1))
+
+		if (a == minValue) && (int64(b) == -1) {
+			printConstantFolderErrorAndExit(tok)
+		}
+
+		if tok.Kype == TT_QUO {
+			return uint64(int64(a) / int64(b))
+		}
+		return uint64(int64(a) % int64(b))
+	}
+
+	if tok.Kype == TT_QUO {
+		return a / b
+	}
+	return a % b
+}
+
+func foldComparison(tokType TokenType, ii IntInfo, a uint64, b uint64) bool {
+	a = getSignExtendedValue(ii, a)
+	b = getSignExtendedValue(ii, b)
+
+	if ii.IsSigned {
+		return map[TokenType]bool{
+			TT_EQL: int64(a) == int64(b),
+			TT_NEQ: int64(a) != int64(b),
+			TT_LSS: int64(a) < int64(b),
+			TT_GTR: int64(a) > int64(b),
+			TT_LEQ: int64(a) <= int64(b),
+			TT_GEQ: int64(a) >= int64(b),
+		}[tokType]
+	}
+
+	return map[TokenType]bool{
+		TT_EQL: a == b,
+		TT_NEQ: a != b,
+		TT_LSS: a < b,
+		TT_GTR: a > b,
+		TT_LEQ: a <= b,
+		TT_GEQ: a >= b,
+	}[tokType]
+}
+
+func foldExprBinary(tn TreeNode) TreeNode {
+	ii1, v1, ok1 := getConstTreeNodeValue(tn.Children[0])
+	ii2, v2, ok2 := getConstTreeNodeValue(tn.Children[1])
+
+	if !ok1 || !ok2 {
+		return tn
+	}
+
+	boolII := IntInfo{IsSigned: false, BytesCount: 1}
+
+	boolValue := func(b bool) uint64 {
+		if b {
+			return 1
+		}
+		return 0
+	}
+
+	switch tn.Tok.Kype {
+	case TT_LAND:
+		return newConstTreeNode(boolII, boolValue((v1 != 0) && (v2 != 0)), tn.Tok)
+	case TT_LOR:
+		return newConstTreeNode(boolII, boolValue((v1 != 0) || (v2 != 0)), tn.Tok)
+	case TT_SHL, TT_SHR:
+		return newConstTreeNode(ii1, foldShift(tn.Tok, ii1, v1, ii2, v2), tn.Tok)
+	}
+
+	if ii1 != ii2 {
+		return tn
+	}
+
+	switch tn.Tok.Kype {
+	case TT_ADD:
+		return newConstTreeNode(ii1, v1+v2, tn.Tok)
+	case TT_SUB:
+		return newConstTreeNode(ii1, v1-v2, tn.Tok)
+	case TT_MUL:
+		return newConstTreeNode(ii1, v1*v2, tn.Tok)
+	case TT_QUO, TT_REM:
+		return newConstTreeNode(ii1, foldDivision(tn.Tok, ii1, v1, v2), tn.Tok)
+	case TT_AND:
+		return newConstTreeNode(ii1, v1&v2, tn.Tok)
+	case TT_OR:
+		return newConstTreeNode(ii1, v1|v2, tn.Tok)
+	case TT_XOR:
+		return newConstTreeNode(ii1, v1^v2, tn.Tok)
+	case TT_EQL, TT_NEQ, TT_LSS, TT_GTR, TT_LEQ, TT_GEQ:
+		return newConstTreeNode(boolII, boolValue(foldComparison(tn.Tok.Kype, ii1, v1, v2)), tn.Tok)
+	}
+
+	return tn
+}
+
+func foldExprFunc(tn TreeNode) TreeNode {
+	ii, ok := getIntInfoFromTypeString(string(tn.Tok.Buf))
+	if !ok {
+		return tn
+	}
+
+	exprFuncParmListTreeNode := tn.Children[0]
+
+	if len(exprFuncParmListTreeNode.Children) != 1 {
+		return tn
+	}
+
+	exprTreeNode := exprFuncParmListTreeNode.Children[0].Children[0]
+
+	if exprTreeNode.Kype != TNT_EXPR {
+		return tn
+	}
+
+	if srcII, v, ok := getConstExprValue(exprTreeNode); ok {
+		return newConstTreeNode(ii, getSignExtendedValue(srcII, v), tn.Tok)
+	}
+
+	return tn
+}
+
+func foldTreeNode(tn TreeNode) TreeNode {
+	if tn.Kype == TNT_FUNC {
+		curSourceFilePath = tn.Children[0].Tok.SourceFilePath
+	}
+
+	for i := range tn.Children {
+		tn.Children[i] = foldTreeNode(tn.Children[i])
+	}
+
+	switch tn.Kype {
+	case TNT_EXPR_BINARY:
+		return foldExprBinary(tn)
+	case TNT_EXPR_FUNC:
+		return foldExprFunc(tn)
+	}
+
+	return tn
+}
+
+func ConstantFolder(tn TreeNode) TreeNode {
+	tn = foldTreeNode(tn)
+
+	curSourceFilePath = ""
+
+	return tn
+}
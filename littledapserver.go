@@ -0,0 +1,527 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+type DAPMessage struct {
+	Seq       int             `json:"seq"`
+	Type      string          `json:"type"`
+	Command   string          `json:"command"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+type DAPSource struct {
+	Name string `json:"name,omitempty"`
+	Path string `json:"path,omitempty"`
+}
+
+type DAPLaunchArguments struct {
+	Program     string `json:"program"`
+	StopOnEntry bool   `json:"stopOnEntry"`
+}
+
+type DAPSetBreakpointsArguments struct {
+	Source      DAPSource `json:"source"`
+	Breakpoints []struct {
+		Line int `json:"line"`
+	} `json:"breakpoints"`
+}
+
+type DAPSetFunctionBreakpointsArguments struct {
+	Breakpoints []struct {
+		Name string `json:"name"`
+	} `json:"breakpoints"`
+}
+
+type DAPFrameArguments struct {
+	FrameID            int    `json:"frameId"`
+	VariablesReference int    `json:"variablesReference"`
+	Expression         string `json:"expression"`
+}
+
+var dapWriter io.Writer
+var dapSeq int
+
+// Program output is collected while the program runs and sent as output
+// events between the slices it runs in and when it stops
+var dapOutput bytes.Buffer
+
+// Requests are read while the program runs. Those that need the program to
+// be stopped wait in dapPendingRequestList.
+var dapRequestChan chan DAPMessage
+var dapPendingRequestList []DAPMessage
+
+// Set when a request interrupts the running program, to "pause" or
+// "terminate"
+var dapInterruptReason string
+var isDAPDisconnected bool
+
+// Breakpoints are replaced per source file and for all functions at once
+var dapBreakpointIDList map[string][]int
+
+var isDAPLaunched bool
+var isDAPStopOnEntry bool
+
+func sendDAPMessage(m map[string]interface{}) {
+	dapSeq++
+	m["seq"] = dapSeq
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		panic(err)
+	}
+
+	writeContentLengthMessage(dapWriter, b)
+}
+
+func sendDAPResponse(req DAPMessage, body interface{}) {
+	m := map[string]interface{}{"type": "response", "request_seq": req.Seq, "command": req.Command,
+		"success": true}
+	if body != nil {
+		m["body"] = body
+	}
+	sendDAPMessage(m)
+}
+
+func sendDAPErrorResponse(req DAPMessage, msg string) {
+	sendDAPMessage(map[string]interface{}{"type": "response", "request_seq": req.Seq,
+		"command": req.Command, "success": false, "message": msg})
+}
+
+func sendDAPEvent(event string, body interface{}) {
+	m := map[string]interface{}{"type": "event", "event": event}
+	if body != nil {
+		m["body"] = body
+	}
+	sendDAPMessage(m)
+}
+
+// Both servers frame their messages with a Content-Length header, which
+// ends with an empty line
+func readContentLengthMessage(r *bufio.Reader) ([]byte, bool) {
+	contentLength := -1
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, false
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+
+		if v, ok := strings.CutPrefix(line, "Content-Length:"); ok {
+			if contentLength, err = strconv.Atoi(strings.TrimSpace(v)); err != nil {
+				return nil, false
+			}
+		}
+	}
+
+	if contentLength < 0 {
+		return nil, false
+	}
+
+	b := make([]byte, contentLength)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, false
+	}
+
+	return b, true
+}
+
+func writeContentLengthMessage(w io.Writer, b []byte) {
+	io.WriteString(w, "Content-Length: "+strconv.Itoa(len(b))+"\r\n\r\n")
+	w.Write(b)
+}
+
+func readDAPMessage(r *bufio.Reader) (DAPMessage, bool) {
+	var m DAPMessage
+
+	b, ok := readContentLengthMessage(r)
+	if !ok || json.Unmarshal(b, &m) != nil {
+		return m, false
+	}
+
+	return m, true
+}
+
+func getDAPSource(sourceFilePath string) DAPSource {
+	if p, err := filepath.Abs(sourceFilePath); err == nil {
+		sourceFilePath = p
+	}
+	return DAPSource{Name: filepath.Base(sourceFilePath), Path: sourceFilePath}
+}
+
+func setDAPBreakpoints(key string, locationList []string) []interface{} {
+	var bpList []DebugBreakpoint
+
+	for _, bp := range debugBreakpointList {
+		isReplaced := false
+		for _, id := range dapBreakpointIDList[key] {
+			if bp.ID == id {
+				isReplaced = true
+			}
+		}
+
+		if !isReplaced {
+			bpList = append(bpList, bp)
+		}
+	}
+
+	debugBreakpointList = bpList
+	dapBreakpointIDList[key] = nil
+
+	resultList := make([]interface{}, 0)
+
+	for _, location := range locationList {
+		bp, ok := addDebugBreakpoint(location)
+		if !ok {
+			resultList = append(resultList, map[string]interface{}{"verified": false,
+				"message": "no code at " + location})
+			continue
+		}
+
+		dapBreakpointIDList[key] = append(dapBreakpointIDList[key], bp.ID)
+
+		resultList = append(resultList, map[string]interface{}{"id": bp.ID, "verified": true,
+			"line": bp.Line, "source": getDAPSource(bp.SourceFilePath)})
+	}
+
+	return resultList
+}
+
+func sendDAPOutput() {
+	if dapOutput.Len() != 0 {
+		sendDAPEvent("output", map[string]interface{}{"category": "stdout", "output": dapOutput.String()})
+		dapOutput.Reset()
+	}
+}
+
+// Runs between the slices of a running program. Returns whether a pause,
+// terminate or disconnect request stops it.
+func pollDAPRequests() bool {
+	sendDAPOutput()
+
+	for {
+		select {
+		case req, ok := <-dapRequestChan:
+			if !ok {
+				isDAPDisconnected = true
+				return true
+			}
+
+			if req.Type != "request" {
+				continue
+			}
+
+			switch req.Command {
+			case "pause", "terminate":
+				sendDAPResponse(req, nil)
+				dapInterruptReason = req.Command
+				return true
+			case "disconnect":
+				runDAPRequest(req)
+				isDAPDisconnected = true
+				return true
+			case "threads":
+				runDAPRequest(req)
+			default:
+				dapPendingRequestList = append(dapPendingRequestList, req)
+			}
+		default:
+			return false
+		}
+	}
+}
+
+// Reports why the program stopped after it ran
+func sendDAPStop(msg string, reason string) {
+	sendDAPOutput()
+
+	interruptReason := dapInterruptReason
+	dapInterruptReason = ""
+
+	if isDAPDisconnected {
+		return
+	}
+
+	if interruptReason == "terminate" {
+		debugVM = nil
+		isDebugProgramRunning = false
+		sendDAPEvent("terminated", nil)
+		return
+	} else if interruptReason == "pause" {
+		reason = "pause"
+	}
+
+	switch msg {
+	case "":
+		sendDAPEvent("exited", map[string]interface{}{"exitCode": 0})
+		sendDAPEvent("terminated", nil)
+	case VM_BREAK_MESSAGE:
+		if _, ok := findDebugBreakpoint(debugVM.PC); ok {
+			reason = "breakpoint"
+		}
+		sendDAPEvent("stopped", map[string]interface{}{"reason": reason, "threadId": 1,
+			"allThreadsStopped": true})
+	default:
+		sendDAPEvent("output", map[string]interface{}{"category": "stderr", "output": msg + "\n"})
+		sendDAPEvent("stopped", map[string]interface{}{"reason": "exception", "description": msg,
+			"text": msg, "threadId": 1, "allThreadsStopped": true})
+	}
+}
+
+// Frames are numbered from 1 and each has a scope for its parameters and one
+// for its locals
+func getDAPFrame(frameID int) (DebugFrame, bool) {
+	frameList := getDebugFrameList()
+	if frameID < 1 || frameID > len(frameList) {
+		return DebugFrame{}, false
+	}
+	return frameList[frameID-1], true
+}
+
+func getDAPVariable(frame DebugFrame, local DebugLocal) map[string]interface{} {
+	return map[string]interface{}{"name": local.Ident,
+		"value":              formatDebugValue(local.Type, getDebugLocalValue(frame, local)),
+		"type":               getTypeStringFromTypeInfo(local.Type),
+		"variablesReference": 0}
+}
+
+func runDAPRequest(req DAPMessage) bool {
+	switch req.Command {
+	case "initialize":
+		sendDAPResponse(req, map[string]interface{}{
+			"supportsConfigurationDoneRequest": true,
+			"supportsFunctionBreakpoints":      true,
+			"supportsEvaluateForHovers":        true,
+			"supportsTerminateRequest":         true,
+		})
+	case "launch":
+		var args DAPLaunchArguments
+		if json.Unmarshal(req.Arguments, &args) != nil || args.Program == "" {
+			sendDAPErrorResponse(req, "missing program")
+			return true
+		}
+
+		isInlinerEnabled = false
+		isTailCallEliminatorEnabled = false
+
+		ir, ce, ok := compileSourceFileOrError(args.Program)
+		if !ok {
+			sendDAPErrorResponse(req, ce.Msg)
+			return true
+		}
+
+		debuggerInit(ir)
+		dapBreakpointIDList = make(map[string][]int)
+
+		isDAPLaunched = true
+		isDAPStopOnEntry = args.StopOnEntry
+
+		sendDAPResponse(req, nil)
+		sendDAPEvent("initialized", nil)
+	case "setBreakpoints", "setFunctionBreakpoints":
+		if !isDAPLaunched {
+			sendDAPErrorResponse(req, "no program")
+			return true
+		}
+
+		var key string
+		var locationList []string
+
+		if req.Command == "setBreakpoints" {
+			var args DAPSetBreakpointsArguments
+			json.Unmarshal(req.Arguments, &args)
+
+			key = getDAPSource(args.Source.Path).Path
+			for _, bp := range args.Breakpoints {
+				locationList = append(locationList, args.Source.Path+":"+strconv.Itoa(bp.Line))
+			}
+		} else {
+			var args DAPSetFunctionBreakpointsArguments
+			json.Unmarshal(req.Arguments, &args)
+
+			for _, bp := range args.Breakpoints {
+				locationList = append(locationList, bp.Name)
+			}
+		}
+
+		sendDAPResponse(req, map[string]interface{}{"breakpoints": setDAPBreakpoints(key, locationList)})
+	case "setExceptionBreakpoints", "pause":
+		sendDAPResponse(req, nil)
+	case "configurationDone":
+		if !isDAPLaunched {
+			sendDAPErrorResponse(req, "no program")
+			return true
+		}
+
+		sendDAPResponse(req, nil)
+
+		startDebugProgram(&dapOutput)
+
+		if df, ok := findDebugFuncByIdent("main"); ok && isDAPStopOnEntry && len(df.LineList) != 0 {
+			sendDAPStop(resumeDebugProgram([]int{df.LineList[0].Addr}, func() bool { return true }), "entry")
+		} else {
+			sendDAPStop(continueDebugProgram(), "breakpoint")
+		}
+	case "threads":
+		sendDAPResponse(req, map[string]interface{}{
+			"threads": []interface{}{map[string]interface{}{"id": 1, "name": "main"}}})
+	case "stackTrace":
+		stackFrameList := make([]interface{}, 0)
+
+		for i, frame := range getDebugFrameList() {
+			stackFrameList = append(stackFrameList, map[string]interface{}{"id": i + 1,
+				"name": frame.Func.Ident, "line": frame.Line, "column": 1,
+				"source": getDAPSource(frame.Func.SourceFilePath)})
+		}
+
+		sendDAPResponse(req, map[string]interface{}{"stackFrames": stackFrameList,
+			"totalFrames": len(stackFrameList)})
+	case "scopes":
+		var args DAPFrameArguments
+		json.Unmarshal(req.Arguments, &args)
+
+		sendDAPResponse(req, map[string]interface{}{"scopes": []interface{}{
+			map[string]interface{}{"name": "Parameters", "presentationHint": "arguments",
+				"variablesReference": args.FrameID * 2, "expensive": false},
+			map[string]interface{}{"name": "Locals", "presentationHint": "locals",
+				"variablesReference": args.FrameID*2 + 1, "expensive": false},
+		}})
+	case "variables":
+		var args DAPFrameArguments
+		json.Unmarshal(req.Arguments, &args)
+
+		variableList := make([]interface{}, 0)
+
+		if frame, ok := getDAPFrame(args.VariablesReference / 2); ok {
+			for _, local := range frame.Func.LocalList {
+				if local.IsParam == (args.VariablesReference%2 == 0) {
+					variableList = append(variableList, getDAPVariable(frame, local))
+				}
+			}
+		}
+
+		sendDAPResponse(req, map[string]interface{}{"variables": variableList})
+	case "evaluate":
+		var args DAPFrameArguments
+		json.Unmarshal(req.Arguments, &args)
+
+		frame, ok := getDAPFrame(args.FrameID)
+		if !ok {
+			frame, ok = getDAPFrame(1)
+		}
+
+		if !ok {
+			sendDAPErrorResponse(req, "no frame")
+			return true
+		}
+
+		local, ok := findDebugLocal(frame, strings.TrimSpace(args.Expression))
+		if !ok {
+			sendDAPErrorResponse(req, "no local named "+args.Expression)
+			return true
+		}
+
+		v := getDAPVariable(frame, local)
+		sendDAPResponse(req, map[string]interface{}{"result": v["value"], "type": v["type"],
+			"variablesReference": 0})
+	case "continue", "next", "stepIn", "stepOut":
+		if !isDAPLaunched || debugVM == nil {
+			sendDAPErrorResponse(req, "the program is not running")
+			return true
+		}
+
+		if req.Command == "continue" {
+			sendDAPResponse(req, map[string]interface{}{"allThreadsContinued": true})
+		} else {
+			sendDAPResponse(req, nil)
+		}
+
+		// A program that stopped with a PANIC ends when it is resumed
+		if !isDebugProgramRunning {
+			sendDAPEvent("exited", map[string]interface{}{"exitCode": 1})
+			sendDAPEvent("terminated", nil)
+			return true
+		}
+
+		switch req.Command {
+		case "continue":
+			sendDAPStop(continueDebugProgram(), "breakpoint")
+		case "next":
+			sendDAPStop(stepDebugProgram(true), "step")
+		case "stepIn":
+			sendDAPStop(stepDebugProgram(false), "step")
+		default:
+			if len(getDebugFrameList()) < 2 {
+				sendDAPStop(stepDebugProgram(true), "step")
+			} else {
+				sendDAPStop(finishDebugProgram(), "step")
+			}
+		}
+	case "disconnect", "terminate":
+		sendDAPResponse(req, nil)
+		if req.Command == "terminate" {
+			sendDAPEvent("terminated", nil)
+		}
+		return req.Command == "terminate"
+	default:
+		sendDAPErrorResponse(req, "unsupported request "+req.Command)
+	}
+
+	return true
+}
+
+// Serves the Debug Adapter Protocol for one debug session. Programs run on
+// the stack VM like with -debug.
+func DAPServer(r io.Reader, w io.Writer) {
+	dapWriter = w
+	dapSeq = 0
+	isDAPLaunched = false
+	isDAPDisconnected = false
+	dapPendingRequestList = nil
+
+	dapRequestChan = make(chan DAPMessage)
+	isDebugInterrupted = pollDAPRequests
+
+	go func() {
+		br := bufio.NewReader(r)
+
+		for {
+			req, ok := readDAPMessage(br)
+			if !ok {
+				close(dapRequestChan)
+				return
+			}
+			dapRequestChan <- req
+		}
+	}()
+
+	for !isDAPDisconnected {
+		var req DAPMessage
+
+		if len(dapPendingRequestList) != 0 {
+			req = dapPendingRequestList[0]
+			dapPendingRequestList = dapPendingRequestList[1:]
+		} else {
+			var ok bool
+			if req, ok = <-dapRequestChan; !ok {
+				return
+			}
+		}
+
+		if req.Type == "request" && !runDAPRequest(req) {
+			return
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+func getTreeNodeLineNumber(tn TreeNode) int {
+	if tn.Tok.LineNumber != 0 {
+		return tn.Tok.LineNumber
+	}
+
+	for _, c := range tn.Children {
+		if l := getTreeNodeLineNumber(c); l != 0 {
+			return l
+		}
+	}
+
+	return 0
+}
+
+func eliminateDeadStmt(tn TreeNode) TreeNode {
+	for i := range tn.Children {
+		tn.Children[i] = eliminateDeadStmt(tn.Children[i])
+	}
+
+	if tn.Kype != TNT_STMT_LIST {
+		return tn
+	}
+
+	for i, c := range tn.Children {
+		if c.Kype != TNT_STMT_RETURN && c.Kype != TNT_STMT_BREAK && c.Kype != TNT_STMT_CONTINUE {
+			continue
+		}
+
+		tn.Children = tn.Children[:i+1]
+		break
+	}
+
+	return tn
+}
+
+func collectFuncRefList(tn TreeNode, funcRefList map[string]bool) {
+	if tn.Kype == TNT_EXPR_FUNC || tn.Kype == TNT_EXPR_INT {
+		funcRefList[string(tn.Tok.Buf)] = true
+	}
+
+	for _, c := range tn.Children {
+		collectFuncRefList(c, funcRefList)
+	}
+}
+
+// Functions that can be reached from main or an exported function through
+// calls and function values. The warning analyzer reports the others as
+// unused.
+func getReachableFuncIdentList(funcListTreeNode TreeNode, exportedFuncIdentList []string) map[string]bool {
+	funcTreeNodeList := make(map[string]TreeNode)
+
+	for _, funcTreeNode := range funcListTreeNode.Children {
+		funcTreeNodeList[string(funcTreeNode.Children[0].Tok.Buf)] = funcTreeNode
+	}
+
+	isReachable := make(map[string]bool)
+
+	var visitFunc func(funcIdent string)
+	visitFunc = func(funcIdent string) {
+		funcTreeNode, ok := funcTreeNodeList[funcIdent]
+		if !ok || isReachable[funcIdent] {
+			return
+		}
+
+		isReachable[funcIdent] = true
+
+		funcRefList := make(map[string]bool)
+		collectFuncRefList(funcTreeNode.Children[2], funcRefList)
+
+		for ident := range funcRefList {
+			visitFunc(ident)
+		}
+	}
+
+	for _, funcIdent := range exportedFuncIdentList {
+		visitFunc(funcIdent)
+	}
+
+	return isReachable
+}
+
+func DeadCodeEliminator(tn TreeNode, exportedFuncIdentList []string) TreeNode {
+	funcListTreeNode := tn.Children[0]
+
+	for i, funcTreeNode := range funcListTreeNode.Children {
+		curSourceFilePath = funcTreeNode.Children[0].Tok.SourceFilePath
+
+		funcListTreeNode.Children[i] = eliminateDeadStmt(funcTreeNode)
+	}
+
+	isReachable := getReachableFuncIdentList(funcListTreeNode, exportedFuncIdentList)
+
+	var newFuncListTreeNode TreeNode
+	newFuncListTreeNode.Kype = TNT_FUNC_LIST
+
+	for _, funcTreeNode := range funcListTreeNode.Children {
+		if isReachable[string(funcTreeNode.Children[0].Tok.Buf)] {
+			newFuncListTreeNode.Children = append(newFuncListTreeNode.Children, funcTreeNode)
+		}
+	}
+
+	tn.Children[0] = newFuncListTreeNode
+
+	curSourceFilePath = ""
+
+	return tn
+}
@@ -0,0 +1,679 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Address of the first instruction of a source line, which is in another
+// file than its function when it was inlined
+type DebugLine struct {
+	Addr           int
+	SourceFilePath string
+	Line           int
+}
+
+// Addr is relative to the frame pointer
+type DebugLocal struct {
+	Ident   string
+	Type    interface{}
+	IsParam bool
+	Line    int
+	Addr    uint64
+}
+
+type DebugFunc struct {
+	Ident          string
+	SourceFilePath string
+	ReturnType     interface{}
+
+	Addr    int
+	EndAddr int
+
+	LocalList []DebugLocal
+	LineList  []DebugLine
+}
+
+type DebugFrame struct {
+	Func DebugFunc
+	PC   uint64
+	FP   uint64
+	Line int
+}
+
+type DebugBreakpoint struct {
+	ID             int
+	SourceFilePath string
+	Line           int
+	AddrList       []int
+}
+
+var debugCode []byte
+var debugVM *VMState
+var isDebugProgramRunning bool
+
+// The program runs this many instructions at a time, and isDebugInterrupted
+// is asked between them whether it should stop
+var DEBUG_RUN_STEPS_COUNT uint64 = 1 << 20
+var isDebugInterrupted func() bool
+
+var debugBreakpointList []DebugBreakpoint
+var debugBreakpointsCount int
+
+var debugSourceLineList map[string][]string
+
+// Entries that start at the same address keep the last line, and entries that
+// do not change the line are dropped
+func appendDebugLine(lineList []DebugLine, dl DebugLine) []DebugLine {
+	if n := len(lineList); n != 0 && lineList[n-1].Addr == dl.Addr {
+		lineList = lineList[:n-1]
+	}
+
+	if n := len(lineList); n != 0 && lineList[n-1].Line == dl.Line &&
+		lineList[n-1].SourceFilePath == dl.SourceFilePath {
+		return lineList
+	}
+
+	return append(lineList, dl)
+}
+
+func recordDebugLine(sourceFilePath string, line int) {
+	if line == 0 || len(debugFuncList) == 0 {
+		return
+	}
+
+	df := &debugFuncList[len(debugFuncList)-1]
+
+	if sourceFilePath == "" {
+		sourceFilePath = df.SourceFilePath
+	}
+
+	df.LineList = appendDebugLine(df.LineList, DebugLine{Addr: len(bytecode), SourceFilePath: sourceFilePath,
+		Line: line})
+}
+
+func findDebugFunc(pc uint64) (DebugFunc, bool) {
+	for _, df := range debugFuncList {
+		if uint64(df.Addr) <= pc && pc < uint64(df.EndAddr) {
+			return df, true
+		}
+	}
+	return DebugFunc{}, false
+}
+
+func findDebugFuncByAddr(addr uint64) (DebugFunc, bool) {
+	for _, df := range debugFuncList {
+		if uint64(df.Addr) == addr {
+			return df, true
+		}
+	}
+	return DebugFunc{}, false
+}
+
+func findDebugLine(df DebugFunc, pc uint64) int {
+	line := 0
+	for _, dl := range df.LineList {
+		if uint64(dl.Addr) > pc {
+			break
+		}
+		line = dl.Line
+	}
+	return line
+}
+
+// Frames are found through the previous frame pointer and the return address
+// that a call stores right below the frame
+func getDebugFrameList() []DebugFrame {
+	var frameList []DebugFrame
+
+	if debugVM == nil {
+		return frameList
+	}
+
+	pc, fp := debugVM.PC, debugVM.FP
+	linePC := pc
+
+	for fp >= 16 {
+		df, ok := findDebugFunc(pc)
+		if !ok {
+			break
+		}
+
+		frameList = append(frameList, DebugFrame{Func: df, PC: pc, FP: fp, Line: findDebugLine(df, linePC)})
+
+		// The return address follows the call, which is still part of its line
+		pc = binary.LittleEndian.Uint64(debugVM.Stack[fp-8:])
+		fp = binary.LittleEndian.Uint64(debugVM.Stack[fp-16:])
+		linePC = pc - 1
+	}
+
+	return frameList
+}
+
+func getDebugValue(t interface{}, b []byte) uint64 {
+	bytesCount := getTypeInfoBytesCount(t)
+
+	v := binary.LittleEndian.Uint64(b) & vmMaskList[bytesCount]
+
+	if ii, ok := t.(IntInfo); ok {
+		v = getVMSignExtendedValue(encodeIntInfo(ii), v)
+	}
+
+	return v
+}
+
+func getDebugLocalValue(frame DebugFrame, local DebugLocal) uint64 {
+	return getDebugValue(local.Type, debugVM.Stack[frame.FP+local.Addr:])
+}
+
+func formatDebugValue(t interface{}, v uint64) string {
+	if ii, ok := t.(IntInfo); ok {
+		if ii.IsSigned {
+			return strconv.FormatInt(int64(v), 10)
+		}
+		return strconv.FormatUint(v, 10)
+	}
+
+	if df, ok := findDebugFuncByAddr(v); ok {
+		return df.Ident
+	}
+
+	return strconv.FormatUint(v, 10)
+}
+
+// Later declarations shadow earlier ones once their line is reached
+func findDebugLocal(frame DebugFrame, ident string) (DebugLocal, bool) {
+	var local DebugLocal
+	isFound := false
+
+	for _, l := range frame.Func.LocalList {
+		if l.Ident == ident && (l.IsParam || l.Line <= frame.Line || !isFound) {
+			local = l
+			isFound = true
+		}
+	}
+
+	return local, isFound
+}
+
+func formatDebugFrame(frame DebugFrame) string {
+	var paramList []string
+
+	for _, local := range frame.Func.LocalList {
+		if local.IsParam {
+			paramList = append(paramList,
+				local.Ident+"="+formatDebugValue(local.Type, getDebugLocalValue(frame, local)))
+		}
+	}
+
+	return frame.Func.Ident + " (" + strings.Join(paramList, ", ") + ") at " +
+		frame.Func.SourceFilePath + ":" + strconv.Itoa(frame.Line)
+}
+
+func getDebugSourceLine(sourceFilePath string, line int) string {
+	lineList, ok := debugSourceLineList[sourceFilePath]
+
+	if !ok {
+		if data, err := os.ReadFile(sourceFilePath); err == nil {
+			lineList = strings.Split(string(data), "\n")
+		}
+		debugSourceLineList[sourceFilePath] = lineList
+	}
+
+	if line < 1 || line > len(lineList) {
+		return ""
+	}
+
+	return lineList[line-1]
+}
+
+func isDebugSourceFile(df DebugFunc, sourceFilePath string) bool {
+	a, errA := filepath.Abs(df.SourceFilePath)
+	b, errB := filepath.Abs(sourceFilePath)
+
+	return df.SourceFilePath == sourceFilePath || (errA == nil && errB == nil && a == b) ||
+		filepath.Base(df.SourceFilePath) == sourceFilePath
+}
+
+// A location is a function name, a line of the file being stopped in (or of
+// main) or file:line. A line without code resolves to the next line with code.
+func resolveDebugLocation(location string) ([]int, string, int, bool) {
+	sourceFilePath := ""
+	lineString := location
+
+	if i := strings.LastIndex(location, ":"); i != -1 {
+		sourceFilePath = location[:i]
+		lineString = location[i+1:]
+	}
+
+	line, err := strconv.Atoi(lineString)
+
+	if err != nil {
+		for _, df := range debugFuncList {
+			if df.Ident == location && len(df.LineList) != 0 {
+				return []int{df.LineList[0].Addr}, df.SourceFilePath, df.LineList[0].Line, true
+			}
+		}
+		return nil, "", 0, false
+	}
+
+	if sourceFilePath == "" {
+		if frameList := getDebugFrameList(); len(frameList) != 0 {
+			sourceFilePath = frameList[0].Func.SourceFilePath
+		} else if df, ok := findDebugFuncByIdent("main"); ok {
+			sourceFilePath = df.SourceFilePath
+		}
+	}
+
+	bestLine := 0
+
+	for _, df := range debugFuncList {
+		if !isDebugSourceFile(df, sourceFilePath) {
+			continue
+		}
+
+		for _, dl := range df.LineList {
+			if dl.Line >= line && (bestLine == 0 || dl.Line < bestLine) {
+				bestLine = dl.Line
+				sourceFilePath = df.SourceFilePath
+			}
+		}
+	}
+
+	if bestLine == 0 {
+		return nil, "", 0, false
+	}
+
+	var addrList []int
+
+	for _, df := range debugFuncList {
+		if df.SourceFilePath != sourceFilePath {
+			continue
+		}
+
+		for _, dl := range df.LineList {
+			if dl.Line == bestLine {
+				addrList = append(addrList, dl.Addr)
+			}
+		}
+	}
+
+	return addrList, sourceFilePath, bestLine, true
+}
+
+func findDebugFuncByIdent(ident string) (DebugFunc, bool) {
+	for _, df := range debugFuncList {
+		if df.Ident == ident {
+			return df, true
+		}
+	}
+	return DebugFunc{}, false
+}
+
+func addDebugBreakpoint(location string) (DebugBreakpoint, bool) {
+	addrList, sourceFilePath, line, ok := resolveDebugLocation(location)
+	if !ok {
+		return DebugBreakpoint{}, false
+	}
+
+	debugBreakpointsCount++
+
+	bp := DebugBreakpoint{ID: debugBreakpointsCount, SourceFilePath: sourceFilePath, Line: line,
+		AddrList: addrList}
+	debugBreakpointList = append(debugBreakpointList, bp)
+
+	return bp, true
+}
+
+func findDebugBreakpoint(pc uint64) (DebugBreakpoint, bool) {
+	for _, bp := range debugBreakpointList {
+		for _, addr := range bp.AddrList {
+			if uint64(addr) == pc {
+				return bp, true
+			}
+		}
+	}
+	return DebugBreakpoint{}, false
+}
+
+func getDebugLineAddrList() []int {
+	var addrList []int
+	for _, df := range debugFuncList {
+		for _, dl := range df.LineList {
+			addrList = append(addrList, dl.Addr)
+		}
+	}
+	return addrList
+}
+
+func debuggerInit(ir IRProgram) {
+	debugCode = BytecodeGenerator(ir)
+	debugVM = nil
+	isDebugProgramRunning = false
+	debugBreakpointList = make([]DebugBreakpoint, 0)
+	debugBreakpointsCount = 0
+	debugSourceLineList = make(map[string][]string)
+}
+
+func startDebugProgram(w io.Writer) {
+	debugVM = initVMState(debugCode, w)
+	isDebugProgramRunning = true
+}
+
+// Resumes the program until it ends, reaches a breakpoint or reaches one of
+// stopAddrList while isStop returns true. Instructions at these addresses are
+// replaced by OP_BREAK, and the instruction the program stopped at runs from
+// the original code.
+func resumeDebugProgram(stopAddrList []int, isStop func() bool) string {
+	code := append([]byte{}, debugCode...)
+
+	for _, addr := range stopAddrList {
+		code[addr] = OP_BREAK
+	}
+
+	for _, bp := range debugBreakpointList {
+		for _, addr := range bp.AddrList {
+			code[addr] = OP_BREAK
+		}
+	}
+
+	for {
+		debugVM.Code = debugCode
+
+		msg := runVMState(debugVM, 1)
+
+		if msg == VM_BREAK_MESSAGE {
+			debugVM.Code = code
+
+			for {
+				msg = runVMState(debugVM, DEBUG_RUN_STEPS_COUNT)
+
+				if msg != VM_BREAK_MESSAGE || code[debugVM.PC] == OP_BREAK {
+					break
+				}
+
+				if isDebugInterrupted != nil && isDebugInterrupted() {
+					return msg
+				}
+			}
+		}
+
+		if msg != VM_BREAK_MESSAGE {
+			isDebugProgramRunning = false
+			return msg
+		}
+
+		if _, ok := findDebugBreakpoint(debugVM.PC); ok || isStop() {
+			return msg
+		}
+	}
+}
+
+func continueDebugProgram() string {
+	return resumeDebugProgram(nil, func() bool { return false })
+}
+
+// Runs until another line starts or the function returns. Calls are stepped
+// into unless isNext is set.
+func stepDebugProgram(isNext bool) string {
+	frameList := getDebugFrameList()
+	if len(frameList) == 0 {
+		return continueDebugProgram()
+	}
+
+	startFP := debugVM.FP
+	startLine := frameList[0].Line
+
+	stopAddrList := getDebugLineAddrList()
+
+	returnAddr, callerFP := uint64(0), uint64(0)
+	if len(frameList) > 1 {
+		returnAddr = frameList[1].PC
+		callerFP = frameList[1].FP
+		stopAddrList = append(stopAddrList, int(returnAddr))
+	}
+
+	return resumeDebugProgram(stopAddrList, func() bool {
+		if len(frameList) > 1 && debugVM.PC == returnAddr && debugVM.FP == callerFP {
+			return true
+		}
+
+		if debugVM.FP != startFP {
+			return !isNext && debugVM.FP > startFP
+		}
+
+		frameList := getDebugFrameList()
+
+		return len(frameList) != 0 && frameList[0].Line != startLine
+	})
+}
+
+// Runs until the innermost frame returns to its caller
+func finishDebugProgram() string {
+	fp := debugVM.FP
+
+	returnAddr := binary.LittleEndian.Uint64(debugVM.Stack[fp-8:])
+	callerFP := binary.LittleEndian.Uint64(debugVM.Stack[fp-16:])
+
+	return resumeDebugProgram([]int{int(returnAddr)}, func() bool {
+		return debugVM.PC == returnAddr && debugVM.FP == callerFP
+	})
+}
+
+func printDebugStop(w io.Writer, msg string, prevFrame DebugFrame) {
+	if msg == "" {
+		fmt.Fprintln(w, "Program exited normally")
+		return
+	}
+
+	frameList := getDebugFrameList()
+
+	if msg != VM_BREAK_MESSAGE {
+		fmt.Fprintln(w, "Program stopped: "+msg)
+	}
+
+	if len(frameList) == 0 {
+		return
+	}
+
+	frame := frameList[0]
+
+	if bp, ok := findDebugBreakpoint(debugVM.PC); ok && msg == VM_BREAK_MESSAGE {
+		fmt.Fprintln(w, "Breakpoint "+strconv.Itoa(bp.ID)+", "+formatDebugFrame(frame))
+	} else if msg != VM_BREAK_MESSAGE || frame.FP != prevFrame.FP || frame.Func.Ident != prevFrame.Func.Ident {
+		fmt.Fprintln(w, formatDebugFrame(frame))
+	}
+
+	fmt.Fprintln(w, strconv.Itoa(frame.Line)+"\t"+getDebugSourceLine(frame.Func.SourceFilePath, frame.Line))
+}
+
+var DEBUGGER_HELP_TEXT = `break LOCATION     set a breakpoint at a function, LINE or FILE:LINE
+delete [ID]        delete a breakpoint or all of them
+info breakpoints   list the breakpoints
+run                start the program from the beginning
+continue           run until the next breakpoint
+step               run to the next line, stepping into calls
+next               run to the next line, stepping over calls
+finish             run until the current function returns
+backtrace          print the call stack
+frame [N]          select the frame of the call stack to inspect
+print NAME         print a local or parameter
+info locals        print the locals and parameters
+quit               exit the debugger`
+
+// Debugs a program on the stack VM with commands read from r. The program
+// writes to w as well.
+func Debugger(ir IRProgram, r io.Reader, w io.Writer) {
+	debuggerInit(ir)
+
+	frameIndex := 0
+
+	scanner := bufio.NewScanner(r)
+
+	var lastFieldList []string
+
+	for {
+		fmt.Fprint(w, "(debug) ")
+
+		if !scanner.Scan() {
+			fmt.Fprintln(w)
+			return
+		}
+
+		fieldList := strings.Fields(scanner.Text())
+		if len(fieldList) == 0 {
+			fieldList = lastFieldList
+		}
+		lastFieldList = fieldList
+
+		if len(fieldList) == 0 {
+			continue
+		}
+
+		cmd, argList := fieldList[0], fieldList[1:]
+
+		var prevFrame DebugFrame
+		if frameList := getDebugFrameList(); len(frameList) != 0 {
+			prevFrame = frameList[0]
+		}
+
+		switch cmd {
+		case "break", "b":
+			if len(argList) != 1 {
+				fmt.Fprintln(w, "Usage: break LOCATION")
+			} else if bp, ok := addDebugBreakpoint(argList[0]); ok {
+				fmt.Fprintln(w, "Breakpoint "+strconv.Itoa(bp.ID)+" at "+bp.SourceFilePath+":"+
+					strconv.Itoa(bp.Line))
+			} else {
+				fmt.Fprintln(w, "No code at "+argList[0])
+			}
+		case "delete", "d":
+			var bpList []DebugBreakpoint
+			for _, bp := range debugBreakpointList {
+				if len(argList) != 0 && argList[0] != strconv.Itoa(bp.ID) {
+					bpList = append(bpList, bp)
+				}
+			}
+			debugBreakpointList = bpList
+		case "info", "i":
+			if len(argList) == 1 && (argList[0] == "breakpoints" || argList[0] == "b") {
+				for _, bp := range debugBreakpointList {
+					fmt.Fprintln(w, strconv.Itoa(bp.ID)+"\t"+bp.SourceFilePath+":"+strconv.Itoa(bp.Line))
+				}
+				continue
+			} else if len(argList) != 1 || (argList[0] != "locals" && argList[0] != "l") {
+				fmt.Fprintln(w, "Usage: info breakpoints|locals")
+				continue
+			}
+
+			frameList := getDebugFrameList()
+			if frameIndex >= len(frameList) {
+				fmt.Fprintln(w, "No frame selected")
+				continue
+			}
+
+			for _, local := range frameList[frameIndex].Func.LocalList {
+				fmt.Fprintln(w, local.Ident+" = "+
+					formatDebugValue(local.Type, getDebugLocalValue(frameList[frameIndex], local))+
+					" ("+getTypeStringFromTypeInfo(local.Type)+")")
+			}
+		case "print", "p":
+			frameList := getDebugFrameList()
+
+			if len(argList) != 1 {
+				fmt.Fprintln(w, "Usage: print NAME")
+			} else if frameIndex >= len(frameList) {
+				fmt.Fprintln(w, "No frame selected")
+			} else if local, ok := findDebugLocal(frameList[frameIndex], argList[0]); ok {
+				fmt.Fprintln(w, local.Ident+" = "+
+					formatDebugValue(local.Type, getDebugLocalValue(frameList[frameIndex], local))+
+					" ("+getTypeStringFromTypeInfo(local.Type)+")")
+			} else {
+				fmt.Fprintln(w, "No local named "+argList[0])
+			}
+		case "backtrace", "bt":
+			for i, frame := range getDebugFrameList() {
+				fmt.Fprintln(w, "#"+strconv.Itoa(i)+"  "+formatDebugFrame(frame))
+			}
+		case "frame", "f":
+			frameList := getDebugFrameList()
+
+			if len(argList) == 1 {
+				n, err := strconv.Atoi(argList[0])
+				if err != nil || n < 0 || n >= len(frameList) {
+					fmt.Fprintln(w, "No frame "+argList[0])
+					continue
+				}
+				frameIndex = n
+			}
+
+			if frameIndex < len(frameList) {
+				frame := frameList[frameIndex]
+				fmt.Fprintln(w, "#"+strconv.Itoa(frameIndex)+"  "+formatDebugFrame(frame))
+				fmt.Fprintln(w, strconv.Itoa(frame.Line)+"\t"+
+					getDebugSourceLine(frame.Func.SourceFilePath, frame.Line))
+			} else {
+				fmt.Fprintln(w, "No frame selected")
+			}
+		case "run", "r":
+			startDebugProgram(w)
+			frameIndex = 0
+			printDebugStop(w, continueDebugProgram(), DebugFrame{})
+		case "continue", "c", "step", "s", "next", "n", "finish":
+			if !isDebugProgramRunning {
+				fmt.Fprintln(w, "The program is not running")
+				continue
+			}
+
+			frameIndex = 0
+
+			var msg string
+			var returnValueString string
+
+			switch cmd {
+			case "continue", "c":
+				msg = continueDebugProgram()
+			case "step", "s":
+				msg = stepDebugProgram(false)
+			case "next", "n":
+				msg = stepDebugProgram(true)
+			default:
+				frameList := getDebugFrameList()
+				if len(frameList) < 2 {
+					fmt.Fprintln(w, "\"finish\" not meaningful in the outermost frame")
+					continue
+				}
+
+				fmt.Fprintln(w, "Run till exit from "+formatDebugFrame(frameList[0]))
+
+				msg = finishDebugProgram()
+
+				returnType := frameList[0].Func.ReturnType
+				if _, ok := returnType.(VoidInfo); !ok && msg == VM_BREAK_MESSAGE && debugVM.PC ==
+					frameList[1].PC {
+					v := getDebugValue(returnType,
+						debugVM.Stack[debugVM.SP-uint64(getTypeInfoBytesCount(returnType)):])
+					returnValueString = formatDebugValue(returnType, v)
+				}
+			}
+
+			printDebugStop(w, msg, prevFrame)
+
+			if returnValueString != "" {
+				fmt.Fprintln(w, "Value returned is "+returnValueString)
+			}
+		case "help", "h":
+			fmt.Fprintln(w, DEBUGGER_HELP_TEXT)
+		case "quit", "q":
+			return
+		default:
+			fmt.Fprintln(w, "Unknown command "+cmd+", try help")
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var OpNames = map[byte]string{
+	OP_HALT:  "halt",
+	OP_ECALL: "ecall",
+	OP_BREAK: "break",
+
+	OP_CALL:          "call",
+	OP_RETURN:        "return",
+	OP_CALL_INDIRECT: "call_indirect",
+
+	OP_JUMP:       "jump",
+	OP_BRANCH:     "branch",
+	OP_JUMP_TABLE: "jump_table",
+
+	OP_PUSH:   "push",
+	OP_POP:    "pop",
+	OP_ASSIGN: "assign",
+
+	OP_ADD: "add",
+	OP_SUB: "sub",
+
+	OP_AND: "and",
+	OP_OR:  "or",
+	OP_XOR: "xor",
+
+	OP_SHL: "shl",
+	OP_SHR: "shr",
+
+	OP_MUL: "mul",
+	OP_QUO: "quo",
+	OP_REM: "rem",
+
+	OP_EQL: "eql",
+	OP_NEQ: "neq",
+	OP_LSS: "lss",
+	OP_GTR: "gtr",
+	OP_LEQ: "leq",
+	OP_GEQ: "geq",
+
+	OP_CONVERT: "convert",
+
+	OP_LOAD:  "load",
+	OP_STORE: "store",
+
+	OP_STORE_STRING: "store_string",
+}
+
+// A type with & is the frame offset of a variable of that type
+func getBytecodeTypeString(t byte) string {
+	if t&0b1111 == 0 {
+		return "void"
+	}
+
+	s := "u"
+	if (t & 0b10000) != 0 {
+		s = "i"
+	}
+	s = s + strconv.Itoa(int(t&0b1111)*8)
+
+	if (t & 0b100000) != 0 {
+		return "&" + s
+	}
+	return s
+}
+
+func getDisasmLabelList() map[int]string {
+	labelList := make(map[int]string)
+	for ident, addr := range funcAddrList {
+		labelList[addr] = ident
+	}
+	return labelList
+}
+
+func getDisasmLineList() map[int]string {
+	lineList := make(map[int]string)
+	for _, df := range debugFuncList {
+		for _, dl := range df.LineList {
+			lineList[dl.Addr] = dl.SourceFilePath + ":" + strconv.Itoa(dl.Line)
+		}
+	}
+	return lineList
+}
+
+func getDisasmPushValue(operands []byte) uint64 {
+	b := make([]byte, 8)
+	copy(b, operands[1:])
+	return getVMSignExtendedValue(operands[0], binary.LittleEndian.Uint64(b))
+}
+
+func getDisasmTargetString(addr int, labelList map[int]string) string {
+	s := fmt.Sprintf("%08x", addr)
+	if label, ok := labelList[addr]; ok {
+		s = s + " " + "<" + label + ">"
+	}
+	return s
+}
+
+// Jumps and calls take their displacement from a push right before them,
+// which may be converted from a smaller type
+func Disassembler(ir IRProgram) string {
+	code := BytecodeGenerator(ir)
+
+	labelList := getDisasmLabelList()
+	lineList := getDisasmLineList()
+
+	var sb strings.Builder
+
+	var disp uint64
+	isDispKnown := false
+
+	for addr := 0; addr < len(code); {
+		op := code[addr]
+
+		n, ok := getInstrOperandsBytesCount(code, addr)
+		if !ok || addr+1+n > len(code) {
+			sb.WriteString(fmt.Sprintf("%08x  .byte 0x%02x\n", addr, op))
+			addr++
+			isDispKnown = false
+			continue
+		}
+
+		operands := code[addr+1 : addr+1+n]
+
+		if label, ok := labelList[addr]; ok {
+			if addr != 0 {
+				sb.WriteString("\n")
+			}
+			sb.WriteString(label + ":" + "\n")
+		}
+
+		s := OpNames[op]
+
+		switch {
+		case op == OP_PUSH:
+			v := getDisasmPushValue(operands)
+
+			s = s + " " + getBytecodeTypeString(operands[0]) + " "
+			if (operands[0] & 0b10000) != 0 {
+				s = s + strconv.FormatInt(int64(v), 10)
+			} else {
+				s = s + strconv.FormatUint(v, 10)
+			}
+		case op == OP_JUMP_TABLE:
+			entriesCount := int(binary.LittleEndian.Uint64(operands[1:]))
+
+			var targetList []string
+			for j := 0; j < entriesCount; j++ {
+				targetList = append(targetList, getDisasmTargetString(
+					addr+int(binary.LittleEndian.Uint64(operands[9+8*j:])), labelList))
+			}
+
+			s = s + " " + getBytecodeTypeString(operands[0]) + " " + strings.Join(targetList, ", ")
+		case op == OP_STORE_STRING:
+			s = s + " " + strconv.Quote(string(operands[:len(operands)-1]))
+		default:
+			for _, t := range operands {
+				s = s + " " + getBytecodeTypeString(t)
+			}
+		}
+
+		if (op == OP_CALL || op == OP_JUMP || op == OP_BRANCH) && isDispKnown {
+			s = s + " " + "->" + " " + getDisasmTargetString(addr+int(disp), labelList)
+		}
+
+		if l, ok := lineList[addr]; ok {
+			s = fmt.Sprintf("%-40s # %s", s, l)
+		}
+
+		sb.WriteString(fmt.Sprintf("%08x  %s\n", addr, s))
+
+		if op == OP_PUSH && (operands[0]&0b100000) == 0 {
+			disp = getDisasmPushValue(operands)
+			isDispKnown = true
+		} else if op != OP_CONVERT {
+			isDispKnown = false
+		}
+
+		addr = addr + 1 + n
+	}
+
+	return sb.String()
+}
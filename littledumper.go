@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+type TokenJSON struct {
+	Type   string `json:"type"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+	Text   string `json:"text"`
+}
+
+type TreeNodeJSON struct {
+	Type     string         `json:"type"`
+	Token    *TokenJSON     `json:"token,omitempty"`
+	Children []TreeNodeJSON `json:"children"`
+}
+
+func getTokenText(tok TokenData) string {
+	if tok.Buf != nil {
+		return string(tok.Buf)
+	}
+	return TokTypeToStr[tok.Kype]
+}
+
+func DumpTokens(toks []TokenData, w io.Writer) {
+	for _, tok := range toks {
+		fmt.Fprintf(w, "%d:%d\t%s", tok.LineNumber, tok.ColumnNumber, TokenTypeNames[tok.Kype])
+
+		if s := getTokenText(tok); s != "" {
+			fmt.Fprintf(w, "\t%s", s)
+		}
+
+		fmt.Fprintln(w)
+	}
+}
+
+// Nodes added by the parser, like the return at the end of every function,
+// have no token
+func DumpTreeNode(tn TreeNode, level int, w io.Writer) {
+	s := strings.Repeat("    ", level) + TreeNodeTypeNames[tn.Kype]
+
+	if tn.Tok.LineNumber != 0 {
+		s = s + " " + TokenTypeNames[tn.Tok.Kype]
+
+		if text := getTokenText(tn.Tok); text != "" {
+			s = s + " " + text
+		}
+
+		s = s + fmt.Sprintf(" (line %d)", tn.Tok.LineNumber)
+	}
+
+	fmt.Fprintln(w, s)
+
+	for _, child := range tn.Children {
+		DumpTreeNode(child, level+1, w)
+	}
+}
+
+func getTreeNodeJSON(tn TreeNode) TreeNodeJSON {
+	tnj := TreeNodeJSON{Type: TreeNodeTypeNames[tn.Kype], Children: []TreeNodeJSON{}}
+
+	if tn.Tok.LineNumber != 0 {
+		tnj.Token = &TokenJSON{
+			Type:   TokenTypeNames[tn.Tok.Kype],
+			Line:   tn.Tok.LineNumber,
+			Column: tn.Tok.ColumnNumber,
+			Text:   getTokenText(tn.Tok)}
+	}
+
+	for _, child := range tn.Children {
+		tnj.Children = append(tnj.Children, getTreeNodeJSON(child))
+	}
+
+	return tnj
+}
+
+func DumpTreeNodeJSON(tn TreeNode, w io.Writer) {
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+
+	if err := e.Encode(getTreeNodeJSON(tn)); err != nil {
+		PrintIOErrorAndExit(err)
+	}
+}
+
+// Only the given file is parsed, its imports are not loaded
+func dumpSourceFile(sourceFilePath string, format string, w io.Writer) {
+	bw := bufio.NewWriter(w)
+
+	toks := readModuleSourceCode(filepath.Clean(sourceFilePath))
+
+	switch format {
+	case "tokens":
+		DumpTokens(toks, bw)
+	case "ast":
+		DumpTreeNode(SyntaxAnalyzer(toks), 0, bw)
+	case "ast-json":
+		DumpTreeNodeJSON(SyntaxAnalyzer(toks), bw)
+	}
+
+	curSourceFilePath = ""
+
+	if err := bw.Flush(); err != nil {
+		PrintIOErrorAndExit(err)
+	}
+}
@@ -0,0 +1,744 @@
+package main
+
+import (
+	"encoding/binary"
+)
+
+var ELF_BASE_ADDR uint64 = 0x4000_0000
+var ELF_ECALL_BUFFER_ADDR uint64 = 0x30_0000
+
+// Program address 0 is at ELF_MEMORY_ADDR. The program runs on its own stack
+// and PANICs when a function starts within ELF_STACK_GUARD_SIZE of its end.
+var ELF_MEMORY_ADDR uint64 = 0x1_0000
+var ELF_STACK_ADDR uint64 = 0x2000_0000
+var ELF_STACK_SIZE uint64 = 0x1000_0000
+var ELF_STACK_GUARD_SIZE uint64 = 0x1_0000
+var ELF_HEADERS_BYTES_COUNT int = 64 + (2 * 56)
+
+var elfCode []byte
+
+var elfFuncAddrList map[string]int
+var elfBlankFuncRelList []BlankFuncCall
+var elfBlankFuncAddrList []BlankFuncCall
+
+var elfBlockAddrList []int
+var elfBlankBlockRelList []BlankBlockJump
+var elfBlankJumpTableEntryList []BlankBlockJump
+
+var elfLocalDispList []int32
+
+func emitElfBytes(b ...byte) {
+	elfCode = append(elfCode, b...)
+}
+
+func emitElfUint32(v uint32) {
+	elfCode = binary.LittleEndian.AppendUint32(elfCode, v)
+}
+
+func emitElfUint64(v uint64) {
+	elfCode = binary.LittleEndian.AppendUint64(elfCode, v)
+}
+
+func emitElfBlankRel32() int {
+	addr := len(elfCode)
+	emitElfUint32(0)
+	return addr
+}
+
+func backpatchElfRel32(addr int, targetAddr int) {
+	binary.LittleEndian.PutUint32(elfCode[addr:], uint32(int32(targetAddr-(addr+4))))
+}
+
+func emitElfFuncRel32(ident string) {
+	elfBlankFuncRelList = append(elfBlankFuncRelList,
+		BlankFuncCall{Ident: ident, Addr: emitElfBlankRel32()})
+}
+
+func emitElfBlockRel32(b int) {
+	elfBlankBlockRelList = append(elfBlankBlockRelList,
+		BlankBlockJump{Block: b, Addr: emitElfBlankRel32()})
+}
+
+// mov rax, v
+func emitElfMovRaxImm(v uint64) {
+	if v < (1 << 32) {
+		emitElfBytes(0xb8)
+		emitElfUint32(uint32(v))
+	} else {
+		emitElfBytes(0x48, 0xb8)
+		emitElfUint64(v)
+	}
+}
+
+// mov rcx, v
+func emitElfMovRcxImm(v uint64) {
+	if v < (1 << 32) {
+		emitElfBytes(0xb9)
+		emitElfUint32(uint32(v))
+	} else {
+		emitElfBytes(0x48, 0xb9)
+		emitElfUint64(v)
+	}
+}
+
+// Keeps the low bytes of rax and extends them to 64 bits
+func emitElfCanonicalizeRax(ii IntInfo) {
+	switch ii.BytesCount {
+	case 1:
+		if ii.IsSigned {
+			emitElfBytes(0x48, 0x0f, 0xbe, 0xc0)
+		} else {
+			emitElfBytes(0x0f, 0xb6, 0xc0)
+		}
+	case 2:
+		if ii.IsSigned {
+			emitElfBytes(0x48, 0x0f, 0xbf, 0xc0)
+		} else {
+			emitElfBytes(0x0f, 0xb7, 0xc0)
+		}
+	case 4:
+		if ii.IsSigned {
+			emitElfBytes(0x48, 0x63, 0xc0)
+		} else {
+			emitElfBytes(0x89, 0xc0)
+		}
+	}
+}
+
+func emitElfPanicJump(cc byte) {
+	emitElfBytes(0x0f, cc)
+	emitElfFuncRel32(".panic")
+}
+
+// Panics unless the bytesCount bytes at the program address in rax are in
+// memory, and turns rax into the native address
+func emitElfMemoryRangeCheck(bytesCount uint64) {
+	// cmp rax, size-count; ja panic; add rax, addr
+	emitElfBytes(0x48, 0x3d)
+	emitElfUint32(uint32(MEMORY_SIZE - bytesCount))
+	emitElfPanicJump(0x87)
+	emitElfBytes(0x48, 0x05)
+	emitElfUint32(uint32(ELF_MEMORY_ADDR))
+}
+
+func emitElfBinaryOp(op TokenType, ii IntInfo, ii2 IntInfo) {
+	// pop rcx; pop rax
+	emitElfBytes(0x59, 0x58)
+
+	bitsCount := byte(ii.BytesCount * 8)
+
+	switch op {
+	case TT_ADD:
+		emitElfBytes(0x48, 0x01, 0xc8)
+	case TT_SUB:
+		emitElfBytes(0x48, 0x29, 0xc8)
+	case TT_AND:
+		emitElfBytes(0x48, 0x21, 0xc8)
+	case TT_OR:
+		emitElfBytes(0x48, 0x09, 0xc8)
+	case TT_XOR:
+		emitElfBytes(0x48, 0x31, 0xc8)
+	case TT_MUL:
+		emitElfBytes(0x48, 0x0f, 0xaf, 0xc1)
+	case TT_QUO, TT_REM:
+		// test rcx, rcx; jz panic
+		emitElfBytes(0x48, 0x85, 0xc9)
+		emitElfPanicJump(0x84)
+
+		if ii.IsSigned {
+			// mov rdx, min; cmp rax, rdx; jne +10; cmp rcx, -1; je panic
+			emitElfBytes(0x48, 0xba)
+			emitElfUint64(getSignExtendedValue(ii, uint64(1)<<(bitsCount-1)))
+			emitElfBytes(0x48, 0x39, 0xd0)
+			emitElfBytes(0x75, 0x0a)
+			emitElfBytes(0x48, 0x83, 0xf9, 0xff)
+			emitElfPanicJump(0x84)
+
+			// cqo; idiv rcx
+			emitElfBytes(0x48, 0x99, 0x48, 0xf7, 0xf9)
+		} else {
+			// xor edx, edx; div rcx
+			emitElfBytes(0x31, 0xd2, 0x48, 0xf7, 0xf1)
+		}
+
+		if op == TT_REM {
+			// mov rax, rdx
+			emitElfBytes(0x48, 0x89, 0xd0)
+		}
+	case TT_SHL, TT_SHR:
+		if ii2.IsSigned {
+			// test rcx, rcx; js panic
+			emitElfBytes(0x48, 0x85, 0xc9)
+			emitElfPanicJump(0x88)
+		}
+
+		// cmp rcx, bits
+		emitElfBytes(0x48, 0x83, 0xf9, bitsCount)
+
+		if op == TT_SHR && ii.IsSigned {
+			// jb +5; mov ecx, bits-1; sar rax, cl
+			emitElfBytes(0x72, 0x05, 0xb9)
+			emitElfUint32(uint32(bitsCount - 1))
+			emitElfBytes(0x48, 0xd3, 0xf8)
+		} else {
+			// jb +4; xor eax, eax; jmp +3; shl/shr rax, cl
+			emitElfBytes(0x72, 0x04, 0x31, 0xc0, 0xeb, 0x03)
+			if op == TT_SHL {
+				emitElfBytes(0x48, 0xd3, 0xe0)
+			} else {
+				emitElfBytes(0x48, 0xd3, 0xe8)
+			}
+		}
+	case TT_EQL, TT_NEQ, TT_LSS, TT_GTR, TT_LEQ, TT_GEQ:
+		cc := map[TokenType]byte{
+			TT_EQL: 0x94, TT_NEQ: 0x95,
+			TT_LSS: 0x92, TT_GTR: 0x97,
+			TT_LEQ: 0x96, TT_GEQ: 0x93}[op]
+
+		if ii.IsSigned {
+			cc = map[TokenType]byte{
+				TT_EQL: 0x94, TT_NEQ: 0x95,
+				TT_LSS: 0x9c, TT_GTR: 0x9f,
+				TT_LEQ: 0x9e, TT_GEQ: 0x9d}[op]
+		}
+
+		// cmp rax, rcx; setcc al; movzx eax, al
+		emitElfBytes(0x48, 0x39, 0xc8, 0x0f, cc, 0xc0, 0x0f, 0xb6, 0xc0)
+
+		ii = IntInfo{IsSigned: false, BytesCount: 1}
+	default:
+		PrintErrorAndExit(0)
+	}
+
+	emitElfCanonicalizeRax(ii)
+
+	// push rax
+	emitElfBytes(0x50)
+}
+
+func emitElfLoad(ii IntInfo) {
+	// pop rax
+	emitElfBytes(0x58)
+
+	emitElfMemoryRangeCheck(uint64(ii.BytesCount))
+
+	switch ii.BytesCount {
+	case 1:
+		if ii.IsSigned {
+			emitElfBytes(0x48, 0x0f, 0xbe, 0x00)
+		} else {
+			emitElfBytes(0x48, 0x0f, 0xb6, 0x00)
+		}
+	case 2:
+		if ii.IsSigned {
+			emitElfBytes(0x48, 0x0f, 0xbf, 0x00)
+		} else {
+			emitElfBytes(0x48, 0x0f, 0xb7, 0x00)
+		}
+	case 4:
+		if ii.IsSigned {
+			emitElfBytes(0x48, 0x63, 0x00)
+		} else {
+			emitElfBytes(0x8b, 0x00)
+		}
+	case 8:
+		emitElfBytes(0x48, 0x8b, 0x00)
+	}
+
+	emitElfBytes(0x50)
+}
+
+func emitElfStore(ii IntInfo) {
+	// pop rcx; pop rax
+	emitElfBytes(0x59, 0x58)
+
+	emitElfMemoryRangeCheck(uint64(ii.BytesCount))
+
+	switch ii.BytesCount {
+	case 1:
+		emitElfBytes(0x88, 0x08)
+	case 2:
+		emitElfBytes(0x66, 0x89, 0x08)
+	case 4:
+		emitElfBytes(0x89, 0x08)
+	case 8:
+		emitElfBytes(0x48, 0x89, 0x08)
+	}
+}
+
+func emitElfStoreString(buf []byte) {
+	buf = append(append(make([]byte, 0), buf...), 0)
+
+	// pop rax
+	emitElfBytes(0x58)
+
+	emitElfMemoryRangeCheck(uint64(len(buf)))
+
+	for i := 0; i < len(buf); {
+		switch n := len(buf) - i; {
+		case n >= 8:
+			// mov rcx, imm64; mov [rax+disp32], rcx
+			emitElfBytes(0x48, 0xb9)
+			emitElfBytes(buf[i : i+8]...)
+			emitElfBytes(0x48, 0x89, 0x88)
+			emitElfUint32(uint32(i))
+			i = i + 8
+		case n >= 4:
+			emitElfBytes(0xc7, 0x80)
+			emitElfUint32(uint32(i))
+			emitElfBytes(buf[i : i+4]...)
+			i = i + 4
+		case n >= 2:
+			emitElfBytes(0x66, 0xc7, 0x80)
+			emitElfUint32(uint32(i))
+			emitElfBytes(buf[i : i+2]...)
+			i = i + 2
+		default:
+			emitElfBytes(0xc6, 0x80)
+			emitElfUint32(uint32(i))
+			emitElfBytes(buf[i])
+			i = i + 1
+		}
+	}
+}
+
+func emitElfSwitch(instr IRInstr, ii IntInfo, blockIndex int) {
+	// pop rax
+	emitElfBytes(0x58)
+
+	if minValue, entriesCount, ok := getSwitchJumpTableInfo(ii, instr.CaseValueList); ok {
+		// mov rcx, min; sub rax, rcx; mov rcx, count; cmp rax, rcx; jae default
+		emitElfBytes(0x48, 0xb9)
+		emitElfUint64(getSignExtendedValue(ii, minValue))
+		emitElfBytes(0x48, 0x29, 0xc8)
+		emitElfMovRcxImm(entriesCount)
+		emitElfBytes(0x48, 0x39, 0xc8)
+		emitElfBytes(0x0f, 0x83)
+		emitElfBlockRel32(instr.TargetList[0])
+
+		// lea rcx, [rip+table]; movsxd rax, [rcx+rax*4]; add rax, rcx; jmp rax
+		emitElfBytes(0x48, 0x8d, 0x0d)
+		emitElfUint32(9)
+		emitElfBytes(0x48, 0x63, 0x04, 0x81, 0x48, 0x01, 0xc8, 0xff, 0xe0)
+
+		tableAddr := len(elfCode)
+
+		for i := 0; i < int(entriesCount); i++ {
+			elfBlankJumpTableEntryList = append(elfBlankJumpTableEntryList,
+				BlankBlockJump{Block: instr.TargetList[0], Addr: tableAddr, EntryIndex: i})
+			emitElfUint32(0)
+		}
+
+		for i, v := range instr.CaseValueList {
+			elfBlankJumpTableEntryList = append(elfBlankJumpTableEntryList,
+				BlankBlockJump{Block: instr.TargetList[i+1], Addr: tableAddr,
+					EntryIndex: int((v - minValue) & getIntInfoMask(ii))})
+		}
+
+		return
+	}
+
+	for i, v := range instr.CaseValueList {
+		// mov rcx, v; cmp rax, rcx; je target
+		emitElfBytes(0x48, 0xb9)
+		emitElfUint64(getSignExtendedValue(ii, v))
+		emitElfBytes(0x48, 0x39, 0xc8)
+		emitElfBytes(0x0f, 0x84)
+		emitElfBlockRel32(instr.TargetList[i+1])
+	}
+
+	if instr.TargetList[0] != blockIndex+1 {
+		emitElfBytes(0xe9)
+		emitElfBlockRel32(instr.TargetList[0])
+	}
+}
+
+func emitElfCallResult(returnValueInfo interface{}, argsCount int) {
+	if argsCount != 0 {
+		// add rsp, imm32
+		emitElfBytes(0x48, 0x81, 0xc4)
+		emitElfUint32(uint32(argsCount * 8))
+	}
+
+	if _, ok := returnValueInfo.(VoidInfo); !ok {
+		emitElfBytes(0x50)
+	}
+}
+
+func lowerIRBlockToElf(f IRFunc, blockIndex int) {
+	for _, instr := range f.BlockList[blockIndex].InstrList {
+		argII := func(k int) IntInfo {
+			return getIRIntInfo(f.ValueTypeList[instr.ArgList[k]])
+		}
+
+		switch instr.Op {
+		case IR_CONST:
+			v := getSignExtendedValue(getIRIntInfo(instr.Type), instr.Value)
+
+			if int64(v) >= -(1<<31) && int64(v) < (1<<31) {
+				// push imm32
+				emitElfBytes(0x68)
+				emitElfUint32(uint32(v))
+			} else {
+				emitElfMovRaxImm(v)
+				emitElfBytes(0x50)
+			}
+		case IR_FUNC_ADDR:
+			// lea rax, [rip+rel32]; push rax
+			emitElfBytes(0x48, 0x8d, 0x05)
+			elfBlankFuncAddrList = append(elfBlankFuncAddrList,
+				BlankFuncCall{Ident: instr.Ident, Addr: emitElfBlankRel32()})
+			emitElfBytes(0x50)
+		case IR_LOAD_LOCAL:
+			// push qword [rbp+disp32]
+			emitElfBytes(0xff, 0xb5)
+			emitElfUint32(uint32(elfLocalDispList[instr.Local]))
+		case IR_STORE_LOCAL:
+			// pop rax; mov [rbp+disp32], rax
+			emitElfBytes(0x58, 0x48, 0x89, 0x85)
+			emitElfUint32(uint32(elfLocalDispList[instr.Local]))
+		case IR_BINARY:
+			emitElfBinaryOp(instr.BinaryOp, argII(0), argII(1))
+		case IR_CONVERT:
+			emitElfBytes(0x58)
+			emitElfCanonicalizeRax(getIRIntInfo(instr.Type))
+			emitElfBytes(0x50)
+		case IR_CALL:
+			emitElfBytes(0xe8)
+			emitElfFuncRel32(instr.Ident)
+			emitElfCallResult(instr.Type, len(instr.ArgList))
+		case IR_CALL_INDIRECT:
+			// pop rax; call check; call rax
+			emitElfBytes(0x58, 0xe8)
+			emitElfFuncRel32(".check_func")
+			emitElfBytes(0xff, 0xd0)
+			emitElfCallResult(instr.Type, len(instr.ArgList)-1)
+		case IR_LOAD:
+			emitElfLoad(getIRIntInfo(instr.Type))
+		case IR_STORE:
+			emitElfStore(argII(1))
+		case IR_STORE_STRING:
+			emitElfStoreString(instr.Buf)
+		case IR_DISCARD:
+			emitElfBytes(0x58)
+		case IR_JUMP:
+			if instr.TargetList[0] != blockIndex+1 {
+				emitElfBytes(0xe9)
+				emitElfBlockRel32(instr.TargetList[0])
+			}
+		case IR_BRANCH:
+			// pop rax; test rax, rax; jz false
+			emitElfBytes(0x58, 0x48, 0x85, 0xc0, 0x0f, 0x84)
+			emitElfBlockRel32(instr.TargetList[1])
+
+			if instr.TargetList[0] != blockIndex+1 {
+				emitElfBytes(0xe9)
+				emitElfBlockRel32(instr.TargetList[0])
+			}
+		case IR_SWITCH:
+			emitElfSwitch(instr, argII(0), blockIndex)
+		case IR_RETURN:
+			if len(instr.ArgList) != 0 {
+				emitElfBytes(0x58)
+			}
+
+			// leave; ret
+			emitElfBytes(0xc9, 0xc3)
+		default:
+			PrintErrorAndExit(0)
+		}
+	}
+}
+
+func lowerIRFuncToElf(f IRFunc) {
+	elfFuncAddrList[f.Ident] = len(elfCode)
+
+	paramsCount := 0
+	for _, local := range f.LocalList {
+		if local.IsParam {
+			paramsCount++
+		}
+	}
+
+	elfLocalDispList = make([]int32, len(f.LocalList))
+
+	paramIndex := 0
+	localsCount := 0
+
+	for i, local := range f.LocalList {
+		if local.IsParam {
+			elfLocalDispList[i] = int32(16 + (8 * (paramsCount - 1 - paramIndex)))
+			paramIndex++
+		} else {
+			localsCount++
+			elfLocalDispList[i] = int32(-8 * localsCount)
+		}
+	}
+
+	// push rbp; mov rbp, rsp
+	emitElfBytes(0x55, 0x48, 0x89, 0xe5)
+
+	if localsCount != 0 {
+		// sub rsp, imm32
+		emitElfBytes(0x48, 0x81, 0xec)
+		emitElfUint32(uint32(localsCount * 8))
+	}
+
+	// cmp rsp, addr; jb panic
+	emitElfBytes(0x48, 0x81, 0xfc)
+	emitElfUint32(uint32(ELF_STACK_ADDR + ELF_STACK_GUARD_SIZE))
+	emitElfPanicJump(0x82)
+
+	if localsCount != 0 {
+		// mov rdi, rsp; mov ecx, count; xor eax, eax; rep stosq
+		emitElfBytes(0x48, 0x89, 0xe7, 0xb9)
+		emitElfUint32(uint32(localsCount))
+		emitElfBytes(0x31, 0xc0, 0xf3, 0x48, 0xab)
+	}
+
+	elfBlockAddrList = make([]int, len(f.BlockList))
+	elfBlankBlockRelList = make([]BlankBlockJump, 0)
+	elfBlankJumpTableEntryList = make([]BlankBlockJump, 0)
+
+	for i := range f.BlockList {
+		elfBlockAddrList[i] = len(elfCode)
+		lowerIRBlockToElf(f, i)
+	}
+
+	for _, bbj := range elfBlankBlockRelList {
+		backpatchElfRel32(bbj.Addr, elfBlockAddrList[bbj.Block])
+	}
+
+	for _, bbj := range elfBlankJumpTableEntryList {
+		binary.LittleEndian.PutUint32(elfCode[bbj.Addr+(bbj.EntryIndex*4):],
+			uint32(int32(elfBlockAddrList[bbj.Block]-bbj.Addr)))
+	}
+}
+
+// Maps zeroed memory at addr and panics if it cannot
+func emitElfMap(addr uint64, bytesCount uint64) {
+	// mov eax, 9; mov edi, addr; mov esi, size; mov edx, PROT_READ|PROT_WRITE
+	emitElfBytes(0xb8)
+	emitElfUint32(9)
+	emitElfBytes(0xbf)
+	emitElfUint32(uint32(addr))
+	emitElfBytes(0xbe)
+	emitElfUint32(uint32(bytesCount))
+	emitElfBytes(0xba)
+	emitElfUint32(3)
+
+	// mov r10d, MAP_PRIVATE|MAP_FIXED|MAP_ANONYMOUS|MAP_NORESERVE; mov r8, -1; xor r9d, r9d; syscall
+	emitElfBytes(0x41, 0xba)
+	emitElfUint32(0x4032)
+	emitElfBytes(0x49, 0xc7, 0xc0, 0xff, 0xff, 0xff, 0xff, 0x45, 0x31, 0xc9, 0x0f, 0x05)
+
+	// cmp rax, addr; jne panic
+	emitElfBytes(0x48, 0x3d)
+	emitElfUint32(uint32(addr))
+	emitElfPanicJump(0x85)
+}
+
+// Maps the program memory and stack, calls main and exits with status 0
+func emitElfEntry() {
+	// The bytes after the memory stay zero, so that ecall stops at its end
+	emitElfMap(ELF_MEMORY_ADDR, MEMORY_SIZE+8)
+	emitElfMap(ELF_STACK_ADDR, ELF_STACK_SIZE)
+
+	// mov rsp, addr
+	emitElfBytes(0x48, 0xc7, 0xc4)
+	emitElfUint32(uint32(ELF_STACK_ADDR + ELF_STACK_SIZE))
+
+	emitElfBytes(0xe8)
+	emitElfFuncRel32("main")
+
+	// mov eax, 231; xor edi, edi; syscall
+	emitElfBytes(0xb8)
+	emitElfUint32(231)
+	emitElfBytes(0x31, 0xff, 0x0f, 0x05)
+}
+
+// Writes the string at the ecall buffer and a newline to standard output
+func emitElfEcall() {
+	elfFuncAddrList["ecall"] = len(elfCode)
+
+	// mov esi, addr; xor edx, edx; cmp byte [rsi+rdx], 0; je +5; inc rdx; jmp -11
+	emitElfBytes(0xbe)
+	emitElfUint32(uint32(ELF_MEMORY_ADDR + ELF_ECALL_BUFFER_ADDR))
+	emitElfBytes(0x31, 0xd2, 0x80, 0x3c, 0x16, 0x00, 0x74, 0x05, 0x48, 0xff, 0xc2, 0xeb, 0xf5)
+
+	// mov eax, 1; mov edi, 1; syscall
+	emitElfBytes(0xb8)
+	emitElfUint32(1)
+	emitElfBytes(0xbf)
+	emitElfUint32(1)
+	emitElfBytes(0x0f, 0x05)
+
+	// lea rsi, [rip+18]; mov edx, 1; mov eax, 1; mov edi, 1; syscall; ret
+	emitElfBytes(0x48, 0x8d, 0x35)
+	emitElfUint32(18)
+	emitElfBytes(0xba)
+	emitElfUint32(1)
+	emitElfBytes(0xb8)
+	emitElfUint32(1)
+	emitElfBytes(0xbf)
+	emitElfUint32(1)
+	emitElfBytes(0x0f, 0x05, 0xc3)
+
+	emitElfBytes('\n')
+}
+
+// Writes PANIC to standard error and exits with status 1
+func emitElfPanic() {
+	elfFuncAddrList[".panic"] = len(elfCode)
+
+	// lea rsi, [rip+msg]; mov edx, 6; mov eax, 1; mov edi, 2; syscall
+	emitElfBytes(0x48, 0x8d, 0x35)
+	emitElfUint32(29)
+	emitElfBytes(0xba)
+	emitElfUint32(6)
+	emitElfBytes(0xb8)
+	emitElfUint32(1)
+	emitElfBytes(0xbf)
+	emitElfUint32(2)
+	emitElfBytes(0x0f, 0x05)
+
+	// mov eax, 231; mov edi, 1; syscall
+	emitElfBytes(0xb8)
+	emitElfUint32(231)
+	emitElfBytes(0xbf)
+	emitElfUint32(1)
+	emitElfBytes(0x0f, 0x05)
+
+	emitElfBytes([]byte("PANIC\n")...)
+}
+
+// Returns if rax is the address of a function that is used as a value and
+// panics otherwise, which also catches null function values
+func emitElfCheckFunc(funcsCount int) {
+	elfFuncAddrList[".check_func"] = len(elfCode)
+
+	// lea rsi, [rip+table]; mov ecx, count; test ecx, ecx; jz panic
+	emitElfBytes(0x48, 0x8d, 0x35)
+	emitElfFuncRel32(".func_table")
+	emitElfBytes(0xb9)
+	emitElfUint32(uint32(funcsCount))
+	emitElfBytes(0x85, 0xc9)
+	emitElfPanicJump(0x84)
+
+	// cmp rax, [rsi]; je +13; add rsi, 8; dec ecx; jnz -13; jmp panic; ret
+	emitElfBytes(0x48, 0x3b, 0x06, 0x74, 0x0d, 0x48, 0x83, 0xc6, 0x08, 0xff, 0xc9, 0x75, 0xf3, 0xe9)
+	emitElfFuncRel32(".panic")
+	emitElfBytes(0xc3)
+}
+
+// Function values can only be the addresses of the functions in the table
+func getElfFuncValueIdentList(ir IRProgram) []string {
+	isFuncValue := make(map[string]bool)
+
+	for _, f := range ir.FuncList {
+		for _, b := range f.BlockList {
+			for _, instr := range b.InstrList {
+				if instr.Op == IR_FUNC_ADDR {
+					isFuncValue[instr.Ident] = true
+				}
+			}
+		}
+	}
+
+	var funcValueIdentList []string
+	for _, f := range ir.FuncList {
+		if isFuncValue[f.Ident] {
+			funcValueIdentList = append(funcValueIdentList, f.Ident)
+		}
+	}
+
+	return funcValueIdentList
+}
+
+func encodeElfFile(code []byte) []byte {
+	headersBytesCount := ELF_HEADERS_BYTES_COUNT
+
+	elf := []byte{0x7f, 'E', 'L', 'F', 2, 1, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+
+	elf = binary.LittleEndian.AppendUint16(elf, 2)
+	elf = binary.LittleEndian.AppendUint16(elf, 0x3e)
+	elf = binary.LittleEndian.AppendUint32(elf, 1)
+	elf = binary.LittleEndian.AppendUint64(elf, ELF_BASE_ADDR+uint64(headersBytesCount))
+	elf = binary.LittleEndian.AppendUint64(elf, 64)
+	elf = binary.LittleEndian.AppendUint64(elf, 0)
+	elf = binary.LittleEndian.AppendUint32(elf, 0)
+	elf = binary.LittleEndian.AppendUint16(elf, 64)
+	elf = binary.LittleEndian.AppendUint16(elf, 56)
+	elf = binary.LittleEndian.AppendUint16(elf, 2)
+	elf = binary.LittleEndian.AppendUint16(elf, 64)
+	elf = binary.LittleEndian.AppendUint16(elf, 0)
+	elf = binary.LittleEndian.AppendUint16(elf, 0)
+
+	fileBytesCount := uint64(headersBytesCount + len(code))
+
+	// PT_LOAD, readable and executable, covering the whole file
+	elf = binary.LittleEndian.AppendUint32(elf, 1)
+	elf = binary.LittleEndian.AppendUint32(elf, 5)
+	elf = binary.LittleEndian.AppendUint64(elf, 0)
+	elf = binary.LittleEndian.AppendUint64(elf, ELF_BASE_ADDR)
+	elf = binary.LittleEndian.AppendUint64(elf, ELF_BASE_ADDR)
+	elf = binary.LittleEndian.AppendUint64(elf, fileBytesCount)
+	elf = binary.LittleEndian.AppendUint64(elf, fileBytesCount)
+	elf = binary.LittleEndian.AppendUint64(elf, 0x1000)
+
+	// PT_GNU_STACK, readable and writable
+	elf = binary.LittleEndian.AppendUint32(elf, 0x6474e551)
+	elf = binary.LittleEndian.AppendUint32(elf, 6)
+	for i := 0; i < 5; i++ {
+		elf = binary.LittleEndian.AppendUint64(elf, 0)
+	}
+	elf = binary.LittleEndian.AppendUint64(elf, 16)
+
+	return append(elf, code...)
+}
+
+func ElfGenerator(ir IRProgram) []byte {
+	elfCode = make([]byte, 0)
+
+	elfFuncAddrList = make(map[string]int)
+	elfBlankFuncRelList = make([]BlankFuncCall, 0)
+	elfBlankFuncAddrList = make([]BlankFuncCall, 0)
+
+	sigInfo, ok := ir.FuncSigList["main"]
+
+	if (!ok) || (len(sigInfo.ParamList) != 0) {
+		PrintErrorAndExit(0)
+	}
+
+	if _, ok := sigInfo.ReturnValueInfo.(VoidInfo); !ok {
+		PrintErrorAndExit(0)
+	}
+
+	funcValueIdentList := getElfFuncValueIdentList(ir)
+
+	emitElfEntry()
+	emitElfEcall()
+	emitElfPanic()
+	emitElfCheckFunc(len(funcValueIdentList))
+
+	for _, f := range ir.FuncList {
+		lowerIRFuncToElf(f)
+	}
+
+	elfFuncAddrList[".func_table"] = len(elfCode)
+
+	for _, ident := range funcValueIdentList {
+		emitElfUint64(ELF_BASE_ADDR + uint64(ELF_HEADERS_BYTES_COUNT+elfFuncAddrList[ident]))
+	}
+
+	for _, bfc := range append(elfBlankFuncRelList, elfBlankFuncAddrList...) {
+		funcAddr, ok := elfFuncAddrList[bfc.Ident]
+		if !ok {
+			PrintErrorAndExit(0)
+		}
+
+		backpatchElfRel32(bfc.Addr, funcAddr)
+	}
+
+	return encodeElfFile(elfCode)
+}
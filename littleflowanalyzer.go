@@ -0,0 +1,134 @@
+package main
+
+var isUnreachableCodeWarningEnabled = true
+
+var flowLoopBreakList []bool
+
+func flowLoopPush() {
+	flowLoopBreakList = append(flowLoopBreakList, false)
+}
+
+// Returns whether a break leaves the loop
+func flowLoopPop() bool {
+	isBroken := flowLoopBreakList[len(flowLoopBreakList)-1]
+
+	flowLoopBreakList = flowLoopBreakList[:len(flowLoopBreakList)-1]
+
+	return isBroken
+}
+
+// Only the first statement of an unreachable run is reported, and the code
+// inside it is not analyzed
+func analyzeFlowStmtList(tn TreeNode) bool {
+	for i, c := range tn.Children {
+		if analyzeFlowTreeNode(c) {
+			continue
+		}
+
+		if i+1 != len(tn.Children) && isUnreachableCodeWarningEnabled {
+			if l := getTreeNodeLineNumber(tn.Children[i+1]); l != 0 {
+				PrintWarning(l, "unreachable code")
+			}
+		}
+
+		return false
+	}
+
+	return true
+}
+
+// Returns whether the end of the statement can be reached. Both branches of
+// an if are taken to be possible, while a loop whose condition is a
+// constant other than zero only ends with a break.
+func analyzeFlowTreeNode(tn TreeNode) bool {
+	switch tn.Kype {
+	case TNT_STMT_LIST:
+		return analyzeFlowStmtList(tn)
+
+	case TNT_STMT_RETURN, TNT_STMT_CONTINUE:
+		return false
+
+	case TNT_STMT_BREAK:
+		flowLoopBreakList[tn.Symbol.Index] = true
+		return false
+
+	case TNT_STMT_IF:
+		isEndReachable := analyzeFlowTreeNode(tn.Children[1])
+		if len(tn.Children) == 3 {
+			return analyzeFlowTreeNode(tn.Children[2]) || isEndReachable
+		}
+		return true
+
+	case TNT_STMT_ELSE:
+		return analyzeFlowTreeNode(tn.Children[0])
+
+	case TNT_STMT_LABEL:
+		return analyzeFlowTreeNode(tn.Children[0])
+
+	case TNT_STMT_WHILE:
+		flowLoopPush()
+		analyzeFlowTreeNode(tn.Children[1])
+		isBroken := flowLoopPop()
+
+		_, v, ok := getConstExprValue(tn.Children[0])
+		return isBroken || !ok || v == 0
+
+	case TNT_STMT_FOR:
+		flowLoopPush()
+		analyzeFlowTreeNode(tn.Children[len(tn.Children)-1])
+		flowLoopPop()
+		return true
+
+	case TNT_STMT_SWITCH:
+		isEndReachable := true
+
+		for _, c := range tn.Children[1:] {
+			if c.Kype == TNT_STMT_DEFAULT {
+				isEndReachable = false
+			}
+		}
+
+		for _, c := range tn.Children[1:] {
+			if analyzeFlowTreeNode(c.Children[len(c.Children)-1]) {
+				isEndReachable = true
+			}
+		}
+
+		return isEndReachable
+
+	default:
+		return true
+	}
+}
+
+func hasFuncReturnType(funcSigTreeNode TreeNode) bool {
+	for _, c := range funcSigTreeNode.Children {
+		if c.Kype == TNT_FUNC_RETURN_TYPE {
+			return true
+		}
+	}
+	return false
+}
+
+// The tree must have been through the semantic analyzer, which resolves
+// the loop of every break. The parser ends every function with a return
+// without a value, which may only be reached in functions without a
+// return type. The error is on the end of the function.
+func FlowAnalyzer(tn TreeNode) {
+	for _, funcTreeNode := range tn.Children[0].Children {
+		curSourceFilePath = funcTreeNode.Children[0].Tok.SourceFilePath
+
+		flowLoopBreakList = make([]bool, 0)
+
+		stmtListTreeNode := funcTreeNode.Children[2]
+
+		bodyTreeNode := stmtListTreeNode
+		bodyTreeNode.Children = stmtListTreeNode.Children[:len(stmtListTreeNode.Children)-1]
+
+		if analyzeFlowStmtList(bodyTreeNode) && hasFuncReturnType(funcTreeNode.Children[1]) {
+			PrintErrorAndExit(stmtListTreeNode.Tok.LineNumber)
+		}
+	}
+
+	curSourceFilePath = ""
+}
@@ -0,0 +1,612 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var FMT_INDENT = "    "
+
+var fmtLineList []string
+
+// Comments are put back in source order before the code that follows them.
+// A comment after code on the same line stays at the end of that line.
+var fmtCommentToks []TokenData
+var fmtCodeLineList map[int]bool
+var isFmtLineCommented bool
+
+// At most one blank line is kept where the source had any, but not at the
+// start of a block
+var fmtBlankLineList map[int]bool
+var fmtPrevLineNumber int
+var isFmtBlockStart bool
+
+func PrintFormatErrorAndExit(s string) {
+	fmt.Println("Format error" + " " + "(" + s + ")")
+	os.Exit(EXIT_COMPILE_ERROR)
+}
+
+func emitFmtBlankLine(l int) {
+	if isFmtBlockStart || len(fmtLineList) == 0 || fmtLineList[len(fmtLineList)-1] == "" {
+		return
+	}
+
+	for k := fmtPrevLineNumber + 1; k < l; k++ {
+		if fmtBlankLineList[k] {
+			fmtLineList = append(fmtLineList, "")
+			isFmtLineCommented = true
+			return
+		}
+	}
+}
+
+func emitFmtCommentLine(tok TokenData, level int) {
+	emitFmtBlankLine(tok.LineNumber)
+
+	fmtLineList = append(fmtLineList, strings.Repeat(FMT_INDENT, level)+strings.TrimRight(string(tok.Buf), " "))
+	isFmtLineCommented = true
+	isFmtBlockStart = false
+	fmtPrevLineNumber = max(fmtPrevLineNumber, tok.LineNumber)
+}
+
+func emitFmtComments(l int, level int) {
+	for len(fmtCommentToks) != 0 && fmtCommentToks[0].LineNumber < l {
+		tok := fmtCommentToks[0]
+		fmtCommentToks = fmtCommentToks[1:]
+
+		// A line that already ends with a comment cannot take another one
+		if fmtCodeLineList[tok.LineNumber] && len(fmtLineList) != 0 && !isFmtLineCommented {
+			fmtLineList[len(fmtLineList)-1] = fmtLineList[len(fmtLineList)-1] + " " +
+				strings.TrimRight(string(tok.Buf), " ")
+			isFmtLineCommented = true
+		} else {
+			emitFmtCommentLine(tok, level)
+		}
+	}
+}
+
+// A piece of a formatted line with the source line of its first token, or
+// zero when the piece is not a token of the syntax tree
+type FmtPiece struct {
+	Buf        string
+	LineNumber int
+}
+
+type FmtLine struct {
+	Buf          string
+	LineNumber   int
+	LineNumberTo int
+}
+
+func newFmtPieceList(s string, l int) []FmtPiece {
+	return []FmtPiece{{Buf: s, LineNumber: l}}
+}
+
+func joinFmtPieceList(pieceLists ...[]FmtPiece) []FmtPiece {
+	var pieceList []FmtPiece
+	for _, l := range pieceLists {
+		pieceList = append(pieceList, l...)
+	}
+	return pieceList
+}
+
+func getFmtPieceListString(pieceList []FmtPiece) string {
+	s := ""
+	for _, piece := range pieceList {
+		s = s + piece.Buf
+	}
+	return s
+}
+
+func getFmtPieceListLineNumber(pieceList []FmtPiece) int {
+	for _, piece := range pieceList {
+		if piece.LineNumber != 0 {
+			return piece.LineNumber
+		}
+	}
+	return 0
+}
+
+// A line may end where the lexer drops the new line, which it keeps after
+// the tokens that can end a statement
+func canFmtLineBreakAfter(s string) bool {
+	toks, _ := generateTokens([]byte(s + "\n"))
+	return len(toks) >= 2 && toks[len(toks)-2].Kype != TT_NEW_LINE
+}
+
+// Breaks the pieces into lines where a new source line starts, if a line
+// may end there
+func splitFmtPieceList(pieceList []FmtPiece) []FmtLine {
+	var lineList []FmtLine
+	var line FmtLine
+
+	for _, piece := range pieceList {
+		if line.LineNumberTo != 0 && piece.LineNumber > line.LineNumberTo &&
+			canFmtLineBreakAfter(line.Buf) {
+			line.Buf = strings.TrimRight(line.Buf, " ")
+			lineList = append(lineList, line)
+
+			line = FmtLine{Buf: strings.TrimLeft(piece.Buf, " "), LineNumber: piece.LineNumber,
+				LineNumberTo: piece.LineNumber}
+			continue
+		}
+
+		line.Buf = line.Buf + piece.Buf
+
+		if line.LineNumber == 0 {
+			line.LineNumber = piece.LineNumber
+		}
+		line.LineNumberTo = max(line.LineNumberTo, piece.LineNumber)
+	}
+
+	return append(lineList, line)
+}
+
+// Emits code that comes from the source lines l1 to l2. Its line breaks are
+// kept where the source had them, with the following lines indented by two
+// more levels. A comment at the end of a source line stays at the end of the
+// line it ends up in, other comments go before the line that follows them.
+func emitFmtLine(l1 int, l2 int, level int, pieceList []FmtPiece) {
+	emitFmtComments(l1, level)
+
+	emitFmtBlankLine(l1)
+
+	lineList := splitFmtPieceList(pieceList)
+
+	for i, line := range lineList {
+		indent := level
+		if i != 0 {
+			indent = level + 2
+		}
+
+		lineNumberTo := line.LineNumberTo
+		if i == len(lineList)-1 {
+			lineNumberTo = max(lineNumberTo, l2)
+		}
+
+		n := 0
+		for n < len(fmtCommentToks) && fmtCommentToks[n].LineNumber <= lineNumberTo {
+			n++
+		}
+
+		comment := ""
+		if n != 0 && fmtCodeLineList[fmtCommentToks[n-1].LineNumber] {
+			comment = " " + strings.TrimRight(string(fmtCommentToks[n-1].Buf), " ")
+			n--
+		}
+
+		for _, tok := range fmtCommentToks[:n] {
+			emitFmtCommentLine(tok, indent)
+		}
+		fmtCommentToks = fmtCommentToks[n:]
+
+		if comment != "" {
+			fmtCommentToks = fmtCommentToks[1:]
+		}
+
+		fmtLineList = append(fmtLineList, strings.Repeat(FMT_INDENT, indent)+line.Buf+comment)
+		isFmtLineCommented = comment != ""
+		isFmtBlockStart = false
+		fmtPrevLineNumber = max(fmtPrevLineNumber, lineNumberTo)
+	}
+}
+
+// Emits a line that ends a block, like end or else. Comments before it
+// belong to the block.
+func emitFmtBlockEndLine(l1 int, l2 int, level int, pieceList []FmtPiece) {
+	emitFmtComments(l1, level+1)
+
+	isFmtBlockStart = true
+	emitFmtLine(l1, l2, level, pieceList)
+}
+
+func getFmtLineRange(tn TreeNode, l1 int, l2 int) (int, int) {
+	if tn.Tok.LineNumber != 0 {
+		l1 = min(l1, tn.Tok.LineNumber)
+		l2 = max(l2, tn.Tok.LineNumber)
+	}
+
+	for _, c := range tn.Children {
+		if c.Kype != TNT_STMT_LIST {
+			l1, l2 = getFmtLineRange(c, l1, l2)
+		}
+	}
+
+	return l1, l2
+}
+
+func formatFuncTypeSig(tn TreeNode) []FmtPiece {
+	pieceList := newFmtPieceList("(", 0)
+	var returnTypePieceList []FmtPiece
+
+	for _, c := range tn.Children {
+		if c.Kype == TNT_FUNC_TYPE_PARAM_LIST {
+			for i, funcTypeParamTreeNode := range c.Children {
+				if i != 0 {
+					pieceList = append(pieceList, FmtPiece{Buf: ", "})
+				}
+				pieceList = append(pieceList, formatType(funcTypeParamTreeNode)...)
+			}
+		} else if c.Kype == TNT_FUNC_TYPE_RETURN_TYPE {
+			returnTypePieceList = joinFmtPieceList(newFmtPieceList(" ", 0), formatType(c))
+		}
+	}
+
+	return joinFmtPieceList(pieceList, newFmtPieceList(")", 0), returnTypePieceList)
+}
+
+func formatType(tn TreeNode) []FmtPiece {
+	pieceList := newFmtPieceList(string(tn.Tok.Buf), tn.Tok.LineNumber)
+	if len(tn.Children) != 0 {
+		return joinFmtPieceList(pieceList, formatFuncTypeSig(tn.Children[0]))
+	}
+	return pieceList
+}
+
+func formatFmtParenExpr(tn TreeNode) []FmtPiece {
+	pieceList := formatExpr(tn)
+	return joinFmtPieceList(newFmtPieceList("(", getFmtPieceListLineNumber(pieceList)), pieceList,
+		newFmtPieceList(")", 0))
+}
+
+// Operators have no precedence, so a binary operand is put in parentheses
+// when it is on the right or when its operator differs
+func formatExpr(tn TreeNode) []FmtPiece {
+	switch tn.Kype {
+	case TNT_EXPR:
+		return formatExpr(tn.Children[0])
+
+	case TNT_EXPR_INT, TNT_EXPR_INT_LIT, TNT_EXPR_CHAR:
+		return newFmtPieceList(string(tn.Tok.Buf), tn.Tok.LineNumber)
+
+	case TNT_EXPR_NEG_INT_LIT:
+		return newFmtPieceList("-"+string(tn.Tok.Buf), tn.Tok.LineNumber)
+
+	case TNT_EXPR_FUNC:
+		pieceList := newFmtPieceList(string(tn.Tok.Buf)+"(", tn.Tok.LineNumber)
+		for i, funcParmTreeNode := range tn.Children[0].Children {
+			if i != 0 {
+				pieceList = append(pieceList, FmtPiece{Buf: ", "})
+			}
+			pieceList = append(pieceList, formatExpr(funcParmTreeNode.Children[0])...)
+		}
+		return append(pieceList, FmtPiece{Buf: ")"})
+
+	case TNT_EXPR_BINARY:
+		leftTreeNode := tn.Children[0]
+		rightTreeNode := tn.Children[1]
+
+		pieceList := formatExpr(leftTreeNode)
+		if leftTreeNode.Kype == TNT_EXPR_BINARY && leftTreeNode.Tok.Kype != tn.Tok.Kype {
+			pieceList = formatFmtParenExpr(leftTreeNode)
+		}
+
+		pieceList = append(pieceList, FmtPiece{Buf: " " + TokTypeToStr[tn.Tok.Kype] + " ",
+			LineNumber: tn.Tok.LineNumber})
+
+		if rightTreeNode.Kype == TNT_EXPR_BINARY {
+			return joinFmtPieceList(pieceList, formatFmtParenExpr(rightTreeNode))
+		}
+		return joinFmtPieceList(pieceList, formatExpr(rightTreeNode))
+	}
+
+	PrintFormatErrorAndExit("unknown expression " + TreeNodeTypeNames[tn.Kype])
+	return nil
+}
+
+func formatStmtList(tn TreeNode, level int) {
+	for _, c := range tn.Children {
+		formatStmt(c, level, "")
+	}
+}
+
+func formatStmtIf(tn TreeNode, level int, s string) {
+	l1, l2 := getFmtLineRange(tn.Children[0], tn.Tok.LineNumber, tn.Tok.LineNumber)
+
+	emitFmtLine(l1, l2, level, joinFmtPieceList(newFmtPieceList(s+"if ", tn.Tok.LineNumber),
+		formatExpr(tn.Children[0])))
+	isFmtBlockStart = true
+
+	stmtListTreeNode := tn.Children[1]
+	formatStmtList(stmtListTreeNode, level+1)
+
+	if len(tn.Children) == 2 {
+		l := stmtListTreeNode.Tok.LineNumber
+		emitFmtBlockEndLine(l, l, level, newFmtPieceList("end", l))
+		return
+	}
+
+	elseTreeNode := tn.Children[2]
+
+	if elseTreeNode.Children[0].Kype == TNT_STMT_IF {
+		emitFmtComments(stmtListTreeNode.Tok.LineNumber, level+1)
+		isFmtBlockStart = true
+
+		formatStmtIf(elseTreeNode.Children[0], level, "else ")
+		return
+	}
+
+	l := stmtListTreeNode.Tok.LineNumber
+	emitFmtBlockEndLine(l, l, level, newFmtPieceList("else", l))
+	isFmtBlockStart = true
+
+	formatStmtList(elseTreeNode.Children[0], level+1)
+
+	l = elseTreeNode.Children[0].Tok.LineNumber
+	emitFmtBlockEndLine(l, l, level, newFmtPieceList("end", l))
+}
+
+func formatStmt(tn TreeNode, level int, s string) {
+	l1, l2 := getFmtLineRange(tn, 1<<62, 0)
+
+	switch tn.Kype {
+	case TNT_STMT_DECL:
+		emitFmtLine(l1, l2, level, joinFmtPieceList(
+			newFmtPieceList("let "+string(tn.Children[0].Tok.Buf)+" ", tn.Children[0].Tok.LineNumber),
+			formatType(tn.Children[1])))
+
+	case TNT_STMT_EXPR:
+		emitFmtLine(l1, l2, level, formatExpr(tn.Children[0]))
+
+	case TNT_STMT_ASSIGN:
+		emitFmtLine(l1, l2, level, joinFmtPieceList(formatExpr(tn.Children[0]),
+			newFmtPieceList(" = ", tn.Tok.LineNumber), formatExpr(tn.Children[1])))
+
+	case TNT_STMT_STORE_STRING:
+		emitFmtLine(l1, l2, level, joinFmtPieceList(formatExpr(tn.Children[0]),
+			newFmtPieceList(" <- ", tn.Tok.LineNumber),
+			newFmtPieceList(string(tn.Children[1].Tok.Buf), tn.Children[1].Tok.LineNumber)))
+
+	case TNT_STMT_LABEL:
+		formatStmt(tn.Children[0], level, s+string(tn.Tok.Buf)+": ")
+
+	case TNT_STMT_WHILE, TNT_STMT_FOR:
+		var pieceList []FmtPiece
+
+		if tn.Kype == TNT_STMT_WHILE {
+			pieceList = joinFmtPieceList(newFmtPieceList(s+"while ", tn.Tok.LineNumber),
+				formatExpr(tn.Children[0]))
+		} else {
+			pieceList = joinFmtPieceList(newFmtPieceList(s+"for ", tn.Tok.LineNumber),
+				newFmtPieceList(string(tn.Children[0].Tok.Buf), tn.Children[0].Tok.LineNumber),
+				newFmtPieceList(" = ", 0), formatExpr(tn.Children[1]),
+				newFmtPieceList(" to ", 0), formatExpr(tn.Children[2]))
+			if len(tn.Children) == 5 {
+				pieceList = joinFmtPieceList(pieceList, newFmtPieceList(" step ", 0),
+					formatExpr(tn.Children[3]))
+			}
+		}
+
+		emitFmtLine(l1, l2, level, pieceList)
+		isFmtBlockStart = true
+
+		stmtListTreeNode := tn.Children[len(tn.Children)-1]
+		formatStmtList(stmtListTreeNode, level+1)
+
+		l := stmtListTreeNode.Tok.LineNumber
+		emitFmtBlockEndLine(l, l, level, newFmtPieceList("end", l))
+
+	case TNT_STMT_IF:
+		formatStmtIf(tn, level, s)
+
+	case TNT_STMT_SWITCH:
+		l1, l2 = getFmtLineRange(tn.Children[0], tn.Tok.LineNumber, tn.Tok.LineNumber)
+
+		emitFmtLine(l1, l2, level, joinFmtPieceList(newFmtPieceList("switch ", tn.Tok.LineNumber),
+			formatExpr(tn.Children[0])))
+		isFmtBlockStart = true
+
+		l := l2
+
+		for _, c := range tn.Children[1:] {
+			stmtListTreeNode := c.Children[len(c.Children)-1]
+
+			caseLine1, caseLine2 := getFmtLineRange(c, 1<<62, 0)
+
+			if c.Kype == TNT_STMT_CASE {
+				pieceList := newFmtPieceList("case ", c.Tok.LineNumber)
+				for i, exprTreeNode := range c.Children[0].Children {
+					if i != 0 {
+						pieceList = append(pieceList, FmtPiece{Buf: ", "})
+					}
+					pieceList = append(pieceList, formatExpr(exprTreeNode)...)
+				}
+				emitFmtBlockEndLine(caseLine1, caseLine2, level, pieceList)
+			} else {
+				emitFmtBlockEndLine(caseLine1, caseLine2, level, newFmtPieceList("default", c.Tok.LineNumber))
+			}
+			isFmtBlockStart = true
+
+			formatStmtList(stmtListTreeNode, level+1)
+
+			l = stmtListTreeNode.Tok.LineNumber
+		}
+
+		emitFmtBlockEndLine(l, l, level, newFmtPieceList("end", l))
+
+	case TNT_STMT_RETURN:
+		// Every function ends with a return added by the parser
+		if tn.Tok.LineNumber == 0 {
+			return
+		}
+
+		if len(tn.Children) != 0 {
+			emitFmtLine(l1, l2, level, joinFmtPieceList(newFmtPieceList("return ", tn.Tok.LineNumber),
+				formatExpr(tn.Children[0])))
+		} else {
+			emitFmtLine(l1, l2, level, newFmtPieceList("return", tn.Tok.LineNumber))
+		}
+
+	case TNT_STMT_BREAK, TNT_STMT_CONTINUE:
+		s = TokTypeToStr[tn.Tok.Kype]
+		if len(tn.Children) != 0 {
+			s = s + " " + string(tn.Children[0].Tok.Buf)
+		}
+		emitFmtLine(l1, l2, level, newFmtPieceList(s, tn.Tok.LineNumber))
+
+	default:
+		PrintFormatErrorAndExit("unknown statement " + TreeNodeTypeNames[tn.Kype])
+	}
+}
+
+func formatFunc(tn TreeNode) {
+	funcIdentTreeNode := tn.Children[0]
+
+	pieceList := newFmtPieceList("func "+string(funcIdentTreeNode.Tok.Buf)+"(",
+		funcIdentTreeNode.Tok.LineNumber)
+	var returnTypePieceList []FmtPiece
+
+	for _, c := range tn.Children[1].Children {
+		if c.Kype == TNT_FUNC_PARAM_LIST {
+			for i, funcParamTreeNode := range c.Children {
+				if i != 0 {
+					pieceList = append(pieceList, FmtPiece{Buf: ", "})
+				}
+
+				funcParamIdentTreeNode := funcParamTreeNode.Children[0]
+				pieceList = joinFmtPieceList(pieceList,
+					newFmtPieceList(string(funcParamIdentTreeNode.Tok.Buf)+" ",
+						funcParamIdentTreeNode.Tok.LineNumber),
+					formatType(funcParamTreeNode.Children[1]))
+			}
+		} else if c.Kype == TNT_FUNC_RETURN_TYPE {
+			returnTypePieceList = joinFmtPieceList(newFmtPieceList(" ", 0), formatType(c))
+		}
+	}
+
+	if len(fmtLineList) != 0 && fmtLineList[len(fmtLineList)-1] != "" {
+		fmtLineList = append(fmtLineList, "")
+		isFmtLineCommented = true
+	}
+
+	l1, l2 := getFmtLineRange(tn, 1<<62, 0)
+
+	emitFmtLine(l1, l2, 0, joinFmtPieceList(pieceList, newFmtPieceList(")", 0), returnTypePieceList))
+	isFmtBlockStart = true
+
+	stmtListTreeNode := tn.Children[2]
+	formatStmtList(stmtListTreeNode, 1)
+
+	l := stmtListTreeNode.Tok.LineNumber
+	emitFmtBlockEndLine(l, l, 0, newFmtPieceList("end", l))
+}
+
+func isSameFmtTreeNode(a TreeNode, b TreeNode) bool {
+	if a.Kype != b.Kype || a.Tok.Kype != b.Tok.Kype || !bytes.Equal(a.Tok.Buf, b.Tok.Buf) ||
+		len(a.Children) != len(b.Children) {
+		return false
+	}
+
+	for i := range a.Children {
+		if !isSameFmtTreeNode(a.Children[i], b.Children[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func parseFmtSourceCode(data []byte) (TreeNode, []TokenData) {
+	toks, commentToks := LexicalAnalyzerWithComments(append(append([]byte{}, data...), 0x0a))
+
+	fmtCodeLineList = make(map[int]bool)
+	for _, tok := range toks {
+		if tok.Kype != TT_NEW_LINE && tok.Kype != TT_EOF {
+			fmtCodeLineList[tok.LineNumber] = true
+		}
+	}
+
+	return SyntaxAnalyzer(toks), commentToks
+}
+
+// Writes source code again from its syntax tree with one statement per
+// line, an indent of four spaces and single spaces around operators. The
+// result must parse into the same tree and keep every comment.
+func Formatter(data []byte) []byte {
+	tn, commentToks := parseFmtSourceCode(data)
+
+	fmtLineList = make([]string, 0)
+	fmtCommentToks = commentToks
+	fmtPrevLineNumber = 0
+	isFmtBlockStart = false
+	isFmtLineCommented = false
+
+	fmtBlankLineList = make(map[int]bool)
+	for i, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == "" {
+			fmtBlankLineList[i+1] = true
+		}
+	}
+
+	for _, importTreeNode := range tn.Children[1].Children {
+		l := importTreeNode.Tok.LineNumber
+		emitFmtLine(l, l, 0, newFmtPieceList("import "+string(importTreeNode.Tok.Buf), l))
+	}
+
+	for _, funcTreeNode := range tn.Children[0].Children {
+		formatFunc(funcTreeNode)
+	}
+
+	emitFmtComments(1<<62, 0)
+
+	formattedData := []byte(strings.Join(fmtLineList, "\n") + "\n")
+
+	formattedTreeNode, formattedCommentToks := parseFmtSourceCode(formattedData)
+
+	if !isSameFmtTreeNode(tn, formattedTreeNode) {
+		PrintFormatErrorAndExit("the formatted code has a different syntax tree")
+	}
+
+	if len(commentToks) != len(formattedCommentToks) {
+		PrintFormatErrorAndExit("the formatted code lost comments")
+	}
+
+	for i := range commentToks {
+		if strings.TrimRight(string(commentToks[i].Buf), " ") != string(formattedCommentToks[i].Buf) {
+			PrintFormatErrorAndExit("the formatted code lost comments")
+		}
+	}
+
+	return formattedData
+}
+
+// Formats files in place, or lists the files that are not formatted and
+// fails when isCheck is set. Standard input is formatted to standard output.
+func formatSourceFiles(sourceFilePathList []string, isCheck bool) {
+	isFormatted := true
+
+	for _, sourceFilePath := range sourceFilePathList {
+		data, err := readSourceFile(sourceFilePath)
+		if err != nil {
+			PrintIOErrorAndExit(err)
+		}
+
+		curSourceFilePath = sourceFilePath
+
+		formattedData := Formatter(data)
+
+		curSourceFilePath = ""
+
+		if sourceFilePath == "-" && !isCheck {
+			writeOutputFile("-", formattedData, 0666)
+			continue
+		}
+
+		if bytes.Equal(data, formattedData) {
+			continue
+		}
+
+		if isCheck {
+			fmt.Println(sourceFilePath)
+			isFormatted = false
+		} else {
+			writeOutputFile(sourceFilePath, formattedData, 0666)
+		}
+	}
+
+	if !isFormatted {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestFormatterIsIdempotent(t *testing.T) {
+	for _, sourceCodeFilePath := range []string{"test_code", "example_code", "bench_code"} {
+		data, err := os.ReadFile(sourceCodeFilePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var once, twice []byte
+
+		ce, ok := catchCompileError(func() {
+			once = Formatter(data)
+			twice = Formatter(once)
+		})
+		if !ok {
+			t.Fatalf("%s: %s", sourceCodeFilePath, ce.Msg)
+		}
+
+		if string(once) != string(twice) {
+			t.Errorf("%s: formatting the formatted code changed it", sourceCodeFilePath)
+		}
+	}
+}
+
+func TestFormatterKeepsLineBreaksAndComments(t *testing.T) {
+	sourceCode := `# top comment
+func long_func(
+        a i64, # first
+        # about b
+        b i64,
+    c u8) u8 # returns u8
+    return u8(a) + # sum
+        u8(b) + c
+end
+
+func main()
+    let x u8
+    x = long_func(i64(1),
+       i64(2),   # two
+       u8(3))
+    switch x
+    case u8(1),
+        u8(2) # small
+        x = u8(0)
+    end
+    if (x == u8(1)) ||
+        # why
+        (x == u8(2))
+        x = u8(5)
+    end
+end
+`
+
+	formattedSourceCode := `# top comment
+func long_func(
+        a i64, # first
+        # about b
+        b i64,
+        c u8) u8 # returns u8
+    return u8(a) + # sum
+            u8(b) + c
+end
+
+func main()
+    let x u8
+    x = long_func(i64(1),
+            i64(2), # two
+            u8(3))
+    switch x
+    case u8(1),
+            u8(2) # small
+        x = u8(0)
+    end
+    if (x == u8(1)) ||
+            # why
+            (x == u8(2))
+        x = u8(5)
+    end
+end
+`
+
+	var b []byte
+
+	ce, ok := catchCompileError(func() {
+		b = Formatter([]byte(sourceCode))
+	})
+	if !ok {
+		t.Fatal(ce.Msg)
+	}
+
+	if string(b) != formattedSourceCode {
+		t.Errorf("got\n%s\nwant\n%s", b, formattedSourceCode)
+	}
+}
@@ -0,0 +1,345 @@
+package main
+
+var isInlinerEnabled = true
+
+var INLINE_MAX_INSTRS_COUNT = 16
+
+func getIRFuncInstrsCount(f IRFunc) int {
+	n := 0
+	for _, b := range f.BlockList {
+		n = n + len(b.InstrList)
+	}
+	return n
+}
+
+func getIRFuncCalleeIdentList(f IRFunc) []string {
+	var identList []string
+	for _, b := range f.BlockList {
+		for _, instr := range b.InstrList {
+			if instr.Op == IR_CALL {
+				identList = append(identList, instr.Ident)
+			}
+		}
+	}
+	return identList
+}
+
+func findIRFuncCall(funcIndexList map[string]int, ir IRProgram, k int, ident string,
+	isVisitedList map[int]bool) bool {
+
+	for _, calleeIdent := range getIRFuncCalleeIdentList(ir.FuncList[k]) {
+		if calleeIdent == ident {
+			return true
+		}
+
+		if j, ok := funcIndexList[calleeIdent]; ok && !isVisitedList[j] {
+			isVisitedList[j] = true
+
+			if findIRFuncCall(funcIndexList, ir, j, ident, isVisitedList) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Callees come before their callers, so that their calls are already
+// inlined when they are inlined themselves
+func appendIRFuncPostOrder(funcIndexList map[string]int, ir IRProgram, k int,
+	isVisitedList map[int]bool, orderList []int) []int {
+
+	if isVisitedList[k] {
+		return orderList
+	}
+
+	isVisitedList[k] = true
+
+	for _, calleeIdent := range getIRFuncCalleeIdentList(ir.FuncList[k]) {
+		if j, ok := funcIndexList[calleeIdent]; ok {
+			orderList = appendIRFuncPostOrder(funcIndexList, ir, j, isVisitedList, orderList)
+		}
+	}
+
+	return append(orderList, k)
+}
+
+func mapIRInstr(instr IRInstr, valueBase int, localBase int, blockBase int) IRInstr {
+	argList := make([]int, len(instr.ArgList))
+	for k, arg := range instr.ArgList {
+		argList[k] = valueBase + arg
+	}
+	instr.ArgList = argList
+
+	if instr.Dest != -1 {
+		instr.Dest = valueBase + instr.Dest
+	}
+
+	if instr.Op == IR_LOAD_LOCAL || instr.Op == IR_STORE_LOCAL {
+		instr.Local = localBase + instr.Local
+	}
+
+	targetList := make([]int, len(instr.TargetList))
+	for k, target := range instr.TargetList {
+		targetList[k] = blockBase + target
+	}
+	instr.TargetList = targetList
+
+	return instr
+}
+
+// Replaces the call at instrIndex of a block of f with the blocks of g. The
+// arguments are stored into copies of the parameters of g. A callee that
+// returns from its entry block is spliced into the block, otherwise the block
+// is split and the values below the arguments are kept in locals meanwhile.
+func inlineIRCall(f IRFunc, blockIndex int, instrIndex int, g IRFunc) IRFunc {
+	instrList := f.BlockList[blockIndex].InstrList
+	call := instrList[instrIndex]
+
+	var pendingValueList []int
+	for _, instr := range instrList[:instrIndex] {
+		pendingValueList = pendingValueList[:len(pendingValueList)-len(instr.ArgList)]
+		if instr.Dest != -1 {
+			pendingValueList = append(pendingValueList, instr.Dest)
+		}
+	}
+	pendingValueList = pendingValueList[:len(pendingValueList)-len(call.ArgList)]
+
+	localBase := len(f.LocalList)
+	localList := append([]IRLocal{}, f.LocalList...)
+
+	var paramLocalList []int
+
+	for k, local := range g.LocalList {
+		if local.IsParam {
+			paramLocalList = append(paramLocalList, localBase+k)
+		}
+		localList = append(localList, IRLocal{Ident: g.Ident + "." + local.Ident, Type: local.Type})
+	}
+
+	valueBase := len(f.ValueTypeList)
+	valueTypeList := append(append([]interface{}{}, f.ValueTypeList...), g.ValueTypeList...)
+
+	newInstrList := append([]IRInstr{}, instrList[:instrIndex]...)
+
+	for k := len(call.ArgList) - 1; k >= 0; k-- {
+		newInstrList = append(newInstrList, IRInstr{Op: IR_STORE_LOCAL, Dest: -1,
+			Local: paramLocalList[k], ArgList: []int{call.ArgList[k]}})
+	}
+
+	blockList := append([]IRBlock{}, f.BlockList...)
+
+	entryInstrList := g.BlockList[0].InstrList
+
+	if ret := entryInstrList[len(entryInstrList)-1]; ret.Op == IR_RETURN {
+		for _, instr := range entryInstrList[:len(entryInstrList)-1] {
+			instr = mapIRInstr(instr, valueBase, localBase, 0)
+			if len(ret.ArgList) != 0 && instr.Dest == valueBase+ret.ArgList[0] {
+				instr.Dest = call.Dest
+			}
+			newInstrList = append(newInstrList, instr)
+		}
+
+		blockList[blockIndex] = IRBlock{InstrList: append(newInstrList, instrList[instrIndex+1:]...)}
+
+		f.LocalList = localList
+		f.ValueTypeList = valueTypeList
+		f.BlockList = blockList
+
+		return f
+	}
+
+	blocksCount := len(g.BlockList)
+	contBlockIndex := blockIndex + 1 + blocksCount
+
+	for j, b := range blockList {
+		terminator := b.InstrList[len(b.InstrList)-1]
+
+		targetList := make([]int, len(terminator.TargetList))
+		for k, target := range terminator.TargetList {
+			targetList[k] = target
+			if target > blockIndex {
+				targetList[k] = target + blocksCount + 1
+			}
+		}
+		terminator.TargetList = targetList
+
+		blockList[j] = IRBlock{InstrList: append(append([]IRInstr{},
+			b.InstrList[:len(b.InstrList)-1]...), terminator)}
+	}
+
+	instrList = blockList[blockIndex].InstrList
+
+	spillLocalList := make([]int, len(pendingValueList))
+
+	for k := len(pendingValueList) - 1; k >= 0; k-- {
+		spillLocalList[k] = len(localList)
+		localList = append(localList, IRLocal{Ident: "spill.value",
+			Type: valueTypeList[pendingValueList[k]]})
+
+		newInstrList = append(newInstrList, IRInstr{Op: IR_STORE_LOCAL, Dest: -1,
+			Local: spillLocalList[k], ArgList: []int{pendingValueList[k]}})
+	}
+
+	newInstrList = append(newInstrList, IRInstr{Op: IR_JUMP, Dest: -1,
+		TargetList: []int{blockIndex + 1}})
+
+	resultLocal := -1
+	if call.Dest != -1 {
+		resultLocal = len(localList)
+		localList = append(localList, IRLocal{Ident: "inline.result", Type: call.Type})
+	}
+
+	var inlinedBlockList []IRBlock
+
+	for _, b := range g.BlockList {
+		var inlinedInstrList []IRInstr
+
+		for _, instr := range b.InstrList {
+			instr = mapIRInstr(instr, valueBase, localBase, blockIndex+1)
+
+			if instr.Op == IR_RETURN {
+				if resultLocal != -1 {
+					inlinedInstrList = append(inlinedInstrList, IRInstr{Op: IR_STORE_LOCAL, Dest: -1,
+						Local: resultLocal, ArgList: instr.ArgList})
+				}
+				instr = IRInstr{Op: IR_JUMP, Dest: -1, TargetList: []int{contBlockIndex}}
+			}
+
+			inlinedInstrList = append(inlinedInstrList, instr)
+		}
+
+		inlinedBlockList = append(inlinedBlockList, IRBlock{InstrList: inlinedInstrList})
+	}
+
+	var contInstrList []IRInstr
+
+	reloadedValueList := make(map[int]int)
+
+	for k, v := range pendingValueList {
+		reloadedValueList[v] = len(valueTypeList)
+		valueTypeList = append(valueTypeList, valueTypeList[v])
+
+		contInstrList = append(contInstrList, IRInstr{Op: IR_LOAD_LOCAL, Dest: reloadedValueList[v],
+			Type: valueTypeList[v], Local: spillLocalList[k]})
+	}
+
+	if resultLocal != -1 {
+		contInstrList = append(contInstrList, IRInstr{Op: IR_LOAD_LOCAL, Dest: call.Dest,
+			Type: call.Type, Local: resultLocal})
+	}
+
+	for _, instr := range instrList[instrIndex+1:] {
+		argList := make([]int, len(instr.ArgList))
+		for k, arg := range instr.ArgList {
+			argList[k] = arg
+			if v, ok := reloadedValueList[arg]; ok {
+				argList[k] = v
+			}
+		}
+		instr.ArgList = argList
+
+		contInstrList = append(contInstrList, instr)
+	}
+
+	newBlockList := append([]IRBlock{}, blockList[:blockIndex]...)
+	newBlockList = append(newBlockList, IRBlock{InstrList: newInstrList})
+	newBlockList = append(newBlockList, inlinedBlockList...)
+	newBlockList = append(newBlockList, IRBlock{InstrList: contInstrList})
+	newBlockList = append(newBlockList, blockList[blockIndex+1:]...)
+
+	f.LocalList = localList
+	f.ValueTypeList = valueTypeList
+	f.BlockList = newBlockList
+
+	return f
+}
+
+// Substitutes small functions that do not call themselves at their call
+// sites and drops the functions that are no longer reachable from the roots
+func InlineExpander(ir IRProgram, rootFuncIdentList []string) IRProgram {
+	funcIndexList := make(map[string]int)
+	for k, f := range ir.FuncList {
+		funcIndexList[f.Ident] = k
+	}
+
+	isRecursiveList := make(map[int]bool)
+	for k, f := range ir.FuncList {
+		isRecursiveList[k] = findIRFuncCall(funcIndexList, ir, k, f.Ident, map[int]bool{k: true})
+	}
+
+	var orderList []int
+	isVisitedList := make(map[int]bool)
+	for k := range ir.FuncList {
+		orderList = appendIRFuncPostOrder(funcIndexList, ir, k, isVisitedList, orderList)
+	}
+
+	for _, k := range orderList {
+		f := ir.FuncList[k]
+
+		for blockIndex := 0; blockIndex < len(f.BlockList); blockIndex++ {
+			for instrIndex := 0; instrIndex < len(f.BlockList[blockIndex].InstrList); instrIndex++ {
+				instr := f.BlockList[blockIndex].InstrList[instrIndex]
+
+				if instr.Op != IR_CALL {
+					continue
+				}
+
+				j, ok := funcIndexList[instr.Ident]
+				if !ok || isRecursiveList[j] ||
+					getIRFuncInstrsCount(ir.FuncList[j]) > INLINE_MAX_INSTRS_COUNT {
+					continue
+				}
+
+				f = inlineIRCall(f, blockIndex, instrIndex, ir.FuncList[j])
+				instrIndex = -1
+			}
+		}
+
+		ir.FuncList[k] = f
+	}
+
+	return removeUnreachableIRFuncs(ir, rootFuncIdentList)
+}
+
+// Keeps the functions that can be reached from the roots through calls or
+// function values
+func removeUnreachableIRFuncs(ir IRProgram, rootFuncIdentList []string) IRProgram {
+	funcIndexList := make(map[string]int)
+	for k, f := range ir.FuncList {
+		funcIndexList[f.Ident] = k
+	}
+
+	isReachableList := make(map[string]bool)
+	identList := append([]string{}, rootFuncIdentList...)
+
+	for len(identList) != 0 {
+		ident := identList[len(identList)-1]
+		identList = identList[:len(identList)-1]
+
+		k, ok := funcIndexList[ident]
+		if !ok || isReachableList[ident] {
+			continue
+		}
+
+		isReachableList[ident] = true
+
+		for _, b := range ir.FuncList[k].BlockList {
+			for _, instr := range b.InstrList {
+				if instr.Op == IR_CALL || instr.Op == IR_FUNC_ADDR {
+					identList = append(identList, instr.Ident)
+				}
+			}
+		}
+	}
+
+	var funcList []IRFunc
+	for _, f := range ir.FuncList {
+		if isReachableList[f.Ident] {
+			funcList = append(funcList, f)
+		}
+	}
+	ir.FuncList = funcList
+
+	return ir
+}
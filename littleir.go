@@ -0,0 +1,636 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+type IntInfo struct {
+	IsSigned   bool
+	BytesCount int
+}
+
+type IntAddressInfo struct {
+	RealSize   int
+	IsSigned   bool
+	BytesCount int
+}
+
+type VoidInfo struct {
+	BytesCount int
+}
+
+type FuncInfo struct {
+	Sig        FuncSigInfo
+	IsUntyped  bool
+	BytesCount int
+}
+
+type FuncAddressInfo struct {
+	Sig        FuncSigInfo
+	BytesCount int
+}
+
+type FuncSigInfo struct {
+	ParamList       []interface{}
+	ReturnValueInfo interface{}
+}
+
+var ADDR_BYTES_COUNT int = 8
+
+// Every target gives the program this much memory, starting at address 0
+var MEMORY_SIZE uint64 = 0x100_0000
+
+// Function values are handled like unsigned integers of the size of an
+// address by the backends
+func getIRIntInfo(i interface{}) IntInfo {
+	switch v := i.(type) {
+	case IntInfo:
+		return v
+	case FuncInfo:
+		return IntInfo{IsSigned: false, BytesCount: ADDR_BYTES_COUNT}
+	default:
+		PrintErrorAndExit(0)
+	}
+	return IntInfo{}
+}
+
+func getIntInfoMask(ii IntInfo) uint64 {
+	return (^uint64(0)) >> ((8 - ii.BytesCount) * 8)
+}
+
+func getSignExtendedValue(ii IntInfo, v uint64) uint64 {
+	v = v & getIntInfoMask(ii)
+	if ii.IsSigned && (v&(uint64(1)<<((ii.BytesCount*8)-1)) != 0) {
+		v = v | (^getIntInfoMask(ii))
+	}
+	return v
+}
+
+func isSameTypeInfo(a interface{}, b interface{}) bool {
+	switch va := a.(type) {
+	case IntInfo:
+		vb, ok := b.(IntInfo)
+		return ok && (va.IsSigned == vb.IsSigned) && (va.BytesCount == vb.BytesCount)
+	case FuncInfo:
+		vb, ok := b.(FuncInfo)
+		return ok && (va.IsUntyped || vb.IsUntyped || isSameFuncSigInfo(va.Sig, vb.Sig))
+	case VoidInfo:
+		_, ok := b.(VoidInfo)
+		return ok
+	default:
+		return false
+	}
+}
+
+func isSameFuncSigInfo(a FuncSigInfo, b FuncSigInfo) bool {
+	if len(a.ParamList) != len(b.ParamList) {
+		return false
+	}
+
+	for i := range a.ParamList {
+		if !isSameTypeInfo(a.ParamList[i], b.ParamList[i]) {
+			return false
+		}
+	}
+
+	return isSameTypeInfo(a.ReturnValueInfo, b.ReturnValueInfo)
+}
+
+func getValueTypeInfo(i interface{}) (interface{}, bool) {
+	switch v := i.(type) {
+	case IntInfo:
+		return v, true
+	case IntAddressInfo:
+		return IntInfo{IsSigned: v.IsSigned, BytesCount: v.RealSize}, true
+	case FuncInfo:
+		return v, true
+	case FuncAddressInfo:
+		return FuncInfo{Sig: v.Sig, IsUntyped: false, BytesCount: ADDR_BYTES_COUNT}, true
+	default:
+		return nil, false
+	}
+}
+
+func getTypeStringFromTypeInfo(i interface{}) string {
+	switch v := i.(type) {
+	case IntInfo:
+		return getTypeStringFromIntInfo(v)
+	case FuncInfo:
+		if v.IsUntyped {
+			return "fn"
+		}
+
+		var paramStringList []string
+		for _, p := range v.Sig.ParamList {
+			paramStringList = append(paramStringList, getTypeStringFromTypeInfo(p))
+		}
+
+		s := "fn(" + strings.Join(paramStringList, ", ") + ")"
+		if _, ok := v.Sig.ReturnValueInfo.(VoidInfo); !ok {
+			s = s + " " + getTypeStringFromTypeInfo(v.Sig.ReturnValueInfo)
+		}
+		return s
+	case VoidInfo:
+		return "void"
+	default:
+		return "?"
+	}
+}
+
+func getTypeInfoBytesCount(i interface{}) int {
+	switch v := i.(type) {
+	case IntInfo:
+		return v.BytesCount
+	case FuncInfo:
+		return v.BytesCount
+	default:
+		return 0
+	}
+}
+
+type IROpType int
+
+const (
+	IR_ILLEGAL IROpType = iota
+
+	IR_CONST
+	IR_FUNC_ADDR
+
+	IR_LOAD_LOCAL
+	IR_STORE_LOCAL
+
+	IR_BINARY
+	IR_CONVERT
+
+	IR_CALL
+	IR_CALL_INDIRECT
+
+	IR_LOAD
+	IR_STORE
+	IR_STORE_STRING
+
+	IR_DISCARD
+
+	IR_JUMP
+	IR_BRANCH
+	IR_SWITCH
+	IR_RETURN
+)
+
+var IROpTypeNames = map[IROpType]string{
+	IR_ILLEGAL:       "illegal",
+	IR_CONST:         "const",
+	IR_FUNC_ADDR:     "funcaddr",
+	IR_LOAD_LOCAL:    "load.local",
+	IR_STORE_LOCAL:   "store.local",
+	IR_BINARY:        "binary",
+	IR_CONVERT:       "convert",
+	IR_CALL:          "call",
+	IR_CALL_INDIRECT: "call.indirect",
+	IR_LOAD:          "load",
+	IR_STORE:         "store",
+	IR_STORE_STRING:  "store.string",
+	IR_DISCARD:       "discard",
+	IR_JUMP:          "jump",
+	IR_BRANCH:        "branch",
+	IR_SWITCH:        "switch",
+	IR_RETURN:        "return",
+}
+
+var IRBinaryOpNames = map[TokenType]string{
+	TT_ADD: "add",
+	TT_SUB: "sub",
+	TT_MUL: "mul",
+	TT_QUO: "quo",
+	TT_REM: "rem",
+	TT_AND: "and",
+	TT_OR:  "or",
+	TT_XOR: "xor",
+	TT_SHL: "shl",
+	TT_SHR: "shr",
+	TT_EQL: "eql",
+	TT_NEQ: "neq",
+	TT_LSS: "lss",
+	TT_GTR: "gtr",
+	TT_LEQ: "leq",
+	TT_GEQ: "geq",
+}
+
+// Values live inside one block and are used exactly once, in the reverse
+// order of their definition, so that every instruction consumes the values
+// on top of an evaluation stack. Data that crosses blocks goes through locals.
+type IRInstr struct {
+	Op IROpType
+
+	Dest int
+	Type interface{}
+
+	ArgList []int
+
+	BinaryOp TokenType
+	Value    uint64
+	Local    int
+	Ident    string
+	Buf      []byte
+
+	TargetList    []int
+	CaseValueList []uint64
+
+	// Inlined instructions keep the source file of the function they came
+	// from
+	SourceFilePath string
+	Line           int
+}
+
+type IRBlock struct {
+	InstrList []IRInstr
+}
+
+type IRLocal struct {
+	Ident   string
+	Type    interface{}
+	IsParam bool
+	Line    int
+}
+
+type IRFunc struct {
+	Ident          string
+	Sig            FuncSigInfo
+	SourceFilePath string
+	Line           int
+
+	LocalList     []IRLocal
+	ValueTypeList []interface{}
+	BlockList     []IRBlock
+}
+
+type IRProgram struct {
+	FuncList    []IRFunc
+	FuncSigList map[string]FuncSigInfo
+}
+
+func isIRTerminator(op IROpType) bool {
+	return op == IR_JUMP || op == IR_BRANCH || op == IR_SWITCH || op == IR_RETURN
+}
+
+func getIRInstrString(instr IRInstr) string {
+	s := ""
+
+	if instr.Dest != -1 {
+		s = "v" + strconv.Itoa(instr.Dest) + " = "
+	}
+
+	if instr.Op == IR_BINARY {
+		s = s + IRBinaryOpNames[instr.BinaryOp]
+	} else {
+		s = s + IROpTypeNames[instr.Op]
+	}
+
+	if instr.Type != nil {
+		s = s + " " + getTypeStringFromTypeInfo(instr.Type)
+	}
+
+	var operandStringList []string
+
+	switch instr.Op {
+	case IR_CONST:
+		operandStringList = append(operandStringList, strconv.FormatUint(instr.Value, 10))
+	case IR_FUNC_ADDR, IR_CALL:
+		operandStringList = append(operandStringList, instr.Ident)
+	case IR_LOAD_LOCAL, IR_STORE_LOCAL:
+		operandStringList = append(operandStringList, "l"+strconv.Itoa(instr.Local))
+	}
+
+	for _, arg := range instr.ArgList {
+		operandStringList = append(operandStringList, "v"+strconv.Itoa(arg))
+	}
+
+	switch instr.Op {
+	case IR_STORE_STRING:
+		operandStringList = append(operandStringList, strconv.Quote(string(instr.Buf)))
+	case IR_JUMP, IR_BRANCH:
+		for _, target := range instr.TargetList {
+			operandStringList = append(operandStringList, "b"+strconv.Itoa(target))
+		}
+	case IR_SWITCH:
+		operandStringList = append(operandStringList, "b"+strconv.Itoa(instr.TargetList[0]))
+		for i, v := range instr.CaseValueList {
+			operandStringList = append(operandStringList,
+				strconv.FormatUint(v, 10)+": b"+strconv.Itoa(instr.TargetList[i+1]))
+		}
+	}
+
+	if len(operandStringList) != 0 {
+		s = s + " " + strings.Join(operandStringList, ", ")
+	}
+
+	return s
+}
+
+func FormatIR(ir IRProgram) string {
+	var sb strings.Builder
+
+	for i, f := range ir.FuncList {
+		if i != 0 {
+			sb.WriteString("\n")
+		}
+
+		sb.WriteString("func " + f.Ident + " " + getTypeStringFromTypeInfo(
+			FuncInfo{Sig: f.Sig, BytesCount: ADDR_BYTES_COUNT}) + "\n")
+
+		for j, local := range f.LocalList {
+			kind := "local"
+			if local.IsParam {
+				kind = "param"
+			}
+			sb.WriteString("    " + kind + " l" + strconv.Itoa(j) + " " + local.Ident + " " +
+				getTypeStringFromTypeInfo(local.Type) + "\n")
+		}
+
+		for j, b := range f.BlockList {
+			sb.WriteString("b" + strconv.Itoa(j) + ":\n")
+
+			for _, instr := range b.InstrList {
+				sb.WriteString("    " + getIRInstrString(instr) + "\n")
+			}
+		}
+	}
+
+	return sb.String()
+}
+
+func PrintIRErrorAndExit(f IRFunc, blockIndex int, s string) {
+	raiseCompileError(f.SourceFilePath, 0, "IR error"+" "+"("+f.Ident+" "+"b"+strconv.Itoa(blockIndex)+": "+
+		s+")")
+}
+
+func verifyIRInstrType(f IRFunc, ir IRProgram, instr IRInstr, argTypeList []interface{}) string {
+	addrII := IntInfo{IsSigned: false, BytesCount: ADDR_BYTES_COUNT}
+
+	isInt := func(i interface{}) bool {
+		_, ok := i.(IntInfo)
+		return ok
+	}
+	isFunc := func(i interface{}) bool {
+		_, ok := i.(FuncInfo)
+		return ok
+	}
+
+	checkArgList := func(paramList []interface{}) bool {
+		if len(paramList) != len(argTypeList) {
+			return false
+		}
+		for i, p := range paramList {
+			if !isSameTypeInfo(p, argTypeList[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	switch instr.Op {
+	case IR_CONST:
+		if !isInt(instr.Type) && !isFunc(instr.Type) {
+			return "const of invalid type"
+		}
+	case IR_FUNC_ADDR:
+		sig, ok := ir.FuncSigList[instr.Ident]
+		if !ok || !isSameTypeInfo(instr.Type, FuncInfo{Sig: sig, BytesCount: ADDR_BYTES_COUNT}) {
+			return "unknown function " + instr.Ident
+		}
+	case IR_LOAD_LOCAL:
+		if instr.Local < 0 || instr.Local >= len(f.LocalList) {
+			return "unknown local"
+		}
+		if !isSameTypeInfo(f.LocalList[instr.Local].Type, instr.Type) {
+			return "local type mismatch"
+		}
+	case IR_STORE_LOCAL:
+		if instr.Local < 0 || instr.Local >= len(f.LocalList) {
+			return "unknown local"
+		}
+		if !isSameTypeInfo(f.LocalList[instr.Local].Type, argTypeList[0]) {
+			return "local type mismatch"
+		}
+	case IR_BINARY:
+		a, b := argTypeList[0], argTypeList[1]
+
+		if _, ok := IRBinaryOpNames[instr.BinaryOp]; !ok {
+			return "unknown binary operator"
+		}
+
+		isComparison := instr.BinaryOp == TT_EQL || instr.BinaryOp == TT_NEQ ||
+			instr.BinaryOp == TT_LSS || instr.BinaryOp == TT_GTR ||
+			instr.BinaryOp == TT_LEQ || instr.BinaryOp == TT_GEQ
+
+		resultType := a
+		if isComparison {
+			resultType = IntInfo{IsSigned: false, BytesCount: 1}
+		}
+
+		if isFunc(a) {
+			if (instr.BinaryOp != TT_EQL && instr.BinaryOp != TT_NEQ) || !isSameTypeInfo(a, b) {
+				return "invalid function operands"
+			}
+		} else if !isInt(a) || !isInt(b) {
+			return "invalid operands"
+		} else if instr.BinaryOp != TT_SHL && instr.BinaryOp != TT_SHR && !isSameTypeInfo(a, b) {
+			return "operand type mismatch"
+		}
+
+		if !isSameTypeInfo(instr.Type, resultType) {
+			return "result type mismatch"
+		}
+	case IR_CONVERT:
+		if !isInt(instr.Type) {
+			return "convert to invalid type"
+		}
+		if isFunc(argTypeList[0]) && !isSameTypeInfo(instr.Type, addrII) {
+			return "convert of function to invalid type"
+		}
+		if !isInt(argTypeList[0]) && !isFunc(argTypeList[0]) {
+			return "convert of invalid type"
+		}
+	case IR_CALL:
+		sig, ok := ir.FuncSigList[instr.Ident]
+		if !ok {
+			return "unknown function " + instr.Ident
+		}
+		if !checkArgList(sig.ParamList) || !isSameTypeInfo(instr.Type, sig.ReturnValueInfo) {
+			return "call type mismatch"
+		}
+	case IR_CALL_INDIRECT:
+		fi, ok := argTypeList[len(argTypeList)-1].(FuncInfo)
+		if !ok || fi.IsUntyped {
+			return "indirect call of invalid type"
+		}
+		argTypeList = argTypeList[:len(argTypeList)-1]
+		if !checkArgList(fi.Sig.ParamList) || !isSameTypeInfo(instr.Type, fi.Sig.ReturnValueInfo) {
+			return "call type mismatch"
+		}
+	case IR_LOAD:
+		if !isSameTypeInfo(argTypeList[0], addrII) || (!isInt(instr.Type) && !isFunc(instr.Type)) {
+			return "invalid load"
+		}
+	case IR_STORE:
+		if !isSameTypeInfo(argTypeList[0], addrII) || (!isInt(argTypeList[1]) && !isFunc(argTypeList[1])) {
+			return "invalid store"
+		}
+	case IR_STORE_STRING:
+		if !isSameTypeInfo(argTypeList[0], addrII) {
+			return "invalid string store"
+		}
+	case IR_BRANCH:
+		if !isInt(argTypeList[0]) {
+			return "branch on invalid type"
+		}
+	case IR_SWITCH:
+		ii, ok := argTypeList[0].(IntInfo)
+		if !ok {
+			return "switch on invalid type"
+		}
+		caseValueList := make(map[uint64]bool)
+		for _, v := range instr.CaseValueList {
+			if v != (v&getIntInfoMask(ii)) || caseValueList[v] {
+				return "invalid case value"
+			}
+			caseValueList[v] = true
+		}
+	case IR_RETURN:
+		if _, ok := f.Sig.ReturnValueInfo.(VoidInfo); ok {
+			if len(argTypeList) != 0 {
+				return "return type mismatch"
+			}
+		} else if len(argTypeList) != 1 || !isSameTypeInfo(f.Sig.ReturnValueInfo, argTypeList[0]) {
+			return "return type mismatch"
+		}
+	}
+
+	return ""
+}
+
+func getIRInstrArgsCount(instr IRInstr) (int, bool) {
+	n, ok := map[IROpType]int{
+		IR_CONST:        0,
+		IR_FUNC_ADDR:    0,
+		IR_LOAD_LOCAL:   0,
+		IR_STORE_LOCAL:  1,
+		IR_BINARY:       2,
+		IR_CONVERT:      1,
+		IR_LOAD:         1,
+		IR_STORE:        2,
+		IR_STORE_STRING: 1,
+		IR_DISCARD:      1,
+		IR_JUMP:         0,
+		IR_BRANCH:       1,
+		IR_SWITCH:       1,
+	}[instr.Op]
+
+	return n, ok
+}
+
+func getIRInstrTargetsCount(instr IRInstr) int {
+	switch instr.Op {
+	case IR_JUMP:
+		return 1
+	case IR_BRANCH:
+		return 2
+	case IR_SWITCH:
+		return len(instr.CaseValueList) + 1
+	default:
+		return 0
+	}
+}
+
+func verifyIRFunc(f IRFunc, ir IRProgram) {
+	if len(f.BlockList) == 0 {
+		PrintIRErrorAndExit(f, 0, "function without blocks")
+	}
+
+	isDefined := make(map[int]bool)
+
+	for i, local := range f.LocalList {
+		if _, ok := getValueTypeInfo(local.Type); !ok {
+			PrintIRErrorAndExit(f, 0, "local l"+strconv.Itoa(i)+" of invalid type")
+		}
+	}
+
+	for blockIndex, b := range f.BlockList {
+		if len(b.InstrList) == 0 {
+			PrintIRErrorAndExit(f, blockIndex, "empty block")
+		}
+
+		var pendingValueList []int
+
+		for j, instr := range b.InstrList {
+			if isIRTerminator(instr.Op) != (j == len(b.InstrList)-1) {
+				PrintIRErrorAndExit(f, blockIndex, "misplaced terminator")
+			}
+
+			n, ok := getIRInstrArgsCount(instr)
+			if instr.Op == IR_CALL || instr.Op == IR_CALL_INDIRECT || instr.Op == IR_RETURN {
+				n, ok = len(instr.ArgList), true
+			}
+			if !ok || n != len(instr.ArgList) || (instr.Op == IR_CALL_INDIRECT && n == 0) ||
+				(instr.Op == IR_RETURN && n > 1) {
+				PrintIRErrorAndExit(f, blockIndex, "invalid instruction "+IROpTypeNames[instr.Op])
+			}
+
+			if n > len(pendingValueList) {
+				PrintIRErrorAndExit(f, blockIndex, "missing operand")
+			}
+
+			var argTypeList []interface{}
+
+			for k, arg := range instr.ArgList {
+				if arg != pendingValueList[len(pendingValueList)-n+k] {
+					PrintIRErrorAndExit(f, blockIndex, "operand v"+strconv.Itoa(arg)+" out of order")
+				}
+				argTypeList = append(argTypeList, f.ValueTypeList[arg])
+			}
+
+			pendingValueList = pendingValueList[:len(pendingValueList)-n]
+
+			if msg := verifyIRInstrType(f, ir, instr, argTypeList); msg != "" {
+				PrintIRErrorAndExit(f, blockIndex, msg)
+			}
+
+			if len(instr.TargetList) != getIRInstrTargetsCount(instr) {
+				PrintIRErrorAndExit(f, blockIndex, "invalid targets")
+			}
+
+			for _, target := range instr.TargetList {
+				if target <= 0 || target >= len(f.BlockList) {
+					PrintIRErrorAndExit(f, blockIndex, "invalid target b"+strconv.Itoa(target))
+				}
+			}
+
+			if instr.Dest != -1 {
+				if instr.Dest < 0 || instr.Dest >= len(f.ValueTypeList) || isDefined[instr.Dest] {
+					PrintIRErrorAndExit(f, blockIndex, "invalid value v"+strconv.Itoa(instr.Dest))
+				}
+				if !isSameTypeInfo(f.ValueTypeList[instr.Dest], instr.Type) {
+					PrintIRErrorAndExit(f, blockIndex, "value v"+strconv.Itoa(instr.Dest)+
+						" type mismatch")
+				}
+
+				isDefined[instr.Dest] = true
+				pendingValueList = append(pendingValueList, instr.Dest)
+			} else if _, ok := instr.Type.(VoidInfo); !ok && instr.Type != nil {
+				PrintIRErrorAndExit(f, blockIndex, "unused result")
+			}
+		}
+
+		if len(pendingValueList) != 0 {
+			PrintIRErrorAndExit(f, blockIndex, "unused value v"+
+				strconv.Itoa(pendingValueList[len(pendingValueList)-1]))
+		}
+	}
+}
+
+func IRVerifier(ir IRProgram) {
+	for _, f := range ir.FuncList {
+		verifyIRFunc(f, ir)
+	}
+}
@@ -0,0 +1,1027 @@
+package main
+
+import "strconv"
+
+func getIntInfoFromTypeString(s string) (IntInfo, bool) {
+	if ii, ok := map[string]IntInfo{
+		"i8":  {IsSigned: true, BytesCount: 1},
+		"i16": {IsSigned: true, BytesCount: 2},
+		"i32": {IsSigned: true, BytesCount: 4},
+		"i64": {IsSigned: true, BytesCount: 8},
+
+		"u8":  {IsSigned: false, BytesCount: 1},
+		"u16": {IsSigned: false, BytesCount: 2},
+		"u32": {IsSigned: false, BytesCount: 4},
+		"u64": {IsSigned: false, BytesCount: 8},
+	}[s]; ok {
+		return ii, true
+	} else {
+		return IntInfo{}, false
+	}
+}
+
+func getTypeStringFromIntInfo(ii IntInfo) string {
+	if ii.IsSigned {
+		return "i" + strconv.Itoa(ii.BytesCount*8)
+	}
+
+	return "u" + strconv.Itoa(ii.BytesCount*8)
+}
+
+func getTypeInfoFromTypeTreeNode(tn TreeNode) (interface{}, bool) {
+	if len(tn.Children) == 0 {
+		if ii, ok := getIntInfoFromTypeString(string(tn.Tok.Buf)); ok {
+			return ii, true
+		}
+
+		return nil, false
+	}
+
+	if fsi, ok := getFuncSigInfoFromFuncTypeSigTreeNode(tn.Children[0]); ok {
+		return FuncInfo{Sig: fsi, IsUntyped: false, BytesCount: ADDR_BYTES_COUNT}, true
+	}
+
+	return nil, false
+}
+
+func getFuncSigInfoFromFuncTypeSigTreeNode(tn TreeNode) (FuncSigInfo, bool) {
+	var fsi FuncSigInfo
+
+	fsi.ParamList = make([]interface{}, 0)
+	fsi.ReturnValueInfo = VoidInfo{BytesCount: 0}
+
+	for _, c := range tn.Children {
+		if c.Kype == TNT_FUNC_TYPE_PARAM_LIST {
+			for _, funcTypeParamTreeNode := range c.Children {
+				if i, ok := getTypeInfoFromTypeTreeNode(funcTypeParamTreeNode); ok {
+					fsi.ParamList = append(fsi.ParamList, i)
+				} else {
+					return FuncSigInfo{}, false
+				}
+			}
+		} else if c.Kype == TNT_FUNC_TYPE_RETURN_TYPE {
+			if i, ok := getTypeInfoFromTypeTreeNode(c); ok {
+				fsi.ReturnValueInfo = i
+			} else {
+				return FuncSigInfo{}, false
+			}
+		}
+	}
+
+	return fsi, true
+}
+
+var returnValueInfo interface{}
+
+var loopContinueBlockList []int
+var loopBreakBlockList []int
+
+type IRStackValue struct {
+	Info  interface{}
+	Value int
+	Local int
+}
+
+// IR locals of the symbols of the function, by their index
+var irSymbolLocalList map[int]int
+var irValueStack []IRStackValue
+
+var irProgram IRProgram
+var curIRFunc IRFunc
+var curIRBlockIndex int
+var irBlockOrderList []int
+
+// Source line of the statement being compiled
+var irLineNumber int
+
+func irFuncReset() {
+	returnValueInfo = VoidInfo{BytesCount: 0}
+	loopContinueBlockList = make([]int, 0)
+	loopBreakBlockList = make([]int, 0)
+	irSymbolLocalList = make(map[int]int)
+	irValueStack = make([]IRStackValue, 0)
+
+	curIRFunc = IRFunc{}
+	curIRBlockIndex = -1
+	irBlockOrderList = make([]int, 0)
+}
+
+func newIRLocal(ident string, i interface{}, isParam bool) int {
+	curIRFunc.LocalList = append(curIRFunc.LocalList,
+		IRLocal{Ident: ident, Type: i, IsParam: isParam, Line: irLineNumber})
+	return len(curIRFunc.LocalList) - 1
+}
+
+func newIRBlock() int {
+	curIRFunc.BlockList = append(curIRFunc.BlockList, IRBlock{})
+	return len(curIRFunc.BlockList) - 1
+}
+
+func startIRBlock(b int) {
+	if curIRBlockIndex != -1 {
+		emitIRInstr(IRInstr{Op: IR_JUMP, TargetList: []int{b}})
+	}
+
+	curIRBlockIndex = b
+	irBlockOrderList = append(irBlockOrderList, b)
+}
+
+func emitIRInstr(instr IRInstr) int {
+	if curIRBlockIndex == -1 {
+		startIRBlock(newIRBlock())
+	}
+
+	instr.Dest = -1
+	instr.SourceFilePath = curSourceFilePath
+	instr.Line = irLineNumber
+
+	if _, ok := getValueTypeInfo(instr.Type); ok {
+		instr.Dest = len(curIRFunc.ValueTypeList)
+		curIRFunc.ValueTypeList = append(curIRFunc.ValueTypeList, instr.Type)
+	}
+
+	b := &curIRFunc.BlockList[curIRBlockIndex]
+	b.InstrList = append(b.InstrList, instr)
+
+	if isIRTerminator(instr.Op) {
+		curIRBlockIndex = -1
+	}
+
+	return instr.Dest
+}
+
+func emitIRJump(b int) {
+	emitIRInstr(IRInstr{Op: IR_JUMP, TargetList: []int{b}})
+}
+
+func irValueStackPush(sv IRStackValue) {
+	irValueStack = append(irValueStack, sv)
+}
+
+func irValueStackPop() IRStackValue {
+	sv := irValueStack[len(irValueStack)-1]
+	irValueStack = irValueStack[:len(irValueStack)-1]
+	return sv
+}
+
+func irValueStackTop() IRStackValue {
+	return irValueStack[len(irValueStack)-1]
+}
+
+func loadIRStackValue(sv IRStackValue) IRStackValue {
+	switch sv.Info.(type) {
+	case IntAddressInfo, FuncAddressInfo:
+		i, _ := getValueTypeInfo(sv.Info)
+		return IRStackValue{Info: i, Value: emitIRInstr(IRInstr{
+			Op: IR_LOAD_LOCAL, Type: i, Local: sv.Local}), Local: -1}
+	default:
+		return sv
+	}
+}
+
+func loadIRValueStackTop() {
+	irValueStack[len(irValueStack)-1] = loadIRStackValue(irValueStack[len(irValueStack)-1])
+}
+
+func spillIRValueStack() []int {
+	spillLocalList := make([]int, len(irValueStack))
+
+	for i := len(irValueStack) - 1; i >= 0; i-- {
+		spillLocalList[i] = -1
+
+		if irValueStack[i].Value != -1 {
+			spillLocalList[i] = newIRLocal("spill.value", irValueStack[i].Info, false)
+			emitIRInstr(IRInstr{Op: IR_STORE_LOCAL, Local: spillLocalList[i],
+				ArgList: []int{irValueStack[i].Value}})
+
+			// The value is used up by the store, so that a nested spill
+			// leaves it alone until it is reloaded
+			irValueStack[i].Value = -1
+		}
+	}
+
+	return spillLocalList
+}
+
+func reloadIRValueStack(spillLocalList []int) {
+	for i, local := range spillLocalList {
+		if local != -1 {
+			irValueStack[i].Value = emitIRInstr(IRInstr{
+				Op: IR_LOAD_LOCAL, Type: irValueStack[i].Info, Local: local})
+		}
+	}
+}
+
+func irSymbolLocalPush(si SymbolInfo, isParam bool) int {
+	local := newIRLocal(si.Ident, si.Info, isParam)
+	irSymbolLocalList[si.Index] = local
+	return local
+}
+
+func loopInfoPush(continueBlock int, breakBlock int) {
+	loopContinueBlockList = append(loopContinueBlockList, continueBlock)
+	loopBreakBlockList = append(loopBreakBlockList, breakBlock)
+}
+
+func loopInfoPop() {
+	loopContinueBlockList = loopContinueBlockList[:len(loopContinueBlockList)-1]
+	loopBreakBlockList = loopBreakBlockList[:len(loopBreakBlockList)-1]
+}
+
+func emitIRBranch(trueBlock int, falseBlock int) {
+	sv := loadIRStackValue(irValueStackPop())
+
+	emitIRInstr(IRInstr{Op: IR_BRANCH, ArgList: []int{sv.Value},
+		TargetList: []int{trueBlock, falseBlock}})
+}
+
+func compileFuncList(tn TreeNode) {
+	compileTreeNodeChildren(tn.Children)
+}
+
+func compileImportList(tn TreeNode) {
+}
+
+func compileFunc(tn TreeNode) {
+	curSourceFilePath = tn.Children[0].Tok.SourceFilePath
+	irFuncReset()
+	irLineNumber = tn.Children[0].Tok.LineNumber
+
+	startIRBlock(newIRBlock())
+
+	compileTreeNodeChildren(tn.Children)
+
+	if curIRBlockIndex != -1 {
+		PrintErrorAndExit(0)
+	}
+
+	newBlockIndexList := make([]int, len(curIRFunc.BlockList))
+	for i, b := range irBlockOrderList {
+		newBlockIndexList[b] = i
+	}
+
+	var blockList []IRBlock
+
+	for _, b := range irBlockOrderList {
+		for i := range curIRFunc.BlockList[b].InstrList {
+			instr := &curIRFunc.BlockList[b].InstrList[i]
+			for j := range instr.TargetList {
+				instr.TargetList[j] = newBlockIndexList[instr.TargetList[j]]
+			}
+		}
+		blockList = append(blockList, curIRFunc.BlockList[b])
+	}
+
+	curIRFunc.BlockList = blockList
+
+	irProgram.FuncList = append(irProgram.FuncList, curIRFunc)
+}
+
+func compileFuncIdent(tn TreeNode) {
+	curIRFunc.Ident = string(tn.Tok.Buf)
+	curIRFunc.Sig = funcListInfo[curIRFunc.Ident]
+	curIRFunc.SourceFilePath = tn.Tok.SourceFilePath
+	curIRFunc.Line = tn.Tok.LineNumber
+}
+
+func compileFuncSig(tn TreeNode) {
+	compileTreeNodeChildren(tn.Children)
+}
+
+func compileFuncParamList(tn TreeNode) {
+	compileTreeNodeChildren(tn.Children)
+}
+
+func compileFuncParam(tn TreeNode) {
+	irSymbolLocalPush(tn.Symbol, true)
+}
+
+func compileFuncReturnType(tn TreeNode) {
+	returnValueInfo = tn.Info
+}
+
+func compileStmtList(tn TreeNode) {
+	// Code emitted after the statements of a body, like the jump back of a
+	// loop, belongs to the enclosing statement
+	lineNumber := irLineNumber
+
+	for _, c := range tn.Children {
+		if l := getTreeNodeLineNumber(c); l != 0 {
+			irLineNumber = l
+		} else if c.Kype == TNT_STMT_RETURN {
+			// The return the parser adds to the end of a function is on its end
+			irLineNumber = tn.Tok.LineNumber
+		}
+		compileTreeNode(c)
+	}
+
+	irLineNumber = lineNumber
+}
+
+func compileStmtDecl(tn TreeNode) {
+	local := irSymbolLocalPush(tn.Symbol, false)
+
+	switch v := tn.Symbol.Info.(type) {
+	case IntInfo:
+		emitIRInstr(IRInstr{Op: IR_STORE_LOCAL, Local: local,
+			ArgList: []int{emitIRInstr(IRInstr{Op: IR_CONST, Type: v, Value: 0})}})
+	case FuncInfo:
+		emitIRInstr(IRInstr{Op: IR_STORE_LOCAL, Local: local,
+			ArgList: []int{emitIRInstr(IRInstr{Op: IR_CONST,
+				Type: FuncInfo{IsUntyped: true, BytesCount: ADDR_BYTES_COUNT}, Value: 0})}})
+	}
+}
+
+func compileStmtExpr(tn TreeNode) {
+	compileTreeNodeChildren(tn.Children)
+
+	if sv := irValueStackPop(); sv.Value != -1 {
+		emitIRInstr(IRInstr{Op: IR_DISCARD, ArgList: []int{sv.Value}})
+	}
+}
+
+func compileStmtAssign(tn TreeNode) {
+	compileTreeNodeChildren(tn.Children)
+
+	v2 := loadIRStackValue(irValueStackPop())
+	v1 := irValueStackPop()
+
+	emitIRInstr(IRInstr{Op: IR_STORE_LOCAL, Local: v1.Local, ArgList: []int{v2.Value}})
+}
+
+func unescapeStmtString(b []byte) (bool, []byte) {
+	var nb []byte
+
+	if (len(b) < 3) || (b[0] != 0x22) || (b[len(b)-1] != 0x22) {
+		return false, nb
+	}
+
+	b = b[1 : len(b)-1]
+
+	for len(b) != 0 {
+		if b[0] == 0x5c {
+			b = b[1:]
+
+			if len(b) == 0 {
+				return false, nb
+			}
+
+			if (b[0] == 0x22) || (b[0] == 0x5c) {
+				nb = append(nb, b[0])
+				b = b[1:]
+			} else {
+				return false, nb
+			}
+		} else {
+			nb = append(nb, b[0])
+			b = b[1:]
+		}
+	}
+
+	return true, nb
+}
+
+func compileStmtStoreString(tn TreeNode) {
+	exprTreeNode := tn.Children[0]
+	stmtStringTreeNode := tn.Children[1]
+
+	compileTreeNode(exprTreeNode)
+
+	_, b := unescapeStmtString(stmtStringTreeNode.Tok.Buf)
+
+	sv := loadIRStackValue(irValueStackPop())
+
+	emitIRInstr(IRInstr{Op: IR_STORE_STRING, ArgList: []int{sv.Value}, Buf: b})
+}
+
+func compileStmtWhile(tn TreeNode) {
+	exprTreeNode := tn.Children[0]
+	stmtListTreeNode := tn.Children[1]
+
+	headBlock := newIRBlock()
+	bodyBlock := newIRBlock()
+	endBlock := newIRBlock()
+
+	startIRBlock(headBlock)
+
+	compileTreeNode(exprTreeNode)
+
+	emitIRBranch(bodyBlock, endBlock)
+
+	loopInfoPush(headBlock, endBlock)
+
+	startIRBlock(bodyBlock)
+
+	compileTreeNode(stmtListTreeNode)
+
+	emitIRJump(headBlock)
+
+	loopInfoPop()
+
+	startIRBlock(endBlock)
+}
+
+// The variable has the type ii. With a signed type the direction of the
+// loop depends on the sign of the step, which is only known at run time.
+func emitIRForCondition(ii IntInfo, stepLocal int, emitAscCondition func() int,
+	emitDescCondition func() int, trueBlock int, falseBlock int) {
+
+	if !ii.IsSigned {
+		emitIRInstr(IRInstr{Op: IR_BRANCH, ArgList: []int{emitAscCondition()},
+			TargetList: []int{trueBlock, falseBlock}})
+		return
+	}
+
+	isNegative := emitIRInstr(IRInstr{Op: IR_BINARY, Type: IntInfo{IsSigned: false, BytesCount: 1},
+		BinaryOp: TT_LSS, ArgList: []int{
+			emitIRInstr(IRInstr{Op: IR_LOAD_LOCAL, Type: ii, Local: stepLocal}),
+			emitIRInstr(IRInstr{Op: IR_CONST, Type: ii, Value: 0})}})
+
+	descBlock := newIRBlock()
+	ascBlock := newIRBlock()
+
+	emitIRInstr(IRInstr{Op: IR_BRANCH, ArgList: []int{isNegative},
+		TargetList: []int{descBlock, ascBlock}})
+
+	startIRBlock(descBlock)
+
+	emitIRInstr(IRInstr{Op: IR_BRANCH, ArgList: []int{emitDescCondition()},
+		TargetList: []int{trueBlock, falseBlock}})
+
+	startIRBlock(ascBlock)
+
+	emitIRInstr(IRInstr{Op: IR_BRANCH, ArgList: []int{emitAscCondition()},
+		TargetList: []int{trueBlock, falseBlock}})
+}
+
+// The loop keeps going while the distance to the end is at least the step,
+// taken as unsigned, so that the variable never wraps around
+func compileStmtFor(tn TreeNode) {
+	stmtForIdentTreeNode := tn.Children[0]
+	stmtListTreeNode := tn.Children[len(tn.Children)-1]
+
+	ii := stmtForIdentTreeNode.Symbol.Info.(IntInfo)
+	uii := IntInfo{IsSigned: false, BytesCount: ii.BytesCount}
+	cii := IntInfo{IsSigned: false, BytesCount: 1}
+
+	identLocal := irSymbolLocalList[stmtForIdentTreeNode.Symbol.Index]
+
+	compileTreeNode(tn.Children[1])
+
+	emitIRInstr(IRInstr{Op: IR_STORE_LOCAL, Local: identLocal,
+		ArgList: []int{loadIRStackValue(irValueStackPop()).Value}})
+
+	compileTreeNode(tn.Children[2])
+
+	endLocal := newIRLocal("for.end", ii, false)
+
+	emitIRInstr(IRInstr{Op: IR_STORE_LOCAL, Local: endLocal,
+		ArgList: []int{loadIRStackValue(irValueStackPop()).Value}})
+
+	var stepValue int
+	if len(tn.Children) == 5 {
+		compileTreeNode(tn.Children[3])
+		stepValue = loadIRStackValue(irValueStackPop()).Value
+	} else {
+		stepValue = emitIRInstr(IRInstr{Op: IR_CONST, Type: ii, Value: 1})
+	}
+
+	stepLocal := newIRLocal("for.step", ii, false)
+
+	emitIRInstr(IRInstr{Op: IR_STORE_LOCAL, Local: stepLocal, ArgList: []int{stepValue}})
+
+	load := func(local int) int {
+		return emitIRInstr(IRInstr{Op: IR_LOAD_LOCAL, Type: ii, Local: local})
+	}
+	binary := func(i interface{}, op TokenType, v1 int, v2 int) int {
+		return emitIRInstr(IRInstr{Op: IR_BINARY, Type: i, BinaryOp: op, ArgList: []int{v1, v2}})
+	}
+	convert := func(v int) int {
+		return emitIRInstr(IRInstr{Op: IR_CONVERT, Type: uii, ArgList: []int{v}})
+	}
+
+	headBlock := newIRBlock()
+	bodyBlock := newIRBlock()
+	continueBlock := newIRBlock()
+	stepBlock := newIRBlock()
+	endBlock := newIRBlock()
+
+	startIRBlock(headBlock)
+
+	emitIRForCondition(ii, stepLocal,
+		func() int { return binary(cii, TT_LEQ, load(identLocal), load(endLocal)) },
+		func() int { return binary(cii, TT_GEQ, load(identLocal), load(endLocal)) },
+		bodyBlock, endBlock)
+
+	loopInfoPush(continueBlock, endBlock)
+
+	startIRBlock(bodyBlock)
+
+	compileTreeNode(stmtListTreeNode)
+
+	startIRBlock(continueBlock)
+
+	emitIRForCondition(ii, stepLocal,
+		func() int {
+			return binary(cii, TT_GEQ,
+				convert(binary(ii, TT_SUB, load(endLocal), load(identLocal))),
+				convert(load(stepLocal)))
+		},
+		func() int {
+			return binary(cii, TT_GEQ,
+				convert(binary(ii, TT_SUB, load(identLocal), load(endLocal))),
+				convert(binary(ii, TT_SUB, emitIRInstr(IRInstr{Op: IR_CONST, Type: ii, Value: 0}),
+					load(stepLocal))))
+		},
+		stepBlock, endBlock)
+
+	startIRBlock(stepBlock)
+
+	emitIRInstr(IRInstr{Op: IR_STORE_LOCAL, Local: identLocal,
+		ArgList: []int{binary(ii, TT_ADD, load(identLocal), load(stepLocal))}})
+
+	emitIRJump(headBlock)
+
+	loopInfoPop()
+
+	startIRBlock(endBlock)
+}
+
+func compileStmtSwitch(tn TreeNode) {
+	compileTreeNode(tn.Children[0])
+
+	sv := loadIRStackValue(irValueStackPop())
+
+	var caseValueList []uint64
+	var caseStmtListIndexList []int
+	var stmtListTreeNodeList []TreeNode
+	var stmtDefaultTreeNode TreeNode
+
+	hasDefault := false
+
+	for _, c := range tn.Children[1:] {
+		if c.Kype == TNT_STMT_DEFAULT {
+			stmtDefaultTreeNode = c.Children[0]
+			hasDefault = true
+			continue
+		}
+
+		for _, exprTreeNode := range c.Children[0].Children {
+			_, v, _ := getConstExprValue(exprTreeNode)
+
+			caseValueList = append(caseValueList, v)
+			caseStmtListIndexList = append(caseStmtListIndexList, len(stmtListTreeNodeList))
+		}
+
+		stmtListTreeNodeList = append(stmtListTreeNodeList, c.Children[1])
+	}
+
+	var stmtListBlockList []int
+	for range stmtListTreeNodeList {
+		stmtListBlockList = append(stmtListBlockList, newIRBlock())
+	}
+
+	endBlock := newIRBlock()
+
+	defaultBlock := endBlock
+	if hasDefault {
+		defaultBlock = newIRBlock()
+	}
+
+	targetList := []int{defaultBlock}
+	for _, i := range caseStmtListIndexList {
+		targetList = append(targetList, stmtListBlockList[i])
+	}
+
+	emitIRInstr(IRInstr{Op: IR_SWITCH, ArgList: []int{sv.Value}, TargetList: targetList,
+		CaseValueList: caseValueList})
+
+	for i, stmtListTreeNode := range stmtListTreeNodeList {
+		startIRBlock(stmtListBlockList[i])
+
+		compileTreeNode(stmtListTreeNode)
+
+		emitIRJump(endBlock)
+	}
+
+	if hasDefault {
+		startIRBlock(defaultBlock)
+
+		compileTreeNode(stmtDefaultTreeNode)
+
+		emitIRJump(endBlock)
+	}
+
+	startIRBlock(endBlock)
+}
+
+func compileStmtLabel(tn TreeNode) {
+	compileTreeNodeChildren(tn.Children)
+}
+
+func compileStmtIf(tn TreeNode) {
+	exprTreeNode := tn.Children[0]
+	stmtListTreeNode := tn.Children[1]
+
+	compileTreeNode(exprTreeNode)
+
+	thenBlock := newIRBlock()
+	endBlock := newIRBlock()
+
+	elseBlock := endBlock
+	if len(tn.Children) == 3 {
+		elseBlock = newIRBlock()
+	}
+
+	emitIRBranch(thenBlock, elseBlock)
+
+	startIRBlock(thenBlock)
+
+	compileTreeNode(stmtListTreeNode)
+
+	emitIRJump(endBlock)
+
+	if len(tn.Children) == 3 {
+		startIRBlock(elseBlock)
+
+		stmtElseTreeNode := tn.Children[2]
+		compileTreeNode(stmtElseTreeNode)
+
+		emitIRJump(endBlock)
+	}
+
+	startIRBlock(endBlock)
+}
+
+func compileStmtElse(tn TreeNode) {
+	compileTreeNodeChildren(tn.Children)
+}
+
+func compileStmtReturn(tn TreeNode) {
+	if len(tn.Children) != 0 {
+		compileTreeNodeChildren(tn.Children)
+
+		sv := loadIRStackValue(irValueStackPop())
+
+		emitIRInstr(IRInstr{Op: IR_RETURN, ArgList: []int{sv.Value}})
+		return
+	}
+
+	switch v := returnValueInfo.(type) {
+	case IntInfo:
+		emitIRInstr(IRInstr{Op: IR_RETURN,
+			ArgList: []int{emitIRInstr(IRInstr{Op: IR_CONST, Type: v, Value: 0})}})
+	case FuncInfo:
+		emitIRInstr(IRInstr{Op: IR_RETURN,
+			ArgList: []int{emitIRInstr(IRInstr{Op: IR_CONST, Type: v, Value: 0})}})
+	default:
+		emitIRInstr(IRInstr{Op: IR_RETURN})
+	}
+}
+
+func compileStmtBreak(tn TreeNode) {
+	emitIRJump(loopBreakBlockList[tn.Symbol.Index])
+}
+
+func compileStmtContinue(tn TreeNode) {
+	emitIRJump(loopContinueBlockList[tn.Symbol.Index])
+}
+
+func compileExpr(tn TreeNode) {
+	compileTreeNodeChildren(tn.Children)
+}
+
+func compileExprInt(tn TreeNode) {
+	if tn.Symbol.Kind == SYM_LOCAL {
+		irValueStackPush(IRStackValue{Info: tn.Info, Value: -1, Local: irSymbolLocalList[tn.Symbol.Index]})
+	} else {
+		irValueStackPush(IRStackValue{Info: tn.Info, Value: emitIRInstr(IRInstr{
+			Op: IR_FUNC_ADDR, Type: tn.Info, Ident: tn.Symbol.Ident}), Local: -1})
+	}
+}
+
+func unescapeExprChar(b []byte) (byte, bool) {
+	if (len(b) < 3) || (b[0] != 0x27) || (b[len(b)-1] != 0x27) {
+		return 0, false
+	}
+
+	if b[1] == 0x5c {
+		if (len(b) == 4) && (b[2] == 0x5c || b[2] == 0x27) {
+			return b[2], true
+		} else {
+			return 0, false
+		}
+	} else if len(b) == 3 {
+		return b[1], true
+	} else {
+		return 0, false
+	}
+}
+
+func getIntLitValue(ii IntInfo, tn TreeNode) uint64 {
+	switch tn.Kype {
+	case TNT_EXPR_CHAR:
+		if b, ok := unescapeExprChar(tn.Tok.Buf); ok {
+			if ii.BytesCount == 1 && (!ii.IsSigned) {
+				return uint64(b)
+			}
+		}
+
+		PrintErrorAndExit(tn.Tok.LineNumber)
+	case TNT_EXPR_INT_LIT:
+		if v, err := strconv.ParseUint(string(tn.Tok.Buf), 0, 64); err == nil {
+			if v <= ((^uint64(0)) >> ((8 - ii.BytesCount) * 8)) {
+				return v
+			}
+		}
+
+		PrintErrorAndExit(tn.Tok.LineNumber)
+	case TNT_EXPR_NEG_INT_LIT:
+		if v, err := strconv.ParseUint(string(tn.Tok.Buf), 0, 64); err == nil {
+			if v <= (uint64(1) << ((ii.BytesCount * 8) - 1)) {
+				return (^v) + 1
+			}
+		}
+
+		PrintErrorAndExit(tn.Tok.LineNumber)
+	default:
+		PrintErrorAndExit(0)
+	}
+
+	return 0
+}
+
+func getConstExprValue(tn TreeNode) (IntInfo, uint64, bool) {
+	if (len(tn.Children) != 1) || (tn.Children[0].Kype != TNT_EXPR_FUNC) {
+		return IntInfo{}, 0, false
+	}
+
+	exprFuncTreeNode := tn.Children[0]
+
+	ii, ok := getIntInfoFromTypeString(string(exprFuncTreeNode.Tok.Buf))
+	if !ok {
+		return IntInfo{}, 0, false
+	}
+
+	exprFuncParmListTreeNode := exprFuncTreeNode.Children[0]
+
+	if len(exprFuncParmListTreeNode.Children) != 1 {
+		return IntInfo{}, 0, false
+	}
+
+	switch c := exprFuncParmListTreeNode.Children[0].Children[0]; c.Kype {
+	case TNT_EXPR_CHAR, TNT_EXPR_INT_LIT, TNT_EXPR_NEG_INT_LIT:
+		return ii, getIntLitValue(ii, c) & ((^uint64(0)) >> ((8 - ii.BytesCount) * 8)), true
+	default:
+		return IntInfo{}, 0, false
+	}
+}
+
+func compileExprFunc(tn TreeNode) {
+	switch tn.Symbol.Kind {
+	case SYM_CAST:
+		ii := tn.Info.(IntInfo)
+
+		exprFuncParmTreeNode := tn.Children[0].Children[0]
+
+		if exprFuncParmTreeNode.Children[0].Kype != TNT_EXPR {
+			irValueStackPush(IRStackValue{Info: ii, Value: emitIRInstr(IRInstr{Op: IR_CONST, Type: ii,
+				Value: getIntLitValue(ii, exprFuncParmTreeNode.Children[0]) &
+					getIntInfoMask(ii)}), Local: -1})
+			return
+		}
+
+		compileTreeNode(exprFuncParmTreeNode.Children[0])
+
+		sv := loadIRStackValue(irValueStackPop())
+
+		irValueStackPush(IRStackValue{Info: ii, Value: emitIRInstr(IRInstr{Op: IR_CONVERT,
+			Type: ii, ArgList: []int{sv.Value}}), Local: -1})
+	case SYM_BUILTIN:
+		argList := compileExprFuncParmListArgs(tn)
+
+		if len(argList) == 1 {
+			irValueStackPush(IRStackValue{Info: tn.Info, Value: emitIRInstr(IRInstr{
+				Op: IR_LOAD, Type: tn.Info, ArgList: argList}), Local: -1})
+		} else {
+			emitIRInstr(IRInstr{Op: IR_STORE, ArgList: argList})
+
+			irValueStackPush(IRStackValue{Info: tn.Info, Value: -1, Local: -1})
+		}
+	case SYM_LOCAL:
+		argList := compileExprFuncParmListArgs(tn)
+
+		argList = append(argList, emitIRInstr(IRInstr{Op: IR_LOAD_LOCAL, Type: tn.Symbol.Info,
+			Local: irSymbolLocalList[tn.Symbol.Index]}))
+
+		irValueStackPush(IRStackValue{Info: tn.Info, Value: emitIRInstr(IRInstr{
+			Op: IR_CALL_INDIRECT, Type: tn.Info, ArgList: argList}), Local: -1})
+	default:
+		argList := compileExprFuncParmListArgs(tn)
+
+		irValueStackPush(IRStackValue{Info: tn.Info, Value: emitIRInstr(IRInstr{
+			Op: IR_CALL, Type: tn.Info, Ident: tn.Symbol.Ident, ArgList: argList}), Local: -1})
+	}
+}
+
+func compileExprFuncParmListArgs(tn TreeNode) []int {
+	irValueStackLenBefore := len(irValueStack)
+
+	compileTreeNodeChildren(tn.Children)
+
+	var argList []int
+
+	for _, sv := range irValueStack[irValueStackLenBefore:] {
+		argList = append(argList, sv.Value)
+	}
+
+	irValueStack = irValueStack[:irValueStackLenBefore]
+
+	return argList
+}
+
+func getBuiltinFuncInfo(ident string) (FuncSigInfo, bool) {
+	addrII := IntInfo{IsSigned: false, BytesCount: ADDR_BYTES_COUNT}
+	untypedFI := FuncInfo{IsUntyped: true, BytesCount: ADDR_BYTES_COUNT}
+
+	if len(ident) >= 2 && (ident[0] == 'l' || ident[0] == 's') {
+		if ii, ok := getIntInfoFromTypeString(ident[1:]); ok {
+			if ident[0] == 'l' {
+				return FuncSigInfo{ParamList: []interface{}{addrII}, ReturnValueInfo: ii}, true
+			}
+			return FuncSigInfo{ParamList: []interface{}{addrII, ii},
+				ReturnValueInfo: VoidInfo{BytesCount: 0}}, true
+		}
+	}
+
+	switch ident {
+	case "lfn":
+		return FuncSigInfo{ParamList: []interface{}{addrII}, ReturnValueInfo: untypedFI}, true
+	case "sfn":
+		return FuncSigInfo{ParamList: []interface{}{addrII, untypedFI},
+			ReturnValueInfo: VoidInfo{BytesCount: 0}}, true
+	default:
+		return FuncSigInfo{}, false
+	}
+}
+
+func compileExprFuncParmList(tn TreeNode) {
+	compileTreeNodeChildren(tn.Children)
+}
+
+func compileExprFuncParm(tn TreeNode) {
+	compileTreeNodeChildren(tn.Children)
+
+	loadIRValueStackTop()
+}
+
+func compileExprBinaryLogical(tn TreeNode) {
+	leftTreeNode := tn.Children[0]
+	rightTreeNode := tn.Children[1]
+
+	ii := IntInfo{IsSigned: false, BytesCount: 1}
+
+	spillLocalList := spillIRValueStack()
+
+	local := newIRLocal("lor.value", ii, false)
+	if tn.Tok.Kype == TT_LAND {
+		local = newIRLocal("land.value", ii, false)
+	}
+
+	rightBlock := newIRBlock()
+	trueBlock := newIRBlock()
+	falseBlock := newIRBlock()
+	endBlock := newIRBlock()
+
+	compileTreeNode(leftTreeNode)
+
+	if tn.Tok.Kype == TT_LAND {
+		emitIRBranch(rightBlock, falseBlock)
+	} else {
+		emitIRBranch(trueBlock, rightBlock)
+	}
+
+	startIRBlock(rightBlock)
+
+	compileTreeNode(rightTreeNode)
+
+	emitIRBranch(trueBlock, falseBlock)
+
+	startIRBlock(trueBlock)
+
+	emitIRInstr(IRInstr{Op: IR_STORE_LOCAL, Local: local,
+		ArgList: []int{emitIRInstr(IRInstr{Op: IR_CONST, Type: ii, Value: 1})}})
+
+	emitIRJump(endBlock)
+
+	startIRBlock(falseBlock)
+
+	emitIRInstr(IRInstr{Op: IR_STORE_LOCAL, Local: local,
+		ArgList: []int{emitIRInstr(IRInstr{Op: IR_CONST, Type: ii, Value: 0})}})
+
+	startIRBlock(endBlock)
+
+	reloadIRValueStack(spillLocalList)
+
+	irValueStackPush(IRStackValue{Info: ii, Value: emitIRInstr(IRInstr{
+		Op: IR_LOAD_LOCAL, Type: ii, Local: local}), Local: -1})
+}
+
+func compileExprBinary(tn TreeNode) {
+	if tn.Tok.Kype == TT_LAND || tn.Tok.Kype == TT_LOR {
+
+		compileExprBinaryLogical(tn)
+
+	} else {
+
+		compileTreeNode(tn.Children[0])
+		loadIRValueStackTop()
+
+		compileTreeNode(tn.Children[1])
+		loadIRValueStackTop()
+
+		v2 := irValueStackPop()
+		v1 := irValueStackPop()
+
+		irValueStackPush(IRStackValue{Info: tn.Info, Value: emitIRInstr(IRInstr{
+			Op: IR_BINARY, Type: tn.Info, BinaryOp: tn.Tok.Kype,
+			ArgList: []int{v1.Value, v2.Value}}), Local: -1})
+
+	}
+}
+
+func compileTreeNode(tn TreeNode) {
+	map[TreeNodeType]func(TreeNode){
+		// TNT_ROOT
+
+		TNT_IMPORT_LIST: compileImportList,
+
+		TNT_FUNC_LIST: compileFuncList,
+		TNT_FUNC:      compileFunc,
+
+		TNT_FUNC_IDENT:      compileFuncIdent,
+		TNT_FUNC_SIG:        compileFuncSig,
+		TNT_FUNC_PARAM_LIST: compileFuncParamList,
+		TNT_FUNC_PARAM:      compileFuncParam,
+		// TNT_FUNC_PARAM_IDENT
+		// TNT_FUNC_PARAM_TYPE
+		TNT_FUNC_RETURN_TYPE: compileFuncReturnType,
+
+		TNT_STMT_LIST: compileStmtList,
+
+		TNT_STMT_DECL: compileStmtDecl,
+		// TNT_STMT_DECL_IDENT
+		// TNT_STMT_DECL_TYPE
+
+		TNT_STMT_EXPR:         compileStmtExpr,
+		TNT_STMT_ASSIGN:       compileStmtAssign,
+		TNT_STMT_STORE_STRING: compileStmtStoreString,
+		// TNT_STMT_STRING
+
+		TNT_STMT_WHILE: compileStmtWhile,
+		TNT_STMT_IF:    compileStmtIf,
+		TNT_STMT_ELSE:  compileStmtElse,
+
+		TNT_STMT_FOR: compileStmtFor,
+		// TNT_STMT_FOR_IDENT
+		TNT_STMT_LABEL: compileStmtLabel,
+		// TNT_STMT_LABEL_IDENT
+
+		TNT_STMT_SWITCH: compileStmtSwitch,
+		// TNT_STMT_CASE
+		// TNT_STMT_CASE_VALUE_LIST
+		// TNT_STMT_DEFAULT
+
+		TNT_STMT_RETURN:   compileStmtReturn,
+		TNT_STMT_BREAK:    compileStmtBreak,
+		TNT_STMT_CONTINUE: compileStmtContinue,
+
+		TNT_EXPR:                compileExpr,
+		TNT_EXPR_INT:            compileExprInt,
+		TNT_EXPR_FUNC:           compileExprFunc,
+		TNT_EXPR_FUNC_PARM_LIST: compileExprFuncParmList,
+		TNT_EXPR_FUNC_PARM:      compileExprFuncParm,
+		// TNT_EXPR_INT_LIT
+		// TNT_EXPR_NEG_INT_LIT
+		// TNT_EXPR_CHAR
+		TNT_EXPR_BINARY: compileExprBinary,
+	}[tn.Kype](tn)
+}
+
+func compileTreeNodeChildren(treeNodeChildren []TreeNode) {
+	for _, tn := range treeNodeChildren {
+		compileTreeNode(tn)
+	}
+}
+
+// The tree must have been through the semantic analyzer, whose funcListInfo
+// is used for the signatures of the functions
+func IRGenerator(tn TreeNode) IRProgram {
+	irProgram = IRProgram{FuncList: make([]IRFunc, 0), FuncSigList: funcListInfo}
+
+	compileTreeNodeChildren(tn.Children)
+
+	curSourceFilePath = ""
+
+	return irProgram
+}
@@ -48,7 +48,9 @@ const (
 	TT_LPAREN // (
 	TT_RPAREN // )
 
-	TT_COMMA // ,
+	TT_COMMA  // ,
+	TT_COLON  // :
+	TT_PERIOD // .
 
 	TT_FUNC
 	TT_RETURN
@@ -60,15 +62,140 @@ const (
 	TT_BREAK
 	TT_CONTINUE
 
+	TT_FOR
+	TT_TO
+	TT_STEP
+
+	TT_SWITCH
+	TT_CASE
+	TT_DEFAULT
+
 	TT_LET
 
+	TT_IMPORT
+
 	TT_END
 )
 
 type TokenData struct {
-	Kype       TokenType
-	LineNumber int
-	Buf        []byte
+	Kype           TokenType
+	LineNumber     int
+	ColumnNumber   int
+	Buf            []byte
+	SourceFilePath string
+}
+
+var TokenTypeNames = map[TokenType]string{
+	TT_ILLEGAL:  "ILLEGAL",
+	TT_EOF:      "EOF",
+	TT_SPACE:    "SPACE",
+	TT_NEW_LINE: "NEW_LINE",
+	TT_COMMENT:  "COMMENT",
+	TT_IDENT:    "IDENT",
+	TT_INT:      "INT",
+	TT_CHAR:     "CHAR",
+	TT_STR:      "STR",
+	TT_ADD:      "ADD",
+	TT_SUB:      "SUB",
+	TT_MUL:      "MUL",
+	TT_QUO:      "QUO",
+	TT_REM:      "REM",
+	TT_AND:      "AND",
+	TT_OR:       "OR",
+	TT_XOR:      "XOR",
+	TT_SHL:      "SHL",
+	TT_SHR:      "SHR",
+	TT_LAND:     "LAND",
+	TT_LOR:      "LOR",
+	TT_ARROW:    "ARROW",
+	TT_EQL:      "EQL",
+	TT_NEQ:      "NEQ",
+	TT_LSS:      "LSS",
+	TT_GTR:      "GTR",
+	TT_LEQ:      "LEQ",
+	TT_GEQ:      "GEQ",
+	TT_ASSIGN:   "ASSIGN",
+	TT_LPAREN:   "LPAREN",
+	TT_RPAREN:   "RPAREN",
+	TT_COMMA:    "COMMA",
+	TT_COLON:    "COLON",
+	TT_PERIOD:   "PERIOD",
+	TT_FUNC:     "FUNC",
+	TT_RETURN:   "RETURN",
+	TT_IF:       "IF",
+	TT_ELSE:     "ELSE",
+	TT_WHILE:    "WHILE",
+	TT_BREAK:    "BREAK",
+	TT_CONTINUE: "CONTINUE",
+	TT_FOR:      "FOR",
+	TT_TO:       "TO",
+	TT_STEP:     "STEP",
+	TT_SWITCH:   "SWITCH",
+	TT_CASE:     "CASE",
+	TT_DEFAULT:  "DEFAULT",
+	TT_LET:      "LET",
+	TT_IMPORT:   "IMPORT",
+	TT_END:      "END",
+}
+
+var TokTypeToStr = map[TokenType]string{
+	TT_ADD: "+",
+	TT_SUB: "-",
+	TT_MUL: "*",
+	TT_QUO: "/",
+	TT_REM: "%",
+
+	TT_AND: "&",
+	TT_OR:  "|",
+	TT_XOR: "^",
+
+	TT_SHL: "<<",
+	TT_SHR: ">>",
+
+	TT_LAND: "&&",
+	TT_LOR:  "||",
+
+	TT_ARROW: "<-",
+
+	TT_EQL: "==",
+	TT_NEQ: "!=",
+	TT_LSS: "<",
+	TT_GTR: ">",
+	TT_LEQ: "<=",
+	TT_GEQ: ">=",
+
+	TT_ASSIGN: "=",
+
+	TT_LPAREN: "(",
+	TT_RPAREN: ")",
+
+	TT_COMMA:  ",",
+	TT_COLON:  ":",
+	TT_PERIOD: ".",
+
+	TT_FUNC:   "func",
+	TT_RETURN: "return",
+
+	TT_IF:   "if",
+	TT_ELSE: "else",
+
+	TT_WHILE:    "while",
+	TT_BREAK:    "break",
+	TT_CONTINUE: "continue",
+
+	TT_FOR:  "for",
+	TT_TO:   "to",
+	TT_STEP: "step",
+
+	TT_SWITCH:  "switch",
+	TT_CASE:    "case",
+	TT_DEFAULT: "default",
+
+	TT_LET: "let",
+
+	TT_IMPORT: "import",
+
+	TT_END: "end",
 }
 
 func checkTokenType(buf []byte) (TokenType, int) {
@@ -96,52 +223,12 @@ func checkTokenType(buf []byte) (TokenType, int) {
 	tokType := TT_ILLEGAL
 	bytesConsumed := 0
 
-	TokTypeToStr := map[TokenType]string{
-		TT_ADD: "+",
-		TT_SUB: "-",
-		TT_MUL: "*",
-		TT_QUO: "/",
-		TT_REM: "%",
-
-		TT_AND: "&",
-		TT_OR:  "|",
-		TT_XOR: "^",
-
-		TT_SHL: "<<",
-		TT_SHR: ">>",
-
-		TT_LAND: "&&",
-		TT_LOR:  "||",
-
-		TT_ARROW: "<-",
-
-		TT_EQL: "==",
-		TT_NEQ: "!=",
-		TT_LSS: "<",
-		TT_GTR: ">",
-		TT_LEQ: "<=",
-		TT_GEQ: ">=",
-
-		TT_ASSIGN: "=",
-
-		TT_LPAREN: "(",
-		TT_RPAREN: ")",
-
-		TT_COMMA: ",",
-
-		TT_FUNC:   "func",
-		TT_RETURN: "return",
-
-		TT_IF:   "if",
-		TT_ELSE: "else",
-
-		TT_WHILE:    "while",
-		TT_BREAK:    "break",
-		TT_CONTINUE: "continue",
-
-		TT_LET: "let",
+	isDigit := func(c byte) bool {
+		return c >= 0x30 && c <= 0x39
+	}
 
-		TT_END: "end",
+	isAplabet := func(c byte) bool {
+		return (c >= 0x41 && c <= 0x5a) || (c >= 0x61 && c <= 0x7a) || (c == 0x5f)
 	}
 
 	var prevTokStr string
@@ -149,6 +236,12 @@ func checkTokenType(buf []byte) (TokenType, int) {
 		if (len(srcLine) >= len(curTokStr) && srcLine[:len(curTokStr)] == curTokStr) &&
 			(tokType == TT_ILLEGAL || len(prevTokStr) < len(curTokStr)) {
 
+			// Keywords must not swallow the start of a longer identifier
+			if isAplabet(curTokStr[0]) && (len(srcLine) > len(curTokStr)) &&
+				(isAplabet(srcLine[len(curTokStr)]) || isDigit(srcLine[len(curTokStr)])) {
+				continue
+			}
+
 			tokType = curTokType
 			bytesConsumed = len(curTokStr)
 			prevTokStr = curTokStr
@@ -159,14 +252,6 @@ func checkTokenType(buf []byte) (TokenType, int) {
 		return tokType, bytesConsumed
 	}
 
-	isDigit := func(c byte) bool {
-		return c >= 0x30 && c <= 0x39
-	}
-
-	isAplabet := func(c byte) bool {
-		return (c >= 0x41 && c <= 0x5a) || (c >= 0x61 && c <= 0x7a) || (c == 0x5f)
-	}
-
 	i := 0
 
 	if isAplabet(srcLine[i]) {
@@ -258,7 +343,7 @@ func filterNewLineTokens(toks []TokenData) []TokenData {
 	allowedPrevTokTypes := []TokenType{TT_IDENT,
 		TT_STR, TT_RPAREN, TT_RETURN,
 		TT_ELSE, TT_BREAK, TT_CONTINUE,
-		TT_END}
+		TT_DEFAULT, TT_END}
 
 	for _, tok := range toks {
 		if tok.Kype == TT_NEW_LINE {
@@ -277,10 +362,13 @@ func filterNewLineTokens(toks []TokenData) []TokenData {
 	return filteredToks
 }
 
-func generateTokens(buf []byte) []TokenData {
+// Comments are returned apart from the other tokens
+func generateTokens(buf []byte) ([]TokenData, []TokenData) {
 	curLineNum := 1
+	curColumnNum := 1
 
 	var toks []TokenData
+	var commentToks []TokenData
 
 	for {
 		tokType, bytesConsumed := checkTokenType(buf)
@@ -292,13 +380,17 @@ func generateTokens(buf []byte) []TokenData {
 		var tok TokenData
 		tok.Kype = tokType
 		tok.LineNumber = curLineNum
+		tok.ColumnNumber = curColumnNum
 
 		if tokType == TT_IDENT || tokType == TT_INT ||
 			tokType == TT_CHAR || tokType == TT_STR {
 			tok.Buf = buf[:bytesConsumed]
 		}
 
-		if tokType != TT_SPACE && tokType != TT_COMMENT {
+		if tokType == TT_COMMENT {
+			tok.Buf = buf[:bytesConsumed]
+			commentToks = append(commentToks, tok)
+		} else if tokType != TT_SPACE {
 			toks = append(toks, tok)
 		}
 
@@ -306,18 +398,26 @@ func generateTokens(buf []byte) []TokenData {
 			break
 		} else if tokType == TT_NEW_LINE {
 			curLineNum++
+			curColumnNum = 0
 		}
 
+		curColumnNum = curColumnNum + bytesConsumed
+
 		buf = buf[bytesConsumed:]
 	}
 
 	toks = filterNewLineTokens(toks)
 
-	return toks
+	return toks, commentToks
 }
 
 func LexicalAnalyzer(buf []byte) []TokenData {
 	checkForInvalidBytes(buf)
-	toks := generateTokens(buf)
+	toks, _ := generateTokens(buf)
 	return toks
 }
+
+func LexicalAnalyzerWithComments(buf []byte) ([]TokenData, []TokenData) {
+	checkForInvalidBytes(buf)
+	return generateTokens(buf)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+const (
+	RELOC_FUNC_CALL byte = 0x01
+	RELOC_FUNC_ADDR byte = 0x02
+)
+
+var OBJECT_FILE_MAGIC = []byte{0x4c, 0x43, 0x4f, 0x01}
+
+type ObjectSymbol struct {
+	Ident string
+	Addr  int
+}
+
+type ObjectRelocation struct {
+	Kype  byte
+	Ident string
+	Addr  int
+}
+
+type ObjectFile struct {
+	ModuleName     string
+	Code           []byte
+	SymbolList     []ObjectSymbol
+	RelocationList []ObjectRelocation
+}
+
+func PrintLinkErrorAndExit(s string) {
+	fmt.Println("Link error" + " " + "(" + s + ")")
+	os.Exit(EXIT_COMPILE_ERROR)
+}
+
+func appendObjectString(b []byte, s string) []byte {
+	b = binary.LittleEndian.AppendUint64(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+func EncodeObjectFile(of ObjectFile) []byte {
+	b := make([]byte, 0)
+
+	b = append(b, OBJECT_FILE_MAGIC...)
+
+	b = appendObjectString(b, of.ModuleName)
+
+	b = binary.LittleEndian.AppendUint64(b, uint64(len(of.Code)))
+	b = append(b, of.Code...)
+
+	b = binary.LittleEndian.AppendUint64(b, uint64(len(of.SymbolList)))
+	for _, sym := range of.SymbolList {
+		b = appendObjectString(b, sym.Ident)
+		b = binary.LittleEndian.AppendUint64(b, uint64(sym.Addr))
+	}
+
+	b = binary.LittleEndian.AppendUint64(b, uint64(len(of.RelocationList)))
+	for _, reloc := range of.RelocationList {
+		b = append(b, reloc.Kype)
+		b = appendObjectString(b, reloc.Ident)
+		b = binary.LittleEndian.AppendUint64(b, uint64(reloc.Addr))
+	}
+
+	return b
+}
+
+func DecodeObjectFile(b []byte) (ObjectFile, bool) {
+	var of ObjectFile
+
+	isValid := true
+
+	readBytes := func(n uint64) []byte {
+		if !isValid || n > uint64(len(b)) {
+			isValid = false
+			return nil
+		}
+		v := b[:n]
+		b = b[n:]
+		return v
+	}
+
+	readUint64 := func() uint64 {
+		v := readBytes(8)
+		if v == nil {
+			return 0
+		}
+		return binary.LittleEndian.Uint64(v)
+	}
+
+	readString := func() string {
+		return string(readBytes(readUint64()))
+	}
+
+	if string(readBytes(uint64(len(OBJECT_FILE_MAGIC)))) != string(OBJECT_FILE_MAGIC) {
+		return of, false
+	}
+
+	of.ModuleName = readString()
+	of.Code = readBytes(readUint64())
+
+	for n := readUint64(); isValid && n != 0; n-- {
+		var sym ObjectSymbol
+		sym.Ident = readString()
+		sym.Addr = int(readUint64())
+		of.SymbolList = append(of.SymbolList, sym)
+	}
+
+	for n := readUint64(); isValid && n != 0; n-- {
+		var reloc ObjectRelocation
+		if kype := readBytes(1); kype != nil {
+			reloc.Kype = kype[0]
+		}
+		reloc.Ident = readString()
+		reloc.Addr = int(readUint64())
+		of.RelocationList = append(of.RelocationList, reloc)
+	}
+
+	if !isValid || len(b) != 0 {
+		return of, false
+	}
+
+	for _, sym := range of.SymbolList {
+		if sym.Addr < 0 || sym.Addr >= len(of.Code) {
+			return of, false
+		}
+	}
+
+	for _, reloc := range of.RelocationList {
+		if (reloc.Kype != RELOC_FUNC_CALL && reloc.Kype != RELOC_FUNC_ADDR) ||
+			reloc.Addr < 0 || reloc.Addr+10 > len(of.Code) {
+			return of, false
+		}
+	}
+
+	return of, true
+}
+
+func Linker(ofs []ObjectFile) []byte {
+	if len(ofs) == 0 {
+		PrintLinkErrorAndExit("no object files")
+	}
+
+	bytecode = make([]byte, 0)
+
+	blankFuncCallList = make([]BlankFuncCall, 0)
+	blankFuncAddrList = make([]BlankFuncCall, 0)
+
+	funcAddrList = make(map[string]int)
+
+	emitBytecodePrologue(ofs[0].ModuleName + "." + "main")
+
+	for _, of := range ofs {
+		baseAddr := len(bytecode)
+
+		bytecode = append(bytecode, of.Code...)
+
+		for _, sym := range of.SymbolList {
+			if _, doesAlreadyExists := funcAddrList[sym.Ident]; doesAlreadyExists {
+				PrintLinkErrorAndExit("duplicate symbol " + sym.Ident)
+			}
+			funcAddrList[sym.Ident] = baseAddr + sym.Addr
+		}
+
+		for _, reloc := range of.RelocationList {
+			bfc := BlankFuncCall{Ident: reloc.Ident, Addr: baseAddr + reloc.Addr}
+
+			if reloc.Kype == RELOC_FUNC_CALL {
+				blankFuncCallList = append(blankFuncCallList, bfc)
+			} else {
+				blankFuncAddrList = append(blankFuncAddrList, bfc)
+			}
+		}
+	}
+
+	if ident, ok := backpatchBlankFuncList(); !ok {
+		PrintLinkErrorAndExit("undefined symbol " + ident)
+	}
+
+	return bytecode
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLinkerMatchesWholeProgramBuild(t *testing.T) {
+	objectDirPath := t.TempDir()
+
+	var code []byte
+
+	ce, ok := catchCompileError(func() {
+		compileObjectFile("test_code", filepath.Join(objectDirPath, "test_code.o"))
+		compileObjectFile("test_module", filepath.Join(objectDirPath, "test_module.o"))
+
+		code = BytecodeGenerator(compileSourceFile("test_code"))
+	})
+	if !ok {
+		t.Fatal(ce.Msg)
+	}
+
+	var ofs []ObjectFile
+
+	for _, name := range []string{"test_code.o", "test_module.o"} {
+		data, err := os.ReadFile(filepath.Join(objectDirPath, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		of, ok := DecodeObjectFile(data)
+		if !ok {
+			t.Fatalf("%s: invalid object file", name)
+		}
+
+		ofs = append(ofs, of)
+	}
+
+	var output, linkedOutput bytes.Buffer
+
+	msg, _ := RunBytecode(code, &output)
+	linkedMsg, _ := RunBytecode(Linker(ofs), &linkedOutput)
+
+	if output.Len() == 0 {
+		t.Fatal("test_code printed nothing")
+	}
+
+	if linkedMsg != msg || linkedOutput.String() != output.String() {
+		t.Errorf("linked program printed\n%s%s\nwant\n%s%s", linkedOutput.String(), linkedMsg,
+			output.String(), msg)
+	}
+}
+
+func TestObjectFileDecoderRejectsTruncatedFiles(t *testing.T) {
+	objectFilePath := filepath.Join(t.TempDir(), "test_module.o")
+
+	if ce, ok := catchCompileError(func() {
+		compileObjectFile("test_module", objectFilePath)
+	}); !ok {
+		t.Fatal(ce.Msg)
+	}
+
+	data, err := os.ReadFile(objectFilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for n := 0; n < len(data); n++ {
+		if _, ok := DecodeObjectFile(data[:n]); ok {
+			t.Errorf("object file truncated to %d bytes was accepted", n)
+		}
+	}
+}
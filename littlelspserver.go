@@ -0,0 +1,531 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type LSPMessage struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+type LSPPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type LSPRange struct {
+	Start LSPPosition `json:"start"`
+	End   LSPPosition `json:"end"`
+}
+
+type LSPLocation struct {
+	URI   string   `json:"uri"`
+	Range LSPRange `json:"range"`
+}
+
+type LSPTextDocumentPositionParams struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+	Position LSPPosition `json:"position"`
+}
+
+// A function, parameter or variable and the token of its name where it is
+// declared
+type LSPSymbol struct {
+	Ident  string
+	Detail string
+	Tok    TokenData
+}
+
+// An identifier in the source and the symbol it refers to
+type LSPReference struct {
+	Tok    TokenData
+	Symbol LSPSymbol
+}
+
+// Each open document is loaded as the main module of a program. Its index is
+// kept when a later version does not parse.
+type LSPDocument struct {
+	FuncSymbolList    []LSPSymbol
+	ReferenceList     []LSPReference
+	CompletionList    []interface{}
+	DiagnosticFileURI string
+}
+
+var LSP_COMPLETION_ITEM_KIND_FUNCTION = 3
+
+var LSP_SYMBOL_KIND_FUNCTION = 12
+
+var LSP_ERROR_METHOD_NOT_FOUND = -32601
+var LSP_ERROR_INVALID_PARAMS = -32602
+
+var lspWriter io.Writer
+var lspDocumentList map[string]LSPDocument
+
+var lspFuncSymbolList map[string]LSPSymbol
+var lspReferenceList []LSPReference
+
+func sendLSPMessage(m map[string]interface{}) {
+	m["jsonrpc"] = "2.0"
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		panic(err)
+	}
+
+	writeContentLengthMessage(lspWriter, b)
+}
+
+func sendLSPResponse(req LSPMessage, result interface{}) {
+	sendLSPMessage(map[string]interface{}{"id": req.ID, "result": result})
+}
+
+func sendLSPErrorResponse(req LSPMessage, code int, msg string) {
+	sendLSPMessage(map[string]interface{}{"id": req.ID,
+		"error": map[string]interface{}{"code": code, "message": msg}})
+}
+
+func sendLSPNotification(method string, params interface{}) {
+	sendLSPMessage(map[string]interface{}{"method": method, "params": params})
+}
+
+func getLSPSourceFilePath(uri string) (string, bool) {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return "", false
+	}
+	return filepath.Clean(u.Path), true
+}
+
+func getLSPFileURI(sourceFilePath string) string {
+	if p, err := filepath.Abs(sourceFilePath); err == nil {
+		sourceFilePath = p
+	}
+	return (&url.URL{Scheme: "file", Path: sourceFilePath}).String()
+}
+
+// Files are read again for every request, because they change when they
+// are saved
+func getLSPSourceLine(sourceFilePath string, l int) string {
+	data, err := os.ReadFile(sourceFilePath)
+	if err != nil {
+		return ""
+	}
+
+	lineList := strings.Split(string(data), "\n")
+	if l < 1 || l > len(lineList) {
+		return ""
+	}
+
+	return lineList[l-1]
+}
+
+// Module functions are renamed by the module loader, so the length of a
+// name is taken from the source
+func getLSPTokenRange(tok TokenData) LSPRange {
+	line := getLSPSourceLine(tok.SourceFilePath, tok.LineNumber)
+
+	i := tok.ColumnNumber - 1
+	for i >= 0 && i < len(line) {
+		c := line[i]
+		if !((c >= 0x30 && c <= 0x39) || (c >= 0x41 && c <= 0x5a) || (c >= 0x61 && c <= 0x7a) ||
+			c == 0x5f || c == 0x2e) {
+			break
+		}
+		i++
+	}
+
+	return LSPRange{Start: LSPPosition{Line: tok.LineNumber - 1, Character: tok.ColumnNumber - 1},
+		End: LSPPosition{Line: tok.LineNumber - 1, Character: i}}
+}
+
+func getLSPLineRange(sourceFilePath string, l int) LSPRange {
+	if l < 1 {
+		l = 1
+	}
+
+	return LSPRange{Start: LSPPosition{Line: l - 1, Character: 0},
+		End: LSPPosition{Line: l - 1, Character: len(getLSPSourceLine(sourceFilePath, l))}}
+}
+
+func getLSPTypeString(tn TreeNode) string {
+	i, _ := getTypeInfoFromTypeTreeNode(tn)
+	return getTypeStringFromTypeInfo(i)
+}
+
+func getLSPFuncDetail(funcTreeNode TreeNode) string {
+	var paramStringList []string
+	returnTypeString := ""
+
+	for _, c := range funcTreeNode.Children[1].Children {
+		if c.Kype == TNT_FUNC_PARAM_LIST {
+			for _, funcParamTreeNode := range c.Children {
+				paramStringList = append(paramStringList, string(funcParamTreeNode.Children[0].Tok.Buf)+
+					" "+getLSPTypeString(funcParamTreeNode.Children[1]))
+			}
+		} else if c.Kype == TNT_FUNC_RETURN_TYPE {
+			returnTypeString = " " + getLSPTypeString(c)
+		}
+	}
+
+	return "func " + string(funcTreeNode.Children[0].Tok.Buf) +
+		"(" + strings.Join(paramStringList, ", ") + ")" + returnTypeString
+}
+
+func addLSPReference(tok TokenData, sym LSPSymbol) {
+	lspReferenceList = append(lspReferenceList, LSPReference{Tok: tok, Symbol: sym})
+}
+
+// Identifiers are resolved like in the IR generator. Casts and builtins
+// come first for calls, then the innermost variable, then functions.
+func findLSPSymbol(tn TreeNode, scopeList []map[string]LSPSymbol) (LSPSymbol, bool) {
+	ident := string(tn.Tok.Buf)
+
+	if tn.Kype == TNT_EXPR_FUNC {
+		if _, isCast := getIntInfoFromTypeString(ident); isCast {
+			return LSPSymbol{}, false
+		}
+		if _, isBuiltin := getBuiltinFuncInfo(ident); isBuiltin {
+			return LSPSymbol{}, false
+		}
+	}
+
+	for i := len(scopeList) - 1; i >= 0; i-- {
+		if sym, ok := scopeList[i][ident]; ok {
+			return sym, true
+		}
+	}
+
+	if tn.Kype == TNT_STMT_FOR_IDENT {
+		return LSPSymbol{}, false
+	}
+
+	sym, ok := lspFuncSymbolList[ident]
+
+	return sym, ok
+}
+
+func indexLSPTreeNode(tn TreeNode, scopeList *[]map[string]LSPSymbol) {
+	switch tn.Kype {
+	case TNT_STMT_LIST:
+		*scopeList = append(*scopeList, make(map[string]LSPSymbol))
+		for _, c := range tn.Children {
+			indexLSPTreeNode(c, scopeList)
+		}
+		*scopeList = (*scopeList)[:len(*scopeList)-1]
+		return
+
+	case TNT_STMT_DECL:
+		tok := tn.Children[0].Tok
+		sym := LSPSymbol{Ident: string(tok.Buf),
+			Detail: "let " + string(tok.Buf) + " " + getLSPTypeString(tn.Children[1]), Tok: tok}
+
+		(*scopeList)[len(*scopeList)-1][sym.Ident] = sym
+		addLSPReference(tok, sym)
+		return
+
+	case TNT_EXPR_INT, TNT_EXPR_FUNC, TNT_STMT_FOR_IDENT:
+		if sym, ok := findLSPSymbol(tn, *scopeList); ok {
+			addLSPReference(tn.Tok, sym)
+		}
+	}
+
+	for _, c := range tn.Children {
+		indexLSPTreeNode(c, scopeList)
+	}
+}
+
+func indexLSPFunc(funcTreeNode TreeNode) {
+	funcIdentTok := funcTreeNode.Children[0].Tok
+	addLSPReference(funcIdentTok, lspFuncSymbolList[string(funcIdentTok.Buf)])
+
+	scopeList := []map[string]LSPSymbol{make(map[string]LSPSymbol)}
+
+	for _, c := range funcTreeNode.Children[1].Children {
+		if c.Kype == TNT_FUNC_PARAM_LIST {
+			for _, funcParamTreeNode := range c.Children {
+				tok := funcParamTreeNode.Children[0].Tok
+				sym := LSPSymbol{Ident: string(tok.Buf),
+					Detail: "param " + string(tok.Buf) + " " + getLSPTypeString(funcParamTreeNode.Children[1]),
+					Tok:    tok}
+
+				scopeList[0][sym.Ident] = sym
+				addLSPReference(tok, sym)
+			}
+		}
+	}
+
+	indexLSPTreeNode(funcTreeNode.Children[2], &scopeList)
+}
+
+// Casts and builtins are offered even before the document parses, then the
+// functions of the document and of the modules it imports
+func getLSPCompletionList(mi *ModuleInfo, funcSymbolList []LSPSymbol) []interface{} {
+	completionList := make([]interface{}, 0)
+
+	appendItem := func(label string, detail string) {
+		completionList = append(completionList, map[string]interface{}{"label": label,
+			"kind": LSP_COMPLETION_ITEM_KIND_FUNCTION, "detail": detail})
+	}
+
+	for _, s := range []string{"u8", "u16", "u32", "u64", "i8", "i16", "i32", "i64"} {
+		appendItem(s, "convert to "+s)
+		appendItem("l"+s, "func l"+s+"(addr u64) "+s)
+		appendItem("s"+s, "func s"+s+"(addr u64, v "+s+")")
+	}
+
+	appendItem("lfn", "func lfn(addr u64) fn")
+	appendItem("sfn", "func sfn(addr u64, f fn)")
+	appendItem("ecall", "func ecall()")
+
+	if mi == nil {
+		return completionList
+	}
+
+	for _, sym := range funcSymbolList {
+		appendItem(sym.Ident, sym.Detail)
+	}
+
+	var importNameList []string
+	for importName := range mi.ImportList {
+		importNameList = append(importNameList, importName)
+	}
+	sort.Strings(importNameList)
+
+	for _, importName := range importNameList {
+		importedModuleInfo := mi.ImportList[importName]
+
+		var funcIdentList []string
+		for funcIdent := range importedModuleInfo.FuncIdentList {
+			funcIdentList = append(funcIdentList, funcIdent)
+		}
+		sort.Strings(funcIdentList)
+
+		for _, funcIdent := range funcIdentList {
+			sym := lspFuncSymbolList[getModuleFuncIdent(importedModuleInfo, funcIdent)]
+			appendItem(importName+"."+funcIdent, sym.Detail)
+		}
+	}
+
+	return completionList
+}
+
+func indexLSPDocument(tn TreeNode, mi *ModuleInfo) LSPDocument {
+	lspFuncSymbolList = make(map[string]LSPSymbol)
+	lspReferenceList = make([]LSPReference, 0)
+
+	var funcSymbolList []LSPSymbol
+
+	for _, funcTreeNode := range tn.Children[0].Children {
+		tok := funcTreeNode.Children[0].Tok
+		ident := string(tok.Buf)
+
+		sym := LSPSymbol{Ident: ident[strings.LastIndexByte(ident, 0x2e)+1:],
+			Detail: getLSPFuncDetail(funcTreeNode), Tok: tok}
+
+		lspFuncSymbolList[ident] = sym
+
+		if tok.SourceFilePath == mi.SourceFilePath {
+			funcSymbolList = append(funcSymbolList, sym)
+		}
+	}
+
+	for _, funcTreeNode := range tn.Children[0].Children {
+		indexLSPFunc(funcTreeNode)
+	}
+
+	return LSPDocument{FuncSymbolList: funcSymbolList, ReferenceList: lspReferenceList,
+		CompletionList: getLSPCompletionList(mi, funcSymbolList)}
+}
+
+// Loads, indexes and checks a saved document and publishes its first
+// compilation error, which may be in an imported file, or its warnings
+func checkLSPDocument(sourceFilePath string) {
+	doc := lspDocumentList[sourceFilePath]
+	prevDiagnosticFileURI := doc.DiagnosticFileURI
+
+	ce, ok := catchCompileError(func() {
+		tn := ModuleLoader(sourceFilePath)
+
+		doc = indexLSPDocument(tn, moduleInfoList[sourceFilePath])
+
+		checkTree(tn, TreeNode{Kype: TNT_FUNC_LIST}, []string{"main"})
+	})
+
+	doc.DiagnosticFileURI = getLSPFileURI(sourceFilePath)
+
+	diagnosticList := make([]interface{}, 0)
+
+	if !ok {
+		if ce.SourceFilePath == "" {
+			ce.SourceFilePath = sourceFilePath
+		}
+
+		doc.DiagnosticFileURI = getLSPFileURI(ce.SourceFilePath)
+
+		diagnosticList = append(diagnosticList, map[string]interface{}{
+			"range":    getLSPLineRange(ce.SourceFilePath, ce.Line),
+			"severity": 1,
+			"source":   "littlecompiler",
+			"message":  ce.Msg})
+	} else {
+		for _, w := range warningList {
+			if w.SourceFilePath != filepath.Clean(sourceFilePath) {
+				continue
+			}
+
+			diagnosticList = append(diagnosticList, map[string]interface{}{
+				"range":    getLSPLineRange(w.SourceFilePath, w.Line),
+				"severity": 2,
+				"source":   "littlecompiler",
+				"message":  w.Msg})
+		}
+	}
+
+	if prevDiagnosticFileURI != "" && prevDiagnosticFileURI != doc.DiagnosticFileURI {
+		sendLSPNotification("textDocument/publishDiagnostics", map[string]interface{}{
+			"uri": prevDiagnosticFileURI, "diagnostics": make([]interface{}, 0)})
+	}
+
+	sendLSPNotification("textDocument/publishDiagnostics", map[string]interface{}{
+		"uri": doc.DiagnosticFileURI, "diagnostics": diagnosticList})
+
+	lspDocumentList[sourceFilePath] = doc
+}
+
+func findLSPReference(params LSPTextDocumentPositionParams) (LSPReference, bool) {
+	sourceFilePath, ok := getLSPSourceFilePath(params.TextDocument.URI)
+	if !ok {
+		return LSPReference{}, false
+	}
+
+	for _, ref := range lspDocumentList[sourceFilePath].ReferenceList {
+		if ref.Tok.SourceFilePath != sourceFilePath || ref.Tok.LineNumber != params.Position.Line+1 {
+			continue
+		}
+
+		r := getLSPTokenRange(ref.Tok)
+		if params.Position.Character >= r.Start.Character && params.Position.Character <= r.End.Character {
+			return ref, true
+		}
+	}
+
+	return LSPReference{}, false
+}
+
+func runLSPRequest(req LSPMessage) bool {
+	var params LSPTextDocumentPositionParams
+
+	if json.Unmarshal(req.Params, &params) != nil && len(req.Params) != 0 {
+		if len(req.ID) != 0 {
+			sendLSPErrorResponse(req, LSP_ERROR_INVALID_PARAMS, "invalid params")
+		}
+		return true
+	}
+
+	sourceFilePath, isSourceFile := getLSPSourceFilePath(params.TextDocument.URI)
+
+	switch req.Method {
+	case "initialize":
+		sendLSPResponse(req, map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync": map[string]interface{}{"openClose": true, "change": 0,
+					"save": true},
+				"definitionProvider":     true,
+				"hoverProvider":          true,
+				"documentSymbolProvider": true,
+				"completionProvider": map[string]interface{}{
+					"triggerCharacters": []string{"."}},
+			},
+			"serverInfo": map[string]interface{}{"name": "littlecompiler"},
+		})
+	case "shutdown":
+		sendLSPResponse(req, nil)
+	case "exit":
+		return false
+	case "textDocument/didOpen", "textDocument/didSave":
+		if isSourceFile {
+			checkLSPDocument(sourceFilePath)
+		}
+	case "textDocument/didClose":
+		delete(lspDocumentList, sourceFilePath)
+	case "textDocument/definition":
+		ref, ok := findLSPReference(params)
+		if !ok {
+			sendLSPResponse(req, nil)
+			return true
+		}
+
+		sendLSPResponse(req, LSPLocation{URI: getLSPFileURI(ref.Symbol.Tok.SourceFilePath),
+			Range: getLSPTokenRange(ref.Symbol.Tok)})
+	case "textDocument/hover":
+		ref, ok := findLSPReference(params)
+		if !ok {
+			sendLSPResponse(req, nil)
+			return true
+		}
+
+		sendLSPResponse(req, map[string]interface{}{
+			"contents": map[string]interface{}{"kind": "markdown",
+				"value": "```\n" + ref.Symbol.Detail + "\n```"},
+			"range": getLSPTokenRange(ref.Tok)})
+	case "textDocument/documentSymbol":
+		symbolList := make([]interface{}, 0)
+
+		for _, sym := range lspDocumentList[sourceFilePath].FuncSymbolList {
+			r := getLSPTokenRange(sym.Tok)
+			symbolList = append(symbolList, map[string]interface{}{"name": sym.Ident,
+				"detail": sym.Detail, "kind": LSP_SYMBOL_KIND_FUNCTION, "range": r, "selectionRange": r})
+		}
+
+		sendLSPResponse(req, symbolList)
+	case "textDocument/completion":
+		completionList := lspDocumentList[sourceFilePath].CompletionList
+		if completionList == nil {
+			completionList = getLSPCompletionList(nil, nil)
+		}
+
+		sendLSPResponse(req, completionList)
+	default:
+		if len(req.ID) != 0 {
+			sendLSPErrorResponse(req, LSP_ERROR_METHOD_NOT_FOUND, "unsupported method "+req.Method)
+		}
+	}
+
+	return true
+}
+
+// Serves the Language Server Protocol. Documents are checked when they are
+// opened and saved.
+func LSPServer(r io.Reader, w io.Writer) {
+	lspWriter = w
+	lspDocumentList = make(map[string]LSPDocument)
+
+	br := bufio.NewReader(r)
+
+	for {
+		b, ok := readContentLengthMessage(br)
+		if !ok {
+			return
+		}
+
+		var req LSPMessage
+		if json.Unmarshal(b, &req) != nil {
+			continue
+		}
+
+		if !runLSPRequest(req) {
+			return
+		}
+	}
+}
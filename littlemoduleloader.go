@@ -0,0 +1,274 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type ModuleInfo struct {
+	Name           string
+	SourceFilePath string
+	TreeNode       TreeNode
+	FuncIdentList  map[string]bool
+	ImportList     map[string]*ModuleInfo
+}
+
+const (
+	MODULE_STATE_LOADING = iota + 1
+	MODULE_STATE_LOADED
+)
+
+var moduleList []*ModuleInfo
+var moduleStateList map[string]int
+var moduleInfoList map[string]*ModuleInfo
+var moduleNameList map[string]string
+
+func readModuleSourceCode(sourceFilePath string) []TokenData {
+	data, err := readSourceFile(sourceFilePath)
+
+	if err != nil {
+		if isCompileErrorRecoverable {
+			raiseCompileError(sourceFilePath, 0, err.Error())
+		}
+		PrintIOErrorAndExit(err)
+	}
+
+	curSourceFilePath = sourceFilePath
+
+	toks := LexicalAnalyzer(append(data, 0x0a))
+
+	for i := range toks {
+		toks[i].SourceFilePath = sourceFilePath
+	}
+
+	return toks
+}
+
+func getModuleNameFromPath(sourceFilePath string) (string, bool) {
+	base := filepath.Base(sourceFilePath)
+	name := strings.TrimSuffix(base, filepath.Ext(base))
+
+	if len(name) == 0 {
+		return name, false
+	}
+
+	tokType, bytesConsumed := checkTokenType([]byte(name + "\n"))
+
+	return name, (tokType == TT_IDENT) && (bytesConsumed == len(name))
+}
+
+func getImportSourceFilePath(mi *ModuleInfo, importTreeNode TreeNode) string {
+	ok, importPath := unescapeStmtString(importTreeNode.Tok.Buf)
+	if !ok {
+		PrintErrorAndExit(importTreeNode.Tok.LineNumber)
+	}
+
+	p := string(importPath)
+
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(filepath.Dir(mi.SourceFilePath), p)
+	}
+
+	return filepath.Clean(p)
+}
+
+func loadModule(sourceFilePath string, name string) *ModuleInfo {
+	moduleStateList[sourceFilePath] = MODULE_STATE_LOADING
+
+	mi := &ModuleInfo{
+		Name:           name,
+		SourceFilePath: sourceFilePath,
+		FuncIdentList:  make(map[string]bool),
+		ImportList:     make(map[string]*ModuleInfo)}
+
+	mi.TreeNode = SyntaxAnalyzer(readModuleSourceCode(sourceFilePath))
+
+	for _, funcTreeNode := range mi.TreeNode.Children[0].Children {
+		mi.FuncIdentList[string(funcTreeNode.Children[0].Tok.Buf)] = true
+	}
+
+	for _, importTreeNode := range mi.TreeNode.Children[1].Children {
+		curSourceFilePath = sourceFilePath
+		l := importTreeNode.Tok.LineNumber
+
+		importSourceFilePath := getImportSourceFilePath(mi, importTreeNode)
+
+		importName, ok := getModuleNameFromPath(importSourceFilePath)
+		if !ok {
+			PrintErrorAndExit(l)
+		}
+
+		if _, doesAlreadyExists := mi.ImportList[importName]; doesAlreadyExists {
+			PrintErrorAndExit(l)
+		}
+
+		if p, doesAlreadyExists := moduleNameList[importName]; doesAlreadyExists &&
+			p != importSourceFilePath {
+			PrintErrorAndExit(l)
+		}
+
+		if _, err := os.Stat(importSourceFilePath); err != nil {
+			PrintErrorAndExit(l)
+		}
+
+		switch moduleStateList[importSourceFilePath] {
+		case MODULE_STATE_LOADING:
+			PrintErrorAndExit(l)
+		case MODULE_STATE_LOADED:
+			mi.ImportList[importName] = moduleInfoList[importSourceFilePath]
+		default:
+			moduleNameList[importName] = importSourceFilePath
+			mi.ImportList[importName] = loadModule(importSourceFilePath, importName)
+		}
+	}
+
+	curSourceFilePath = sourceFilePath
+
+	resolveModuleFuncList(mi)
+
+	moduleStateList[sourceFilePath] = MODULE_STATE_LOADED
+	moduleInfoList[sourceFilePath] = mi
+	moduleList = append(moduleList, mi)
+
+	return mi
+}
+
+func getModuleFuncIdent(mi *ModuleInfo, funcIdent string) string {
+	if mi.Name == "" {
+		return funcIdent
+	}
+	return mi.Name + "." + funcIdent
+}
+
+func resolveModuleFuncList(mi *ModuleInfo) {
+	funcListTreeNode := mi.TreeNode.Children[0]
+
+	for i := range funcListTreeNode.Children {
+		funcTreeNode := &funcListTreeNode.Children[i]
+
+		funcIdentTreeNode := &funcTreeNode.Children[0]
+		funcIdentTreeNode.Tok.Buf = []byte(
+			getModuleFuncIdent(mi, string(funcIdentTreeNode.Tok.Buf)))
+
+		scopeList := []map[string]bool{make(map[string]bool)}
+
+		for _, c := range funcTreeNode.Children[1].Children {
+			if c.Kype == TNT_FUNC_PARAM_LIST {
+				for _, funcParamTreeNode := range c.Children {
+					scopeList[0][string(funcParamTreeNode.Children[0].Tok.Buf)] = true
+				}
+			}
+		}
+
+		resolveModuleTreeNode(mi, &funcTreeNode.Children[2], &scopeList)
+	}
+}
+
+func resolveModuleTreeNode(mi *ModuleInfo, tn *TreeNode, scopeList *[]map[string]bool) {
+	switch tn.Kype {
+	case TNT_STMT_LIST:
+		*scopeList = append(*scopeList, make(map[string]bool))
+		for i := range tn.Children {
+			resolveModuleTreeNode(mi, &tn.Children[i], scopeList)
+		}
+		*scopeList = (*scopeList)[:len(*scopeList)-1]
+		return
+
+	case TNT_STMT_DECL:
+		(*scopeList)[len(*scopeList)-1][string(tn.Children[0].Tok.Buf)] = true
+		return
+
+	case TNT_EXPR_INT, TNT_EXPR_FUNC:
+		tn.Tok.Buf = []byte(resolveModuleIdent(mi, tn.Tok, *scopeList))
+	}
+
+	for i := range tn.Children {
+		resolveModuleTreeNode(mi, &tn.Children[i], scopeList)
+	}
+}
+
+func resolveModuleIdent(mi *ModuleInfo, tok TokenData, scopeList []map[string]bool) string {
+	ident := string(tok.Buf)
+
+	if moduleName, funcIdent, isQualified := strings.Cut(ident, "."); isQualified {
+		importedModuleInfo, ok := mi.ImportList[moduleName]
+		if !ok || !importedModuleInfo.FuncIdentList[funcIdent] {
+			PrintErrorAndExit(tok.LineNumber)
+		}
+		return getModuleFuncIdent(importedModuleInfo, funcIdent)
+	}
+
+	for _, scope := range scopeList {
+		if scope[ident] {
+			return ident
+		}
+	}
+
+	if _, isType := getIntInfoFromTypeString(ident); isType {
+		return ident
+	}
+
+	if mi.FuncIdentList[ident] {
+		return getModuleFuncIdent(mi, ident)
+	}
+
+	return ident
+}
+
+func moduleLoaderInit() {
+	moduleList = make([]*ModuleInfo, 0)
+	moduleStateList = make(map[string]int)
+	moduleInfoList = make(map[string]*ModuleInfo)
+	moduleNameList = make(map[string]string)
+}
+
+func ModuleLoader(sourceFilePath string) TreeNode {
+	moduleLoaderInit()
+
+	mainModuleInfo := loadModule(filepath.Clean(sourceFilePath), "")
+
+	tn := mainModuleInfo.TreeNode
+
+	funcListTreeNode := tn.Children[0]
+	for _, mi := range moduleList {
+		if mi != mainModuleInfo {
+			funcListTreeNode.Children = append(funcListTreeNode.Children,
+				mi.TreeNode.Children[0].Children...)
+		}
+	}
+	tn.Children[0] = funcListTreeNode
+
+	curSourceFilePath = ""
+
+	return tn
+}
+
+func ObjectModuleLoader(sourceFilePath string) (string, TreeNode, TreeNode) {
+	moduleLoaderInit()
+
+	sourceFilePath = filepath.Clean(sourceFilePath)
+
+	name, ok := getModuleNameFromPath(sourceFilePath)
+	if !ok {
+		PrintErrorAndExit(0)
+	}
+
+	moduleNameList[name] = sourceFilePath
+
+	objectModuleInfo := loadModule(sourceFilePath, name)
+
+	var externFuncListTreeNode TreeNode
+	externFuncListTreeNode.Kype = TNT_FUNC_LIST
+
+	for _, mi := range moduleList {
+		if mi != objectModuleInfo {
+			externFuncListTreeNode.Children = append(externFuncListTreeNode.Children,
+				mi.TreeNode.Children[0].Children...)
+		}
+	}
+
+	curSourceFilePath = ""
+
+	return name, objectModuleInfo.TreeNode, externFuncListTreeNode
+}
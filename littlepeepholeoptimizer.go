@@ -0,0 +1,378 @@
+package main
+
+import "encoding/binary"
+
+var isPeepholeOptimizerEnabled = true
+
+type Instr struct {
+	Op       byte
+	Operands []byte
+
+	Addr    int
+	NewAddr int
+
+	IsRemoved bool
+	IsTarget  bool
+	IsBlank   bool
+
+	JumpTargetIndex          int
+	JumpDispBytesCount       int
+	JumpTableTargetIndexList []int
+}
+
+var instrList []Instr
+
+func getInstrOperandsBytesCount(code []byte, addr int) (int, bool) {
+	op := code[addr]
+
+	switch op {
+	case OP_HALT, OP_ECALL, OP_CALL, OP_JUMP:
+		return 0, true
+	case OP_RETURN, OP_CALL_INDIRECT, OP_BRANCH, OP_POP:
+		return 1, true
+	case OP_PUSH:
+		if addr+1 >= len(code) {
+			return 0, false
+		}
+		return 1 + int(code[addr+1]&0b1111), true
+	case OP_JUMP_TABLE:
+		if addr+10 > len(code) {
+			return 0, false
+		}
+		return 9 + 8*int(binary.LittleEndian.Uint64(code[addr+2:])), true
+	case OP_STORE_STRING:
+		for i := addr + 1; i < len(code); i++ {
+			if code[i] == 0 {
+				return i - addr, true
+			}
+		}
+		return 0, false
+	case OP_ASSIGN, OP_CONVERT, OP_LOAD, OP_STORE:
+		return 2, true
+	}
+
+	if op >= OP_ADD && op <= OP_GEQ {
+		return 2, true
+	}
+
+	return 0, false
+}
+
+func isJumpDispPushInstr(instr Instr) bool {
+	return (instr.Op == OP_PUSH) && (instr.Operands[0] == byte(ADDR_BYTES_COUNT)) && !instr.IsBlank
+}
+
+func decodeInstrList(code []byte, blankAddrList map[int]bool) {
+	instrList = make([]Instr, 0)
+
+	addrIndexList := make(map[int]int)
+
+	for addr := 0; addr < len(code); {
+		n, ok := getInstrOperandsBytesCount(code, addr)
+		if !ok || addr+1+n > len(code) {
+			PrintErrorAndExit(0)
+		}
+
+		instr := Instr{
+			Op:              code[addr],
+			Operands:        code[addr+1 : addr+1+n],
+			Addr:            addr,
+			IsBlank:         blankAddrList[addr],
+			JumpTargetIndex: -1}
+
+		if (instr.Op == OP_JUMP || instr.Op == OP_BRANCH || instr.Op == OP_CALL) &&
+			(len(instrList) != 0) && isJumpDispPushInstr(instrList[len(instrList)-1]) {
+
+			dispInstr := instrList[len(instrList)-1]
+			instrList = instrList[:len(instrList)-1]
+
+			instr.Addr = dispInstr.Addr
+			instr.JumpTargetIndex = addr + int(binary.LittleEndian.Uint64(dispInstr.Operands[1:]))
+			instr.JumpDispBytesCount = ADDR_BYTES_COUNT
+		}
+
+		if instr.Op == OP_JUMP_TABLE {
+			entriesCount := int(binary.LittleEndian.Uint64(instr.Operands[1:]))
+			for j := 0; j < entriesCount; j++ {
+				instr.JumpTableTargetIndexList = append(instr.JumpTableTargetIndexList,
+					addr+int(binary.LittleEndian.Uint64(instr.Operands[9+8*j:])))
+			}
+		}
+
+		addrIndexList[instr.Addr] = len(instrList)
+		instrList = append(instrList, instr)
+
+		addr = addr + 1 + n
+	}
+
+	addrIndexList[len(code)] = len(instrList)
+
+	getIndex := func(addr int) int {
+		index, ok := addrIndexList[addr]
+		if !ok {
+			PrintErrorAndExit(0)
+		}
+		if index < len(instrList) {
+			instrList[index].IsTarget = true
+		}
+		return index
+	}
+
+	for i := range instrList {
+		if instrList[i].JumpTargetIndex != -1 {
+			instrList[i].JumpTargetIndex = getIndex(instrList[i].JumpTargetIndex)
+		}
+		for j, targetAddr := range instrList[i].JumpTableTargetIndexList {
+			instrList[i].JumpTableTargetIndexList[j] = getIndex(targetAddr)
+		}
+	}
+}
+
+func getNextInstrIndex(i int) int {
+	for i = i + 1; i < len(instrList); i++ {
+		if !instrList[i].IsRemoved {
+			return i
+		}
+	}
+	return -1
+}
+
+func optimizePushPopInstr(i int) bool {
+	a := instrList[i]
+	j := getNextInstrIndex(i)
+	if j == -1 {
+		return false
+	}
+	b := instrList[j]
+
+	if (a.Op == OP_PUSH) && !a.IsBlank && ((a.Operands[0] & 0b100000) == 0) &&
+		(b.Op == OP_POP) && !b.IsTarget &&
+		((b.Operands[0] & 0b1111) == (a.Operands[0] & 0b1111)) {
+
+		instrList[i].IsRemoved = true
+		instrList[j].IsRemoved = true
+
+		return true
+	}
+
+	return false
+}
+
+func optimizeLoadInstr(i int) bool {
+	a := instrList[i]
+	j := getNextInstrIndex(i)
+	if j == -1 {
+		return false
+	}
+	b := instrList[j]
+
+	if (a.Op == OP_PUSH) && !a.IsBlank && !a.IsTarget &&
+		((a.Operands[0] & 0b100000) == 0) && !b.IsTarget && (b.Op == OP_ADD) &&
+		(b.Operands[1] == a.Operands[0]) && (b.Operands[0] == (a.Operands[0] | 0b100000)) {
+
+		for _, v := range a.Operands[1:] {
+			if v != 0 {
+				return false
+			}
+		}
+
+		instrList[i].IsRemoved = true
+		instrList[j].Op = OP_CONVERT
+
+		return true
+	}
+
+	return false
+}
+
+func getJumpInstrBytesCount(instr Instr, dispBytesCount int) int {
+	n := 2 + dispBytesCount + 1 + len(instr.Operands)
+	if dispBytesCount != ADDR_BYTES_COUNT {
+		n = n + 3
+	}
+	return n
+}
+
+func getInstrBytesCount(instr Instr) int {
+	if instr.IsRemoved {
+		return 0
+	} else if instr.JumpTargetIndex != -1 {
+		return getJumpInstrBytesCount(instr, instr.JumpDispBytesCount)
+	}
+	return 1 + len(instr.Operands)
+}
+
+func getInstrNewAddr(index int, endAddr int) int {
+	if index == len(instrList) {
+		return endAddr
+	}
+	return instrList[index].NewAddr
+}
+
+func layoutInstrList() int {
+	addr := 0
+	for i := range instrList {
+		instrList[i].NewAddr = addr
+		addr = addr + getInstrBytesCount(instrList[i])
+	}
+	return addr
+}
+
+func doesDispFit(disp int, bytesCount int) bool {
+	if bytesCount == ADDR_BYTES_COUNT {
+		return true
+	}
+	bitsCount := bytesCount * 8
+	return (disp >= -(1 << (bitsCount - 1))) && (disp < (1 << (bitsCount - 1)))
+}
+
+func shrinkJumpInstrList() {
+	for {
+		isChanged := false
+
+		endAddr := layoutInstrList()
+
+		for i, instr := range instrList {
+			if instr.IsRemoved || instr.JumpTargetIndex == -1 {
+				continue
+			}
+
+			targetAddr := getInstrNewAddr(instr.JumpTargetIndex, endAddr)
+
+			for _, bytesCount := range []int{1, 2, 4} {
+				if bytesCount >= instr.JumpDispBytesCount {
+					break
+				}
+
+				opAddr := instr.NewAddr + getJumpInstrBytesCount(instr, bytesCount) -
+					(1 + len(instr.Operands))
+
+				if doesDispFit(targetAddr-opAddr, bytesCount) {
+					instrList[i].JumpDispBytesCount = bytesCount
+					isChanged = true
+					break
+				}
+			}
+		}
+
+		if !isChanged {
+			return
+		}
+	}
+}
+
+func encodeInstrList() []byte {
+	endAddr := layoutInstrList()
+
+	code := make([]byte, 0)
+
+	for _, instr := range instrList {
+		if instr.IsRemoved {
+			continue
+		}
+
+		if instr.JumpTargetIndex != -1 {
+			dispII := IntInfo{IsSigned: true, BytesCount: instr.JumpDispBytesCount}
+			if instr.JumpDispBytesCount == ADDR_BYTES_COUNT {
+				dispII.IsSigned = false
+			}
+
+			opAddr := instr.NewAddr + getInstrBytesCount(instr) - (1 + len(instr.Operands))
+			disp := getInstrNewAddr(instr.JumpTargetIndex, endAddr) - opAddr
+
+			if !doesDispFit(disp, instr.JumpDispBytesCount) {
+				PrintErrorAndExit(0)
+			}
+
+			code = append(code, OP_PUSH, encodeIntInfo(dispII))
+			code = append(code,
+				binary.LittleEndian.AppendUint64(make([]byte, 0), uint64(disp))[:dispII.BytesCount]...)
+
+			if instr.JumpDispBytesCount != ADDR_BYTES_COUNT {
+				code = append(code, OP_CONVERT, encodeIntInfo(dispII),
+					encodeIntInfo(IntInfo{IsSigned: false, BytesCount: ADDR_BYTES_COUNT}))
+			}
+		}
+
+		opAddr := len(code)
+
+		code = append(code, instr.Op)
+		code = append(code, instr.Operands...)
+
+		for j, targetIndex := range instr.JumpTableTargetIndexList {
+			binary.LittleEndian.PutUint64(code[opAddr+10+8*j:],
+				uint64(getInstrNewAddr(targetIndex, endAddr)-opAddr))
+		}
+	}
+
+	return code
+}
+
+func PeepholeOptimizer() {
+	blankAddrList := make(map[int]bool)
+
+	for _, bfc := range blankFuncCallList {
+		blankAddrList[bfc.Addr] = true
+	}
+	for _, bfa := range blankFuncAddrList {
+		blankAddrList[bfa.Addr] = true
+	}
+
+	decodeInstrList(bytecode, blankAddrList)
+
+	endAddr := 0
+
+	addrIndexList := make(map[int]int)
+	for i, instr := range instrList {
+		addrIndexList[instr.Addr] = i
+	}
+	addrIndexList[len(bytecode)] = len(instrList)
+
+	getNewAddr := func(addr int) int {
+		index, ok := addrIndexList[addr]
+		if !ok {
+			PrintErrorAndExit(0)
+		}
+		return getInstrNewAddr(index, endAddr)
+	}
+
+	for isChanged := true; isChanged; {
+		isChanged = false
+
+		for i := range instrList {
+			if !instrList[i].IsRemoved && optimizePushPopInstr(i) {
+				isChanged = true
+			}
+			if !instrList[i].IsRemoved && optimizeLoadInstr(i) {
+				isChanged = true
+			}
+		}
+	}
+
+	shrinkJumpInstrList()
+
+	newBytecode := encodeInstrList()
+	endAddr = len(newBytecode)
+
+	for i := range blankFuncCallList {
+		blankFuncCallList[i].Addr = getNewAddr(blankFuncCallList[i].Addr)
+	}
+	for i := range blankFuncAddrList {
+		blankFuncAddrList[i].Addr = getNewAddr(blankFuncAddrList[i].Addr)
+	}
+	for ident, addr := range funcAddrList {
+		funcAddrList[ident] = getNewAddr(addr)
+	}
+	for i := range debugFuncList {
+		debugFuncList[i].Addr = getNewAddr(debugFuncList[i].Addr)
+
+		var lineList []DebugLine
+		for _, dl := range debugFuncList[i].LineList {
+			lineList = appendDebugLine(lineList, DebugLine{Addr: getNewAddr(dl.Addr),
+				SourceFilePath: dl.SourceFilePath, Line: dl.Line})
+		}
+		debugFuncList[i].LineList = lineList
+	}
+
+	bytecode = newBytecode
+}
@@ -0,0 +1,582 @@
+package main
+
+import "encoding/binary"
+
+var REGISTER_BYTECODE_MAGIC = []byte{0x7f, 'L', 'C', 'R'}
+
+const (
+	ROP_HALT  byte = 0x01
+	ROP_ECALL byte = 0x02
+	ROP_ENTER byte = 0x03
+
+	ROP_CALL          byte = 0x04
+	ROP_RETURN        byte = 0x05
+	ROP_CALL_INDIRECT byte = 0x06
+
+	ROP_JUMP           byte = 0x08
+	ROP_BRANCH_ZERO    byte = 0x09
+	ROP_JUMP_TABLE     byte = 0x0a
+	ROP_BRANCH_NONZERO byte = 0x0b
+	ROP_SWITCH         byte = 0x0c
+
+	ROP_LOAD_IMM byte = 0x10
+	ROP_MOVE     byte = 0x11
+
+	ROP_LOAD         byte = 0x20
+	ROP_STORE        byte = 0x21
+	ROP_STORE_STRING byte = 0x22
+
+	ROP_CONVERT byte = 0x58
+
+	ROP_BRANCH_EQL byte = 0x60
+	ROP_BRANCH_NEQ byte = 0x61
+	ROP_BRANCH_LSS byte = 0x62
+	ROP_BRANCH_GTR byte = 0x63
+	ROP_BRANCH_LEQ byte = 0x64
+	ROP_BRANCH_GEQ byte = 0x65
+
+	// Binary ops use the numbers of the stack ops. Binary ops and branches on
+	// comparisons have this bit set when the second operand is an immediate
+	ROP_IMM_FLAG byte = 0x80
+)
+
+var REGISTERS_MAX_COUNT = 0xffff
+var REGISTER_NONE uint16 = 0xffff
+
+var registerBytecode []byte
+
+var regFuncAddrList map[string]int
+var regBlankFuncCallList []BlankFuncCall
+var regBlankFuncAddrList []BlankFuncCall
+
+var regBlockAddrList []int
+var regBlankBlockJumpList []BlankBlockJump
+
+var localRegList []uint16
+var valueRegBase int
+var valueRegMaxCount int
+var regIsLocalReferencedList []bool
+var regIsLoopBlockList []bool
+
+func emitRegOp(op byte, operands ...interface{}) {
+	registerBytecode = append(registerBytecode, op)
+
+	for _, operand := range operands {
+		switch v := operand.(type) {
+		case byte:
+			registerBytecode = append(registerBytecode, v)
+		case uint16:
+			registerBytecode = binary.LittleEndian.AppendUint16(registerBytecode, v)
+		case uint32:
+			registerBytecode = binary.LittleEndian.AppendUint32(registerBytecode, v)
+		case uint64:
+			registerBytecode = binary.LittleEndian.AppendUint64(registerBytecode, v)
+		default:
+			PrintErrorAndExit(0)
+		}
+	}
+}
+
+func emitRegBlockAddr(b int) {
+	regBlankBlockJumpList = append(regBlankBlockJumpList,
+		BlankBlockJump{Block: b, Addr: len(registerBytecode)})
+	registerBytecode = binary.LittleEndian.AppendUint32(registerBytecode, 0)
+}
+
+func emitRegBlockJumpOp(op byte, reg uint16, b int) {
+	emitRegOp(op)
+	if op != ROP_JUMP {
+		registerBytecode = binary.LittleEndian.AppendUint16(registerBytecode, reg)
+	}
+	emitRegBlockAddr(b)
+}
+
+func emitRegCallOp(ident string, base uint16, dest uint16) {
+	emitRegOp(ROP_CALL)
+	regBlankFuncCallList = append(regBlankFuncCallList,
+		BlankFuncCall{Ident: ident, Addr: len(registerBytecode)})
+	registerBytecode = binary.LittleEndian.AppendUint32(registerBytecode, 0)
+	registerBytecode = binary.LittleEndian.AppendUint16(registerBytecode, base)
+	registerBytecode = binary.LittleEndian.AppendUint16(registerBytecode, dest)
+}
+
+func getValueReg(depth int) uint16 {
+	if depth+1 > valueRegMaxCount {
+		valueRegMaxCount = depth + 1
+	}
+
+	if valueRegBase+depth >= REGISTERS_MAX_COUNT {
+		PrintErrorAndExit(0)
+	}
+
+	return uint16(valueRegBase + depth)
+}
+
+func getRegCanonicalValue(i interface{}, v uint64) uint64 {
+	if ii, ok := i.(IntInfo); ok {
+		return getSignExtendedValue(ii, v)
+	}
+	return v
+}
+
+func lowerIRSwitchToRegister(f IRFunc, instr IRInstr, reg uint16) {
+	ii := f.ValueTypeList[instr.ArgList[0]].(IntInfo)
+
+	if minValue, entriesCount, ok := getSwitchJumpTableInfo(ii, instr.CaseValueList); ok {
+		emitRegOp(ROP_JUMP_TABLE, reg, encodeIntInfo(ii),
+			getSignExtendedValue(ii, minValue), uint32(entriesCount))
+		emitRegBlockAddr(instr.TargetList[0])
+
+		entryBlockList := make([]int, entriesCount)
+		for j := range entryBlockList {
+			entryBlockList[j] = instr.TargetList[0]
+		}
+		for j, v := range instr.CaseValueList {
+			entryBlockList[(v-minValue)&getIntInfoMask(ii)] = instr.TargetList[j+1]
+		}
+
+		for _, b := range entryBlockList {
+			emitRegBlockAddr(b)
+		}
+	} else {
+		emitRegOp(ROP_SWITCH, reg, uint32(len(instr.CaseValueList)))
+		emitRegBlockAddr(instr.TargetList[0])
+
+		for j, v := range instr.CaseValueList {
+			registerBytecode = binary.LittleEndian.AppendUint64(registerBytecode,
+				getSignExtendedValue(ii, v))
+			emitRegBlockAddr(instr.TargetList[j+1])
+		}
+	}
+}
+
+var regBinaryOpList = map[TokenType]byte{
+	TT_ADD: OP_ADD,
+	TT_SUB: OP_SUB,
+
+	TT_AND: OP_AND,
+	TT_OR:  OP_OR,
+	TT_XOR: OP_XOR,
+
+	TT_SHL: OP_SHL,
+	TT_SHR: OP_SHR,
+
+	TT_MUL: OP_MUL,
+	TT_QUO: OP_QUO,
+	TT_REM: OP_REM,
+
+	TT_EQL: OP_EQL,
+	TT_NEQ: OP_NEQ,
+	TT_LSS: OP_LSS,
+	TT_GTR: OP_GTR,
+	TT_LEQ: OP_LEQ,
+	TT_GEQ: OP_GEQ,
+}
+
+// Ops whose operands can be swapped, with the op to use after the swap
+var regSwappedBinaryOpList = map[byte]byte{
+	OP_ADD: OP_ADD,
+	OP_AND: OP_AND,
+	OP_OR:  OP_OR,
+	OP_XOR: OP_XOR,
+	OP_MUL: OP_MUL,
+
+	OP_EQL: OP_EQL,
+	OP_NEQ: OP_NEQ,
+	OP_LSS: OP_GTR,
+	OP_GTR: OP_LSS,
+	OP_LEQ: OP_GEQ,
+	OP_GEQ: OP_LEQ,
+}
+
+var regInvertedCmpOpList = map[byte]byte{
+	OP_EQL: OP_NEQ,
+	OP_NEQ: OP_EQL,
+	OP_LSS: OP_GEQ,
+	OP_GTR: OP_LEQ,
+	OP_LEQ: OP_GTR,
+	OP_GEQ: OP_LSS,
+}
+
+func lowerIRBlockToRegister(f IRFunc, blockIndex int) {
+	instrList := f.BlockList[blockIndex].InstrList
+
+	defIndexList := make(map[int]int)
+	useIndexList := make(map[int]int)
+
+	for i, instr := range instrList {
+		for _, arg := range instr.ArgList {
+			useIndexList[arg] = i
+		}
+		if instr.Dest != -1 {
+			defIndexList[instr.Dest] = i
+		}
+	}
+
+	// Values keep their registers across conversions that do not change them
+	isNopConvert := func(instr IRInstr) bool {
+		return instr.Op == IR_CONVERT && encodeTypeInfo(instr.Type, false) ==
+			encodeTypeInfo(f.ValueTypeList[instr.ArgList[0]], false)
+	}
+
+	getUse := func(v int) (int, int) {
+		j := useIndexList[v]
+		for isNopConvert(instrList[j]) {
+			v = instrList[j].Dest
+			j = useIndexList[v]
+		}
+		return j, v
+	}
+
+	isSkipped := make(map[int]bool)
+
+	// A value that is stored into a local right away is computed into the
+	// register of the local
+	destLocalList := make(map[int]int)
+
+	for i, instr := range instrList {
+		if instr.Op == IR_STORE_LOCAL {
+			arg := instr.ArgList[0]
+			argInstr := instrList[defIndexList[arg]]
+
+			// Registers of locals start out as zero
+			if !regIsLoopBlockList[blockIndex] && !f.LocalList[instr.Local].IsParam &&
+				!regIsLocalReferencedList[instr.Local] &&
+				argInstr.Op == IR_CONST && argInstr.Value == 0 && defIndexList[arg] == i-1 {
+				isSkipped[i-1] = true
+				isSkipped[i] = true
+			} else if defIndexList[arg] == i-1 {
+				destLocalList[i-1] = instr.Local
+				isSkipped[i] = true
+			}
+		}
+
+		if instr.Op == IR_LOAD_LOCAL || instr.Op == IR_STORE_LOCAL {
+			regIsLocalReferencedList[instr.Local] = true
+		}
+	}
+
+	// A variable read is used straight from the register of the local unless
+	// it is a call argument or the local is written before the use
+	isFolded := make(map[int]bool)
+
+	for i, instr := range instrList {
+		if instr.Op != IR_LOAD_LOCAL {
+			continue
+		}
+
+		if _, ok := destLocalList[i]; ok {
+			continue
+		}
+
+		j, v := getUse(instr.Dest)
+		user := instrList[j]
+
+		if user.Op == IR_CALL ||
+			(user.Op == IR_CALL_INDIRECT && user.ArgList[len(user.ArgList)-1] != v) {
+			continue
+		}
+
+		isFolded[instr.Dest] = true
+
+		for k := i + 1; k < j; k++ {
+			if instrList[k].Op == IR_STORE_LOCAL && instrList[k].Local == instr.Local {
+				isFolded[instr.Dest] = false
+			}
+		}
+	}
+
+	// Constant operands of binary ops are encoded inline, and a comparison
+	// right before a branch is merged into it
+	immArgList := make(map[int]int)
+	isMergedCmp := make(map[int]bool)
+
+	for i, instr := range instrList {
+		switch instr.Op {
+		case IR_BINARY:
+			if instrList[defIndexList[instr.ArgList[1]]].Op == IR_CONST {
+				immArgList[i] = 1
+			} else if _, ok := regSwappedBinaryOpList[regBinaryOpList[instr.BinaryOp]]; ok &&
+				instrList[defIndexList[instr.ArgList[0]]].Op == IR_CONST {
+				immArgList[i] = 0
+			}
+		case IR_BRANCH:
+			if k := defIndexList[instr.ArgList[0]]; k == i-1 && instrList[k].Op == IR_BINARY {
+				if _, ok := regInvertedCmpOpList[regBinaryOpList[instrList[k].BinaryOp]]; ok {
+					isMergedCmp[k] = true
+				}
+			}
+		}
+	}
+
+	isImm := make(map[int]bool)
+	for i, k := range immArgList {
+		isImm[instrList[i].ArgList[k]] = true
+	}
+
+	valueRegList := make(map[int]uint16)
+	depth := 0
+
+	for i, instr := range instrList {
+		depth = depth - len(instr.ArgList)
+
+		argReg := func(k int) uint16 {
+			return valueRegList[instr.ArgList[k]]
+		}
+
+		var dest uint16 = REGISTER_NONE
+
+		if instr.Dest != -1 {
+			_, isDestLocal := destLocalList[i]
+
+			if isFolded[instr.Dest] {
+				dest = localRegList[instr.Local]
+			} else if isDestLocal {
+				dest = localRegList[destLocalList[i]]
+			} else if isNopConvert(instr) {
+				dest = argReg(0)
+			} else {
+				dest = getValueReg(depth)
+			}
+
+			valueRegList[instr.Dest] = dest
+			depth = depth + 1
+		}
+
+		if isSkipped[i] || isImm[instr.Dest] || isFolded[instr.Dest] || isMergedCmp[i] {
+			continue
+		}
+
+		switch instr.Op {
+		case IR_CONST:
+			emitRegOp(ROP_LOAD_IMM, dest, getRegCanonicalValue(instr.Type, instr.Value))
+		case IR_FUNC_ADDR:
+			emitRegOp(ROP_LOAD_IMM, dest)
+			regBlankFuncAddrList = append(regBlankFuncAddrList,
+				BlankFuncCall{Ident: instr.Ident, Addr: len(registerBytecode)})
+			registerBytecode = binary.LittleEndian.AppendUint64(registerBytecode, 0)
+		case IR_LOAD_LOCAL:
+			emitRegOp(ROP_MOVE, dest, localRegList[instr.Local])
+		case IR_STORE_LOCAL:
+			emitRegOp(ROP_MOVE, localRegList[instr.Local], argReg(0))
+		case IR_BINARY:
+			lowerIRBinaryToRegister(f, instrList, defIndexList, i, immArgList, valueRegList,
+				dest, -1, false)
+		case IR_CONVERT:
+			if dest != argReg(0) || !isNopConvert(instr) {
+				emitRegOp(ROP_CONVERT, encodeTypeInfo(instr.Type, false), dest, argReg(0))
+			}
+		case IR_CALL, IR_CALL_INDIRECT:
+			var base uint16
+
+			if len(instr.ArgList) != 0 {
+				base = argReg(0)
+			} else {
+				base = getValueReg(depth)
+			}
+
+			if instr.Op == IR_CALL_INDIRECT {
+				emitRegOp(ROP_CALL_INDIRECT, argReg(len(instr.ArgList)-1), base, dest)
+			} else {
+				emitRegCallOp(instr.Ident, base, dest)
+			}
+		case IR_LOAD:
+			emitRegOp(ROP_LOAD, encodeTypeInfo(instr.Type, false), dest, argReg(0))
+		case IR_STORE:
+			emitRegOp(ROP_STORE, encodeTypeInfo(f.ValueTypeList[instr.ArgList[1]], false),
+				argReg(0), argReg(1))
+		case IR_STORE_STRING:
+			emitRegOp(ROP_STORE_STRING, argReg(0))
+			registerBytecode = append(registerBytecode, instr.Buf...)
+			registerBytecode = append(registerBytecode, 0)
+		case IR_DISCARD:
+		case IR_JUMP:
+			if instr.TargetList[0] != blockIndex+1 {
+				emitRegBlockJumpOp(ROP_JUMP, 0, instr.TargetList[0])
+			}
+		case IR_BRANCH:
+			trueBlock, falseBlock := instr.TargetList[0], instr.TargetList[1]
+
+			if isMergedCmp[i-1] {
+				if trueBlock == blockIndex+1 {
+					lowerIRBinaryToRegister(f, instrList, defIndexList, i-1, immArgList, valueRegList,
+						0, falseBlock, true)
+				} else {
+					lowerIRBinaryToRegister(f, instrList, defIndexList, i-1, immArgList, valueRegList,
+						0, trueBlock, false)
+				}
+			} else if trueBlock == blockIndex+1 {
+				emitRegBlockJumpOp(ROP_BRANCH_ZERO, argReg(0), falseBlock)
+			} else {
+				emitRegBlockJumpOp(ROP_BRANCH_NONZERO, argReg(0), trueBlock)
+			}
+
+			if trueBlock != blockIndex+1 && falseBlock != blockIndex+1 {
+				emitRegBlockJumpOp(ROP_JUMP, 0, falseBlock)
+			}
+		case IR_SWITCH:
+			lowerIRSwitchToRegister(f, instr, argReg(0))
+		case IR_RETURN:
+			if len(instr.ArgList) != 0 {
+				emitRegOp(ROP_RETURN, argReg(0))
+			} else {
+				emitRegOp(ROP_RETURN, REGISTER_NONE)
+			}
+		default:
+			PrintErrorAndExit(0)
+		}
+	}
+}
+
+// Emits a binary op, or for a comparison with a target block, a branch that
+// jumps to the block when the comparison is true, or false if inverted
+func lowerIRBinaryToRegister(f IRFunc, instrList []IRInstr, defIndexList map[int]int, i int,
+	immArgList map[int]int, valueRegList map[int]uint16, dest uint16,
+	targetBlock int, isInverted bool) {
+
+	instr := instrList[i]
+
+	op := regBinaryOpList[instr.BinaryOp]
+	a, b := instr.ArgList[0], instr.ArgList[1]
+
+	k, isImm := immArgList[i]
+	if isImm && k == 0 {
+		op = regSwappedBinaryOpList[op]
+		a, b = b, a
+	}
+
+	t1 := encodeTypeInfo(f.ValueTypeList[a], false)
+	t2 := encodeTypeInfo(f.ValueTypeList[b], false)
+
+	if targetBlock != -1 {
+		if isInverted {
+			op = regInvertedCmpOpList[op]
+		}
+		op = op - OP_EQL + ROP_BRANCH_EQL
+	}
+
+	if isImm {
+		op = op | ROP_IMM_FLAG
+	}
+
+	if targetBlock != -1 {
+		emitRegOp(op, t1, valueRegList[a])
+	} else {
+		emitRegOp(op, t1, t2, dest, valueRegList[a])
+	}
+
+	if isImm {
+		constInstr := instrList[defIndexList[b]]
+		registerBytecode = binary.LittleEndian.AppendUint64(registerBytecode,
+			getRegCanonicalValue(constInstr.Type, constInstr.Value))
+	} else {
+		registerBytecode = binary.LittleEndian.AppendUint16(registerBytecode, valueRegList[b])
+	}
+
+	if targetBlock != -1 {
+		emitRegBlockAddr(targetBlock)
+	}
+}
+
+func lowerIRFuncToRegister(f IRFunc) {
+	regFuncAddrList[f.Ident] = len(registerBytecode)
+
+	localRegList = make([]uint16, len(f.LocalList))
+
+	paramsCount := 0
+	for i, local := range f.LocalList {
+		if local.IsParam {
+			localRegList[i] = uint16(paramsCount)
+			paramsCount++
+		}
+	}
+
+	valueRegBase = paramsCount
+	for i, local := range f.LocalList {
+		if !local.IsParam {
+			localRegList[i] = uint16(valueRegBase)
+			valueRegBase++
+		}
+	}
+
+	if valueRegBase >= REGISTERS_MAX_COUNT {
+		PrintErrorAndExit(0)
+	}
+
+	valueRegMaxCount = 0
+
+	enterAddr := len(registerBytecode)
+	emitRegOp(ROP_ENTER, uint16(0), uint16(paramsCount))
+
+	regIsLocalReferencedList = make([]bool, len(f.LocalList))
+	regIsLoopBlockList = getLoopBlockList(f)
+
+	regBlockAddrList = make([]int, len(f.BlockList))
+	regBlankBlockJumpList = make([]BlankBlockJump, 0)
+
+	for i := range f.BlockList {
+		regBlockAddrList[i] = len(registerBytecode)
+		lowerIRBlockToRegister(f, i)
+	}
+
+	binary.LittleEndian.PutUint16(registerBytecode[enterAddr+1:],
+		uint16(valueRegBase+valueRegMaxCount))
+
+	for _, bbj := range regBlankBlockJumpList {
+		binary.LittleEndian.PutUint32(registerBytecode[bbj.Addr:],
+			uint32(regBlockAddrList[bbj.Block]))
+	}
+}
+
+func RegisterGenerator(ir IRProgram) []byte {
+	registerBytecode = make([]byte, 0)
+	registerBytecode = append(registerBytecode, REGISTER_BYTECODE_MAGIC...)
+
+	regFuncAddrList = make(map[string]int)
+	regBlankFuncCallList = make([]BlankFuncCall, 0)
+	regBlankFuncAddrList = make([]BlankFuncCall, 0)
+
+	sigInfo, ok := ir.FuncSigList["main"]
+
+	if (!ok) || (len(sigInfo.ParamList) != 0) {
+		PrintErrorAndExit(0)
+	}
+
+	if _, ok := sigInfo.ReturnValueInfo.(VoidInfo); !ok {
+		PrintErrorAndExit(0)
+	}
+
+	emitRegCallOp("main", 0, REGISTER_NONE)
+	emitRegOp(ROP_HALT)
+
+	regFuncAddrList["ecall"] = len(registerBytecode)
+	emitRegOp(ROP_ENTER, uint16(0), uint16(0))
+	emitRegOp(ROP_ECALL)
+	emitRegOp(ROP_RETURN, REGISTER_NONE)
+
+	for _, f := range ir.FuncList {
+		lowerIRFuncToRegister(f)
+	}
+
+	if len(registerBytecode) > 0xffff_ffff {
+		PrintErrorAndExit(0)
+	}
+
+	for _, bfc := range regBlankFuncCallList {
+		funcAddr, ok := regFuncAddrList[bfc.Ident]
+		if !ok {
+			PrintErrorAndExit(0)
+		}
+		binary.LittleEndian.PutUint32(registerBytecode[bfc.Addr:], uint32(funcAddr))
+	}
+
+	for _, bfa := range regBlankFuncAddrList {
+		funcAddr, ok := regFuncAddrList[bfa.Ident]
+		if !ok {
+			PrintErrorAndExit(0)
+		}
+		binary.LittleEndian.PutUint64(registerBytecode[bfa.Addr:], uint64(funcAddr))
+	}
+
+	return registerBytecode
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+var VM_REGISTERS_COUNT = 0x10_0000
+
+type RegisterVMFrame struct {
+	ReturnAddr uint64
+	Base       int
+	Dest       uint16
+}
+
+func isRegisterBytecode(code []byte) bool {
+	return bytes.HasPrefix(code, REGISTER_BYTECODE_MAGIC)
+}
+
+func getRegSecondOperand(code []byte, r []uint64, op byte, addr uint64) (uint64, uint64) {
+	if (op & ROP_IMM_FLAG) != 0 {
+		return binary.LittleEndian.Uint64(code[addr:]), addr + 8
+	}
+	return r[binary.LittleEndian.Uint16(code[addr:])], addr + 2
+}
+
+// Compares values that are sign extended to 64 bits according to their type
+func isRegCmpTrue(op byte, t byte, a uint64, b uint64) bool {
+	if (t & 0b10000) != 0 {
+		a = a ^ (uint64(1) << 63)
+		b = b ^ (uint64(1) << 63)
+	}
+
+	switch op {
+	case OP_EQL:
+		return a == b
+	case OP_NEQ:
+		return a != b
+	case OP_LSS:
+		return a < b
+	case OP_GTR:
+		return a > b
+	case OP_LEQ:
+		return a <= b
+	default:
+		return a >= b
+	}
+}
+
+// Runs register bytecode until it halts. The returned message is empty when
+// the program halted normally.
+func RunRegisterBytecode(code []byte, w io.Writer) (msg string, instrCount uint64) {
+	defer func() {
+		if recover() != nil {
+			msg = VM_INVALID_CODE_MESSAGE
+		}
+	}()
+
+	if !isRegisterBytecode(code) {
+		return VM_INVALID_CODE_MESSAGE, 0
+	}
+
+	mem := make([]byte, MEMORY_SIZE+8)
+	regList := make([]uint64, VM_REGISTERS_COUNT)
+
+	frameList := make([]RegisterVMFrame, 0)
+
+	base := 0
+	r := regList
+
+	pc := uint64(len(REGISTER_BYTECODE_MAGIC))
+
+	u16 := func(addr uint64) uint16 {
+		return binary.LittleEndian.Uint16(code[addr:])
+	}
+
+	u32 := func(addr uint64) uint64 {
+		return uint64(binary.LittleEndian.Uint32(code[addr:]))
+	}
+
+	for {
+		instrCount++
+
+		op := code[pc]
+
+		switch op {
+		case ROP_HALT:
+			return "", instrCount
+		case ROP_ECALL:
+			runVMEcall(mem, w)
+			pc = pc + 1
+		case ROP_ENTER:
+			regsCount := int(u16(pc + 1))
+			if base+regsCount > len(regList) {
+				return VM_PANIC_MESSAGE, instrCount
+			}
+			clear(r[u16(pc+3):regsCount])
+			pc = pc + 5
+		case ROP_CALL, ROP_CALL_INDIRECT:
+			var targetAddr uint64
+			var frame RegisterVMFrame
+
+			if op == ROP_CALL {
+				targetAddr = u32(pc + 1)
+				frame = RegisterVMFrame{ReturnAddr: pc + 9, Base: base, Dest: u16(pc + 7)}
+				base = base + int(u16(pc+5))
+			} else {
+				targetAddr = r[u16(pc+1)]
+				frame = RegisterVMFrame{ReturnAddr: pc + 7, Base: base, Dest: u16(pc + 5)}
+				base = base + int(u16(pc+3))
+
+				if targetAddr >= uint64(len(code)) || code[targetAddr] != ROP_ENTER {
+					return VM_PANIC_MESSAGE, instrCount
+				}
+			}
+
+			if len(frameList) == VM_REGISTERS_COUNT {
+				return VM_PANIC_MESSAGE, instrCount
+			}
+
+			frameList = append(frameList, frame)
+			r = regList[base:]
+			pc = targetAddr
+		case ROP_RETURN:
+			var v uint64
+			if src := u16(pc + 1); src != REGISTER_NONE {
+				v = r[src]
+			}
+
+			frame := frameList[len(frameList)-1]
+			frameList = frameList[:len(frameList)-1]
+
+			base = frame.Base
+			r = regList[base:]
+			if frame.Dest != REGISTER_NONE {
+				r[frame.Dest] = v
+			}
+			pc = frame.ReturnAddr
+		case ROP_JUMP:
+			pc = u32(pc + 1)
+		case ROP_BRANCH_ZERO:
+			if r[u16(pc+1)] == 0 {
+				pc = u32(pc + 3)
+			} else {
+				pc = pc + 7
+			}
+		case ROP_BRANCH_NONZERO:
+			if r[u16(pc+1)] != 0 {
+				pc = u32(pc + 3)
+			} else {
+				pc = pc + 7
+			}
+		case ROP_JUMP_TABLE:
+			t := code[pc+3]
+			i := (r[u16(pc+1)] - binary.LittleEndian.Uint64(code[pc+4:])) & vmMaskList[t&0b1111]
+			if i < u32(pc+12) {
+				pc = u32(pc + 20 + (i * 4))
+			} else {
+				pc = u32(pc + 16)
+			}
+		case ROP_SWITCH:
+			v := r[u16(pc+1)]
+			casesCount := u32(pc + 3)
+			targetAddr := u32(pc + 7)
+			for i := uint64(0); i < casesCount; i++ {
+				if binary.LittleEndian.Uint64(code[pc+11+(i*12):]) == v {
+					targetAddr = u32(pc + 19 + (i * 12))
+					break
+				}
+			}
+			pc = targetAddr
+		case ROP_LOAD_IMM:
+			r[u16(pc+1)] = binary.LittleEndian.Uint64(code[pc+3:])
+			pc = pc + 11
+		case ROP_MOVE:
+			r[u16(pc+1)] = r[u16(pc+3)]
+			pc = pc + 5
+		case ROP_CONVERT:
+			r[u16(pc+2)] = getVMSignExtendedValue(code[pc+1], r[u16(pc+4)])
+			pc = pc + 6
+		case ROP_LOAD:
+			t := code[pc+1]
+			addr := r[u16(pc+4)]
+			if !isVMMemoryRangeValid(addr, uint64(t&0b1111)) {
+				return VM_PANIC_MESSAGE, instrCount
+			}
+			r[u16(pc+2)] = getVMSignExtendedValue(t, binary.LittleEndian.Uint64(mem[addr:]))
+			pc = pc + 6
+		case ROP_STORE:
+			t := code[pc+1]
+			addr := r[u16(pc+2)]
+			if !isVMMemoryRangeValid(addr, uint64(t&0b1111)) {
+				return VM_PANIC_MESSAGE, instrCount
+			}
+			putVMValue(mem[addr:], r[u16(pc+4)], t)
+			pc = pc + 6
+		case ROP_STORE_STRING:
+			end := pc + 3
+			for code[end] != 0 {
+				end++
+			}
+
+			if !runVMStoreString(mem, r[u16(pc+1)], code[pc+3:end]) {
+				return VM_PANIC_MESSAGE, instrCount
+			}
+			pc = end + 1
+		case OP_ADD, OP_ADD | ROP_IMM_FLAG, OP_SUB, OP_SUB | ROP_IMM_FLAG,
+			OP_MUL, OP_MUL | ROP_IMM_FLAG:
+
+			t := code[pc+1]
+			dest := u16(pc + 3)
+			a := r[u16(pc+5)]
+
+			var b uint64
+			b, pc = getRegSecondOperand(code, r, op, pc+7)
+
+			switch op &^ ROP_IMM_FLAG {
+			case OP_ADD:
+				r[dest] = getVMSignExtendedValue(t, a+b)
+			case OP_SUB:
+				r[dest] = getVMSignExtendedValue(t, a-b)
+			case OP_MUL:
+				r[dest] = getVMSignExtendedValue(t, a*b)
+			}
+		case OP_EQL, OP_EQL | ROP_IMM_FLAG, OP_NEQ, OP_NEQ | ROP_IMM_FLAG,
+			OP_LSS, OP_LSS | ROP_IMM_FLAG, OP_GTR, OP_GTR | ROP_IMM_FLAG,
+			OP_LEQ, OP_LEQ | ROP_IMM_FLAG, OP_GEQ, OP_GEQ | ROP_IMM_FLAG:
+
+			t := code[pc+1]
+			dest := u16(pc + 3)
+			a := r[u16(pc+5)]
+
+			var b uint64
+			b, pc = getRegSecondOperand(code, r, op, pc+7)
+
+			r[dest] = 0
+			if isRegCmpTrue(op&^ROP_IMM_FLAG, t, a, b) {
+				r[dest] = 1
+			}
+		case ROP_BRANCH_EQL, ROP_BRANCH_EQL | ROP_IMM_FLAG, ROP_BRANCH_NEQ, ROP_BRANCH_NEQ | ROP_IMM_FLAG,
+			ROP_BRANCH_LSS, ROP_BRANCH_LSS | ROP_IMM_FLAG, ROP_BRANCH_GTR, ROP_BRANCH_GTR | ROP_IMM_FLAG,
+			ROP_BRANCH_LEQ, ROP_BRANCH_LEQ | ROP_IMM_FLAG, ROP_BRANCH_GEQ, ROP_BRANCH_GEQ | ROP_IMM_FLAG:
+
+			t := code[pc+1]
+			a := r[u16(pc+2)]
+
+			var b uint64
+			b, pc = getRegSecondOperand(code, r, op, pc+4)
+
+			if isRegCmpTrue((op&^ROP_IMM_FLAG)-ROP_BRANCH_EQL+OP_EQL, t, a, b) {
+				pc = u32(pc)
+			} else {
+				pc = pc + 4
+			}
+		default:
+			binaryOp := op &^ ROP_IMM_FLAG
+			if !isVMBinaryOp(binaryOp) {
+				return VM_INVALID_CODE_MESSAGE, instrCount
+			}
+
+			t1, t2 := code[pc+1], code[pc+2]
+			dest := u16(pc + 3)
+			a := r[u16(pc+5)]
+
+			var b uint64
+			b, pc = getRegSecondOperand(code, r, op, pc+7)
+
+			v, ok := runVMBinaryOp(binaryOp, t1, t2, a, b)
+			if !ok {
+				return VM_PANIC_MESSAGE, instrCount
+			}
+
+			r[dest] = v
+		}
+	}
+}
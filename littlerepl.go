@@ -0,0 +1,576 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var REPL_SOURCE_FILE_PATH = "<repl>"
+
+type REPLFunc struct {
+	Ident    string
+	LineList []string
+
+	// First line of the function in the input it was entered with, while
+	// that input is compiled
+	InputLine int
+}
+
+// A local keeps its value between inputs. Functions are kept by name, since
+// their addresses change with every program.
+type REPLLocal struct {
+	Ident      string
+	TypeString string
+	Type       interface{}
+	Value      uint64
+	FuncIdent  string
+
+	Line int
+}
+
+var replImportList []string
+var replFuncList []REPLFunc
+var replLocalList []REPLLocal
+
+// Memory is kept between inputs as well
+var replVMMemory []byte
+
+// The input line of every line of the program, or 0 for generated lines
+var replInputLineList []int
+
+func replInit() {
+	replImportList = make([]string, 0)
+	replFuncList = make([]REPLFunc, 0)
+	replLocalList = make([]REPLLocal, 0)
+	replVMMemory = nil
+}
+
+func getREPLRestoreString(local REPLLocal) string {
+	if _, ok := local.Type.(IntInfo); ok {
+		return local.Ident + " = " + local.TypeString + "(" + formatDebugValue(local.Type, local.Value) + ")"
+	}
+	if local.FuncIdent != "" {
+		return local.Ident + " = " + local.FuncIdent
+	}
+	return ""
+}
+
+// The locals are declared and restored at the start of main, followed by
+// the statements of the input
+func buildREPLProgram(importList []string, funcList []REPLFunc, localList []REPLLocal,
+	inputLineList []string) ([]byte, []REPLLocal) {
+
+	var lineList []string
+	replInputLineList = make([]int, 0)
+
+	appendLine := func(s string, inputLine int) {
+		lineList = append(lineList, s)
+		replInputLineList = append(replInputLineList, inputLine)
+	}
+
+	for _, s := range importList {
+		appendLine(s, 0)
+	}
+
+	for _, f := range funcList {
+		for i, s := range f.LineList {
+			if f.InputLine != 0 {
+				appendLine(s, f.InputLine+i)
+			} else {
+				appendLine(s, 0)
+			}
+		}
+	}
+
+	appendLine("func main()", 0)
+
+	localList = append([]REPLLocal{}, localList...)
+
+	for i := range localList {
+		localList[i].Line = len(lineList) + 1
+		appendLine("let "+localList[i].Ident+" "+localList[i].TypeString, 0)
+	}
+
+	for _, local := range localList {
+		if s := getREPLRestoreString(local); s != "" {
+			appendLine(s, 0)
+		}
+	}
+
+	for i, s := range inputLineList {
+		appendLine(s, i+1)
+	}
+
+	appendLine("end", 0)
+
+	return []byte(strings.Join(lineList, "\n") + "\n"), localList
+}
+
+func printREPLCompileError(w io.Writer, ce CompileError) {
+	if ce.SourceFilePath == REPL_SOURCE_FILE_PATH && ce.Line > 0 && ce.Line <= len(replInputLineList) &&
+		replInputLineList[ce.Line-1] != 0 {
+		fmt.Fprintln(w, "Compilation error (line "+strconv.Itoa(replInputLineList[ce.Line-1])+")")
+		return
+	}
+
+	// Errors in generated lines, like the end of an unfinished input
+	if ce.SourceFilePath == REPL_SOURCE_FILE_PATH {
+		fmt.Fprintln(w, "Compilation error")
+		return
+	}
+
+	fmt.Fprintln(w, ce.Msg)
+}
+
+// Parses the input on its own, as a file or as the body of main, so that
+// errors point at its lines
+func parseREPLInput(w io.Writer, inputLineList []string, isFuncList bool) (TreeNode, bool) {
+	lineList := inputLineList
+	if !isFuncList {
+		lineList = append(append([]string{"func main()"}, inputLineList...), "end")
+	}
+
+	replInputLineList = make([]int, len(lineList))
+	for i := range inputLineList {
+		if isFuncList {
+			replInputLineList[i] = i + 1
+		} else {
+			replInputLineList[i+1] = i + 1
+		}
+	}
+
+	var tn TreeNode
+
+	ce, ok := catchCompileError(func() {
+		curSourceFilePath = REPL_SOURCE_FILE_PATH
+		tn = SyntaxAnalyzer(LexicalAnalyzer([]byte(strings.Join(lineList, "\n") + "\n")))
+	})
+
+	curSourceFilePath = ""
+
+	if !ok {
+		printREPLCompileError(w, ce)
+	}
+
+	return tn, ok
+}
+
+func isREPLInputFuncList(inputLineList []string) bool {
+	var toks []TokenData
+
+	_, ok := catchCompileError(func() {
+		toks = LexicalAnalyzer([]byte(strings.Join(inputLineList, "\n") + "\n"))
+	})
+
+	return ok && len(toks) != 0 && (toks[0].Kype == TT_FUNC || toks[0].Kype == TT_IMPORT)
+}
+
+// An input is complete when every block is closed and the last line does not
+// continue on the next one, like one that ends with an operator
+func isREPLInputComplete(inputLineList []string) bool {
+	var toks []TokenData
+
+	_, ok := catchCompileError(func() {
+		toks = LexicalAnalyzer([]byte(strings.Join(inputLineList, "\n") + "\n"))
+	})
+
+	if !ok {
+		return true
+	}
+
+	blocksCount := 0
+	parensCount := 0
+
+	for i, tok := range toks {
+		switch tok.Kype {
+		case TT_FUNC, TT_WHILE, TT_FOR, TT_SWITCH:
+			blocksCount++
+		case TT_IF:
+			if i == 0 || toks[i-1].Kype != TT_ELSE {
+				blocksCount++
+			}
+		case TT_END:
+			blocksCount--
+		case TT_LPAREN:
+			parensCount++
+		case TT_RPAREN:
+			parensCount--
+		}
+	}
+
+	if blocksCount > 0 || parensCount > 0 {
+		return false
+	}
+
+	return len(toks) < 2 || toks[len(toks)-2].Kype == TT_NEW_LINE
+}
+
+func compileREPLProgram(w io.Writer, data []byte) (IRProgram, bool) {
+	memorySourceFileList[REPL_SOURCE_FILE_PATH] = data
+
+	ir, ce, ok := compileSourceFileOrError(REPL_SOURCE_FILE_PATH)
+	if !ok {
+		printREPLCompileError(w, ce)
+	}
+
+	return ir, ok
+}
+
+func addREPLFuncList(w io.Writer, inputLineList []string) {
+	tn, ok := parseREPLInput(w, inputLineList, true)
+	if !ok {
+		return
+	}
+
+	importList := append([]string{}, replImportList...)
+	for _, importTreeNode := range tn.Children[1].Children {
+		s := "import " + string(importTreeNode.Tok.Buf)
+
+		isFound := false
+		for _, t := range importList {
+			isFound = isFound || t == s
+		}
+
+		if !isFound {
+			importList = append(importList, s)
+		}
+	}
+
+	var newFuncList []REPLFunc
+	for _, funcTreeNode := range tn.Children[0].Children {
+		l1 := funcTreeNode.Children[0].Tok.LineNumber
+		l2 := funcTreeNode.Children[2].Tok.LineNumber
+
+		if string(funcTreeNode.Children[0].Tok.Buf) == "main" {
+			fmt.Fprintln(w, "Compilation error (line "+strconv.Itoa(l1)+")")
+			return
+		}
+
+		newFuncList = append(newFuncList, REPLFunc{Ident: string(funcTreeNode.Children[0].Tok.Buf),
+			LineList: inputLineList[l1-1 : l2], InputLine: l1})
+	}
+
+	// Functions that are entered again replace the old ones
+	var funcList []REPLFunc
+	for _, f := range replFuncList {
+		isReplaced := false
+		for _, g := range newFuncList {
+			isReplaced = isReplaced || f.Ident == g.Ident
+		}
+
+		if !isReplaced {
+			funcList = append(funcList, f)
+		}
+	}
+	funcList = append(funcList, newFuncList...)
+
+	data, _ := buildREPLProgram(importList, funcList, replLocalList, nil)
+
+	if _, ok := compileREPLProgram(w, data); !ok {
+		return
+	}
+
+	for i := range funcList {
+		funcList[i].InputLine = 0
+	}
+
+	replImportList = importList
+	replFuncList = funcList
+}
+
+// Values of the expression statements at the top of the input are stored in
+// locals named $ and their line instead of being discarded, since these
+// names cannot be used in the source
+func captureREPLValueList(ir IRProgram, lineList map[int]bool) {
+	for i := range ir.FuncList {
+		f := &ir.FuncList[i]
+		if f.Ident != "main" {
+			continue
+		}
+
+		for j := range f.BlockList {
+			for k, instr := range f.BlockList[j].InstrList {
+				if instr.Op != IR_DISCARD || !lineList[instr.Line] {
+					continue
+				}
+
+				f.LocalList = append(f.LocalList, IRLocal{Ident: "$" + strconv.Itoa(instr.Line),
+					Type: f.ValueTypeList[instr.ArgList[0]], Line: instr.Line})
+
+				f.BlockList[j].InstrList[k] = IRInstr{Op: IR_STORE_LOCAL, Dest: -1,
+					Local: len(f.LocalList) - 1, ArgList: instr.ArgList, Line: instr.Line}
+			}
+		}
+	}
+}
+
+func runREPLStmtList(w io.Writer, inputLineList []string) {
+	tn, ok := parseREPLInput(w, inputLineList, false)
+	if !ok {
+		return
+	}
+
+	stmtListTreeNode := tn.Children[0].Children[0].Children[2]
+
+	// Locals that are declared again are replaced
+	localList := make([]REPLLocal, 0)
+	for _, local := range replLocalList {
+		isReplaced := false
+		for _, c := range stmtListTreeNode.Children {
+			isReplaced = isReplaced || (c.Kype == TNT_STMT_DECL && string(c.Children[0].Tok.Buf) == local.Ident)
+		}
+
+		if !isReplaced {
+			localList = append(localList, local)
+		}
+	}
+
+	isLocalList := make(map[string]bool)
+	for _, local := range localList {
+		isLocalList[local.Ident] = true
+	}
+
+	inputLineList = append([]string{}, inputLineList...)
+
+	// A variable on its own is converted to its own type, so that the statement
+	// has a value. Function values are converted to addresses and shown by name.
+	typeStringList := make(map[int]string)
+	exprLineList := make(map[int]bool)
+
+	var newLocalList []REPLLocal
+
+	for _, c := range stmtListTreeNode.Children {
+		l := getTreeNodeLineNumber(c) - 1
+		if l < 1 {
+			continue
+		}
+
+		switch c.Kype {
+		case TNT_STMT_DECL:
+			v, _ := getTypeInfoFromTypeTreeNode(c.Children[1])
+			newLocalList = append(newLocalList, REPLLocal{Ident: string(c.Children[0].Tok.Buf),
+				TypeString: getFmtPieceListString(formatType(c.Children[1])), Type: v, Line: l})
+			isLocalList[string(c.Children[0].Tok.Buf)] = true
+
+		case TNT_STMT_EXPR:
+			exprTreeNode := c.Children[0].Children[0]
+			exprLineList[l] = true
+
+			if exprTreeNode.Kype != TNT_EXPR_INT || !isLocalList[string(exprTreeNode.Tok.Buf)] {
+				continue
+			}
+
+			var local REPLLocal
+			for _, m := range append(append([]REPLLocal{}, localList...), newLocalList...) {
+				if m.Ident == string(exprTreeNode.Tok.Buf) {
+					local = m
+				}
+			}
+
+			castString := local.TypeString
+			if _, ok := local.Type.(IntInfo); !ok {
+				castString = "u64"
+				typeStringList[l] = local.TypeString
+			}
+
+			s := inputLineList[l-1]
+			col := exprTreeNode.Tok.ColumnNumber - 1
+			inputLineList[l-1] = s[:col] + castString + "(" + local.Ident + ")" +
+				s[col+len(local.Ident):]
+		}
+	}
+
+	data, localList := buildREPLProgram(replImportList, replFuncList, localList, inputLineList)
+
+	// The input is followed by the end of main
+	inputStartLine := len(replInputLineList) - len(inputLineList)
+
+	programLineList := make(map[int]bool)
+	for l := range exprLineList {
+		programLineList[inputStartLine+l-1] = true
+	}
+
+	for i := range newLocalList {
+		newLocalList[i].Line = inputStartLine + newLocalList[i].Line - 1
+	}
+
+	ir, ok := compileREPLProgram(w, data)
+	if !ok {
+		return
+	}
+
+	captureREPLValueList(ir, programLineList)
+
+	var code []byte
+	ce, ok := catchCompileError(func() {
+		IRVerifier(ir)
+		code = BytecodeGenerator(ir)
+	})
+	if !ok {
+		printREPLCompileError(w, ce)
+		return
+	}
+
+	vm := initVMState(code, w)
+	if replVMMemory != nil {
+		vm.Mem = replVMMemory
+	}
+
+	msg := runVMState(vm, ^uint64(0))
+
+	replVMMemory = vm.Mem
+
+	if msg != "" {
+		if msg == VM_BREAK_MESSAGE {
+			msg = VM_INVALID_CODE_MESSAGE
+		}
+		fmt.Fprintln(w, msg)
+		return
+	}
+
+	mainFunc, _ := findDebugFuncByIdent("main")
+
+	// main is called with an empty stack, so its frame starts after the saved
+	// frame pointer and return address
+	fp := uint64(2 * ADDR_BYTES_COUNT)
+
+	getLocalValue := func(ident string, line int) (DebugLocal, uint64, bool) {
+		for _, local := range mainFunc.LocalList {
+			if local.Ident == ident && local.Line == line {
+				return local, getDebugValue(local.Type, vm.Stack[fp+local.Addr:]), true
+			}
+		}
+		return DebugLocal{}, 0, false
+	}
+
+	var valueLineList []int
+	for l := range programLineList {
+		valueLineList = append(valueLineList, l)
+	}
+	sort.Ints(valueLineList)
+
+	for _, l := range valueLineList {
+		local, v, ok := getLocalValue("$"+strconv.Itoa(l), l)
+		if !ok {
+			continue
+		}
+
+		typeString := getTypeStringFromTypeInfo(local.Type)
+		if s, ok := typeStringList[replInputLineList[l-1]]; ok {
+			typeString = s
+			local.Type = FuncInfo{}
+		}
+
+		fmt.Fprintln(w, formatDebugValue(local.Type, v)+" "+typeString)
+	}
+
+	replLocalList = make([]REPLLocal, 0)
+	for _, local := range append(localList, newLocalList...) {
+		_, v, ok := getLocalValue(local.Ident, local.Line)
+		if !ok {
+			continue
+		}
+
+		local.Value = v
+		local.FuncIdent = ""
+
+		if _, ok := local.Type.(IntInfo); !ok {
+			if df, ok := findDebugFuncByAddr(v); ok {
+				local.FuncIdent = df.Ident
+			}
+		}
+
+		replLocalList = append(replLocalList, local)
+	}
+}
+
+var REPL_HELP_TEXT = `:locals   print the variables
+:funcs    print the functions
+:reset    forget the variables, the functions and the memory
+:quit     exit the REPL
+
+Every input runs as the body of main, after the variables so far are
+declared and restored, and the value of each expression statement is
+printed with its type. Inputs that start with func or import define
+functions and import modules.`
+
+// Reads statements and function definitions from r. Every input is compiled
+// into a program with the definitions so far, which runs on the stack VM.
+func REPL(r io.Reader, w io.Writer) {
+	replInit()
+
+	// The frame of main has to hold the variables of the session
+	isInlinerEnabled = false
+	isTailCallEliminatorEnabled = false
+
+	scanner := bufio.NewScanner(r)
+
+	var inputLineList []string
+
+	for {
+		if len(inputLineList) == 0 {
+			fmt.Fprint(w, ">>> ")
+		} else {
+			fmt.Fprint(w, "... ")
+		}
+
+		if !scanner.Scan() {
+			fmt.Fprintln(w)
+			return
+		}
+
+		line := scanner.Text()
+
+		if len(inputLineList) == 0 {
+			switch strings.TrimSpace(line) {
+			case "":
+				continue
+			case ":quit", ":q":
+				return
+			case ":help":
+				fmt.Fprintln(w, REPL_HELP_TEXT)
+				continue
+			case ":reset":
+				replInit()
+				continue
+			case ":locals":
+				for _, local := range replLocalList {
+					v := formatDebugValue(local.Type, local.Value)
+					if _, ok := local.Type.(IntInfo); !ok {
+						v = local.FuncIdent
+						if v == "" {
+							v = "0"
+						}
+					}
+					fmt.Fprintln(w, "let "+local.Ident+" "+local.TypeString+" = "+v)
+				}
+				continue
+			case ":funcs":
+				for _, f := range replFuncList {
+					fmt.Fprintln(w, strings.TrimSpace(f.LineList[0]))
+				}
+				continue
+			}
+		}
+
+		// An empty line ends an input that is still open
+		if strings.TrimSpace(line) != "" {
+			inputLineList = append(inputLineList, line)
+			if !isREPLInputComplete(inputLineList) {
+				continue
+			}
+		}
+
+		if isREPLInputFuncList(inputLineList) {
+			addREPLFuncList(w, inputLineList)
+		} else {
+			runREPLStmtList(w, inputLineList)
+		}
+
+		inputLineList = nil
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestREPLKeepsStateBetweenInputs(t *testing.T) {
+	defer func(isInliner bool, isTailCallEliminator bool) {
+		isInlinerEnabled = isInliner
+		isTailCallEliminatorEnabled = isTailCallEliminator
+	}(isInlinerEnabled, isTailCallEliminatorEnabled)
+
+	input := `u8(255) + u8(1)
+let a u8
+a = u8(200)
+func inc(x u8) u8
+    return x + u8(1)
+end
+inc(a)
+su8(u64(16), a)
+lu8(u64(16))
+let z i8
+i8(1) / z
+a
+func inc(x u8) u8
+    return x + u8(2)
+end
+inc(a)
+:locals
+:funcs
+:reset
+:locals
+`
+
+	outputLineList := []string{
+		">>> 0 u8",
+		">>> >>> >>> ... ... >>> 201 u8",
+		">>> >>> 200 u8",
+		">>> >>> PANIC",
+		">>> 200 u8",
+		">>> ... ... >>> 202 u8",
+		">>> let a u8 = 200",
+		"let z i8 = 0",
+		">>> func inc(x u8) u8",
+		">>> >>> >>> ",
+	}
+
+	var w bytes.Buffer
+
+	REPL(strings.NewReader(input), &w)
+
+	if w.String() != strings.Join(outputLineList, "\n")+"\n" {
+		t.Errorf("got\n%s\nwant\n%s", w.String(), strings.Join(outputLineList, "\n"))
+	}
+}
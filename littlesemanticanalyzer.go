@@ -0,0 +1,740 @@
+package main
+
+import "strings"
+
+type SymbolKind int
+
+const (
+	SYM_NONE SymbolKind = iota
+
+	SYM_LOCAL
+	SYM_FUNC
+	SYM_BUILTIN
+	SYM_CAST
+	SYM_LOOP
+)
+
+// Locals are numbered in the order of their declarations in a function,
+// starting with the parameters, and loops by how deeply they are nested
+type SymbolInfo struct {
+	Kind  SymbolKind
+	Ident string
+	Info  interface{}
+	Index int
+}
+
+type SemStorageInfo struct {
+	Symbol     SymbolInfo
+	BlockLevel int
+}
+
+var STARTING_BLOCK_LEVEL int = 1
+
+var semBlockLevel int
+var semReturnValueInfo interface{}
+
+var semStorageList []SemStorageInfo
+var semLocalsCount int
+
+var semLoopLabelList []string
+var semStmtLabel string
+
+var funcListInfo map[string]FuncSigInfo
+
+func semFuncReset() {
+	semBlockLevel = STARTING_BLOCK_LEVEL
+	semReturnValueInfo = VoidInfo{BytesCount: 0}
+	semStorageList = make([]SemStorageInfo, 0)
+	semLocalsCount = 0
+	semLoopLabelList = make([]string, 0)
+	semStmtLabel = ""
+}
+
+func semStorageFind(ident string) (SemStorageInfo, bool) {
+	for i := len(semStorageList) - 1; i >= 0; i-- {
+		if semStorageList[i].Symbol.Ident == ident {
+			return semStorageList[i], true
+		}
+	}
+
+	return SemStorageInfo{}, false
+}
+
+func semStoragePush(ident string, i interface{}) SymbolInfo {
+	si := SymbolInfo{Kind: SYM_LOCAL, Ident: ident, Info: i, Index: semLocalsCount}
+	semLocalsCount++
+
+	semStorageList = append(semStorageList, SemStorageInfo{Symbol: si, BlockLevel: semBlockLevel})
+
+	return si
+}
+
+func semStoragePopBlock() {
+	for len(semStorageList) != 0 && semStorageList[len(semStorageList)-1].BlockLevel > semBlockLevel {
+		semStorageList = semStorageList[:len(semStorageList)-1]
+	}
+}
+
+func semLoopPush() {
+	semLoopLabelList = append(semLoopLabelList, semStmtLabel)
+	semStmtLabel = ""
+}
+
+func semLoopPop() {
+	semLoopLabelList = semLoopLabelList[:len(semLoopLabelList)-1]
+}
+
+func semLoopFindIndex(tn TreeNode) int {
+	if len(tn.Children) == 0 {
+		if len(semLoopLabelList) == 0 {
+			PrintErrorAndExit(tn.Tok.LineNumber)
+		}
+
+		return len(semLoopLabelList) - 1
+	}
+
+	stmtLabelIdentTreeNode := tn.Children[0]
+
+	for i := len(semLoopLabelList) - 1; i >= 0; i-- {
+		if semLoopLabelList[i] == string(stmtLabelIdentTreeNode.Tok.Buf) {
+			return i
+		}
+	}
+
+	PrintErrorAndExit(stmtLabelIdentTreeNode.Tok.LineNumber)
+	return 0
+}
+
+// A variable used as an expression is the address of its value until it is
+// loaded
+func getSymbolAddressInfo(si SymbolInfo) interface{} {
+	switch v := si.Info.(type) {
+	case IntInfo:
+		return IntAddressInfo{RealSize: v.BytesCount, IsSigned: v.IsSigned, BytesCount: ADDR_BYTES_COUNT}
+	case FuncInfo:
+		return FuncAddressInfo{Sig: v.Sig, BytesCount: ADDR_BYTES_COUNT}
+	default:
+		return nil
+	}
+}
+
+func getLoadedTypeInfo(i interface{}) interface{} {
+	switch i.(type) {
+	case IntAddressInfo, FuncAddressInfo:
+		vi, _ := getValueTypeInfo(i)
+		return vi
+	default:
+		return i
+	}
+}
+
+func checkBranchTypeInfo(l int, i interface{}) {
+	switch i.(type) {
+	case IntInfo, IntAddressInfo:
+	default:
+		PrintErrorAndExit(l)
+	}
+}
+
+func funcListInfoInit(tn TreeNode) {
+	funcListInfo = make(map[string]FuncSigInfo)
+
+	for _, funcTreeNode := range tn.Children {
+
+		funcSigTreeNode := funcTreeNode.Children[1]
+		var newFuncSigInfo FuncSigInfo
+
+		newFuncSigInfo.ParamList = make([]interface{}, 0)
+
+		for _, c := range funcSigTreeNode.Children {
+
+			if c.Kype == TNT_FUNC_PARAM_LIST {
+
+				funcParamListTreeNode := c
+
+				for _, funcParmTreeNode := range funcParamListTreeNode.Children {
+
+					funcParamTypeTreeNode := funcParmTreeNode.Children[1]
+
+					i, ok := getTypeInfoFromTypeTreeNode(funcParamTypeTreeNode)
+					if !ok {
+						PrintErrorAndExit(funcParamTypeTreeNode.Tok.LineNumber)
+					}
+
+					newFuncSigInfo.ParamList = append(newFuncSigInfo.ParamList, i)
+
+				}
+
+			} else if c.Kype == TNT_FUNC_RETURN_TYPE {
+
+				funcReturnTypeTreeNode := c
+				i, ok := getTypeInfoFromTypeTreeNode(funcReturnTypeTreeNode)
+				if !ok {
+					PrintErrorAndExit(funcReturnTypeTreeNode.Tok.LineNumber)
+				}
+				newFuncSigInfo.ReturnValueInfo = i
+
+			}
+
+		}
+
+		funcIdentTreeNode := funcTreeNode.Children[0]
+		funcIdent := string(funcIdentTreeNode.Tok.Buf)
+
+		if _, doesAlreadyExists := funcListInfo[funcIdent]; doesAlreadyExists {
+			PrintErrorAndExit(funcIdentTreeNode.Tok.LineNumber)
+		}
+
+		if _, isBuiltin := getBuiltinFuncInfo(
+			funcIdent[strings.LastIndexByte(funcIdent, 0x2e)+1:]); isBuiltin {
+			PrintErrorAndExit(funcIdentTreeNode.Tok.LineNumber)
+		}
+
+		if newFuncSigInfo.ReturnValueInfo == nil {
+			newFuncSigInfo.ReturnValueInfo = VoidInfo{BytesCount: 0}
+		}
+
+		funcListInfo[funcIdent] = newFuncSigInfo
+	}
+}
+
+func analyzeFuncList(tn *TreeNode) {
+	analyzeTreeNodeChildren(tn.Children)
+}
+
+func analyzeImportList(tn *TreeNode) {
+}
+
+func analyzeFunc(tn *TreeNode) {
+	curSourceFilePath = tn.Children[0].Tok.SourceFilePath
+	semFuncReset()
+
+	analyzeTreeNodeChildren(tn.Children)
+}
+
+func analyzeFuncIdent(tn *TreeNode) {
+	ident := string(tn.Tok.Buf)
+
+	tn.Symbol = SymbolInfo{Kind: SYM_FUNC, Ident: ident,
+		Info: FuncInfo{Sig: funcListInfo[ident], IsUntyped: false, BytesCount: ADDR_BYTES_COUNT}}
+}
+
+func analyzeFuncSig(tn *TreeNode) {
+	analyzeTreeNodeChildren(tn.Children)
+}
+
+func analyzeFuncParamList(tn *TreeNode) {
+	analyzeTreeNodeChildren(tn.Children)
+}
+
+func analyzeFuncParam(tn *TreeNode) {
+	funcParamIdentTreeNode := tn.Children[0]
+	funcParamTypeTreeNode := tn.Children[1]
+
+	switch v, _ := getTypeInfoFromTypeTreeNode(funcParamTypeTreeNode); v := v.(type) {
+	case IntInfo, FuncInfo:
+		tn.Symbol = semStoragePush(string(funcParamIdentTreeNode.Tok.Buf), v)
+	default:
+		PrintErrorAndExit(funcParamTypeTreeNode.Tok.LineNumber)
+	}
+}
+
+func analyzeFuncReturnType(tn *TreeNode) {
+	if i, ok := getTypeInfoFromTypeTreeNode(*tn); ok {
+		semReturnValueInfo = i
+		tn.Info = i
+	} else {
+		PrintErrorAndExit(tn.Tok.LineNumber)
+	}
+}
+
+func analyzeStmtList(tn *TreeNode) {
+	semBlockLevel++
+
+	analyzeTreeNodeChildren(tn.Children)
+
+	semBlockLevel--
+
+	semStoragePopBlock()
+}
+
+func analyzeStmtDecl(tn *TreeNode) {
+	stmtDeclIdentTreeNode := tn.Children[0]
+	stmtDeclTypeTreeNode := tn.Children[1]
+
+	if si, ok := semStorageFind(string(stmtDeclIdentTreeNode.Tok.Buf)); ok {
+		if (si.BlockLevel == semBlockLevel) ||
+			((si.BlockLevel == STARTING_BLOCK_LEVEL) && (semBlockLevel == STARTING_BLOCK_LEVEL+1)) {
+			PrintErrorAndExit(stmtDeclIdentTreeNode.Tok.LineNumber)
+		}
+	}
+
+	switch v, _ := getTypeInfoFromTypeTreeNode(stmtDeclTypeTreeNode); v := v.(type) {
+	case IntInfo, FuncInfo:
+		tn.Symbol = semStoragePush(string(stmtDeclIdentTreeNode.Tok.Buf), v)
+	default:
+		PrintErrorAndExit(stmtDeclTypeTreeNode.Tok.LineNumber)
+	}
+}
+
+func analyzeStmtExpr(tn *TreeNode) {
+	analyzeTreeNodeChildren(tn.Children)
+}
+
+func analyzeStmtAssign(tn *TreeNode) {
+	analyzeTreeNodeChildren(tn.Children)
+
+	vi2, ok := getValueTypeInfo(tn.Children[1].Info)
+	if !ok {
+		PrintErrorAndExit(tn.Tok.LineNumber)
+	}
+
+	switch v := tn.Children[0].Info.(type) {
+	case IntAddressInfo:
+		if !isSameTypeInfo(IntInfo{IsSigned: v.IsSigned, BytesCount: v.RealSize}, vi2) {
+			PrintErrorAndExit(tn.Tok.LineNumber)
+		}
+	case FuncAddressInfo:
+		if !isSameTypeInfo(FuncInfo{Sig: v.Sig, IsUntyped: false, BytesCount: ADDR_BYTES_COUNT}, vi2) {
+			PrintErrorAndExit(tn.Tok.LineNumber)
+		}
+	default:
+		PrintErrorAndExit(tn.Tok.LineNumber)
+	}
+}
+
+func analyzeStmtStoreString(tn *TreeNode) {
+	analyzeTreeNode(&tn.Children[0])
+
+	stmtStringTreeNode := tn.Children[1]
+
+	if ok, _ := unescapeStmtString(stmtStringTreeNode.Tok.Buf); !ok {
+		PrintErrorAndExit(stmtStringTreeNode.Tok.LineNumber)
+	}
+
+	if iai, ok := tn.Children[0].Info.(IntAddressInfo); !ok || (iai.RealSize != 8) || iai.IsSigned {
+		PrintErrorAndExit(tn.Tok.LineNumber)
+	}
+}
+
+func analyzeStmtWhile(tn *TreeNode) {
+	analyzeTreeNode(&tn.Children[0])
+
+	checkBranchTypeInfo(tn.Tok.LineNumber, tn.Children[0].Info)
+
+	semLoopPush()
+
+	analyzeTreeNode(&tn.Children[1])
+
+	semLoopPop()
+}
+
+// The start, end and step values are checked as if they were assigned to
+// the variable of the loop. A constant step of zero would never end the
+// loop.
+func analyzeStmtFor(tn *TreeNode) {
+	stmtForIdentTreeNode := &tn.Children[0]
+
+	l := tn.Tok.LineNumber
+
+	si, ok := semStorageFind(string(stmtForIdentTreeNode.Tok.Buf))
+	if !ok {
+		PrintErrorAndExit(stmtForIdentTreeNode.Tok.LineNumber)
+	}
+
+	ii, ok := si.Symbol.Info.(IntInfo)
+	if !ok {
+		PrintErrorAndExit(stmtForIdentTreeNode.Tok.LineNumber)
+	}
+
+	stmtForIdentTreeNode.Symbol = si.Symbol
+
+	analyzeTreeNode(&tn.Children[1])
+
+	if vi, ok := getValueTypeInfo(tn.Children[1].Info); !ok || !isSameTypeInfo(ii, vi) {
+		PrintErrorAndExit(l)
+	}
+
+	for i := 2; i < len(tn.Children)-1; i++ {
+		analyzeTreeNode(&tn.Children[i])
+
+		if !isSameTypeInfo(ii, getLoadedTypeInfo(tn.Children[i].Info)) {
+			PrintErrorAndExit(l)
+		}
+	}
+
+	if len(tn.Children) == 5 {
+		if _, v, ok := getConstExprValue(tn.Children[3]); ok && v == 0 {
+			PrintErrorAndExit(l)
+		}
+	}
+
+	semLoopPush()
+
+	analyzeTreeNode(&tn.Children[len(tn.Children)-1])
+
+	semLoopPop()
+}
+
+// The bodies of the cases are analyzed after all the values, with the
+// default last
+func analyzeStmtSwitch(tn *TreeNode) {
+	l := tn.Tok.LineNumber
+
+	analyzeTreeNode(&tn.Children[0])
+
+	ii, ok := getLoadedTypeInfo(tn.Children[0].Info).(IntInfo)
+	if !ok {
+		PrintErrorAndExit(l)
+	}
+
+	var caseValueList []uint64
+
+	for _, c := range tn.Children[1:] {
+		if c.Kype == TNT_STMT_DEFAULT {
+			continue
+		}
+
+		for _, exprTreeNode := range c.Children[0].Children {
+			vii, v, ok := getConstExprValue(exprTreeNode)
+			if !ok || !isSameTypeInfo(ii, vii) {
+				PrintErrorAndExit(c.Tok.LineNumber)
+			}
+
+			for _, prevValue := range caseValueList {
+				if prevValue == v {
+					PrintErrorAndExit(c.Tok.LineNumber)
+				}
+			}
+
+			caseValueList = append(caseValueList, v)
+		}
+	}
+
+	if len(caseValueList) == 0 {
+		PrintErrorAndExit(l)
+	}
+
+	stmtDefaultIndex := -1
+
+	for i := 1; i < len(tn.Children); i++ {
+		if tn.Children[i].Kype == TNT_STMT_DEFAULT {
+			stmtDefaultIndex = i
+			continue
+		}
+
+		analyzeTreeNode(&tn.Children[i].Children[1])
+	}
+
+	if stmtDefaultIndex != -1 {
+		analyzeTreeNode(&tn.Children[stmtDefaultIndex].Children[0])
+	}
+}
+
+func analyzeStmtLabel(tn *TreeNode) {
+	semStmtLabel = string(tn.Tok.Buf)
+
+	for _, label := range semLoopLabelList {
+		if label == semStmtLabel {
+			PrintErrorAndExit(tn.Tok.LineNumber)
+		}
+	}
+
+	analyzeTreeNodeChildren(tn.Children)
+}
+
+func analyzeStmtIf(tn *TreeNode) {
+	analyzeTreeNode(&tn.Children[0])
+
+	checkBranchTypeInfo(tn.Tok.LineNumber, tn.Children[0].Info)
+
+	analyzeTreeNodeChildren(tn.Children[1:])
+}
+
+func analyzeStmtElse(tn *TreeNode) {
+	analyzeTreeNodeChildren(tn.Children)
+}
+
+func analyzeStmtReturn(tn *TreeNode) {
+	if len(tn.Children) == 0 {
+		switch semReturnValueInfo.(type) {
+		case IntInfo, FuncInfo, VoidInfo:
+		default:
+			PrintErrorAndExit(0)
+		}
+		return
+	}
+
+	analyzeTreeNodeChildren(tn.Children)
+
+	switch semReturnValueInfo.(type) {
+	case IntInfo, FuncInfo:
+		if vi, ok := getValueTypeInfo(tn.Children[0].Info); !ok || !isSameTypeInfo(semReturnValueInfo, vi) {
+			PrintErrorAndExit(tn.Tok.LineNumber)
+		}
+	case VoidInfo:
+		PrintErrorAndExit(tn.Tok.LineNumber)
+	default:
+		PrintErrorAndExit(0)
+	}
+}
+
+func analyzeStmtBreak(tn *TreeNode) {
+	i := semLoopFindIndex(*tn)
+	tn.Symbol = SymbolInfo{Kind: SYM_LOOP, Ident: semLoopLabelList[i], Index: i}
+}
+
+func analyzeStmtContinue(tn *TreeNode) {
+	i := semLoopFindIndex(*tn)
+	tn.Symbol = SymbolInfo{Kind: SYM_LOOP, Ident: semLoopLabelList[i], Index: i}
+}
+
+func analyzeExpr(tn *TreeNode) {
+	analyzeTreeNodeChildren(tn.Children)
+
+	tn.Info = tn.Children[0].Info
+}
+
+func analyzeExprInt(tn *TreeNode) {
+	ident := string(tn.Tok.Buf)
+
+	if si, ok := semStorageFind(ident); ok {
+		tn.Symbol = si.Symbol
+		tn.Info = getSymbolAddressInfo(si.Symbol)
+	} else if fsi, ok := funcListInfo[ident]; ok {
+		fi := FuncInfo{Sig: fsi, IsUntyped: false, BytesCount: ADDR_BYTES_COUNT}
+
+		tn.Symbol = SymbolInfo{Kind: SYM_FUNC, Ident: ident, Info: fi}
+		tn.Info = fi
+	} else {
+		PrintErrorAndExit(tn.Tok.LineNumber)
+	}
+}
+
+// Casts of a literal are checked for its range, casts of an expression
+// accept integers and, for u64, function values
+func analyzeExprCast(tn *TreeNode, ii IntInfo) {
+	exprFuncParmListTreeNode := &tn.Children[0]
+
+	if len(exprFuncParmListTreeNode.Children) != 1 {
+		PrintErrorAndExit(tn.Tok.LineNumber)
+	}
+
+	exprFuncParmTreeNode := &exprFuncParmListTreeNode.Children[0]
+
+	switch exprFuncParmTreeNode.Children[0].Kype {
+	case TNT_EXPR_CHAR, TNT_EXPR_INT_LIT, TNT_EXPR_NEG_INT_LIT:
+		getIntLitValue(ii, exprFuncParmTreeNode.Children[0])
+	case TNT_EXPR:
+		analyzeTreeNode(&exprFuncParmTreeNode.Children[0])
+
+		switch exprFuncParmTreeNode.Children[0].Info.(type) {
+		case IntInfo, IntAddressInfo:
+		case FuncInfo, FuncAddressInfo:
+			if (ii.BytesCount != ADDR_BYTES_COUNT) || ii.IsSigned {
+				PrintErrorAndExit(tn.Tok.LineNumber)
+			}
+		default:
+			PrintErrorAndExit(tn.Tok.LineNumber)
+		}
+	default:
+		PrintErrorAndExit(0)
+	}
+}
+
+func analyzeExprFuncParmListCheck(tn *TreeNode, fsi FuncSigInfo) {
+	analyzeTreeNodeChildren(tn.Children)
+
+	exprFuncParmListTreeNode := tn.Children[0]
+
+	if len(exprFuncParmListTreeNode.Children) != len(fsi.ParamList) {
+		PrintErrorAndExit(tn.Tok.LineNumber)
+	}
+
+	for i, sigParam := range fsi.ParamList {
+		if !isSameTypeInfo(sigParam, exprFuncParmListTreeNode.Children[i].Info) {
+			PrintErrorAndExit(tn.Tok.LineNumber)
+		}
+	}
+}
+
+func analyzeExprFunc(tn *TreeNode) {
+	ident := string(tn.Tok.Buf)
+
+	if ii, ok := getIntInfoFromTypeString(ident); ok {
+		analyzeExprCast(tn, ii)
+
+		tn.Symbol = SymbolInfo{Kind: SYM_CAST, Ident: ident, Info: ii}
+		tn.Info = ii
+	} else if fsi, ok := getBuiltinFuncInfo(ident); ok {
+		analyzeExprFuncParmListCheck(tn, fsi)
+
+		tn.Symbol = SymbolInfo{Kind: SYM_BUILTIN, Ident: ident,
+			Info: FuncInfo{Sig: fsi, IsUntyped: false, BytesCount: ADDR_BYTES_COUNT}}
+		tn.Info = fsi.ReturnValueInfo
+	} else if si, ok := semStorageFind(ident); ok {
+		fi, ok := si.Symbol.Info.(FuncInfo)
+		if !ok {
+			PrintErrorAndExit(tn.Tok.LineNumber)
+		}
+
+		analyzeExprFuncParmListCheck(tn, fi.Sig)
+
+		tn.Symbol = si.Symbol
+		tn.Info = fi.Sig.ReturnValueInfo
+	} else if fsi, ok := funcListInfo[ident]; ok {
+		analyzeExprFuncParmListCheck(tn, fsi)
+
+		tn.Symbol = SymbolInfo{Kind: SYM_FUNC, Ident: ident,
+			Info: FuncInfo{Sig: fsi, IsUntyped: false, BytesCount: ADDR_BYTES_COUNT}}
+		tn.Info = fsi.ReturnValueInfo
+	} else {
+		PrintErrorAndExit(tn.Tok.LineNumber)
+	}
+}
+
+func analyzeExprFuncParmList(tn *TreeNode) {
+	analyzeTreeNodeChildren(tn.Children)
+}
+
+func analyzeExprFuncParm(tn *TreeNode) {
+	analyzeTreeNodeChildren(tn.Children)
+
+	tn.Info = getLoadedTypeInfo(tn.Children[0].Info)
+}
+
+func analyzeExprBinary(tn *TreeNode) {
+	if tn.Tok.Kype == TT_LAND || tn.Tok.Kype == TT_LOR {
+		for i := range tn.Children {
+			analyzeTreeNode(&tn.Children[i])
+			checkBranchTypeInfo(tn.Tok.LineNumber, tn.Children[i].Info)
+		}
+
+		tn.Info = IntInfo{IsSigned: false, BytesCount: 1}
+		return
+	}
+
+	analyzeTreeNodeChildren(tn.Children)
+
+	v1 := getLoadedTypeInfo(tn.Children[0].Info)
+	v2 := getLoadedTypeInfo(tn.Children[1].Info)
+
+	if _, ok := IRBinaryOpNames[tn.Tok.Kype]; !ok {
+		PrintErrorAndExit(0)
+	}
+
+	isComparison := map[TokenType]bool{
+		TT_EQL: true, TT_NEQ: true,
+		TT_LSS: true, TT_GTR: true,
+		TT_LEQ: true, TT_GEQ: true}[tn.Tok.Kype]
+
+	switch v := v1.(type) {
+	case FuncInfo:
+		if (tn.Tok.Kype != TT_EQL && tn.Tok.Kype != TT_NEQ) || !isSameTypeInfo(v, v2) {
+			PrintErrorAndExit(tn.Tok.LineNumber)
+		}
+		tn.Info = IntInfo{IsSigned: false, BytesCount: 1}
+	case IntInfo:
+		ii2, ok := v2.(IntInfo)
+		if !ok || ((v != ii2) && (tn.Tok.Kype != TT_SHL) && (tn.Tok.Kype != TT_SHR)) {
+			PrintErrorAndExit(tn.Tok.LineNumber)
+		}
+		tn.Info = v
+		if isComparison {
+			tn.Info = IntInfo{IsSigned: false, BytesCount: 1}
+		}
+	default:
+		PrintErrorAndExit(tn.Tok.LineNumber)
+	}
+}
+
+func analyzeTreeNode(tn *TreeNode) {
+	map[TreeNodeType]func(*TreeNode){
+		// TNT_ROOT
+
+		TNT_IMPORT_LIST: analyzeImportList,
+
+		TNT_FUNC_LIST: analyzeFuncList,
+		TNT_FUNC:      analyzeFunc,
+
+		TNT_FUNC_IDENT:      analyzeFuncIdent,
+		TNT_FUNC_SIG:        analyzeFuncSig,
+		TNT_FUNC_PARAM_LIST: analyzeFuncParamList,
+		TNT_FUNC_PARAM:      analyzeFuncParam,
+		// TNT_FUNC_PARAM_IDENT
+		// TNT_FUNC_PARAM_TYPE
+		TNT_FUNC_RETURN_TYPE: analyzeFuncReturnType,
+
+		TNT_STMT_LIST: analyzeStmtList,
+
+		TNT_STMT_DECL: analyzeStmtDecl,
+		// TNT_STMT_DECL_IDENT
+		// TNT_STMT_DECL_TYPE
+
+		TNT_STMT_EXPR:         analyzeStmtExpr,
+		TNT_STMT_ASSIGN:       analyzeStmtAssign,
+		TNT_STMT_STORE_STRING: analyzeStmtStoreString,
+		// TNT_STMT_STRING
+
+		TNT_STMT_WHILE: analyzeStmtWhile,
+		TNT_STMT_IF:    analyzeStmtIf,
+		TNT_STMT_ELSE:  analyzeStmtElse,
+
+		TNT_STMT_FOR: analyzeStmtFor,
+		// TNT_STMT_FOR_IDENT
+		TNT_STMT_LABEL: analyzeStmtLabel,
+		// TNT_STMT_LABEL_IDENT
+
+		TNT_STMT_SWITCH: analyzeStmtSwitch,
+		// TNT_STMT_CASE
+		// TNT_STMT_CASE_VALUE_LIST
+		// TNT_STMT_DEFAULT
+
+		TNT_STMT_RETURN:   analyzeStmtReturn,
+		TNT_STMT_BREAK:    analyzeStmtBreak,
+		TNT_STMT_CONTINUE: analyzeStmtContinue,
+
+		TNT_EXPR:                analyzeExpr,
+		TNT_EXPR_INT:            analyzeExprInt,
+		TNT_EXPR_FUNC:           analyzeExprFunc,
+		TNT_EXPR_FUNC_PARM_LIST: analyzeExprFuncParmList,
+		TNT_EXPR_FUNC_PARM:      analyzeExprFuncParm,
+		// TNT_EXPR_INT_LIT
+		// TNT_EXPR_NEG_INT_LIT
+		// TNT_EXPR_CHAR
+		TNT_EXPR_BINARY: analyzeExprBinary,
+	}[tn.Kype](tn)
+}
+
+func analyzeTreeNodeChildren(treeNodeChildren []TreeNode) {
+	for i := range treeNodeChildren {
+		analyzeTreeNode(&treeNodeChildren[i])
+	}
+}
+
+// Resolves every name and types every expression of the program, reporting
+// errors in the order of the source. The IR generator relies on the Info and
+// Symbol of the nodes and on funcListInfo, which also holds the signatures
+// of the extern functions.
+func SemanticAnalyzer(tn TreeNode, externFuncListTreeNode TreeNode) TreeNode {
+	funcListTreeNode := tn.Children[0]
+
+	var allFuncListTreeNode TreeNode
+	allFuncListTreeNode.Kype = TNT_FUNC_LIST
+	allFuncListTreeNode.Children = append(allFuncListTreeNode.Children,
+		funcListTreeNode.Children...)
+	allFuncListTreeNode.Children = append(allFuncListTreeNode.Children,
+		externFuncListTreeNode.Children...)
+
+	funcListInfoInit(allFuncListTreeNode)
+
+	funcListInfo["ecall"] = FuncSigInfo{
+		ParamList:       make([]interface{}, 0),
+		ReturnValueInfo: VoidInfo{BytesCount: 0}}
+
+	analyzeTreeNodeChildren(tn.Children)
+
+	curSourceFilePath = ""
+
+	return tn
+}
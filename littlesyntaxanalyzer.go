@@ -1,7 +1,5 @@
 package main
 
-import "fmt"
-
 type TreeNodeType int
 
 const (
@@ -9,6 +7,9 @@ const (
 
 	TNT_ROOT
 
+	TNT_IMPORT_LIST
+	TNT_IMPORT
+
 	TNT_FUNC_LIST
 	TNT_FUNC
 
@@ -20,6 +21,11 @@ const (
 	TNT_FUNC_PARAM_TYPE
 	TNT_FUNC_RETURN_TYPE
 
+	TNT_FUNC_TYPE_SIG
+	TNT_FUNC_TYPE_PARAM_LIST
+	TNT_FUNC_TYPE_PARAM
+	TNT_FUNC_TYPE_RETURN_TYPE
+
 	TNT_STMT_LIST
 
 	TNT_STMT_DECL
@@ -35,6 +41,16 @@ const (
 	TNT_STMT_IF
 	TNT_STMT_ELSE
 
+	TNT_STMT_FOR
+	TNT_STMT_FOR_IDENT
+	TNT_STMT_LABEL
+	TNT_STMT_LABEL_IDENT
+
+	TNT_STMT_SWITCH
+	TNT_STMT_CASE
+	TNT_STMT_CASE_VALUE_LIST
+	TNT_STMT_DEFAULT
+
 	TNT_STMT_RETURN
 	TNT_STMT_BREAK
 	TNT_STMT_CONTINUE
@@ -51,46 +67,64 @@ const (
 )
 
 var TreeNodeTypeNames = map[TreeNodeType]string{
-	TNT_ILLEGAL:             "ILLEGAL",
-	TNT_ROOT:                "ROOT",
-	TNT_FUNC_LIST:           "FUNC_LIST",
-	TNT_FUNC:                "FUNC",
-	TNT_FUNC_IDENT:          "FUNC_IDENT",
-	TNT_FUNC_SIG:            "FUNC_SIG",
-	TNT_FUNC_PARAM_LIST:     "FUNC_PARAM_LIST",
-	TNT_FUNC_PARAM:          "FUNC_PARAM",
-	TNT_FUNC_PARAM_IDENT:    "FUNC_PARAM_IDENT",
-	TNT_FUNC_PARAM_TYPE:     "FUNC_PARAM_TYPE",
-	TNT_FUNC_RETURN_TYPE:    "FUNC_RETURN_TYPE",
-	TNT_STMT_LIST:           "STMT_LIST",
-	TNT_STMT_DECL:           "STMT_DECL",
-	TNT_STMT_DECL_IDENT:     "STMT_DECL_IDENT",
-	TNT_STMT_DECL_TYPE:      "STMT_DECL_TYPE",
-	TNT_STMT_EXPR:           "STMT_EXPR",
-	TNT_STMT_ASSIGN:         "STMT_ASSIGN",
-	TNT_STMT_STORE_STRING:   "STMT_STORE_STRING",
-	TNT_STMT_STRING:         "STMT_STRING",
-	TNT_STMT_WHILE:          "STMT_WHILE",
-	TNT_STMT_IF:             "STMT_IF",
-	TNT_STMT_ELSE:           "STMT_ELSE",
-	TNT_STMT_RETURN:         "STMT_RETURN",
-	TNT_STMT_BREAK:          "STMT_BREAK",
-	TNT_STMT_CONTINUE:       "STMT_CONTINUE",
-	TNT_EXPR:                "EXPR",
-	TNT_EXPR_INT:            "EXPR_INT",
-	TNT_EXPR_FUNC:           "EXPR_FUNC",
-	TNT_EXPR_FUNC_PARM_LIST: "EXPR_FUNC_PARM_LIST",
-	TNT_EXPR_FUNC_PARM:      "EXPR_FUNC_PARM",
-	TNT_EXPR_INT_LIT:        "EXPR_INT_LIT",
-	TNT_EXPR_NEG_INT_LIT:    "EXPR_NEG_INT_LIT",
-	TNT_EXPR_CHAR:           "EXPR_CHAR",
-	TNT_EXPR_BINARY:         "EXPR_BINARY",
+	TNT_ILLEGAL:               "ILLEGAL",
+	TNT_ROOT:                  "ROOT",
+	TNT_IMPORT_LIST:           "IMPORT_LIST",
+	TNT_IMPORT:                "IMPORT",
+	TNT_FUNC_LIST:             "FUNC_LIST",
+	TNT_FUNC:                  "FUNC",
+	TNT_FUNC_IDENT:            "FUNC_IDENT",
+	TNT_FUNC_SIG:              "FUNC_SIG",
+	TNT_FUNC_PARAM_LIST:       "FUNC_PARAM_LIST",
+	TNT_FUNC_PARAM:            "FUNC_PARAM",
+	TNT_FUNC_PARAM_IDENT:      "FUNC_PARAM_IDENT",
+	TNT_FUNC_PARAM_TYPE:       "FUNC_PARAM_TYPE",
+	TNT_FUNC_RETURN_TYPE:      "FUNC_RETURN_TYPE",
+	TNT_FUNC_TYPE_SIG:         "FUNC_TYPE_SIG",
+	TNT_FUNC_TYPE_PARAM_LIST:  "FUNC_TYPE_PARAM_LIST",
+	TNT_FUNC_TYPE_PARAM:       "FUNC_TYPE_PARAM",
+	TNT_FUNC_TYPE_RETURN_TYPE: "FUNC_TYPE_RETURN_TYPE",
+	TNT_STMT_LIST:             "STMT_LIST",
+	TNT_STMT_DECL:             "STMT_DECL",
+	TNT_STMT_DECL_IDENT:       "STMT_DECL_IDENT",
+	TNT_STMT_DECL_TYPE:        "STMT_DECL_TYPE",
+	TNT_STMT_EXPR:             "STMT_EXPR",
+	TNT_STMT_ASSIGN:           "STMT_ASSIGN",
+	TNT_STMT_STORE_STRING:     "STMT_STORE_STRING",
+	TNT_STMT_STRING:           "STMT_STRING",
+	TNT_STMT_WHILE:            "STMT_WHILE",
+	TNT_STMT_IF:               "STMT_IF",
+	TNT_STMT_ELSE:             "STMT_ELSE",
+	TNT_STMT_FOR:              "STMT_FOR",
+	TNT_STMT_FOR_IDENT:        "STMT_FOR_IDENT",
+	TNT_STMT_LABEL:            "STMT_LABEL",
+	TNT_STMT_LABEL_IDENT:      "STMT_LABEL_IDENT",
+	TNT_STMT_SWITCH:           "STMT_SWITCH",
+	TNT_STMT_CASE:             "STMT_CASE",
+	TNT_STMT_CASE_VALUE_LIST:  "STMT_CASE_VALUE_LIST",
+	TNT_STMT_DEFAULT:          "STMT_DEFAULT",
+	TNT_STMT_RETURN:           "STMT_RETURN",
+	TNT_STMT_BREAK:            "STMT_BREAK",
+	TNT_STMT_CONTINUE:         "STMT_CONTINUE",
+	TNT_EXPR:                  "EXPR",
+	TNT_EXPR_INT:              "EXPR_INT",
+	TNT_EXPR_FUNC:             "EXPR_FUNC",
+	TNT_EXPR_FUNC_PARM_LIST:   "EXPR_FUNC_PARM_LIST",
+	TNT_EXPR_FUNC_PARM:        "EXPR_FUNC_PARM",
+	TNT_EXPR_INT_LIT:          "EXPR_INT_LIT",
+	TNT_EXPR_NEG_INT_LIT:      "EXPR_NEG_INT_LIT",
+	TNT_EXPR_CHAR:             "EXPR_CHAR",
+	TNT_EXPR_BINARY:           "EXPR_BINARY",
 }
 
 type TreeNode struct {
 	Kype     TreeNodeType
 	Children []TreeNode
 	Tok      TokenData
+
+	// Filled in by the semantic analyzer
+	Info   interface{}
+	Symbol SymbolInfo
 }
 
 var curToks []TokenData
@@ -132,6 +166,10 @@ func matchTok(tokTypes ...TokenType) bool {
 	return false
 }
 
+func matchLabelTok() bool {
+	return matchTok(TT_IDENT) && (len(curToks) > 1) && (curToks[1].Kype == TT_COLON)
+}
+
 func matchBinaryTok() bool {
 	return matchTok(TT_ADD, TT_SUB,
 		TT_MUL, TT_QUO, TT_REM,
@@ -143,6 +181,29 @@ func matchBinaryTok() bool {
 		TT_LEQ, TT_GEQ)
 }
 
+func parseImportList() TreeNode {
+	var tn TreeNode
+	tn.Kype = TNT_IMPORT_LIST
+
+	for matchTok(TT_IMPORT) {
+		tn.Children = append(tn.Children, parseImport())
+	}
+
+	return tn
+}
+
+func parseImport() TreeNode {
+	consumeTok(TT_IMPORT)
+
+	var tn TreeNode
+	tn.Kype = TNT_IMPORT
+	tn.Tok = consumeTok(TT_STR)
+
+	consumeTok(TT_NEW_LINE)
+
+	return tn
+}
+
 func parseFuncList() TreeNode {
 	var tn TreeNode
 	tn.Kype = TNT_FUNC_LIST
@@ -236,6 +297,10 @@ func parseFuncParamType() TreeNode {
 	tn.Kype = TNT_FUNC_PARAM_TYPE
 	tn.Tok = consumeTok(TT_IDENT)
 
+	if matchFuncTypeTok(tn.Tok) {
+		tn.Children = append(tn.Children, parseFuncTypeSig())
+	}
+
 	return tn
 }
 
@@ -244,6 +309,70 @@ func parseFuncReturnType() TreeNode {
 	tn.Kype = TNT_FUNC_RETURN_TYPE
 	tn.Tok = consumeTok(TT_IDENT)
 
+	if matchFuncTypeTok(tn.Tok) {
+		tn.Children = append(tn.Children, parseFuncTypeSig())
+	}
+
+	return tn
+}
+
+func matchFuncTypeTok(tok TokenData) bool {
+	return string(tok.Buf) == "fn" && matchTok(TT_LPAREN)
+}
+
+func parseFuncTypeSig() TreeNode {
+	consumeTok(TT_LPAREN)
+
+	var tn TreeNode
+	tn.Kype = TNT_FUNC_TYPE_SIG
+
+	if matchTok(TT_IDENT) {
+		tn.Children = append(tn.Children, parseFuncTypeParamList())
+	}
+
+	consumeTok(TT_RPAREN)
+
+	if matchTok(TT_IDENT) {
+		tn.Children = append(tn.Children, parseFuncTypeReturnType())
+	}
+
+	return tn
+}
+
+func parseFuncTypeParamList() TreeNode {
+	var tn TreeNode
+	tn.Kype = TNT_FUNC_TYPE_PARAM_LIST
+
+	tn.Children = append(tn.Children, parseFuncTypeParam())
+	for matchTok(TT_COMMA) {
+		consumeTok(TT_COMMA)
+		tn.Children = append(tn.Children, parseFuncTypeParam())
+	}
+
+	return tn
+}
+
+func parseFuncTypeParam() TreeNode {
+	var tn TreeNode
+	tn.Kype = TNT_FUNC_TYPE_PARAM
+	tn.Tok = consumeTok(TT_IDENT)
+
+	if matchFuncTypeTok(tn.Tok) {
+		tn.Children = append(tn.Children, parseFuncTypeSig())
+	}
+
+	return tn
+}
+
+func parseFuncTypeReturnType() TreeNode {
+	var tn TreeNode
+	tn.Kype = TNT_FUNC_TYPE_RETURN_TYPE
+	tn.Tok = consumeTok(TT_IDENT)
+
+	if matchFuncTypeTok(tn.Tok) {
+		tn.Children = append(tn.Children, parseFuncTypeSig())
+	}
+
 	return tn
 }
 
@@ -251,10 +380,14 @@ func parseStmtList() TreeNode {
 	var tn TreeNode
 	tn.Kype = TNT_STMT_LIST
 
-	for matchTok(TT_LET, TT_WHILE, TT_IF, TT_RETURN, TT_BREAK, TT_CONTINUE, TT_IDENT, TT_LPAREN) {
+	for matchTok(TT_LET, TT_WHILE, TT_FOR, TT_IF, TT_SWITCH,
+		TT_RETURN, TT_BREAK, TT_CONTINUE, TT_IDENT, TT_LPAREN) {
 		tn.Children = append(tn.Children, parseStmt())
 	}
 
+	// The token that ends the list, like end or else
+	tn.Tok = peekTok()
+
 	return tn
 }
 
@@ -263,8 +396,14 @@ func parseStmt() TreeNode {
 		return parseStmtDecl()
 	} else if matchTok(TT_WHILE) {
 		return parseStmtWhile()
+	} else if matchTok(TT_FOR) {
+		return parseStmtFor()
+	} else if matchLabelTok() {
+		return parseStmtLabel()
 	} else if matchTok(TT_IF) {
 		return parseStmtIf()
+	} else if matchTok(TT_SWITCH) {
+		return parseStmtSwitch()
 	} else if matchTok(TT_RETURN) {
 		return parseStmtReturn()
 	} else if matchTok(TT_BREAK) {
@@ -311,6 +450,10 @@ func parseStmtDeclType() TreeNode {
 	tn.Kype = TNT_STMT_DECL_TYPE
 	tn.Tok = consumeTok(TT_IDENT)
 
+	if matchFuncTypeTok(tn.Tok) {
+		tn.Children = append(tn.Children, parseFuncTypeSig())
+	}
+
 	return tn
 }
 
@@ -376,6 +519,69 @@ func parseStmtWhile() TreeNode {
 	return tn
 }
 
+func parseStmtFor() TreeNode {
+	var tn TreeNode
+	tn.Kype = TNT_STMT_FOR
+
+	tn.Tok = consumeTok(TT_FOR)
+
+	tn.Children = append(tn.Children, parseStmtForIdent())
+
+	consumeTok(TT_ASSIGN)
+
+	tn.Children = append(tn.Children, parseExpr())
+
+	consumeTok(TT_TO)
+
+	tn.Children = append(tn.Children, parseExpr())
+
+	if matchTok(TT_STEP) {
+		consumeTok(TT_STEP)
+		tn.Children = append(tn.Children, parseExpr())
+	}
+
+	consumeTok(TT_NEW_LINE)
+
+	tn.Children = append(tn.Children, parseStmtList())
+
+	consumeTok(TT_END)
+	consumeTok(TT_NEW_LINE)
+
+	return tn
+}
+
+func parseStmtForIdent() TreeNode {
+	var tn TreeNode
+	tn.Kype = TNT_STMT_FOR_IDENT
+	tn.Tok = consumeTok(TT_IDENT)
+
+	return tn
+}
+
+func parseStmtLabel() TreeNode {
+	var tn TreeNode
+	tn.Kype = TNT_STMT_LABEL
+
+	tn.Tok = consumeTok(TT_IDENT)
+	consumeTok(TT_COLON)
+
+	if matchTok(TT_WHILE) {
+		tn.Children = append(tn.Children, parseStmtWhile())
+	} else {
+		tn.Children = append(tn.Children, parseStmtFor())
+	}
+
+	return tn
+}
+
+func parseStmtLabelIdent() TreeNode {
+	var tn TreeNode
+	tn.Kype = TNT_STMT_LABEL_IDENT
+	tn.Tok = consumeTok(TT_IDENT)
+
+	return tn
+}
+
 func parseStmtIf() TreeNode {
 	var tn TreeNode
 	tn.Kype = TNT_STMT_IF
@@ -418,6 +624,71 @@ func parseStmtElse() TreeNode {
 	return tn
 }
 
+func parseStmtSwitch() TreeNode {
+	var tn TreeNode
+	tn.Kype = TNT_STMT_SWITCH
+
+	tn.Tok = consumeTok(TT_SWITCH)
+
+	tn.Children = append(tn.Children, parseExpr())
+
+	consumeTok(TT_NEW_LINE)
+
+	for matchTok(TT_CASE) {
+		tn.Children = append(tn.Children, parseStmtCase())
+	}
+
+	if matchTok(TT_DEFAULT) {
+		tn.Children = append(tn.Children, parseStmtDefault())
+	}
+
+	consumeTok(TT_END)
+	consumeTok(TT_NEW_LINE)
+
+	return tn
+}
+
+func parseStmtCase() TreeNode {
+	var tn TreeNode
+	tn.Kype = TNT_STMT_CASE
+
+	tn.Tok = consumeTok(TT_CASE)
+
+	tn.Children = append(tn.Children, parseStmtCaseValueList())
+
+	consumeTok(TT_NEW_LINE)
+
+	tn.Children = append(tn.Children, parseStmtList())
+
+	return tn
+}
+
+func parseStmtCaseValueList() TreeNode {
+	var tn TreeNode
+	tn.Kype = TNT_STMT_CASE_VALUE_LIST
+
+	tn.Children = append(tn.Children, parseExpr())
+	for matchTok(TT_COMMA) {
+		consumeTok(TT_COMMA)
+		tn.Children = append(tn.Children, parseExpr())
+	}
+
+	return tn
+}
+
+func parseStmtDefault() TreeNode {
+	var tn TreeNode
+	tn.Kype = TNT_STMT_DEFAULT
+
+	tn.Tok = consumeTok(TT_DEFAULT)
+
+	consumeTok(TT_NEW_LINE)
+
+	tn.Children = append(tn.Children, parseStmtList())
+
+	return tn
+}
+
 func parseExpr() TreeNode {
 	var tn TreeNode
 	tn.Kype = TNT_EXPR
@@ -440,7 +711,7 @@ func parseExprUnary() TreeNode {
 	var tn TreeNode
 
 	if matchTok(TT_IDENT) {
-		tn.Tok = consumeTok(TT_IDENT)
+		tn.Tok = parseQualifiedIdentTok()
 		if matchTok(TT_LPAREN) {
 			tn.Kype = TNT_EXPR_FUNC
 			tn.Children = append(tn.Children, parseExprUnaryFuncParmList())
@@ -456,6 +727,23 @@ func parseExprUnary() TreeNode {
 	return tn
 }
 
+func parseQualifiedIdentTok() TokenData {
+	tok := consumeTok(TT_IDENT)
+
+	if matchTok(TT_PERIOD) {
+		consumeTok(TT_PERIOD)
+		funcIdentTok := consumeTok(TT_IDENT)
+
+		var buf []byte
+		buf = append(buf, tok.Buf...)
+		buf = append(buf, 0x2e)
+		buf = append(buf, funcIdentTok.Buf...)
+		tok.Buf = buf
+	}
+
+	return tok
+}
+
 func parseExprUnaryFuncParmList() TreeNode {
 	var tn TreeNode
 	tn.Kype = TNT_EXPR_FUNC_PARM_LIST
@@ -543,6 +831,9 @@ func parseStmtBreak() TreeNode {
 	var tn TreeNode
 	tn.Kype = TNT_STMT_BREAK
 	tn.Tok = consumeTok(TT_BREAK)
+	if matchTok(TT_IDENT) {
+		tn.Children = append(tn.Children, parseStmtLabelIdent())
+	}
 	consumeTok(TT_NEW_LINE)
 	return tn
 }
@@ -551,23 +842,13 @@ func parseStmtContinue() TreeNode {
 	var tn TreeNode
 	tn.Kype = TNT_STMT_CONTINUE
 	tn.Tok = consumeTok(TT_CONTINUE)
+	if matchTok(TT_IDENT) {
+		tn.Children = append(tn.Children, parseStmtLabelIdent())
+	}
 	consumeTok(TT_NEW_LINE)
 	return tn
 }
 
-func PrintTreeNode(tn TreeNode, level int) {
-	var s string
-	for i := 0; i < level; i++ {
-		s = s + " "
-	}
-
-	fmt.Println(s, "->", TreeNodeTypeNames[tn.Kype], tn.Tok)
-
-	for _, child := range tn.Children {
-		PrintTreeNode(child, level+4)
-	}
-}
-
 func normalizeWholeTree(tn TreeNode) TreeNode {
 	funcListTreeNode := tn.Children[0]
 
@@ -590,7 +871,10 @@ func SyntaxAnalyzer(toks []TokenData) TreeNode {
 
 	tn.Kype = TNT_ROOT
 
+	importListTreeNode := parseImportList()
+
 	tn.Children = append(tn.Children, parseFuncList())
+	tn.Children = append(tn.Children, importListTreeNode)
 
 	tn = normalizeWholeTree(tn)
 
@@ -0,0 +1,183 @@
+package main
+
+var isTailCallEliminatorEnabled = true
+
+// Returns the index of the call at the end of a block whose result is
+// returned right away, or -1. A void call may also be followed by jumps to
+// blocks that only return.
+func getIRTailCallIndex(f IRFunc, b IRBlock) int {
+	instrList := b.InstrList
+
+	if len(instrList) < 2 || instrList[len(instrList)-2].Op != IR_CALL {
+		return -1
+	}
+
+	call := instrList[len(instrList)-2]
+	terminator := instrList[len(instrList)-1]
+
+	if call.Dest != -1 {
+		if terminator.Op == IR_RETURN && len(terminator.ArgList) == 1 && terminator.ArgList[0] == call.Dest {
+			return len(instrList) - 2
+		}
+		return -1
+	}
+
+	for k := 0; k < len(f.BlockList) && terminator.Op == IR_JUMP; k++ {
+		targetInstrList := f.BlockList[terminator.TargetList[0]].InstrList
+		if len(targetInstrList) != 1 {
+			return -1
+		}
+		terminator = targetInstrList[0]
+	}
+
+	if terminator.Op == IR_RETURN && len(terminator.ArgList) == 0 {
+		return len(instrList) - 2
+	}
+
+	return -1
+}
+
+func getIRTailCalleeIdentList(f IRFunc) []string {
+	var identList []string
+	for _, b := range f.BlockList {
+		if k := getIRTailCallIndex(f, b); k != -1 {
+			identList = append(identList, b.InstrList[k].Ident)
+		}
+	}
+	return identList
+}
+
+func findIRFuncTailCall(funcIndexList map[string]int, ir IRProgram, k int, ident string,
+	isVisitedList map[int]bool) bool {
+
+	for _, calleeIdent := range getIRTailCalleeIdentList(ir.FuncList[k]) {
+		if calleeIdent == ident {
+			return true
+		}
+
+		if j, ok := funcIndexList[calleeIdent]; ok && !isVisitedList[j] {
+			isVisitedList[j] = true
+
+			if findIRFuncTailCall(funcIndexList, ir, j, ident, isVisitedList) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// The blocks of a function that was copied into another function, and the
+// copies of its parameters
+type IRTailCallEntry struct {
+	BlockIndex     int
+	ParamLocalList []int
+}
+
+// Turns calls in tail position into stores to the parameters and a jump to
+// the entry of the callee. The callee is either the function itself, which
+// gets a new entry block that jumps to its old one, or a function that tail
+// calls it back. Such a function is copied into the caller once, with its
+// returns kept, so that mutual recursion also runs in a single frame.
+func TailCallEliminator(ir IRProgram, rootFuncIdentList []string) IRProgram {
+	funcIndexList := make(map[string]int)
+	for k, f := range ir.FuncList {
+		funcIndexList[f.Ident] = k
+	}
+
+	funcList := make([]IRFunc, len(ir.FuncList))
+
+	for k, f := range ir.FuncList {
+		funcList[k] = f
+
+		if !findIRFuncTailCall(funcIndexList, ir, k, f.Ident, map[int]bool{k: true}) {
+			continue
+		}
+
+		blockList := []IRBlock{{InstrList: []IRInstr{{Op: IR_JUMP, Dest: -1, TargetList: []int{1}}}}}
+
+		for _, b := range f.BlockList {
+			var instrList []IRInstr
+			for _, instr := range b.InstrList {
+				instrList = append(instrList, mapIRInstr(instr, 0, 0, 1))
+			}
+			blockList = append(blockList, IRBlock{InstrList: instrList})
+		}
+
+		f.BlockList = blockList
+		f.LocalList = append([]IRLocal{}, f.LocalList...)
+		f.ValueTypeList = append([]interface{}{}, f.ValueTypeList...)
+
+		var paramLocalList []int
+		for j, local := range f.LocalList {
+			if local.IsParam {
+				paramLocalList = append(paramLocalList, j)
+			}
+		}
+
+		entryList := map[string]IRTailCallEntry{
+			f.Ident: {BlockIndex: 1, ParamLocalList: paramLocalList},
+		}
+
+		// Copied blocks are appended and scanned as well
+		for blockIndex := 0; blockIndex < len(f.BlockList); blockIndex++ {
+			instrIndex := getIRTailCallIndex(f, f.BlockList[blockIndex])
+			if instrIndex == -1 {
+				continue
+			}
+
+			call := f.BlockList[blockIndex].InstrList[instrIndex]
+
+			entry, ok := entryList[call.Ident]
+
+			if !ok {
+				j, ok := funcIndexList[call.Ident]
+				if !ok || !findIRFuncTailCall(funcIndexList, ir, j, f.Ident, map[int]bool{j: true}) {
+					continue
+				}
+
+				g := ir.FuncList[j]
+
+				entry = IRTailCallEntry{BlockIndex: len(f.BlockList)}
+
+				localBase := len(f.LocalList)
+				for l, local := range g.LocalList {
+					if local.IsParam {
+						entry.ParamLocalList = append(entry.ParamLocalList, localBase+l)
+					}
+					f.LocalList = append(f.LocalList, IRLocal{Ident: g.Ident + "." + local.Ident, Type: local.Type})
+				}
+
+				valueBase := len(f.ValueTypeList)
+				f.ValueTypeList = append(f.ValueTypeList, g.ValueTypeList...)
+
+				for _, b := range g.BlockList {
+					var instrList []IRInstr
+					for _, instr := range b.InstrList {
+						instrList = append(instrList, mapIRInstr(instr, valueBase, localBase, entry.BlockIndex))
+					}
+					f.BlockList = append(f.BlockList, IRBlock{InstrList: instrList})
+				}
+
+				entryList[call.Ident] = entry
+			}
+
+			instrList := append([]IRInstr{}, f.BlockList[blockIndex].InstrList[:instrIndex]...)
+
+			for l := len(call.ArgList) - 1; l >= 0; l-- {
+				instrList = append(instrList, IRInstr{Op: IR_STORE_LOCAL, Dest: -1,
+					Local: entry.ParamLocalList[l], ArgList: []int{call.ArgList[l]}})
+			}
+
+			instrList = append(instrList, IRInstr{Op: IR_JUMP, Dest: -1, TargetList: []int{entry.BlockIndex}})
+
+			f.BlockList[blockIndex] = IRBlock{InstrList: instrList}
+		}
+
+		funcList[k] = f
+	}
+
+	ir.FuncList = funcList
+
+	return removeUnreachableIRFuncs(ir, rootFuncIdentList)
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+var VM_STACK_SIZE uint64 = 0x100_0000
+var VM_ECALL_BUFFER_ADDR uint64 = 0x30_0000
+
+var VM_PANIC_MESSAGE = "PANIC"
+var VM_INVALID_CODE_MESSAGE = "invalid bytecode"
+var VM_BREAK_MESSAGE = "break"
+
+var vmMaskList = [9]uint64{0, 0xff, 0xffff, 0, 0xffff_ffff, 0, 0, 0, 0xffff_ffff_ffff_ffff}
+
+func getVMSignExtendedValue(t byte, v uint64) uint64 {
+	switch t & 0b11111 {
+	case 0b10001:
+		return uint64(int64(int8(v)))
+	case 0b10010:
+		return uint64(int64(int16(v)))
+	case 0b10100:
+		return uint64(int64(int32(v)))
+	}
+	return v & vmMaskList[t&0b1111]
+}
+
+func putVMValue(b []byte, v uint64, t byte) {
+	switch t & 0b1111 {
+	case 1:
+		b[0] = byte(v)
+	case 2:
+		binary.LittleEndian.PutUint16(b, uint16(v))
+	case 4:
+		binary.LittleEndian.PutUint32(b, uint32(v))
+	case 8:
+		binary.LittleEndian.PutUint64(b, v)
+	}
+}
+
+func isVMMemoryRangeValid(addr uint64, bytesCount uint64) bool {
+	return (addr < MEMORY_SIZE) && (bytesCount <= MEMORY_SIZE-addr)
+}
+
+func runVMEcall(mem []byte, w io.Writer) {
+	end := VM_ECALL_BUFFER_ADDR
+	for end < MEMORY_SIZE && mem[end] != 0 {
+		end++
+	}
+	w.Write(mem[VM_ECALL_BUFFER_ADDR:end])
+	w.Write([]byte{'\n'})
+}
+
+func runVMStoreString(mem []byte, addr uint64, s []byte) bool {
+	if !isVMMemoryRangeValid(addr, uint64(len(s))+1) {
+		return false
+	}
+	copy(mem[addr:], s)
+	mem[addr+uint64(len(s))] = 0
+	return true
+}
+
+// Computes the result of an arithmetic or comparison op on values that are
+// already sign extended to 64 bits according to their types
+func runVMBinaryOp(op byte, t1 byte, t2 byte, a uint64, b uint64) (uint64, bool) {
+	bitsCount := uint64(t1&0b1111) * 8
+	isSigned := (t1 & 0b10000) != 0
+
+	var r uint64
+
+	switch op {
+	case OP_ADD:
+		r = a + b
+	case OP_SUB:
+		r = a - b
+	case OP_AND:
+		r = a & b
+	case OP_OR:
+		r = a | b
+	case OP_XOR:
+		r = a ^ b
+	case OP_MUL:
+		r = a * b
+	case OP_SHL, OP_SHR:
+		if (t2&0b10000) != 0 && int64(b) < 0 {
+			return 0, false
+		}
+		if op == OP_SHL {
+			if b < bitsCount {
+				r = a << b
+			}
+		} else if isSigned {
+			if b >= bitsCount {
+				b = bitsCount - 1
+			}
+			r = uint64(int64(a) >> b)
+		} else if b < bitsCount {
+			r = a >> b
+		}
+	case OP_QUO, OP_REM:
+		if b == 0 {
+			return 0, false
+		}
+		if isSigned {
+			if int64(a) == -(int64(1)<<(bitsCount-1)) && int64(b) == -1 {
+				return 0, false
+			}
+			if op == OP_QUO {
+				r = uint64(int64(a) / int64(b))
+			} else {
+				r = uint64(int64(a) % int64(b))
+			}
+		} else if op == OP_QUO {
+			r = a / b
+		} else {
+			r = a % b
+		}
+	case OP_EQL, OP_NEQ, OP_LSS, OP_GTR, OP_LEQ, OP_GEQ:
+		isLess := a < b
+		if isSigned {
+			isLess = int64(a) < int64(b)
+		}
+
+		var c bool
+
+		switch op {
+		case OP_EQL:
+			c = a == b
+		case OP_NEQ:
+			c = a != b
+		case OP_LSS:
+			c = isLess
+		case OP_GTR:
+			c = !isLess && a != b
+		case OP_LEQ:
+			c = isLess || a == b
+		case OP_GEQ:
+			c = !isLess
+		}
+
+		if c {
+			return 1, true
+		}
+		return 0, true
+	default:
+		return 0, false
+	}
+
+	return getVMSignExtendedValue(t1, r), true
+}
+
+func isVMBinaryOp(op byte) bool {
+	switch op {
+	case OP_ADD, OP_SUB, OP_AND, OP_OR, OP_XOR, OP_SHL, OP_SHR, OP_MUL, OP_QUO, OP_REM,
+		OP_EQL, OP_NEQ, OP_LSS, OP_GTR, OP_LEQ, OP_GEQ:
+		return true
+	}
+	return false
+}
+
+// State of a stack VM between runs, so that a program can be stopped and
+// resumed by the debugger
+type VMState struct {
+	Code  []byte
+	Mem   []byte
+	Stack []byte
+
+	PC uint64
+	SP uint64
+	FP uint64
+
+	InstrCount uint64
+
+	W io.Writer
+}
+
+func initVMState(code []byte, w io.Writer) *VMState {
+	return &VMState{
+		Code:  code,
+		Mem:   make([]byte, MEMORY_SIZE+8),
+		Stack: make([]byte, VM_STACK_SIZE+8),
+		W:     w,
+	}
+}
+
+// Runs stack bytecode until it halts. The returned message is empty when the
+// program halted normally.
+func RunBytecode(code []byte, w io.Writer) (string, uint64) {
+	vm := initVMState(code, w)
+
+	msg := runVMState(vm, ^uint64(0))
+	if msg == VM_BREAK_MESSAGE {
+		msg = VM_INVALID_CODE_MESSAGE
+	}
+
+	return msg, vm.InstrCount
+}
+
+// Runs at most stepsCount instructions. The program stops at a break
+// instruction or after the last step with VM_BREAK_MESSAGE, and the program
+// counter is left at the instruction that has not run yet.
+func runVMState(vm *VMState, stepsCount uint64) (msg string) {
+	code, mem, stack := vm.Code, vm.Mem, vm.Stack
+	pc, sp, fp := vm.PC, vm.SP, vm.FP
+	instrCount := vm.InstrCount
+
+	defer func() {
+		if recover() != nil {
+			msg = VM_INVALID_CODE_MESSAGE
+		}
+	}()
+
+	push := func(v uint64, t byte) bool {
+		binary.LittleEndian.PutUint64(stack[sp:], v)
+		sp = sp + uint64(t&0b1111)
+		return sp <= VM_STACK_SIZE
+	}
+
+	pop := func(t byte) uint64 {
+		if (t & 0b100000) != 0 {
+			sp = sp - 8
+			addr := fp + binary.LittleEndian.Uint64(stack[sp:])
+			return binary.LittleEndian.Uint64(stack[addr:]) & vmMaskList[t&0b1111]
+		}
+		sp = sp - uint64(t&0b1111)
+		return binary.LittleEndian.Uint64(stack[sp:]) & vmMaskList[t&0b1111]
+	}
+
+	msg = VM_BREAK_MESSAGE
+
+run:
+	for ; stepsCount != 0; stepsCount-- {
+		instrCount++
+
+		op := code[pc]
+
+		switch op {
+		case OP_HALT:
+			msg = ""
+			break run
+		case OP_BREAK:
+			instrCount--
+			break run
+		case OP_ECALL:
+			runVMEcall(mem, vm.W)
+			pc = pc + 1
+		case OP_CALL, OP_CALL_INDIRECT:
+			var targetAddr uint64
+
+			if op == OP_CALL {
+				targetAddr = pc + pop(8)
+				pc = pc + 1
+			} else {
+				targetAddr = pop(code[pc+1])
+				pc = pc + 2
+			}
+
+			if !push(fp, 8) || !push(pc, 8) {
+				msg = VM_PANIC_MESSAGE
+				break run
+			}
+
+			fp = sp
+			pc = targetAddr
+		case OP_RETURN:
+			t := code[pc+1]
+			framePointer := pop(8)
+			v := pop(t)
+
+			pc = binary.LittleEndian.Uint64(stack[fp-8:])
+			sp = fp + framePointer
+			fp = binary.LittleEndian.Uint64(stack[fp-16:])
+
+			push(v, t)
+		case OP_JUMP:
+			pc = pc + pop(8)
+		case OP_BRANCH:
+			disp := pop(8)
+			if pop(code[pc+1]) == 0 {
+				pc = pc + disp
+			} else {
+				pc = pc + 2
+			}
+		case OP_JUMP_TABLE:
+			i := pop(code[pc+1])
+			entriesCount := binary.LittleEndian.Uint64(code[pc+2:])
+			if i < entriesCount {
+				pc = pc + binary.LittleEndian.Uint64(code[pc+10+(i*8):])
+			} else {
+				pc = pc + 10 + (entriesCount * 8)
+			}
+		case OP_PUSH:
+			t := code[pc+1]
+			if !push(binary.LittleEndian.Uint64(code[pc+2:])&vmMaskList[t&0b1111], t) {
+				msg = VM_PANIC_MESSAGE
+				break run
+			}
+			pc = pc + 2 + uint64(t&0b1111)
+		case OP_POP:
+			pop(code[pc+1])
+			pc = pc + 2
+		case OP_ASSIGN:
+			t1, t2 := code[pc+1], code[pc+2]
+			v := pop(t2)
+			sp = sp - 8
+			addr := fp + binary.LittleEndian.Uint64(stack[sp:])
+			putVMValue(stack[addr:], v, t1)
+			pc = pc + 3
+		case OP_CONVERT:
+			t1, t2 := code[pc+1], code[pc+2]
+			if !push(getVMSignExtendedValue(t1, pop(t1)), t2) {
+				msg = VM_PANIC_MESSAGE
+				break run
+			}
+			pc = pc + 3
+		case OP_LOAD:
+			t1, t2 := code[pc+1], code[pc+2]
+			addr := pop(t1)
+			if !isVMMemoryRangeValid(addr, uint64(t2&0b1111)) {
+				msg = VM_PANIC_MESSAGE
+				break run
+			}
+			if !push(binary.LittleEndian.Uint64(mem[addr:])&vmMaskList[t2&0b1111], t2) {
+				msg = VM_PANIC_MESSAGE
+				break run
+			}
+			pc = pc + 3
+		case OP_STORE:
+			t1, t2 := code[pc+1], code[pc+2]
+			v := pop(t2)
+			addr := pop(t1)
+			if !isVMMemoryRangeValid(addr, uint64(t2&0b1111)) {
+				msg = VM_PANIC_MESSAGE
+				break run
+			}
+			putVMValue(mem[addr:], v, t2)
+			pc = pc + 3
+		case OP_STORE_STRING:
+			addr := pop(0b101000)
+
+			end := pc + 1
+			for code[end] != 0 {
+				end++
+			}
+
+			if !runVMStoreString(mem, addr, code[pc+1:end]) {
+				msg = VM_PANIC_MESSAGE
+				break run
+			}
+			pc = end + 1
+		default:
+			if !isVMBinaryOp(op) {
+				msg = VM_INVALID_CODE_MESSAGE
+				break run
+			}
+
+			t1, t2 := code[pc+1], code[pc+2]
+			b := getVMSignExtendedValue(t2, pop(t2))
+			a := getVMSignExtendedValue(t1, pop(t1))
+
+			r, ok := runVMBinaryOp(op, t1, t2, a, b)
+			if !ok {
+				msg = VM_PANIC_MESSAGE
+				break run
+			}
+
+			if op >= OP_EQL {
+				push(r, 1)
+			} else {
+				push(r, t1)
+			}
+			pc = pc + 3
+		}
+	}
+
+	vm.PC, vm.SP, vm.FP, vm.InstrCount = pc, sp, fp, instrCount
+
+	return msg
+}
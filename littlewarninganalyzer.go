@@ -0,0 +1,192 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+var isUnusedVariableWarningEnabled = true
+var isUnusedParameterWarningEnabled = true
+var isUnusedFunctionWarningEnabled = true
+var isDeadStoreWarningEnabled = true
+
+type WarningInfo struct {
+	Line int
+	Msg  string
+}
+
+// Locals added by the generator, like the bounds of a for loop, have a dot
+// in their name
+func isUserIRLocal(local IRLocal) bool {
+	return !strings.Contains(local.Ident, ".")
+}
+
+func getIRBlockTargetList(b IRBlock) []int {
+	if len(b.InstrList) == 0 {
+		return nil
+	}
+	return b.InstrList[len(b.InstrList)-1].TargetList
+}
+
+func getReachableIRBlockList(f IRFunc) []bool {
+	isReachable := make([]bool, len(f.BlockList))
+
+	var visitBlock func(b int)
+	visitBlock = func(b int) {
+		if isReachable[b] {
+			return
+		}
+
+		isReachable[b] = true
+
+		for _, target := range getIRBlockTargetList(f.BlockList[b]) {
+			visitBlock(target)
+		}
+	}
+
+	if len(f.BlockList) != 0 {
+		visitBlock(0)
+	}
+
+	return isReachable
+}
+
+// Returns for every block the locals that may be read after it, before
+// they are stored again
+func getIRLiveOutList(f IRFunc) [][]bool {
+	useList := make([][]bool, len(f.BlockList))
+	defList := make([][]bool, len(f.BlockList))
+	liveOutList := make([][]bool, len(f.BlockList))
+
+	for i, b := range f.BlockList {
+		useList[i] = make([]bool, len(f.LocalList))
+		defList[i] = make([]bool, len(f.LocalList))
+		liveOutList[i] = make([]bool, len(f.LocalList))
+
+		for _, instr := range b.InstrList {
+			switch instr.Op {
+			case IR_LOAD_LOCAL:
+				if !defList[i][instr.Local] {
+					useList[i][instr.Local] = true
+				}
+			case IR_STORE_LOCAL:
+				defList[i][instr.Local] = true
+			}
+		}
+	}
+
+	for isChanged := true; isChanged; {
+		isChanged = false
+
+		for i := len(f.BlockList) - 1; i >= 0; i-- {
+			for _, target := range getIRBlockTargetList(f.BlockList[i]) {
+				for local := range f.LocalList {
+					isLiveIn := useList[target][local] ||
+						(liveOutList[target][local] && !defList[target][local])
+
+					if isLiveIn && !liveOutList[i][local] {
+						liveOutList[i][local] = true
+						isChanged = true
+					}
+				}
+			}
+		}
+	}
+
+	return liveOutList
+}
+
+// The store that a declaration emits to zero its variable is on the line
+// of the variable and is not an assignment
+func getDeadStoreWarningList(f IRFunc, isLoaded []bool) []WarningInfo {
+	var warningList []WarningInfo
+
+	isReachable := getReachableIRBlockList(f)
+	liveOutList := getIRLiveOutList(f)
+
+	for i, b := range f.BlockList {
+		if !isReachable[i] {
+			continue
+		}
+
+		isLive := append([]bool{}, liveOutList[i]...)
+
+		for j := len(b.InstrList) - 1; j >= 0; j-- {
+			instr := b.InstrList[j]
+
+			switch instr.Op {
+			case IR_LOAD_LOCAL:
+				isLive[instr.Local] = true
+			case IR_STORE_LOCAL:
+				local := f.LocalList[instr.Local]
+
+				if !isLive[instr.Local] && isLoaded[instr.Local] && isUserIRLocal(local) &&
+					instr.Line != local.Line {
+					warningList = append(warningList, WarningInfo{Line: instr.Line,
+						Msg: "value assigned to " + local.Ident + " is never read"})
+				}
+
+				isLive[instr.Local] = false
+			}
+		}
+	}
+
+	return warningList
+}
+
+func getIRFuncWarningList(f IRFunc) []WarningInfo {
+	var warningList []WarningInfo
+
+	isLoaded := make([]bool, len(f.LocalList))
+
+	for _, b := range f.BlockList {
+		for _, instr := range b.InstrList {
+			if instr.Op == IR_LOAD_LOCAL {
+				isLoaded[instr.Local] = true
+			}
+		}
+	}
+
+	for i, local := range f.LocalList {
+		if isLoaded[i] || !isUserIRLocal(local) {
+			continue
+		}
+
+		if local.IsParam && isUnusedParameterWarningEnabled {
+			warningList = append(warningList, WarningInfo{Line: local.Line,
+				Msg: "unused parameter " + local.Ident})
+		} else if !local.IsParam && isUnusedVariableWarningEnabled {
+			warningList = append(warningList, WarningInfo{Line: local.Line,
+				Msg: "unused variable " + local.Ident})
+		}
+	}
+
+	if isDeadStoreWarningEnabled {
+		warningList = append(warningList, getDeadStoreWarningList(f, isLoaded)...)
+	}
+
+	sort.SliceStable(warningList, func(i, j int) bool {
+		return warningList[i].Line < warningList[j].Line
+	})
+
+	return warningList
+}
+
+// Functions are unused when the dead code eliminator would remove them.
+// Functions of imported modules have a dot in their name and are left out,
+// since they are meant to be used by other programs too.
+func WarningAnalyzer(ir IRProgram, isReachableFuncList map[string]bool) {
+	for _, f := range ir.FuncList {
+		curSourceFilePath = f.SourceFilePath
+
+		if !isReachableFuncList[f.Ident] && !strings.Contains(f.Ident, ".") && isUnusedFunctionWarningEnabled {
+			PrintWarning(f.Line, "unused function "+f.Ident)
+		}
+
+		for _, wi := range getIRFuncWarningList(f) {
+			PrintWarning(wi.Line, wi.Msg)
+		}
+	}
+
+	curSourceFilePath = ""
+}
@@ -0,0 +1,725 @@
+package main
+
+import (
+	"strings"
+)
+
+var (
+	WASM_I32     byte = 0x7f
+	WASM_I64     byte = 0x7e
+	WASM_FUNCREF byte = 0x70
+)
+
+var (
+	WASM_UNREACHABLE   byte = 0x00
+	WASM_BLOCK         byte = 0x02
+	WASM_LOOP          byte = 0x03
+	WASM_IF            byte = 0x04
+	WASM_END           byte = 0x0b
+	WASM_BR            byte = 0x0c
+	WASM_BR_IF         byte = 0x0d
+	WASM_BR_TABLE      byte = 0x0e
+	WASM_RETURN        byte = 0x0f
+	WASM_CALL          byte = 0x10
+	WASM_CALL_INDIRECT byte = 0x11
+	WASM_DROP          byte = 0x1a
+	WASM_SELECT        byte = 0x1b
+	WASM_LOCAL_GET     byte = 0x20
+	WASM_LOCAL_SET     byte = 0x21
+
+	WASM_I32_LOAD     byte = 0x28
+	WASM_I64_LOAD     byte = 0x29
+	WASM_I32_LOAD8_S  byte = 0x2c
+	WASM_I32_LOAD8_U  byte = 0x2d
+	WASM_I32_LOAD16_S byte = 0x2e
+	WASM_I32_LOAD16_U byte = 0x2f
+	WASM_I32_STORE    byte = 0x36
+	WASM_I64_STORE    byte = 0x37
+	WASM_I32_STORE8   byte = 0x3a
+	WASM_I32_STORE16  byte = 0x3b
+
+	WASM_I32_CONST byte = 0x41
+	WASM_I64_CONST byte = 0x42
+
+	WASM_I32_EQZ  byte = 0x45
+	WASM_I32_EQ   byte = 0x46
+	WASM_I32_NE   byte = 0x47
+	WASM_I32_LT_S byte = 0x48
+	WASM_I32_LT_U byte = 0x49
+	WASM_I32_GT_S byte = 0x4a
+	WASM_I32_GT_U byte = 0x4b
+	WASM_I32_LE_S byte = 0x4c
+	WASM_I32_LE_U byte = 0x4d
+	WASM_I32_GE_S byte = 0x4e
+	WASM_I32_GE_U byte = 0x4f
+	WASM_I64_EQZ  byte = 0x50
+
+	WASM_I32_ADD   byte = 0x6a
+	WASM_I32_SUB   byte = 0x6b
+	WASM_I32_MUL   byte = 0x6c
+	WASM_I32_DIV_S byte = 0x6d
+	WASM_I32_DIV_U byte = 0x6e
+	WASM_I32_REM_S byte = 0x6f
+	WASM_I32_REM_U byte = 0x70
+	WASM_I32_AND   byte = 0x71
+	WASM_I32_OR    byte = 0x72
+	WASM_I32_XOR   byte = 0x73
+	WASM_I32_SHL   byte = 0x74
+	WASM_I32_SHR_S byte = 0x75
+	WASM_I32_SHR_U byte = 0x76
+
+	WASM_I32_WRAP_I64     byte = 0xa7
+	WASM_I64_EXTEND_I32_S byte = 0xac
+	WASM_I64_EXTEND_I32_U byte = 0xad
+	WASM_I32_EXTEND8_S    byte = 0xc0
+	WASM_I32_EXTEND16_S   byte = 0xc1
+)
+
+// Offsets from the i32 opcode to the matching i64 opcode
+var (
+	WASM_I64_ARITH_OFFSET   byte = 0x12
+	WASM_I64_COMPARE_OFFSET byte = 0x0b
+)
+
+var WASM_MEMORY_PAGES_COUNT uint64 = MEMORY_SIZE / 0x1_0000
+
+var wasmCode []byte
+
+var wasmFuncTypeList []string
+var wasmFuncIndexList map[string]int
+
+var wasmBlocksCount int
+var wasmLocalIndexList []int
+var wasmPCLocal int
+var wasmTempLocalList map[byte][]int
+
+func appendWasmUleb(b []byte, v uint64) []byte {
+	for {
+		c := byte(v & 0x7f)
+		v = v >> 7
+		if v == 0 {
+			return append(b, c)
+		}
+		b = append(b, c|0x80)
+	}
+}
+
+func appendWasmSleb(b []byte, v int64) []byte {
+	for {
+		c := byte(v & 0x7f)
+		v = v >> 7
+		if (v == 0 && (c&0x40) == 0) || (v == -1 && (c&0x40) != 0) {
+			return append(b, c)
+		}
+		b = append(b, c|0x80)
+	}
+}
+
+func appendWasmName(b []byte, s string) []byte {
+	b = appendWasmUleb(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+func appendWasmVector(b []byte, count int, content []byte) []byte {
+	b = appendWasmUleb(b, uint64(count))
+	return append(b, content...)
+}
+
+func appendWasmSection(b []byte, id byte, content []byte) []byte {
+	b = append(b, id)
+	b = appendWasmUleb(b, uint64(len(content)))
+	return append(b, content...)
+}
+
+func getWasmValType(i interface{}) byte {
+	if getIRIntInfo(i).BytesCount == 8 {
+		return WASM_I64
+	}
+	return WASM_I32
+}
+
+// Signature key, one byte per type, used to find the function type index
+func getWasmFuncTypeKey(paramList []interface{}, returnValueInfo interface{}) string {
+	var b []byte
+	for _, p := range paramList {
+		b = append(b, getWasmValType(p))
+	}
+
+	b = append(b, 0)
+
+	if _, ok := returnValueInfo.(VoidInfo); !ok {
+		b = append(b, getWasmValType(returnValueInfo))
+	}
+
+	return string(b)
+}
+
+func getWasmFuncTypeIndex(key string) int {
+	for i, k := range wasmFuncTypeList {
+		if k == key {
+			return i
+		}
+	}
+
+	wasmFuncTypeList = append(wasmFuncTypeList, key)
+
+	return len(wasmFuncTypeList) - 1
+}
+
+func emitWasmOp(b ...byte) {
+	wasmCode = append(wasmCode, b...)
+}
+
+func emitWasmUleb(v uint64) {
+	wasmCode = appendWasmUleb(wasmCode, v)
+}
+
+func emitWasmLocalOp(op byte, local int) {
+	emitWasmOp(op)
+	emitWasmUleb(uint64(local))
+}
+
+func emitWasmConst(vt byte, ii IntInfo, v uint64) {
+	sv := int64(getSignExtendedValue(ii, v))
+
+	if vt == WASM_I64 {
+		emitWasmOp(WASM_I64_CONST)
+		wasmCode = appendWasmSleb(wasmCode, sv)
+	} else {
+		emitWasmOp(WASM_I32_CONST)
+		wasmCode = appendWasmSleb(wasmCode, int64(int32(sv)))
+	}
+}
+
+func emitWasmMemArg() {
+	emitWasmOp(0, 0)
+}
+
+// Keeps the low bytes of an i32 and extends them to 32 bits
+func emitWasmCanonicalize(ii IntInfo) {
+	switch ii.BytesCount {
+	case 1:
+		if ii.IsSigned {
+			emitWasmOp(WASM_I32_EXTEND8_S)
+		} else {
+			emitWasmConst(WASM_I32, IntInfo{IsSigned: false, BytesCount: 4}, 0xff)
+			emitWasmOp(WASM_I32_AND)
+		}
+	case 2:
+		if ii.IsSigned {
+			emitWasmOp(WASM_I32_EXTEND16_S)
+		} else {
+			emitWasmConst(WASM_I32, IntInfo{IsSigned: false, BytesCount: 4}, 0xffff)
+			emitWasmOp(WASM_I32_AND)
+		}
+	}
+}
+
+func emitWasmConvert(from interface{}, to interface{}) {
+	fii := getIRIntInfo(from)
+	tii := getIRIntInfo(to)
+
+	switch {
+	case fii.BytesCount != 8 && tii.BytesCount == 8:
+		if fii.IsSigned {
+			emitWasmOp(WASM_I64_EXTEND_I32_S)
+		} else {
+			emitWasmOp(WASM_I64_EXTEND_I32_U)
+		}
+	case fii.BytesCount == 8 && tii.BytesCount != 8:
+		emitWasmOp(WASM_I32_WRAP_I64)
+		emitWasmCanonicalize(tii)
+	case tii.BytesCount != 8:
+		emitWasmCanonicalize(tii)
+	}
+}
+
+func getWasmTypedOp(vt byte, op byte, offset byte) byte {
+	if vt == WASM_I64 {
+		return op + offset
+	}
+	return op
+}
+
+func emitWasmPanicIf() {
+	emitWasmOp(WASM_IF, 0x40, WASM_UNREACHABLE, WASM_END)
+}
+
+func emitWasmBinaryOp(op TokenType, ii IntInfo, ii2 IntInfo) {
+	vt := getWasmValType(ii)
+	vt2 := getWasmValType(ii2)
+
+	arith := func(op byte) byte {
+		return getWasmTypedOp(vt, op, WASM_I64_ARITH_OFFSET)
+	}
+
+	compare := func(op byte) byte {
+		return getWasmTypedOp(vt, op, WASM_I64_COMPARE_OFFSET)
+	}
+
+	switch op {
+	case TT_ADD, TT_SUB, TT_MUL, TT_AND, TT_OR, TT_XOR:
+		emitWasmOp(arith(map[TokenType]byte{
+			TT_ADD: WASM_I32_ADD, TT_SUB: WASM_I32_SUB, TT_MUL: WASM_I32_MUL,
+			TT_AND: WASM_I32_AND, TT_OR: WASM_I32_OR, TT_XOR: WASM_I32_XOR}[op]))
+		emitWasmCanonicalize(ii)
+	case TT_QUO, TT_REM:
+		a := wasmTempLocalList[vt][0]
+		b := wasmTempLocalList[vt][1]
+
+		emitWasmLocalOp(WASM_LOCAL_SET, b)
+		emitWasmLocalOp(WASM_LOCAL_SET, a)
+
+		if ii.IsSigned {
+			emitWasmLocalOp(WASM_LOCAL_GET, a)
+			emitWasmConst(vt, ii, uint64(1)<<((ii.BytesCount*8)-1))
+			emitWasmOp(compare(WASM_I32_EQ))
+			emitWasmLocalOp(WASM_LOCAL_GET, b)
+			emitWasmConst(vt, ii, getIntInfoMask(ii))
+			emitWasmOp(compare(WASM_I32_EQ))
+			emitWasmOp(WASM_I32_AND)
+			emitWasmPanicIf()
+		}
+
+		emitWasmLocalOp(WASM_LOCAL_GET, a)
+		emitWasmLocalOp(WASM_LOCAL_GET, b)
+
+		switch {
+		case op == TT_QUO && ii.IsSigned:
+			emitWasmOp(arith(WASM_I32_DIV_S))
+		case op == TT_QUO:
+			emitWasmOp(arith(WASM_I32_DIV_U))
+		case ii.IsSigned:
+			emitWasmOp(arith(WASM_I32_REM_S))
+		default:
+			emitWasmOp(arith(WASM_I32_REM_U))
+		}
+	case TT_SHL, TT_SHR:
+		a := wasmTempLocalList[vt][0]
+		b := wasmTempLocalList[vt2][1]
+		bitsCount := uint64(ii.BytesCount * 8)
+		uii2 := IntInfo{IsSigned: false, BytesCount: ii2.BytesCount}
+
+		emitWasmLocalOp(WASM_LOCAL_SET, b)
+		emitWasmLocalOp(WASM_LOCAL_SET, a)
+
+		if ii2.IsSigned {
+			emitWasmLocalOp(WASM_LOCAL_GET, b)
+			emitWasmConst(vt2, ii2, 0)
+			emitWasmOp(getWasmTypedOp(vt2, WASM_I32_LT_S, WASM_I64_COMPARE_OFFSET))
+			emitWasmPanicIf()
+		}
+
+		emitWasmLocalOp(WASM_LOCAL_GET, a)
+		emitWasmLocalOp(WASM_LOCAL_GET, b)
+		emitWasmConvert(uii2, IntInfo{IsSigned: false, BytesCount: map[byte]int{
+			WASM_I32: 4, WASM_I64: 8}[vt]})
+
+		if op == TT_SHR && ii.IsSigned {
+			emitWasmConst(vt, ii, bitsCount-1)
+		} else {
+			if op == TT_SHL {
+				emitWasmOp(arith(WASM_I32_SHL))
+			} else {
+				emitWasmOp(arith(WASM_I32_SHR_U))
+			}
+			emitWasmConst(vt, ii, 0)
+		}
+
+		emitWasmLocalOp(WASM_LOCAL_GET, b)
+		emitWasmConst(vt2, uii2, bitsCount)
+		emitWasmOp(getWasmTypedOp(vt2, WASM_I32_LT_U, WASM_I64_COMPARE_OFFSET))
+		emitWasmOp(WASM_SELECT)
+
+		if op == TT_SHR && ii.IsSigned {
+			emitWasmOp(arith(WASM_I32_SHR_S))
+		}
+
+		emitWasmCanonicalize(ii)
+	case TT_EQL, TT_NEQ, TT_LSS, TT_GTR, TT_LEQ, TT_GEQ:
+		cop := map[TokenType]byte{
+			TT_EQL: WASM_I32_EQ, TT_NEQ: WASM_I32_NE,
+			TT_LSS: WASM_I32_LT_U, TT_GTR: WASM_I32_GT_U,
+			TT_LEQ: WASM_I32_LE_U, TT_GEQ: WASM_I32_GE_U}[op]
+
+		if ii.IsSigned {
+			cop = map[TokenType]byte{
+				TT_EQL: WASM_I32_EQ, TT_NEQ: WASM_I32_NE,
+				TT_LSS: WASM_I32_LT_S, TT_GTR: WASM_I32_GT_S,
+				TT_LEQ: WASM_I32_LE_S, TT_GEQ: WASM_I32_GE_S}[op]
+		}
+
+		emitWasmOp(compare(cop))
+	default:
+		PrintErrorAndExit(0)
+	}
+}
+
+func emitWasmLoad(ii IntInfo) {
+	emitWasmOp(WASM_I32_WRAP_I64)
+
+	switch ii.BytesCount {
+	case 1:
+		if ii.IsSigned {
+			emitWasmOp(WASM_I32_LOAD8_S)
+		} else {
+			emitWasmOp(WASM_I32_LOAD8_U)
+		}
+	case 2:
+		if ii.IsSigned {
+			emitWasmOp(WASM_I32_LOAD16_S)
+		} else {
+			emitWasmOp(WASM_I32_LOAD16_U)
+		}
+	case 4:
+		emitWasmOp(WASM_I32_LOAD)
+	case 8:
+		emitWasmOp(WASM_I64_LOAD)
+	}
+
+	emitWasmMemArg()
+}
+
+func emitWasmStore(ii IntInfo) {
+	v := wasmTempLocalList[getWasmValType(ii)][1]
+
+	emitWasmLocalOp(WASM_LOCAL_SET, v)
+	emitWasmOp(WASM_I32_WRAP_I64)
+	emitWasmLocalOp(WASM_LOCAL_GET, v)
+
+	emitWasmOp(map[int]byte{
+		1: WASM_I32_STORE8, 2: WASM_I32_STORE16,
+		4: WASM_I32_STORE, 8: WASM_I64_STORE}[ii.BytesCount])
+
+	emitWasmMemArg()
+}
+
+func emitWasmStoreString(buf []byte) {
+	buf = append(append(make([]byte, 0), buf...), 0)
+
+	a := wasmTempLocalList[WASM_I32][0]
+
+	emitWasmOp(WASM_I32_WRAP_I64)
+	emitWasmLocalOp(WASM_LOCAL_SET, a)
+
+	for i := 0; i < len(buf); {
+		n := 1
+		for _, bytesCount := range []int{8, 4, 2} {
+			if len(buf)-i >= bytesCount {
+				n = bytesCount
+				break
+			}
+		}
+
+		var v uint64
+		for j := n - 1; j >= 0; j-- {
+			v = (v << 8) | uint64(buf[i+j])
+		}
+
+		ii := IntInfo{IsSigned: false, BytesCount: n}
+		vt := getWasmValType(ii)
+
+		emitWasmLocalOp(WASM_LOCAL_GET, a)
+		emitWasmConst(vt, ii, v)
+		emitWasmOp(map[int]byte{
+			1: WASM_I32_STORE8, 2: WASM_I32_STORE16,
+			4: WASM_I32_STORE, 8: WASM_I64_STORE}[n])
+		emitWasmOp(0)
+		emitWasmUleb(uint64(i))
+
+		i = i + n
+	}
+}
+
+// Blocks are laid out inside nested wasm blocks, the code of block k follows the
+// end of wasm block k. Forward jumps leave the enclosing blocks, backward jumps
+// set the pc local and go through the dispatch loop.
+func emitWasmJump(blockIndex int, target int, depth int) {
+	if target > blockIndex {
+		if target == blockIndex+1 && depth == 0 {
+			return
+		}
+		emitWasmOp(WASM_BR)
+		emitWasmUleb(uint64(target - blockIndex - 1 + depth))
+		return
+	}
+
+	emitWasmConst(WASM_I32, IntInfo{IsSigned: false, BytesCount: 4}, uint64(target))
+	emitWasmLocalOp(WASM_LOCAL_SET, wasmPCLocal)
+	emitWasmOp(WASM_BR)
+	emitWasmUleb(uint64(wasmBlocksCount - 1 - blockIndex + depth))
+}
+
+func emitWasmCondJump(blockIndex int, target int) {
+	if target > blockIndex {
+		emitWasmOp(WASM_BR_IF)
+		emitWasmUleb(uint64(target - blockIndex - 1))
+		return
+	}
+
+	emitWasmOp(WASM_IF, 0x40)
+	emitWasmJump(blockIndex, target, 1)
+	emitWasmOp(WASM_END)
+}
+
+func emitWasmSwitch(instr IRInstr, ii IntInfo, blockIndex int) {
+	vt := getWasmValType(ii)
+
+	isForward := true
+	for _, t := range instr.TargetList {
+		if t <= blockIndex {
+			isForward = false
+		}
+	}
+
+	if minValue, entriesCount, ok := getSwitchJumpTableInfo(ii, instr.CaseValueList); ok &&
+		isForward && vt == WASM_I32 {
+
+		emitWasmConst(vt, ii, minValue)
+		emitWasmOp(WASM_I32_SUB)
+
+		depthList := make([]int, entriesCount)
+		for i := range depthList {
+			depthList[i] = instr.TargetList[0] - blockIndex - 1
+		}
+
+		for i, v := range instr.CaseValueList {
+			depthList[(v-minValue)&getIntInfoMask(ii)] = instr.TargetList[i+1] - blockIndex - 1
+		}
+
+		emitWasmOp(WASM_BR_TABLE)
+		emitWasmUleb(entriesCount)
+		for _, d := range depthList {
+			emitWasmUleb(uint64(d))
+		}
+		emitWasmUleb(uint64(instr.TargetList[0] - blockIndex - 1))
+
+		return
+	}
+
+	a := wasmTempLocalList[vt][0]
+
+	emitWasmLocalOp(WASM_LOCAL_SET, a)
+
+	for i, v := range instr.CaseValueList {
+		emitWasmLocalOp(WASM_LOCAL_GET, a)
+		emitWasmConst(vt, ii, v)
+		emitWasmOp(getWasmTypedOp(vt, WASM_I32_EQ, WASM_I64_COMPARE_OFFSET))
+		emitWasmCondJump(blockIndex, instr.TargetList[i+1])
+	}
+
+	emitWasmJump(blockIndex, instr.TargetList[0], 0)
+}
+
+func lowerIRBlockToWasm(f IRFunc, blockIndex int) {
+	for _, instr := range f.BlockList[blockIndex].InstrList {
+		argII := func(k int) IntInfo {
+			return getIRIntInfo(f.ValueTypeList[instr.ArgList[k]])
+		}
+
+		switch instr.Op {
+		case IR_CONST:
+			emitWasmConst(getWasmValType(instr.Type), getIRIntInfo(instr.Type), instr.Value)
+		case IR_FUNC_ADDR:
+			emitWasmOp(WASM_I64_CONST)
+			wasmCode = appendWasmSleb(wasmCode, int64(wasmFuncIndexList[instr.Ident]+1))
+		case IR_LOAD_LOCAL:
+			emitWasmLocalOp(WASM_LOCAL_GET, wasmLocalIndexList[instr.Local])
+		case IR_STORE_LOCAL:
+			emitWasmLocalOp(WASM_LOCAL_SET, wasmLocalIndexList[instr.Local])
+		case IR_BINARY:
+			emitWasmBinaryOp(instr.BinaryOp, argII(0), argII(1))
+		case IR_CONVERT:
+			emitWasmConvert(f.ValueTypeList[instr.ArgList[0]], instr.Type)
+		case IR_CALL:
+			emitWasmOp(WASM_CALL)
+			emitWasmUleb(uint64(wasmFuncIndexList[instr.Ident]))
+		case IR_CALL_INDIRECT:
+			var paramTypeList []interface{}
+			for k := 0; k < len(instr.ArgList)-1; k++ {
+				paramTypeList = append(paramTypeList, f.ValueTypeList[instr.ArgList[k]])
+			}
+
+			emitWasmOp(WASM_I32_WRAP_I64, WASM_CALL_INDIRECT)
+			emitWasmUleb(uint64(getWasmFuncTypeIndex(getWasmFuncTypeKey(paramTypeList, instr.Type))))
+			emitWasmOp(0)
+		case IR_LOAD:
+			emitWasmLoad(getIRIntInfo(instr.Type))
+		case IR_STORE:
+			emitWasmStore(argII(1))
+		case IR_STORE_STRING:
+			emitWasmStoreString(instr.Buf)
+		case IR_DISCARD:
+			emitWasmOp(WASM_DROP)
+		case IR_JUMP:
+			emitWasmJump(blockIndex, instr.TargetList[0], 0)
+		case IR_BRANCH:
+			if argII(0).BytesCount == 8 {
+				emitWasmOp(WASM_I64_EQZ, WASM_I32_EQZ)
+			}
+
+			if instr.TargetList[0] == blockIndex+1 {
+				emitWasmOp(WASM_I32_EQZ)
+				emitWasmCondJump(blockIndex, instr.TargetList[1])
+			} else {
+				emitWasmCondJump(blockIndex, instr.TargetList[0])
+				emitWasmJump(blockIndex, instr.TargetList[1], 0)
+			}
+		case IR_SWITCH:
+			emitWasmSwitch(instr, argII(0), blockIndex)
+		case IR_RETURN:
+			emitWasmOp(WASM_RETURN)
+		default:
+			PrintErrorAndExit(0)
+		}
+	}
+}
+
+func lowerIRFuncToWasm(f IRFunc) []byte {
+	wasmCode = make([]byte, 0)
+
+	wasmLocalIndexList = make([]int, len(f.LocalList))
+
+	index := 0
+	for i, local := range f.LocalList {
+		if local.IsParam {
+			wasmLocalIndexList[i] = index
+			index++
+		}
+	}
+
+	var localTypeList []byte
+	for i, local := range f.LocalList {
+		if !local.IsParam {
+			wasmLocalIndexList[i] = index + len(localTypeList)
+			localTypeList = append(localTypeList, getWasmValType(local.Type))
+		}
+	}
+
+	wasmPCLocal = index + len(localTypeList)
+	wasmTempLocalList = map[byte][]int{
+		WASM_I32: {wasmPCLocal + 1, wasmPCLocal + 2},
+		WASM_I64: {wasmPCLocal + 3, wasmPCLocal + 4}}
+	localTypeList = append(localTypeList, WASM_I32, WASM_I32, WASM_I32, WASM_I64, WASM_I64)
+
+	wasmBlocksCount = len(f.BlockList)
+
+	emitWasmOp(WASM_LOOP, 0x40)
+
+	for i := 0; i < wasmBlocksCount; i++ {
+		emitWasmOp(WASM_BLOCK, 0x40)
+	}
+
+	emitWasmLocalOp(WASM_LOCAL_GET, wasmPCLocal)
+	emitWasmOp(WASM_BR_TABLE)
+	emitWasmUleb(uint64(wasmBlocksCount))
+	for i := 0; i < wasmBlocksCount; i++ {
+		emitWasmUleb(uint64(i))
+	}
+	emitWasmUleb(0)
+
+	for i := range f.BlockList {
+		emitWasmOp(WASM_END)
+		lowerIRBlockToWasm(f, i)
+	}
+
+	emitWasmOp(WASM_END, WASM_UNREACHABLE, WASM_END)
+
+	var localsContent []byte
+	localsCount := 0
+
+	for i := 0; i < len(localTypeList); {
+		j := i
+		for j < len(localTypeList) && localTypeList[j] == localTypeList[i] {
+			j++
+		}
+
+		localsContent = appendWasmUleb(localsContent, uint64(j-i))
+		localsContent = append(localsContent, localTypeList[i])
+		localsCount++
+
+		i = j
+	}
+
+	body := appendWasmVector(make([]byte, 0), localsCount, localsContent)
+
+	return append(body, wasmCode...)
+}
+
+func WasmGenerator(ir IRProgram) []byte {
+	sigInfo, ok := ir.FuncSigList["main"]
+
+	if (!ok) || (len(sigInfo.ParamList) != 0) {
+		PrintErrorAndExit(0)
+	}
+
+	if _, ok := sigInfo.ReturnValueInfo.(VoidInfo); !ok {
+		PrintErrorAndExit(0)
+	}
+
+	wasmFuncTypeList = make([]string, 0)
+
+	wasmFuncIndexList = make(map[string]int)
+	wasmFuncIndexList["ecall"] = 0
+
+	for i, f := range ir.FuncList {
+		wasmFuncIndexList[f.Ident] = i + 1
+	}
+
+	ecallTypeIndex := getWasmFuncTypeIndex(getWasmFuncTypeKey(nil, VoidInfo{}))
+
+	var funcContent []byte
+	var codeContent []byte
+
+	for _, f := range ir.FuncList {
+		funcContent = appendWasmUleb(funcContent,
+			uint64(getWasmFuncTypeIndex(getWasmFuncTypeKey(f.Sig.ParamList, f.Sig.ReturnValueInfo))))
+
+		body := lowerIRFuncToWasm(f)
+		codeContent = appendWasmUleb(codeContent, uint64(len(body)))
+		codeContent = append(codeContent, body...)
+	}
+
+	module := []byte{0x00, 'a', 's', 'm', 0x01, 0x00, 0x00, 0x00}
+
+	var typeContent []byte
+	for _, key := range wasmFuncTypeList {
+		paramsKey, resultsKey, _ := strings.Cut(key, "\x00")
+
+		typeContent = append(typeContent, 0x60)
+		typeContent = appendWasmVector(typeContent, len(paramsKey), []byte(paramsKey))
+		typeContent = appendWasmVector(typeContent, len(resultsKey), []byte(resultsKey))
+	}
+	module = appendWasmSection(module, 1, appendWasmVector(nil, len(wasmFuncTypeList), typeContent))
+
+	importContent := appendWasmName(appendWasmName(nil, "env"), "ecall")
+	importContent = append(importContent, 0x00)
+	importContent = appendWasmUleb(importContent, uint64(ecallTypeIndex))
+	module = appendWasmSection(module, 2, appendWasmVector(nil, 1, importContent))
+
+	module = appendWasmSection(module, 3, appendWasmVector(nil, len(ir.FuncList), funcContent))
+
+	// Table element 0 stays empty so that a zero function value traps
+	tableContent := []byte{WASM_FUNCREF, 0x00}
+	tableContent = appendWasmUleb(tableContent, uint64(len(ir.FuncList)+2))
+	module = appendWasmSection(module, 4, appendWasmVector(nil, 1, tableContent))
+
+	memoryContent := appendWasmUleb([]byte{0x00}, WASM_MEMORY_PAGES_COUNT)
+	module = appendWasmSection(module, 5, appendWasmVector(nil, 1, memoryContent))
+
+	exportContent := append(appendWasmName(nil, "memory"), 0x02, 0x00)
+	exportContent = append(appendWasmName(exportContent, "main"), 0x00)
+	exportContent = appendWasmUleb(exportContent, uint64(wasmFuncIndexList["main"]))
+	module = appendWasmSection(module, 7, appendWasmVector(nil, 2, exportContent))
+
+	elemContent := []byte{0x00, WASM_I32_CONST, 0x01, WASM_END}
+	elemContent = appendWasmUleb(elemContent, uint64(len(ir.FuncList)+1))
+	for i := 0; i <= len(ir.FuncList); i++ {
+		elemContent = appendWasmUleb(elemContent, uint64(i))
+	}
+	module = appendWasmSection(module, 9, appendWasmVector(nil, 1, elemContent))
+
+	module = appendWasmSection(module, 10, appendWasmVector(nil, len(ir.FuncList), codeContent))
+
+	return module
+}
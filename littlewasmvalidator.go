@@ -0,0 +1,662 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"unicode/utf8"
+)
+
+type WasmFuncType struct {
+	ParamList  []byte
+	ResultList []byte
+}
+
+type WasmModule struct {
+	FuncTypeList []WasmFuncType
+
+	// Imported functions come first in the function index space
+	FuncTypeIndexList  []int
+	ImportedFuncsCount int
+	DeclaredFuncsCount int
+
+	TableSize        uint64
+	HasTable         bool
+	MemoryPagesCount uint64
+	HasMemory        bool
+
+	ExportList        map[string]bool
+	ElemFuncIndexList []uint64
+
+	FuncBodyList        [][]byte
+	IsCodeSectionParsed bool
+}
+
+type WasmControlFrame struct {
+	Op            byte
+	LabelTypeList []byte
+	ResultList    []byte
+	Height        int
+	IsUnreachable bool
+}
+
+func PrintWasmErrorAndExit(s string) {
+	fmt.Println("Wasm error" + " " + "(" + s + ")")
+	os.Exit(EXIT_COMPILE_ERROR)
+}
+
+func isWasmValType(t byte) bool {
+	return t == 0x7f || t == 0x7e || t == 0x7d || t == 0x7c
+}
+
+// Reads a LEB128 integer of at most bitsCount bits from the start of b
+func readWasmLeb(b []byte, bitsCount int, isSigned bool) (uint64, int, bool) {
+	var v uint64
+	var shift int
+
+	for i := 0; i < len(b); i++ {
+		if i >= (bitsCount+6)/7 {
+			return 0, 0, false
+		}
+
+		c := b[i]
+		v = v | (uint64(c&0x7f) << shift)
+		shift = shift + 7
+
+		if (c & 0x80) == 0 {
+			if isSigned && shift < 64 && (c&0x40) != 0 {
+				v = v | (^uint64(0) << shift)
+			}
+			return v, i + 1, true
+		}
+	}
+
+	return 0, 0, false
+}
+
+func validateWasmFuncBody(m WasmModule, funcIndex int, body []byte) string {
+	var err string
+
+	readByte := func() byte {
+		if err != "" || len(body) == 0 {
+			if err == "" {
+				err = "unexpected end of function body"
+			}
+			return 0
+		}
+		c := body[0]
+		body = body[1:]
+		return c
+	}
+
+	readLeb := func(bitsCount int, isSigned bool) uint64 {
+		if err != "" {
+			return 0
+		}
+		v, n, ok := readWasmLeb(body, bitsCount, isSigned)
+		if !ok {
+			err = "invalid integer"
+			return 0
+		}
+		body = body[n:]
+		return v
+	}
+
+	funcType := m.FuncTypeList[m.FuncTypeIndexList[funcIndex]]
+
+	localTypeList := append(make([]byte, 0), funcType.ParamList...)
+
+	localGroupsCount := readLeb(32, false)
+	for i := uint64(0); i < localGroupsCount && err == ""; i++ {
+		n := readLeb(32, false)
+		t := readByte()
+
+		if !isWasmValType(t) {
+			return "invalid local type"
+		}
+
+		if uint64(len(localTypeList))+n > 50000 {
+			return "too many locals"
+		}
+
+		for j := uint64(0); j < n; j++ {
+			localTypeList = append(localTypeList, t)
+		}
+	}
+
+	var stack []byte
+	var frameList []WasmControlFrame
+
+	pushFrame := func(op byte, resultList []byte) {
+		labelTypeList := resultList
+		if op == WASM_LOOP {
+			labelTypeList = nil
+		}
+
+		frameList = append(frameList, WasmControlFrame{Op: op, LabelTypeList: labelTypeList,
+			ResultList: resultList, Height: len(stack)})
+	}
+
+	push := func(t byte) {
+		stack = append(stack, t)
+	}
+
+	// Type 0 is an unknown type coming from unreachable code
+	pop := func(expected byte) byte {
+		frame := frameList[len(frameList)-1]
+
+		if len(stack) == frame.Height {
+			if !frame.IsUnreachable && err == "" {
+				err = "operand stack underflow"
+			}
+			return expected
+		}
+
+		t := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if t != expected && t != 0 && expected != 0 && err == "" {
+			err = "type mismatch"
+		}
+
+		if t == 0 {
+			return expected
+		}
+
+		return t
+	}
+
+	popList := func(typeList []byte) {
+		for i := len(typeList) - 1; i >= 0; i-- {
+			pop(typeList[i])
+		}
+	}
+
+	setUnreachable := func() {
+		frame := &frameList[len(frameList)-1]
+		stack = stack[:frame.Height]
+		frame.IsUnreachable = true
+	}
+
+	getLabelTypeList := func(l uint64) []byte {
+		if l >= uint64(len(frameList)) {
+			if err == "" {
+				err = "invalid label " + strconv.FormatUint(l, 10)
+			}
+			return nil
+		}
+		return frameList[len(frameList)-1-int(l)].LabelTypeList
+	}
+
+	readBlockType := func() []byte {
+		t := readByte()
+		if t == 0x40 {
+			return nil
+		}
+		if !isWasmValType(t) {
+			if err == "" {
+				err = "unsupported block type"
+			}
+			return nil
+		}
+		return []byte{t}
+	}
+
+	checkMemArg := func(maxAlign uint64) {
+		if !m.HasMemory && err == "" {
+			err = "memory access without memory"
+		}
+		if readLeb(32, false) > maxAlign && err == "" {
+			err = "invalid alignment"
+		}
+		readLeb(32, false)
+	}
+
+	type wasmOpTypeInfo struct {
+		ParamList  []byte
+		ResultList []byte
+	}
+
+	i32 := WASM_I32
+	i64 := WASM_I64
+
+	opTypeInfoList := make(map[byte]wasmOpTypeInfo)
+
+	opTypeInfoList[0x45] = wasmOpTypeInfo{[]byte{i32}, []byte{i32}}
+	opTypeInfoList[0x50] = wasmOpTypeInfo{[]byte{i64}, []byte{i32}}
+	for op := byte(0x46); op <= 0x4f; op++ {
+		opTypeInfoList[op] = wasmOpTypeInfo{[]byte{i32, i32}, []byte{i32}}
+	}
+	for op := byte(0x51); op <= 0x5a; op++ {
+		opTypeInfoList[op] = wasmOpTypeInfo{[]byte{i64, i64}, []byte{i32}}
+	}
+	for op := byte(0x67); op <= 0x69; op++ {
+		opTypeInfoList[op] = wasmOpTypeInfo{[]byte{i32}, []byte{i32}}
+	}
+	for op := byte(0x6a); op <= 0x78; op++ {
+		opTypeInfoList[op] = wasmOpTypeInfo{[]byte{i32, i32}, []byte{i32}}
+	}
+	for op := byte(0x79); op <= 0x7b; op++ {
+		opTypeInfoList[op] = wasmOpTypeInfo{[]byte{i64}, []byte{i64}}
+	}
+	for op := byte(0x7c); op <= 0x8a; op++ {
+		opTypeInfoList[op] = wasmOpTypeInfo{[]byte{i64, i64}, []byte{i64}}
+	}
+	opTypeInfoList[0xa7] = wasmOpTypeInfo{[]byte{i64}, []byte{i32}}
+	opTypeInfoList[0xac] = wasmOpTypeInfo{[]byte{i32}, []byte{i64}}
+	opTypeInfoList[0xad] = wasmOpTypeInfo{[]byte{i32}, []byte{i64}}
+	opTypeInfoList[0xc0] = wasmOpTypeInfo{[]byte{i32}, []byte{i32}}
+	opTypeInfoList[0xc1] = wasmOpTypeInfo{[]byte{i32}, []byte{i32}}
+	for op := byte(0xc2); op <= 0xc4; op++ {
+		opTypeInfoList[op] = wasmOpTypeInfo{[]byte{i64}, []byte{i64}}
+	}
+
+	// Result or stored type and the largest alignment of each memory access
+	memOpTypeList := map[byte]byte{
+		0x28: i32, 0x29: i64, 0x2c: i32, 0x2d: i32, 0x2e: i32, 0x2f: i32,
+		0x30: i64, 0x31: i64, 0x32: i64, 0x33: i64, 0x34: i64, 0x35: i64,
+		0x36: i32, 0x37: i64, 0x3a: i32, 0x3b: i32, 0x3c: i64, 0x3d: i64, 0x3e: i64}
+	memOpMaxAlignList := map[byte]uint64{
+		0x28: 2, 0x29: 3, 0x2c: 0, 0x2d: 0, 0x2e: 1, 0x2f: 1,
+		0x30: 0, 0x31: 0, 0x32: 1, 0x33: 1, 0x34: 2, 0x35: 2,
+		0x36: 2, 0x37: 3, 0x3a: 0, 0x3b: 1, 0x3c: 0, 0x3d: 1, 0x3e: 2}
+
+	pushFrame(0, funcType.ResultList)
+
+	for len(frameList) != 0 && err == "" {
+		op := readByte()
+		if err != "" {
+			break
+		}
+
+		if info, ok := opTypeInfoList[op]; ok {
+			popList(info.ParamList)
+			for _, t := range info.ResultList {
+				push(t)
+			}
+			continue
+		}
+
+		if t, ok := memOpTypeList[op]; ok {
+			checkMemArg(memOpMaxAlignList[op])
+			if op <= 0x35 {
+				pop(i32)
+				push(t)
+			} else {
+				pop(t)
+				pop(i32)
+			}
+			continue
+		}
+
+		switch op {
+		case WASM_UNREACHABLE:
+			setUnreachable()
+		case 0x01:
+		case WASM_BLOCK, WASM_LOOP:
+			pushFrame(op, readBlockType())
+		case WASM_IF:
+			resultList := readBlockType()
+			pop(i32)
+			pushFrame(op, resultList)
+		case 0x05:
+			frame := frameList[len(frameList)-1]
+			if frame.Op != WASM_IF {
+				err = "else without if"
+				break
+			}
+			popList(frame.ResultList)
+			if len(stack) != frame.Height {
+				err = "operand stack not empty at else"
+				break
+			}
+			frameList[len(frameList)-1].Op = 0x05
+			frameList[len(frameList)-1].IsUnreachable = false
+		case WASM_END:
+			frame := frameList[len(frameList)-1]
+			popList(frame.ResultList)
+			if len(stack) != frame.Height && err == "" {
+				err = "operand stack not empty at end"
+			}
+			if frame.Op == WASM_IF && len(frame.ResultList) != 0 && err == "" {
+				err = "if with a result needs an else"
+			}
+			frameList = frameList[:len(frameList)-1]
+			stack = append(stack, frame.ResultList...)
+		case WASM_BR:
+			popList(getLabelTypeList(readLeb(32, false)))
+			setUnreachable()
+		case WASM_BR_IF:
+			labelTypeList := getLabelTypeList(readLeb(32, false))
+			pop(i32)
+			popList(labelTypeList)
+			stack = append(stack, labelTypeList...)
+		case WASM_BR_TABLE:
+			n := readLeb(32, false)
+			if n > uint64(len(body)) {
+				err = "invalid br_table"
+				break
+			}
+			var labelList []uint64
+			for j := uint64(0); j <= n; j++ {
+				labelList = append(labelList, readLeb(32, false))
+			}
+			pop(i32)
+			defaultTypeList := getLabelTypeList(labelList[len(labelList)-1])
+			for _, l := range labelList {
+				if len(getLabelTypeList(l)) != len(defaultTypeList) && err == "" {
+					err = "br_table label arity mismatch"
+				}
+			}
+			popList(defaultTypeList)
+			setUnreachable()
+		case WASM_RETURN:
+			popList(funcType.ResultList)
+			setUnreachable()
+		case WASM_CALL:
+			f := readLeb(32, false)
+			if f >= uint64(len(m.FuncTypeIndexList)) {
+				err = "invalid function index"
+				break
+			}
+			t := m.FuncTypeList[m.FuncTypeIndexList[f]]
+			popList(t.ParamList)
+			stack = append(stack, t.ResultList...)
+		case WASM_CALL_INDIRECT:
+			typeIndex := readLeb(32, false)
+			tableIndex := readLeb(32, false)
+			if typeIndex >= uint64(len(m.FuncTypeList)) {
+				err = "invalid type index"
+				break
+			}
+			if tableIndex != 0 || !m.HasTable {
+				err = "invalid table index"
+				break
+			}
+			t := m.FuncTypeList[typeIndex]
+			pop(i32)
+			popList(t.ParamList)
+			stack = append(stack, t.ResultList...)
+		case WASM_DROP:
+			pop(0)
+		case WASM_SELECT:
+			pop(i32)
+			t := pop(0)
+			push(pop(t))
+		case WASM_LOCAL_GET, WASM_LOCAL_SET, 0x22:
+			l := readLeb(32, false)
+			if l >= uint64(len(localTypeList)) {
+				err = "invalid local index"
+				break
+			}
+			t := localTypeList[l]
+			if op != WASM_LOCAL_GET {
+				pop(t)
+			}
+			if op != WASM_LOCAL_SET {
+				push(t)
+			}
+		case WASM_I32_CONST:
+			readLeb(32, true)
+			push(i32)
+		case WASM_I64_CONST:
+			readLeb(64, true)
+			push(i64)
+		default:
+			err = "unsupported opcode 0x" + strconv.FormatUint(uint64(op), 16)
+		}
+	}
+
+	if err == "" && len(body) != 0 {
+		err = "code after the end of the function body"
+	}
+
+	return err
+}
+
+func DecodeWasmModule(b []byte) (WasmModule, string) {
+	var m WasmModule
+
+	m.ExportList = make(map[string]bool)
+
+	var err string
+
+	readBytes := func(n uint64) []byte {
+		if err != "" || n > uint64(len(b)) {
+			if err == "" {
+				err = "unexpected end of module"
+			}
+			return nil
+		}
+		v := b[:n]
+		b = b[n:]
+		return v
+	}
+
+	readByte := func() byte {
+		v := readBytes(1)
+		if v == nil {
+			return 0
+		}
+		return v[0]
+	}
+
+	readU32 := func() uint64 {
+		if err != "" {
+			return 0
+		}
+		v, n, ok := readWasmLeb(b, 32, false)
+		if !ok {
+			err = "invalid integer"
+			return 0
+		}
+		b = b[n:]
+		return v
+	}
+
+	readName := func() string {
+		s := readBytes(readU32())
+		if !utf8.Valid(s) && err == "" {
+			err = "invalid name"
+		}
+		return string(s)
+	}
+
+	readLimits := func() uint64 {
+		flag := readByte()
+		min := readU32()
+		if flag == 1 {
+			if readU32() < min && err == "" {
+				err = "invalid limits"
+			}
+		} else if flag != 0 && err == "" {
+			err = "invalid limits"
+		}
+		return min
+	}
+
+	if string(readBytes(8)) != "\x00asm\x01\x00\x00\x00" {
+		return m, "invalid header"
+	}
+
+	var lastSectionID byte
+
+	for len(b) != 0 && err == "" {
+		id := readByte()
+		content := readBytes(readU32())
+
+		if err != "" {
+			break
+		}
+
+		if id != 0 {
+			if id <= lastSectionID || id > 12 {
+				return m, "unexpected section " + strconv.Itoa(int(id))
+			}
+			lastSectionID = id
+		}
+
+		rest := b
+		b = content
+
+		switch id {
+		case 1:
+			n := readU32()
+			for i := uint64(0); i < n && err == ""; i++ {
+				if readByte() != 0x60 {
+					err = "invalid function type"
+					break
+				}
+
+				var t WasmFuncType
+				t.ParamList = append(t.ParamList, readBytes(readU32())...)
+				t.ResultList = append(t.ResultList, readBytes(readU32())...)
+
+				for _, vt := range append(append([]byte{}, t.ParamList...), t.ResultList...) {
+					if !isWasmValType(vt) {
+						err = "invalid value type"
+					}
+				}
+
+				m.FuncTypeList = append(m.FuncTypeList, t)
+			}
+		case 2:
+			n := readU32()
+			for i := uint64(0); i < n && err == ""; i++ {
+				readName()
+				readName()
+				if readByte() != 0x00 {
+					err = "only function imports are supported"
+					break
+				}
+				t := readU32()
+				if t >= uint64(len(m.FuncTypeList)) {
+					err = "invalid type index"
+					break
+				}
+				m.FuncTypeIndexList = append(m.FuncTypeIndexList, int(t))
+				m.ImportedFuncsCount++
+			}
+		case 3:
+			n := readU32()
+			for i := uint64(0); i < n && err == ""; i++ {
+				t := readU32()
+				if t >= uint64(len(m.FuncTypeList)) {
+					err = "invalid type index"
+					break
+				}
+				m.FuncTypeIndexList = append(m.FuncTypeIndexList, int(t))
+				m.DeclaredFuncsCount++
+			}
+		case 4:
+			if readU32() != 1 || readByte() != WASM_FUNCREF {
+				err = "invalid table"
+				break
+			}
+			m.TableSize = readLimits()
+			m.HasTable = true
+		case 5:
+			if readU32() != 1 {
+				err = "invalid memory"
+				break
+			}
+			m.MemoryPagesCount = readLimits()
+			if m.MemoryPagesCount > 65536 && err == "" {
+				err = "invalid memory size"
+			}
+			m.HasMemory = true
+		case 7:
+			n := readU32()
+			for i := uint64(0); i < n && err == ""; i++ {
+				name := readName()
+				if m.ExportList[name] {
+					err = "duplicate export " + name
+					break
+				}
+				m.ExportList[name] = true
+
+				kind := readByte()
+				index := readU32()
+
+				switch {
+				case kind == 0x00 && index < uint64(len(m.FuncTypeIndexList)):
+				case kind == 0x01 && index == 0 && m.HasTable:
+				case kind == 0x02 && index == 0 && m.HasMemory:
+				default:
+					if err == "" {
+						err = "invalid export " + name
+					}
+				}
+			}
+		case 9:
+			n := readU32()
+			for i := uint64(0); i < n && err == ""; i++ {
+				if readU32() != 0 || readByte() != WASM_I32_CONST {
+					err = "unsupported element segment"
+					break
+				}
+
+				offset, k, ok := readWasmLeb(b, 32, true)
+				if !ok || readBytes(uint64(k)) == nil || readByte() != WASM_END {
+					err = "invalid element segment offset"
+					break
+				}
+
+				count := readU32()
+				for j := uint64(0); j < count && err == ""; j++ {
+					f := readU32()
+					if f >= uint64(len(m.FuncTypeIndexList)) {
+						err = "invalid function index in element segment"
+					}
+					m.ElemFuncIndexList = append(m.ElemFuncIndexList, f)
+				}
+
+				if !m.HasTable || uint64(uint32(offset))+count > m.TableSize {
+					if err == "" {
+						err = "element segment out of table bounds"
+					}
+				}
+			}
+		case 10:
+			n := readU32()
+			if n != uint64(m.DeclaredFuncsCount) {
+				err = "function and code section sizes differ"
+				break
+			}
+			for i := uint64(0); i < n && err == ""; i++ {
+				m.FuncBodyList = append(m.FuncBodyList, readBytes(readU32()))
+			}
+			m.IsCodeSectionParsed = true
+		case 6, 8, 11, 12:
+			err = "unsupported section " + strconv.Itoa(int(id))
+		}
+
+		if err == "" && id != 0 && len(b) != 0 {
+			err = "section " + strconv.Itoa(int(id)) + " size mismatch"
+		}
+
+		b = rest
+	}
+
+	if err != "" {
+		return m, err
+	}
+
+	if m.DeclaredFuncsCount != 0 && !m.IsCodeSectionParsed {
+		return m, "missing code section"
+	}
+
+	for i, body := range m.FuncBodyList {
+		if s := validateWasmFuncBody(m, m.ImportedFuncsCount+i, body); s != "" {
+			return m, "function " + strconv.Itoa(m.ImportedFuncsCount+i) + ": " + s
+		}
+	}
+
+	return m, ""
+}
+
+func WasmValidator(module []byte) {
+	if _, err := DecodeWasmModule(module); err != "" {
+		PrintWasmErrorAndExit(err)
+	}
+}
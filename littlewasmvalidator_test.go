@@ -0,0 +1,42 @@
+package main
+
+import "testing"
+
+func TestWasmValidatorAcceptsGeneratedModules(t *testing.T) {
+	for _, sourceCodeFilePath := range []string{"test_code", "example_code", "bench_code"} {
+		var module []byte
+
+		ce, ok := catchCompileError(func() {
+			module = WasmGenerator(compileSourceFile(sourceCodeFilePath))
+		})
+		if !ok {
+			t.Fatalf("%s: %s", sourceCodeFilePath, ce.Msg)
+		}
+
+		if _, err := DecodeWasmModule(module); err != "" {
+			t.Errorf("%s: %s", sourceCodeFilePath, err)
+		}
+	}
+}
+
+func TestWasmValidatorRejectsBrokenModules(t *testing.T) {
+	var module []byte
+
+	if _, ok := catchCompileError(func() {
+		module = WasmGenerator(compileSourceFile("example_code"))
+	}); !ok {
+		t.Fatal("example_code: compilation error")
+	}
+
+	brokenModuleList := map[string][]byte{
+		"truncated":   module[:len(module)-1],
+		"bad magic":   append([]byte{0, 'w'}, module[2:]...),
+		"bad version": append(append([]byte{}, module[:4]...), append([]byte{2}, module[5:]...)...),
+	}
+
+	for name, b := range brokenModuleList {
+		if _, err := DecodeWasmModule(b); err == "" {
+			t.Errorf("%s module was accepted", name)
+		}
+	}
+}